@@ -0,0 +1,30 @@
+package eventual
+
+import (
+	"context"
+)
+
+// startSyncLocked starts the goroutine that finishes a refresh made with
+// WithAsyncRefresh, unless it's already running. This must be called while
+// holding the write lock.
+func (m *Map[K, V]) startSyncLocked() {
+	if m.syncer {
+		return
+	}
+	m.syncer = true
+	m.background.Add(1)
+	go m.syncInBackground()
+}
+
+// syncInBackground waits for the readers to leave the old readable map and
+// syncs it, unless a writer has already done so or the map has been closed.
+func (m *Map[K, V]) syncInBackground() {
+	defer m.background.Done()
+	m.writeLock.Lock()
+	defer m.writeLock.Unlock()
+	m.syncer = false
+	if !m.closed {
+		// Without a deadline this can't fail
+		_ = m.waitPendingLocked(context.Background())
+	}
+}
@@ -0,0 +1,56 @@
+package eventual
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestMap_AsyncRefresh(t *testing.T) {
+	m := NewMap[string, int](WithAsyncRefresh())
+	defer m.Close()
+	r := m.Reader()
+	v1, v2 := 1, 2
+	assert.NoError(t, m.Insert("foo", &v1))
+
+	// Refresh doesn't wait for the reader that is reading from the old map, which
+	// would otherwise deadlock.
+	r.With(func(old map[string]*int) {
+		assert.NoError(t, m.Refresh())
+		assert.Empty(t, old)
+		got, ok := r.Get("foo")
+		assert.True(t, ok)
+		assert.Equal(t, &v1, got)
+	})
+
+	// The next write waits for the sync to finish
+	assert.NoError(t, m.Insert("bar", &v2))
+	assert.Equal(t, 1, m.PendingWrites())
+	assert.NoError(t, m.Refresh())
+	assert.Equal(t, map[string]int{"foo": 1, "bar": 2}, r.Snapshot())
+
+	// The background goroutine finishes the sync without any further writes
+	assert.Eventually(t, func() bool {
+		m.writeLock.Lock()
+		defer m.writeLock.Unlock()
+		return !m.unsynced && !m.syncer && len(*m.writable) == 2
+	}, time.Second, time.Millisecond)
+}
+
+func TestMap_AsyncRefreshAndWait(t *testing.T) {
+	m := NewMap[string, int](WithAsyncRefresh())
+	defer m.Close()
+	r := m.Reader()
+	v := 1
+	assert.NoError(t, m.Insert("foo", &v))
+
+	r.With(func(map[string]*int) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		assert.ErrorIs(t, m.RefreshAndWait(ctx), context.DeadlineExceeded)
+	})
+	assert.NoError(t, m.RefreshAndWait(context.Background()))
+	assert.Equal(t, map[string]int{"foo": 1}, r.Snapshot())
+	assert.Equal(t, 1, m.Len())
+}
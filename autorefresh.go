@@ -0,0 +1,29 @@
+package eventual
+
+import (
+	"context"
+	"time"
+)
+
+// autoRefresh refreshes the map every interval until the map is closed. The
+// refresh is skipped if no writes have been made since the last refresh.
+func (m *Map[K, V]) autoRefresh(interval time.Duration) {
+	defer m.background.Done()
+
+	ticker := m.options.Clock.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-ticker.C():
+			m.labeled(context.Background(), autoRefreshLabels, func(ctx context.Context) {
+				m.writeLock.Lock()
+				if !m.closed && m.pendingWritesLocked() > 0 {
+					_ = m.refreshLocked(ctx)
+				}
+				m.writeLock.Unlock()
+			})
+		}
+	}
+}
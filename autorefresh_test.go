@@ -0,0 +1,24 @@
+package eventual
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestMap_AutoRefresh(t *testing.T) {
+	m := NewMap[string, any](WithAutoRefreshInterval(time.Millisecond))
+	reader := m.Reader()
+
+	m.Insert("foo", nil)
+	assert.Eventually(t, func() bool {
+		return reader.Has("foo")
+	}, time.Second, time.Millisecond)
+
+	// Refreshes are skipped while there are no pending writes
+	generation := m.Generation()
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, generation, m.Generation())
+
+	assert.NoError(t, m.Close())
+}
@@ -0,0 +1,85 @@
+package eventual
+
+import (
+	"context"
+	"github.com/clarkmcc/go-evmap/pkg/oplog"
+)
+
+// Batch buffers inserts and deletes so that they can be committed to a map
+// with a single write lock acquisition and a single oplog entry. Because the
+// buffered writes are applied together, readers observe either none or all of
+// them. A Batch is only valid inside the function passed to Map.Batch.
+type Batch[K comparable, V any] struct {
+	m       *Map[K, V]
+	b       *oplog.Batch[K, *V]
+	refresh bool
+	tag     string
+
+	// The number of buffered writes of each kind, for metrics
+	inserts, deletes, clears int
+}
+
+// Insert buffers an insert of the value under the key.
+func (b *Batch[K, V]) Insert(key K, value *V) {
+	b.b.Insert(b.m.storedKey(key), b.m.stored(value))
+	b.inserts++
+}
+
+// Delete buffers a delete of the key.
+func (b *Batch[K, V]) Delete(key K) {
+	b.b.Delete(key)
+	b.deletes++
+}
+
+// Clear buffers the removal of every key from the map.
+func (b *Batch[K, V]) Clear() {
+	b.b.Clear()
+	b.clears++
+}
+
+// Len returns the number of buffered writes.
+func (b *Batch[K, V]) Len() int {
+	return b.b.Len()
+}
+
+// Tag sets the tag of the oplog entry of the batch, such as the name of the
+// user or process that made the writes, which is available from the entry's
+// Tag method to the sink of WithWriteBehind and to PendingEntries.
+func (b *Batch[K, V]) Tag(tag string) {
+	b.tag = tag
+}
+
+// RefreshOnCommit causes the map to be refreshed as soon as the batch has
+// been committed, exposing the batch to the readers immediately.
+func (b *Batch[K, V]) RefreshOnCommit() {
+	b.refresh = true
+}
+
+// Batch calls fn with a new batch and commits the writes buffered by fn to the
+// map once fn returns. Nothing is committed if fn doesn't buffer any writes.
+func (m *Map[K, V]) Batch(fn func(b *Batch[K, V])) error {
+	b := &Batch[K, V]{m: m, b: oplog.NewBatch[K, *V]()}
+	fn(b)
+
+	m.lockForAppend()
+	defer m.writeLock.Unlock()
+	if m.closed {
+		return ErrClosed
+	}
+
+	if b.Len() > 0 {
+		if err := m.pushLocked(b.b.Entry().WithTag(b.tag)); err != nil {
+			return err
+		}
+		for i := 0; i < b.clears; i++ {
+			m.metrics.Cleared()
+		}
+		m.metrics.Inserted(b.inserts)
+		m.metrics.Deleted(b.deletes)
+		m.writtenLocked()
+	}
+	if b.refresh {
+		_ = m.refreshLocked(context.Background())
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package eventual
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestMap_Batch(t *testing.T) {
+	m := NewMap[string, any]()
+	reader := m.Reader()
+	m.Insert("foo", nil)
+	m.Refresh()
+
+	t.Run("commit", func(t *testing.T) {
+		m.Batch(func(b *Batch[string, any]) {
+			b.Insert("bar", nil)
+			b.Insert("baz", nil)
+			b.Delete("foo")
+			assert.Equal(t, 0, m.oplog.Len(), "nothing should be written before the batch commits")
+		})
+		assert.Equal(t, 1, m.oplog.Len(), "the batch should be recorded as a single entry")
+		assert.ElementsMatch(t, []string{"bar", "baz"}, m.Keys())
+		assert.Equal(t, []string{"foo"}, reader.Keys())
+
+		m.Refresh()
+		assert.ElementsMatch(t, []string{"bar", "baz"}, reader.Keys())
+	})
+	t.Run("refresh on commit", func(t *testing.T) {
+		m.Batch(func(b *Batch[string, any]) {
+			b.Clear()
+			b.Insert("qux", nil)
+			b.RefreshOnCommit()
+		})
+		assert.Equal(t, []string{"qux"}, reader.Keys())
+	})
+	t.Run("empty", func(t *testing.T) {
+		m.Batch(func(b *Batch[string, any]) {})
+		assert.Equal(t, 0, m.oplog.Len())
+	})
+}
+
+func TestBatch_Tag(t *testing.T) {
+	m := NewMap[string, int](WithEntryTimestamps())
+	v := 1
+	before := time.Now()
+	assert.NoError(t, m.Batch(func(b *Batch[string, int]) {
+		b.Insert("foo", &v)
+		b.Tag("import")
+	}))
+	assert.NoError(t, m.Insert("bar", &v))
+
+	entries := m.PendingEntries()
+	assert.Len(t, entries, 2)
+	assert.Equal(t, "import", entries[0].Tag())
+	assert.Equal(t, "", entries[1].Tag())
+	assert.False(t, entries[0].Time().Before(before))
+	assert.False(t, entries[1].Time().Before(entries[0].Time()))
+
+	// Entries aren't timestamped by default
+	m = NewMap[string, int]()
+	assert.NoError(t, m.Insert("foo", &v))
+	assert.True(t, m.PendingEntries()[0].Time().IsZero())
+}
@@ -0,0 +1,225 @@
+package eventual
+
+import (
+	"github.com/clarkmcc/go-evmap/pkg/oplog"
+)
+
+// BiMap is a one-to-one map that can be looked up by key or by value. Inserting
+// a key or a value that already exists replaces the existing pair, so every key
+// maps to exactly one value and every value maps back to exactly one key.
+//
+// Under the hood both directions are stored in a single regular Map, so a BiMap
+// shares the refresh semantics of a Map, and the forward and reverse mappings
+// are always published together by the same refresh.
+type BiMap[K comparable, V comparable] struct {
+	m *Map[biKey[K, V], biKey[K, V]]
+}
+
+// biKey is a key of the underlying map. Forward entries are stored under the
+// key with the value in the stored biKey, while reverse entries are stored
+// under the value with the key in the stored biKey.
+type biKey[K comparable, V comparable] struct {
+	key     K
+	value   V
+	reverse bool
+}
+
+func forwardKey[K comparable, V comparable](key K) biKey[K, V] {
+	return biKey[K, V]{key: key}
+}
+
+func reverseKey[K comparable, V comparable](value V) biKey[K, V] {
+	return biKey[K, V]{value: value, reverse: true}
+}
+
+// Insert inserts the pair into the map, removing any existing pair that has
+// the same key or the same value.
+func (m *BiMap[K, V]) Insert(key K, value V) error {
+	m.m.lockForWrite()
+	defer m.m.writeLock.Unlock()
+	if m.m.closed {
+		return ErrClosed
+	}
+
+	// The entries are pushed together so that either the whole insert fits in
+	// the oplog or none of it is written
+	entries := m.deleteKeyLocked(nil, key)
+	if rev, ok := (*m.m.writable)[reverseKey[K](value)]; ok && rev.key != key {
+		entries = m.deleteValueLocked(entries, value)
+	}
+	entries = append(entries,
+		oplog.Insert(forwardKey[K, V](key), &biKey[K, V]{value: value}),
+		oplog.Insert(reverseKey[K](value), &biKey[K, V]{key: key}))
+	if err := m.m.pushLocked(entries...); err != nil {
+		return err
+	}
+	m.m.metrics.Inserted(1)
+	m.m.writtenLocked()
+	return nil
+}
+
+// Delete deletes the pair with the given key and returns a boolean representing
+// whether the key existed.
+func (m *BiMap[K, V]) Delete(key K) bool {
+	m.m.lockForWrite()
+	defer m.m.writeLock.Unlock()
+	if m.m.closed {
+		return false
+	}
+	entries := m.deleteKeyLocked(nil, key)
+	if len(entries) == 0 || m.m.pushLocked(entries...) != nil {
+		return false
+	}
+	m.m.metrics.Deleted(1)
+	m.m.writtenLocked()
+	return true
+}
+
+// DeleteByValue deletes the pair with the given value and returns a boolean
+// representing whether the value existed.
+func (m *BiMap[K, V]) DeleteByValue(value V) bool {
+	m.m.lockForWrite()
+	defer m.m.writeLock.Unlock()
+	if m.m.closed {
+		return false
+	}
+	entries := m.deleteValueLocked(nil, value)
+	if len(entries) == 0 || m.m.pushLocked(entries...) != nil {
+		return false
+	}
+	m.m.metrics.Deleted(1)
+	m.m.writtenLocked()
+	return true
+}
+
+// deleteKeyLocked appends the entries deleting both directions of the pair
+// with the given key, if there is one, to entries.
+func (m *BiMap[K, V]) deleteKeyLocked(entries []*oplog.Entry[biKey[K, V], *biKey[K, V]], key K) []*oplog.Entry[biKey[K, V], *biKey[K, V]] {
+	fwd, ok := (*m.m.writable)[forwardKey[K, V](key)]
+	if !ok {
+		return entries
+	}
+	return append(entries,
+		oplog.Delete[biKey[K, V], *biKey[K, V]](forwardKey[K, V](key)),
+		oplog.Delete[biKey[K, V], *biKey[K, V]](reverseKey[K](fwd.value)))
+}
+
+// deleteValueLocked appends the entries deleting both directions of the pair
+// with the given value, if there is one, to entries.
+func (m *BiMap[K, V]) deleteValueLocked(entries []*oplog.Entry[biKey[K, V], *biKey[K, V]], value V) []*oplog.Entry[biKey[K, V], *biKey[K, V]] {
+	rev, ok := (*m.m.writable)[reverseKey[K](value)]
+	if !ok {
+		return entries
+	}
+	return append(entries,
+		oplog.Delete[biKey[K, V], *biKey[K, V]](reverseKey[K](value)),
+		oplog.Delete[biKey[K, V], *biKey[K, V]](forwardKey[K, V](rev.key)))
+}
+
+// Get returns the value of the key, including writes that have not been
+// exposed to the readers yet.
+func (m *BiMap[K, V]) Get(key K) (V, bool) {
+	fwd, ok := m.m.Get(forwardKey[K, V](key))
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	return fwd.value, true
+}
+
+// GetByValue returns the key of the value, including writes that have not been
+// exposed to the readers yet.
+func (m *BiMap[K, V]) GetByValue(value V) (K, bool) {
+	rev, ok := m.m.Get(reverseKey[K](value))
+	if !ok {
+		var zero K
+		return zero, false
+	}
+	return rev.key, true
+}
+
+// Len returns the number of pairs in the map, including writes that have not
+// been exposed to the readers yet.
+func (m *BiMap[K, V]) Len() int {
+	return m.m.Len() / 2
+}
+
+// Clear removes all the pairs from the map.
+func (m *BiMap[K, V]) Clear() error {
+	return m.m.Clear()
+}
+
+// Refresh exposes the current state of the map to the readers.
+func (m *BiMap[K, V]) Refresh() error {
+	return m.m.Refresh()
+}
+
+// Close tears down the map, closing every reader created from it.
+func (m *BiMap[K, V]) Close() error {
+	return m.m.Close()
+}
+
+// Reader creates and registers a new reader for the map.
+func (m *BiMap[K, V]) Reader() *BiMapReader[K, V] {
+	return &BiMapReader[K, V]{r: m.m.Reader()}
+}
+
+// BiMapReader reads from a BiMap.
+type BiMapReader[K comparable, V comparable] struct {
+	r *Reader[biKey[K, V], biKey[K, V]]
+}
+
+func (r *BiMapReader[K, V]) Get(key K) (V, bool) {
+	fwd, ok := r.r.Get(forwardKey[K, V](key))
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	return fwd.value, true
+}
+
+// GetByValue returns the key of the value that is visible to this reader.
+func (r *BiMapReader[K, V]) GetByValue(value V) (K, bool) {
+	rev, ok := r.r.Get(reverseKey[K](value))
+	if !ok {
+		var zero K
+		return zero, false
+	}
+	return rev.key, true
+}
+
+func (r *BiMapReader[K, V]) Has(key K) bool {
+	return r.r.Has(forwardKey[K, V](key))
+}
+
+// HasValue reports whether the value is visible to this reader.
+func (r *BiMapReader[K, V]) HasValue(value V) bool {
+	return r.r.Has(reverseKey[K](value))
+}
+
+// Len returns the number of pairs visible to this reader.
+func (r *BiMapReader[K, V]) Len() int {
+	n := 0
+	r.r.With(func(m map[biKey[K, V]]*biKey[K, V]) {
+		n = len(m) / 2
+	})
+	return n
+}
+
+// Close removes the reader from the map.
+func (r *BiMapReader[K, V]) Close() error {
+	return r.r.Close()
+}
+
+// NewBiMap creates a new BiMap of the given types with the provided options.
+func NewBiMap[K comparable, V comparable](opts ...OptionFunc) *BiMap[K, V] {
+	options := newOptions(opts...)
+
+	// The value options don't apply to the pairs, and evictions would break
+	// the pairs apart, so they aren't supported.
+	options = options.withoutValueOptions()
+	options.MaxEntries = 0
+	r := make(map[biKey[K, V]]*biKey[K, V], 2*options.InitialCapacity)
+	w := make(map[biKey[K, V]]*biKey[K, V], 2*options.InitialCapacity)
+	return &BiMap[K, V]{m: newMap(r, w, options)}
+}
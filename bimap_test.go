@@ -0,0 +1,62 @@
+package eventual
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestBiMap(t *testing.T) {
+	m := NewBiMap[string, int]()
+	reader := m.Reader()
+
+	assert.NoError(t, m.Insert("foo", 1))
+	assert.NoError(t, m.Insert("bar", 2))
+	assert.Equal(t, 2, m.Len())
+	assert.False(t, reader.HasValue(1))
+
+	key, ok := m.GetByValue(1)
+	assert.True(t, ok)
+	assert.Equal(t, "foo", key)
+
+	assert.NoError(t, m.Refresh())
+	value, ok := reader.Get("foo")
+	assert.True(t, ok)
+	assert.Equal(t, 1, value)
+	key, ok = reader.GetByValue(2)
+	assert.True(t, ok)
+	assert.Equal(t, "bar", key)
+	assert.Equal(t, 2, reader.Len())
+
+	// Reusing a value removes the pair that it belonged to
+	assert.NoError(t, m.Insert("baz", 1))
+	assert.NoError(t, m.Refresh())
+	assert.False(t, reader.Has("foo"))
+	key, _ = reader.GetByValue(1)
+	assert.Equal(t, "baz", key)
+
+	// Reusing a key removes its previous value
+	assert.NoError(t, m.Insert("baz", 3))
+	assert.NoError(t, m.Refresh())
+	assert.False(t, reader.HasValue(1))
+	value, _ = reader.Get("baz")
+	assert.Equal(t, 3, value)
+	assert.Equal(t, 2, reader.Len())
+
+	assert.True(t, m.Delete("baz"))
+	assert.False(t, m.Delete("baz"))
+	assert.True(t, m.DeleteByValue(2))
+	assert.False(t, m.DeleteByValue(2))
+	assert.NoError(t, m.Refresh())
+	assert.False(t, reader.HasValue(3))
+	assert.False(t, reader.Has("bar"))
+	assert.Equal(t, 0, reader.Len())
+
+	assert.NoError(t, m.Insert("foo", 1))
+	assert.NoError(t, m.Clear())
+	assert.Equal(t, 0, m.Len())
+	_, ok = m.Get("foo")
+	assert.False(t, ok)
+
+	assert.NoError(t, m.Close())
+	assert.ErrorIs(t, m.Insert("foo", 1), ErrClosed)
+}
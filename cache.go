@@ -0,0 +1,73 @@
+package eventual
+
+import (
+	"context"
+	"time"
+)
+
+// Cache adapts a TTLMap to the interface of a cache with per-key TTLs, such as
+// the cache abstractions of web frameworks and caching libraries, which pass a
+// context to every call and store values rather than pointers.
+//
+// Reads are served by a dedicated reader of the map, so like any other reader
+// they don't observe writes until the map is refreshed. The map should be
+// created with WithAutoRefreshInterval or WithMaxReplicationWriteLag when the
+// writes are never refreshed explicitly.
+type Cache[K comparable, V any] struct {
+	m *TTLMap[K, V]
+	r *TTLReader[K, V]
+}
+
+// Cache returns a Cache backed by the map, registering a new reader that is
+// closed by Cache.Close.
+func (m *TTLMap[K, V]) Cache() *Cache[K, V] {
+	return &Cache[K, V]{m: m, r: m.Reader()}
+}
+
+// Get returns the value stored under the key, or ErrCacheMiss if the key
+// doesn't exist or has expired. The zero value is returned for keys that were
+// inserted into the map with a nil value.
+func (c *Cache[K, V]) Get(ctx context.Context, key K) (V, error) {
+	var zero V
+	if err := ctx.Err(); err != nil {
+		return zero, err
+	}
+	e, ok, err := c.r.r.GetErr(key)
+	if err != nil {
+		return zero, err
+	}
+	if !ok || e.expired(c.m.m.options.Clock.Now()) {
+		return zero, ErrCacheMiss
+	}
+	if e.value == nil {
+		return zero, nil
+	}
+	return *e.value, nil
+}
+
+// Set stores the value under the key, expiring it once ttl has elapsed. A ttl
+// of zero or less never expires.
+func (c *Cache[K, V]) Set(ctx context.Context, key K, value V, ttl time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.m.InsertWithTTL(key, &value, ttl)
+}
+
+// Delete deletes the key from the cache. Deleting a key that doesn't exist
+// isn't an error.
+func (c *Cache[K, V]) Delete(ctx context.Context, key K) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if !c.m.Delete(key) && c.m.m.isClosed() {
+		return ErrClosed
+	}
+	return nil
+}
+
+// Close closes the reader of the cache. The map itself must still be closed by
+// its owner.
+func (c *Cache[K, V]) Close() error {
+	return c.r.Close()
+}
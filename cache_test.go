@@ -0,0 +1,61 @@
+package eventual
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	m := NewTTLMap[string, int](WithTTLSweepInterval(time.Hour), WithClock(clock))
+	c := m.Cache()
+	ctx := context.Background()
+
+	assert.NoError(t, c.Set(ctx, "foo", 1, time.Minute))
+	assert.NoError(t, c.Set(ctx, "bar", 2, 0))
+
+	// Writes are visible after a refresh
+	_, err := c.Get(ctx, "foo")
+	assert.ErrorIs(t, err, ErrCacheMiss)
+	assert.NoError(t, m.Refresh())
+	v, err := c.Get(ctx, "foo")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, v)
+
+	clock.Advance(time.Minute)
+	_, err = c.Get(ctx, "foo")
+	assert.ErrorIs(t, err, ErrCacheMiss)
+	v, err = c.Get(ctx, "bar")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, v)
+
+	assert.NoError(t, c.Delete(ctx, "bar"))
+	assert.NoError(t, c.Delete(ctx, "missing"))
+	assert.NoError(t, m.Refresh())
+	_, err = c.Get(ctx, "bar")
+	assert.ErrorIs(t, err, ErrCacheMiss)
+
+	// Nil values are returned as the zero value
+	assert.NoError(t, m.Insert("nil", nil))
+	assert.NoError(t, m.Refresh())
+	v, err = c.Get(ctx, "nil")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, v)
+
+	// Canceled contexts fail every call
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = c.Get(canceled, "nil")
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.ErrorIs(t, c.Set(canceled, "foo", 1, 0), context.Canceled)
+	assert.ErrorIs(t, c.Delete(canceled, "foo"), context.Canceled)
+
+	assert.NoError(t, c.Close())
+	_, err = c.Get(ctx, "nil")
+	assert.ErrorIs(t, err, ErrReaderClosed)
+	assert.NoError(t, m.Close())
+	assert.ErrorIs(t, c.Set(ctx, "foo", 1, 0), ErrClosed)
+	assert.ErrorIs(t, c.Delete(ctx, "foo"), ErrClosed)
+}
@@ -0,0 +1,173 @@
+package eventual
+
+import (
+	"context"
+	"github.com/clarkmcc/go-evmap/pkg/oplog"
+	"sync"
+)
+
+// Changes are the key-level changes that were made visible by a single refresh.
+type Changes[K comparable, V any] struct {
+	// Generation is the generation of the snapshot that made the changes visible
+	Generation uint64
+
+	// Changes contains a single change for every key whose visible value was
+	// changed by the refresh, in no particular order.
+	Changes []Change[K, V]
+}
+
+// Changefeed streams the changes made visible by every refresh of a map, which
+// makes it possible to mirror the map elsewhere, for example in a downstream
+// cache or over a WebSocket, without diffing snapshots.
+//
+// Unlike Watch and Subscribe, a changefeed never drops changes. Refreshes never
+// block on a changefeed, so the changes are queued until they're received with
+// Next, and a changefeed that isn't consumed grows without bounds.
+type Changefeed[K comparable, V any] struct {
+	m *Map[K, V]
+
+	mu     sync.Mutex
+	queue  []Changes[K, V]
+	closed bool
+
+	// notify has a buffer of one and is signalled when changes are queued or
+	// the changefeed is closed
+	notify chan struct{}
+}
+
+// Changefeed creates a changefeed that receives the changes made visible by
+// every refresh from now on. It must be closed when it's no longer needed.
+func (m *Map[K, V]) Changefeed() *Changefeed[K, V] {
+	m.writeLock.Lock()
+	defer m.writeLock.Unlock()
+	f := &Changefeed[K, V]{m: m, notify: make(chan struct{}, 1)}
+	if m.closed {
+		f.closed = true
+		return f
+	}
+	m.feeds = append(m.feeds, f)
+	return f
+}
+
+// Next blocks until the changes of the next refresh are available, or until
+// the context is done. Once the changefeed or the map is closed and every
+// queued change has been received, Next returns ErrClosed.
+func (f *Changefeed[K, V]) Next(ctx context.Context) (Changes[K, V], error) {
+	for {
+		f.mu.Lock()
+		if len(f.queue) > 0 {
+			c := f.queue[0]
+			f.queue = f.queue[1:]
+			f.mu.Unlock()
+			return c, nil
+		}
+		closed := f.closed
+		f.mu.Unlock()
+		if closed {
+			return Changes[K, V]{}, ErrClosed
+		}
+
+		select {
+		case <-ctx.Done():
+			return Changes[K, V]{}, ctx.Err()
+		case <-f.notify:
+		}
+	}
+}
+
+// Close stops the changefeed from receiving changes. Changes that were already
+// queued can still be received with Next.
+func (f *Changefeed[K, V]) Close() {
+	f.m.writeLock.Lock()
+	defer f.m.writeLock.Unlock()
+	for i, feed := range f.m.feeds {
+		if feed == f {
+			f.m.feeds = remove(f.m.feeds, i)
+			break
+		}
+	}
+	f.close()
+}
+
+// push queues the changes and wakes up Next.
+func (f *Changefeed[K, V]) push(c Changes[K, V]) {
+	f.mu.Lock()
+	f.queue = append(f.queue, c)
+	f.mu.Unlock()
+	f.signal()
+}
+
+// close marks the changefeed as closed and wakes up Next.
+func (f *Changefeed[K, V]) close() {
+	f.mu.Lock()
+	f.closed = true
+	f.mu.Unlock()
+	f.signal()
+}
+
+func (f *Changefeed[K, V]) signal() {
+	select {
+	case f.notify <- struct{}{}:
+	default:
+	}
+}
+
+// notifyFeedsLocked computes the changes between the previously visible map and
+// the newly visible map, queues them on every changefeed and records them for
+// Diff. Like notifyWatchersLocked, this must be called before the previously
+// visible map is synced.
+func (m *Map[K, V]) notifyFeedsLocked(prev, next *map[K]*V, generation uint64) {
+	if len(m.feeds) == 0 && m.options.DiffHistory <= 0 {
+		return
+	}
+	c := m.changesLocked(prev, next, generation)
+	for _, f := range m.feeds {
+		f.push(c)
+	}
+	m.recordDiffLocked(c)
+}
+
+// changesLocked computes the changes between the previously visible map and the
+// newly visible map. Only the keys modified by the oplog are compared, unless
+// the oplog contains a clear or an operation, whose modified keys aren't known,
+// or some writes skipped the oplog.
+func (m *Map[K, V]) changesLocked(prev, next *map[K]*V, generation uint64) Changes[K, V] {
+	keys, cleared := m.oplog.ModifiedKeys()
+	if cleared {
+		// Every key that was visible before the clear may have been deleted
+		for k := range *prev {
+			keys = append(keys, k)
+		}
+	}
+	if m.oplog.Contains(oplog.EntryOperation) || m.unlogged > 0 {
+		// Any key may have been modified by the operation or the unlogged writes
+		for k := range *prev {
+			keys = append(keys, k)
+		}
+		for k := range *next {
+			keys = append(keys, k)
+		}
+	}
+
+	c := Changes[K, V]{Generation: generation}
+	seen := make(map[K]struct{}, len(keys))
+	for _, k := range keys {
+		if _, ok := seen[k]; ok {
+			continue
+		}
+		seen[k] = struct{}{}
+		if change, changed := m.diffKey(prev, next, k, generation); changed {
+			c.Changes = append(c.Changes, change)
+		}
+	}
+	return c
+}
+
+// closeFeedsLocked closes every changefeed. This must be called while holding
+// the write lock.
+func (m *Map[K, V]) closeFeedsLocked() {
+	for _, f := range m.feeds {
+		f.close()
+	}
+	m.feeds = nil
+}
@@ -0,0 +1,87 @@
+package eventual
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestMap_Changefeed(t *testing.T) {
+	m := NewMap[string, int]()
+	feed := m.Changefeed()
+	ctx := context.Background()
+
+	v1, v2 := 1, 2
+	assert.NoError(t, m.Insert("foo", &v1))
+	assert.NoError(t, m.Insert("foo", &v2))
+	assert.NoError(t, m.Insert("bar", &v1))
+	assert.NoError(t, m.Refresh())
+
+	// Changes are never dropped
+	assert.NoError(t, m.Insert("foo", &v1))
+	assert.True(t, m.Delete("bar"))
+	assert.False(t, m.Delete("baz"))
+	assert.NoError(t, m.Refresh())
+	assert.NoError(t, m.Refresh())
+
+	c, err := feed.Next(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), c.Generation)
+	assert.ElementsMatch(t, []Change[string, int]{
+		{Key: "foo", Op: ChangeInsert, New: &v2, Generation: 1},
+		{Key: "bar", Op: ChangeInsert, New: &v1, Generation: 1},
+	}, c.Changes)
+
+	c, err = feed.Next(ctx)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []Change[string, int]{
+		{Key: "foo", Op: ChangeUpdate, Old: &v2, New: &v1, Generation: 2},
+		{Key: "bar", Op: ChangeDelete, Old: &v1, Deleted: true, Generation: 2},
+	}, c.Changes)
+
+	c, err = feed.Next(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(3), c.Generation)
+	assert.Empty(t, c.Changes)
+
+	// Clearing the map deletes every key that was visible
+	assert.NoError(t, m.Clear())
+	assert.NoError(t, m.Insert("baz", &v1))
+	assert.NoError(t, m.Refresh())
+	c, err = feed.Next(ctx)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []Change[string, int]{
+		{Key: "foo", Op: ChangeDelete, Old: &v1, Deleted: true, Generation: 4},
+		{Key: "baz", Op: ChangeInsert, New: &v1, Generation: 4},
+	}, c.Changes)
+
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = feed.Next(timeout)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// Queued changes can be received after the feed is closed
+	assert.NoError(t, m.Refresh())
+	feed.Close()
+	_, err = feed.Next(ctx)
+	assert.NoError(t, err)
+	_, err = feed.Next(ctx)
+	assert.ErrorIs(t, err, ErrClosed)
+}
+
+func TestMap_Changefeed_close(t *testing.T) {
+	m := NewMap[string, int]()
+	feed := m.Changefeed()
+
+	done := make(chan error)
+	go func() {
+		_, err := feed.Next(context.Background())
+		done <- err
+	}()
+	assert.NoError(t, m.Close())
+	assert.ErrorIs(t, <-done, ErrClosed)
+
+	_, err := m.Changefeed().Next(context.Background())
+	assert.ErrorIs(t, err, ErrClosed)
+}
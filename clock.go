@@ -0,0 +1,65 @@
+package eventual
+
+import (
+	"time"
+)
+
+// Clock is the source of time of a map: the time of every refresh, the
+// timestamps of oplog entries and of the writes of write handles, the expiry
+// of the keys of a TTLMap, and the tickers and timers of automatic refreshes,
+// coalesced refreshes, TTL sweeps and automatic checkpoints. Tests can replace
+// it with WithClock to advance time deterministically rather than sleeping.
+//
+// The durations reported to the MetricsCollector, the pauses of
+// WithIncrementalRefresh and the deadline of WithRefreshDeadline bound work
+// rather than time passing, so they're always measured with the real time.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+
+	// NewTicker returns a ticker that ticks every d, like time.NewTicker.
+	NewTicker(d time.Duration) Ticker
+
+	// AfterFunc calls fn in its own goroutine once d has elapsed, like
+	// time.AfterFunc.
+	AfterFunc(d time.Duration, fn func()) Timer
+}
+
+// Ticker is a ticker created by a Clock.
+type Ticker interface {
+	// C returns the channel on which the ticks are delivered.
+	C() <-chan time.Time
+
+	// Stop stops the ticker.
+	Stop()
+}
+
+// Timer is a timer created by Clock.AfterFunc.
+type Timer interface {
+	// Stop prevents the timer from firing, and reports whether it was stopped
+	// before it fired.
+	Stop() bool
+}
+
+// realClock is the Clock of the time package.
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) NewTicker(d time.Duration) Ticker {
+	return realTicker{time.NewTicker(d)}
+}
+
+func (realClock) AfterFunc(d time.Duration, fn func()) Timer {
+	return time.AfterFunc(d, fn)
+}
+
+type realTicker struct {
+	*time.Ticker
+}
+
+func (t realTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
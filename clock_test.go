@@ -0,0 +1,201 @@
+package eventual
+
+import (
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a manually advanced clock. Timers that are due are fired by
+// Advance before it returns, and tickers tick at most once per Advance.
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	timers  []*fakeTimer
+	tickers []*fakeTicker
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) NewTicker(d time.Duration) Ticker {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTicker{clock: c, c: make(chan time.Time, 1), every: d, next: c.now.Add(d)}
+	c.tickers = append(c.tickers, t)
+	return t
+}
+
+func (c *fakeClock) AfterFunc(d time.Duration, fn func()) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTimer{clock: c, at: c.now.Add(d), fn: fn}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+// Advance moves the clock forward, fires the timers that are due and ticks the
+// tickers that are due.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	var due []*fakeTimer
+	pending := c.timers[:0]
+	for _, t := range c.timers {
+		if t.at.After(c.now) {
+			pending = append(pending, t)
+		} else {
+			due = append(due, t)
+		}
+	}
+	c.timers = pending
+	for _, t := range c.tickers {
+		if t.stopped || t.next.After(c.now) {
+			continue
+		}
+		for !t.next.After(c.now) {
+			t.next = t.next.Add(t.every)
+		}
+		select {
+		case t.c <- c.now:
+		default:
+		}
+	}
+	c.mu.Unlock()
+
+	// The timers are fired without holding the lock since they may read the
+	// clock
+	for _, t := range due {
+		t.fn()
+	}
+}
+
+// Timers returns the number of timers that haven't fired or been stopped.
+func (c *fakeClock) Timers() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.timers)
+}
+
+type fakeTicker struct {
+	clock   *fakeClock
+	c       chan time.Time
+	every   time.Duration
+	next    time.Time
+	stopped bool
+}
+
+func (t *fakeTicker) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTicker) Stop() {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	t.stopped = true
+}
+
+type fakeTimer struct {
+	clock *fakeClock
+	at    time.Time
+	fn    func()
+}
+
+func (t *fakeTimer) Stop() bool {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, pending := range c.timers {
+		if pending == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func TestMap_ClockAutoRefresh(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	m := NewMap[string, any](WithAutoRefreshInterval(time.Minute), WithClock(clock))
+	defer m.Close()
+	reader := m.Reader()
+
+	assert.NoError(t, m.Insert("foo", nil))
+	time.Sleep(10 * time.Millisecond)
+	assert.False(t, reader.Has("foo"))
+
+	// The ticks only come from the clock
+	clock.Advance(time.Minute)
+	assert.Eventually(t, func() bool {
+		return reader.Has("foo")
+	}, time.Second, time.Millisecond)
+}
+
+func TestMap_ClockCoalesceWindow(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	m := NewMap[int, int](WithRefreshCoalesceWindow(time.Minute), WithClock(clock))
+	defer m.Close()
+	reader := m.Reader()
+
+	assert.NoError(t, m.Insert(0, nil))
+	assert.NoError(t, m.Refresh())
+	assert.Equal(t, uint64(1), m.Generation())
+
+	// The refreshes within the window share a single timer
+	for i := 1; i < 10; i++ {
+		assert.NoError(t, m.Insert(i, nil))
+		assert.NoError(t, m.Refresh())
+	}
+	assert.Equal(t, 1, clock.Timers())
+	clock.Advance(59 * time.Second)
+	assert.Equal(t, uint64(1), m.Generation())
+
+	clock.Advance(time.Second)
+	assert.Equal(t, uint64(2), m.Generation())
+	assert.Len(t, reader.Keys(), 10)
+	assert.Equal(t, 0, clock.Timers())
+
+	// Once the window has passed, the next refresh happens immediately
+	clock.Advance(time.Minute)
+	assert.NoError(t, m.Insert(10, nil))
+	assert.NoError(t, m.Refresh())
+	assert.Equal(t, uint64(3), m.Generation())
+}
+
+func TestMap_ClockEntryTimestamps(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(100, 0)}
+	m := NewMap[string, int](WithEntryTimestamps(), WithClock(clock))
+	defer m.Close()
+
+	v := 1
+	assert.NoError(t, m.Insert("foo", &v))
+	clock.Advance(time.Second)
+	assert.NoError(t, m.Insert("bar", &v))
+
+	entries := m.PendingEntries()
+	if assert.Len(t, entries, 2) {
+		assert.Equal(t, time.Unix(100, 0), entries[0].Time())
+		assert.Equal(t, time.Unix(101, 0), entries[1].Time())
+	}
+}
+
+func TestWriteHandle_Clock(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(100, 0)}
+	m := NewMap[string, int](WithClock(clock))
+	defer m.Close()
+	a, b := m.WriteHandle(), m.WriteHandle()
+	reader := m.Reader()
+
+	// The write of b is made at the time of the clock, which is before the
+	// explicit time of the write of a
+	v1, v2 := 1, 2
+	assert.NoError(t, a.InsertAt("foo", &v1, time.Unix(100, 0).Add(time.Second)))
+	assert.NoError(t, b.Insert("foo", &v2))
+	assert.NoError(t, m.Refresh())
+	v, _ := reader.Get("foo")
+	assert.Equal(t, 1, *v)
+}
@@ -0,0 +1,33 @@
+package eventual
+
+import (
+	"context"
+)
+
+// coalesceRefreshLocked refreshes the map immediately if the coalesce window of
+// the previous refresh has passed. Otherwise, it schedules a single refresh for
+// the end of the window that every call within the window shares. This must be
+// called while holding the write lock.
+func (m *Map[K, V]) coalesceRefreshLocked() error {
+	if m.closed {
+		return ErrClosed
+	}
+	remaining := m.options.RefreshCoalesceWindow - m.options.Clock.Now().Sub(m.lastRefresh)
+	if remaining <= 0 {
+		return m.refreshLocked(context.Background())
+	}
+	if m.coalesceTimer == nil {
+		m.coalesceTimer = m.options.Clock.AfterFunc(remaining, m.coalescedRefresh)
+	}
+	return nil
+}
+
+// coalescedRefresh performs a refresh that was scheduled by coalesceRefreshLocked.
+func (m *Map[K, V]) coalescedRefresh() {
+	m.writeLock.Lock()
+	defer m.writeLock.Unlock()
+	m.coalesceTimer = nil
+	if !m.closed {
+		_ = m.refreshLocked(context.Background())
+	}
+}
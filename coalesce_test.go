@@ -0,0 +1,32 @@
+package eventual
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestMap_RefreshCoalesceWindow(t *testing.T) {
+	m := NewMap[int, int](WithRefreshCoalesceWindow(50 * time.Millisecond))
+	reader := m.Reader()
+
+	// The first refresh happens immediately
+	m.Insert(0, nil)
+	assert.NoError(t, m.Refresh())
+	assert.Equal(t, uint64(1), m.Generation())
+
+	// Refreshes within the window are collapsed into one
+	for i := 1; i < 10; i++ {
+		m.Insert(i, nil)
+		assert.NoError(t, m.Refresh())
+	}
+	assert.Equal(t, uint64(1), m.Generation())
+	assert.Len(t, reader.Keys(), 1)
+
+	assert.Eventually(t, func() bool {
+		return len(reader.Keys()) == 10
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, uint64(2), m.Generation())
+
+	assert.NoError(t, m.Close())
+}
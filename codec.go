@@ -0,0 +1,78 @@
+package eventual
+
+import (
+	"encoding/json"
+	"github.com/clarkmcc/go-evmap/pkg/oplog"
+)
+
+// Codec encodes and decodes a single key or value. The persistence features of
+// the map, such as WriteTo, OpenMap and replication, encode keys and values with
+// the codecs set by WithKeyCodec and WithValueCodec, which makes it possible to
+// use encodings such as protobuf or msgpack instead of gob. It's an alias of
+// oplog.Codec, so the same codecs encode the oplog entries of the map.
+type Codec[T any] = oplog.Codec[T]
+
+// GobCodec is a Codec that uses encoding/gob. It's the default codec.
+type GobCodec[T any] = oplog.GobCodec[T]
+
+// JSONCodec is a Codec that uses encoding/json.
+type JSONCodec[T any] struct{}
+
+func (JSONCodec[T]) Encode(v T) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONCodec[T]) Decode(data []byte) (T, error) {
+	var v T
+	err := json.Unmarshal(data, &v)
+	return v, err
+}
+
+// NewEntryCodec returns a codec of the oplog entries of a Map[K, V], such as the
+// entries handed to the sink of WithWriteBehind, which encodes the keys and
+// values with the codecs set by WithKeyCodec and WithValueCodec. Unlike the
+// codecs used by Entry.MarshalBinary, the codec supports nil values.
+//
+// Every persistence feature of the map encodes its entries with this codec:
+// the records of the write-ahead log of OpenMap, the contents written by
+// WriteTo and by checkpoints, and the frames sent by the replication package
+// are batches of inserts, deletes and clears.
+func NewEntryCodec[K comparable, V any](opts ...OptionFunc) *oplog.EntryCodec[K, *V] {
+	return entryCodec[K, V](newOptions(opts...))
+}
+
+// entryCodec returns the entry codec configured by the options.
+func entryCodec[K comparable, V any](o Options) *oplog.EntryCodec[K, *V] {
+	return oplog.NewEntryCodec[K, *V](keyCodec[K](o), pointerCodec[V]{values: valueCodec[V](o)})
+}
+
+// pointerCodec is a Codec of pointers that encodes a nil flag followed by the
+// value that is pointed to, if any, encoded with a Codec of the values.
+type pointerCodec[V any] struct {
+	values Codec[V]
+}
+
+func (c pointerCodec[V]) Encode(v *V) ([]byte, error) {
+	if v == nil {
+		return []byte{1}, nil
+	}
+	data, err := c.values.Encode(*v)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{0}, data...), nil
+}
+
+func (c pointerCodec[V]) Decode(data []byte) (*V, error) {
+	if len(data) == 0 {
+		return nil, oplog.ErrMalformedEntry
+	}
+	if data[0] == 1 {
+		return nil, nil
+	}
+	v, err := c.values.Decode(data[1:])
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
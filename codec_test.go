@@ -0,0 +1,73 @@
+package eventual
+
+import (
+	"github.com/clarkmcc/go-evmap/pkg/oplog"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestRecordCodec(t *testing.T) {
+	codec := entryCodec[string, int](newOptions(WithValueCodec[int](JSONCodec[int]{})))
+	v := 1
+	var rec walRecord[string, int]
+	rec.insert("foo", &v)
+	rec.insert("bar", nil)
+	rec.add(oplog.Delete[string, *int]("foo"), nil)
+	rec.add(oplog.Clear[string, *int](), nil)
+	rec.insert("baz", &v)
+
+	data, err := rec.encode(codec)
+	assert.NoError(t, err)
+	decoded, err := decodeRecord(codec, data)
+	assert.NoError(t, err)
+	assert.Len(t, decoded.Entries(), 5)
+	m := map[string]*int{"qux": &v}
+	decoded.Apply(&m)
+	assert.Equal(t, map[string]*int{"baz": &v}, m)
+
+	// Records are batch entries, and truncated and trailing data are rejected
+	_, err = decodeRecord(codec, data[:len(data)-1])
+	assert.ErrorIs(t, err, oplog.ErrMalformedEntry)
+	_, err = decodeRecord(codec, append(data, 0))
+	assert.ErrorIs(t, err, oplog.ErrMalformedEntry)
+	single, err := codec.Encode(oplog.Clear[string, *int]())
+	assert.NoError(t, err)
+	_, err = decodeRecord(codec, single)
+	assert.ErrorIs(t, err, oplog.ErrMalformedEntry)
+}
+
+func TestGobCodec(t *testing.T) {
+	type user struct{ Name string }
+	data, err := GobCodec[user]{}.Encode(user{Name: "foo"})
+	assert.NoError(t, err)
+	u, err := GobCodec[user]{}.Decode(data)
+	assert.NoError(t, err)
+	assert.Equal(t, user{Name: "foo"}, u)
+}
+
+func TestNewEntryCodec(t *testing.T) {
+	var entries [][]*oplog.Entry[string, *int]
+	m := NewMap[string, int](WithWriteBehind(func(e []*oplog.Entry[string, *int]) error {
+		entries = append(entries, e)
+		return nil
+	}))
+	v := 1
+	assert.NoError(t, m.Insert("foo", &v))
+	assert.NoError(t, m.InsertMany(map[string]*int{"bar": nil}))
+	assert.NoError(t, m.Refresh())
+	assert.NoError(t, m.Close())
+
+	// The entries handed to the sink can be shipped elsewhere and replayed
+	codec := NewEntryCodec[string, int](WithValueCodec[int](JSONCodec[int]{}))
+	replica := map[string]*int{}
+	for _, e := range entries[0] {
+		data, err := codec.Encode(e)
+		assert.NoError(t, err)
+		decoded, err := codec.Decode(data)
+		assert.NoError(t, err)
+		decoded.Apply(&replica)
+	}
+	assert.Len(t, replica, 2)
+	assert.Equal(t, 1, *replica["foo"])
+	assert.Nil(t, replica["bar"])
+}
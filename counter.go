@@ -0,0 +1,47 @@
+package eventual
+
+import (
+	"github.com/clarkmcc/go-evmap/pkg/oplog"
+)
+
+// CounterMap is a Map of int64 counters that supports incrementing a counter
+// without a read-modify-write cycle on the caller's side. Increments are
+// recorded in the oplog as deltas and applied to whatever value is in each of
+// the two maps, so they are correctly absorbed into both maps on refresh.
+//
+// All the methods of Map are available on a CounterMap, and its readers are
+// regular Readers.
+type CounterMap[K comparable] struct {
+	*Map[K, int64]
+}
+
+// Increment adds delta to the counter under the key, starting from zero if the
+// key doesn't exist. Use a negative delta to decrement the counter.
+func (m *CounterMap[K]) Increment(key K, delta int64) error {
+	m.lockForWrite()
+	defer m.writeLock.Unlock()
+	if m.closed {
+		return ErrClosed
+	}
+
+	// Every application allocates a new value because the previous value may
+	// still be visible to readers through the other map.
+	err := m.pushLocked(oplog.Update(key, func(old *int64, ok bool) *int64 {
+		n := delta
+		if ok && old != nil {
+			n += *old
+		}
+		return &n
+	}))
+	if err != nil {
+		return err
+	}
+	m.metrics.Inserted(1)
+	m.writtenLocked()
+	return nil
+}
+
+// NewCounterMap creates a new CounterMap with the provided options.
+func NewCounterMap[K comparable](opts ...OptionFunc) *CounterMap[K] {
+	return &CounterMap[K]{Map: NewMap[K, int64](opts...)}
+}
@@ -0,0 +1,63 @@
+package eventual
+
+import (
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+)
+
+func TestCounterMap_Increment(t *testing.T) {
+	m := NewCounterMap[string]()
+	reader := m.Reader()
+
+	assert.NoError(t, m.Increment("foo", 1))
+	assert.NoError(t, m.Increment("foo", 2))
+	assert.NoError(t, m.Refresh())
+	v, ok := reader.Get("foo")
+	assert.True(t, ok)
+	assert.Equal(t, int64(3), *v)
+
+	// Both maps absorb the increments, so the value is correct after the next
+	// refresh syncs the other map
+	assert.NoError(t, m.Increment("foo", -1))
+	assert.NoError(t, m.Refresh())
+	assert.NoError(t, m.Refresh())
+	v, _ = reader.Get("foo")
+	assert.Equal(t, int64(2), *v)
+	v, _ = m.Get("foo")
+	assert.Equal(t, int64(2), *v)
+
+	// Values that were handed out to readers are never modified
+	old := v
+	assert.NoError(t, m.Increment("foo", 10))
+	assert.NoError(t, m.Refresh())
+	assert.Equal(t, int64(2), *old)
+
+	assert.NoError(t, m.Close())
+	assert.ErrorIs(t, m.Increment("foo", 1), ErrClosed)
+}
+
+func TestCounterMap_concurrent(t *testing.T) {
+	m := NewCounterMap[int](WithMaxReplicationWriteLag(7))
+	reader := m.Reader()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 250; j++ {
+				assert.NoError(t, m.Increment(j%3, 1))
+			}
+		}()
+	}
+	wg.Wait()
+	assert.NoError(t, m.Refresh())
+
+	var total int64
+	for i := 0; i < 3; i++ {
+		v, _ := reader.Get(i)
+		total += *v
+	}
+	assert.Equal(t, int64(1000), total)
+}
@@ -0,0 +1,83 @@
+package eventual
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// errRefreshDeadline is the cause of the context of a refresh whose deadline
+// set with WithRefreshDeadline has passed.
+var errRefreshDeadline = errors.New("refresh deadline exceeded")
+
+// StuckReadersError is returned by Refresh when some readers are still reading
+// from the previous snapshot once the deadline set with WithRefreshDeadline
+// has passed. Like RefreshAndWait when its context is done, the refresh has
+// already moved the readers to the new snapshot, and the next write or
+// refresh blocks until the stuck readers finish their reads. It matches
+// context.DeadlineExceeded with errors.Is.
+type StuckReadersError struct {
+	// Generation is the generation of the snapshot that the readers are stuck on
+	Generation uint64
+
+	// Readers are the IDs of the stuck readers, as returned by Reader.ID
+	Readers []uint64
+}
+
+func (e *StuckReadersError) Error() string {
+	return fmt.Sprintf("refresh deadline exceeded: %d readers stuck on generation %d: %v", len(e.Readers), e.Generation, e.Readers)
+}
+
+func (e *StuckReadersError) Unwrap() error {
+	return context.DeadlineExceeded
+}
+
+// refreshContext applies the deadline set with WithRefreshDeadline, if any, to
+// the context of a refresh.
+func (m *Map[K, V]) refreshContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if m.options.RefreshDeadline <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeoutCause(ctx, m.options.RefreshDeadline, errRefreshDeadline)
+}
+
+// waitLaggingLocked is like waitReadersLocked, but once the refresh deadline
+// has passed, it either returns a *StuckReadersError identifying the readers
+// that still have the side pinned, or detaches them. Detaching abandons the
+// map that they're reading from to them, and the writable map is replaced with
+// a copy of the readable map, which the next sync makes. This must be called
+// while holding the write lock and the readers lock.
+func (m *Map[K, V]) waitLaggingLocked(ctx context.Context, side uint8) error {
+	err := m.waitReadersLocked(ctx, side)
+	if err == nil || context.Cause(ctx) != errRefreshDeadline {
+		return err
+	}
+
+	var stuck []*readerState[K, V]
+	for r := range m.readers.all() {
+		if !r.detached && r.pinned(side) {
+			stuck = append(stuck, r)
+		}
+	}
+	if !m.options.DetachStuckReaders {
+		e := &StuckReadersError{Generation: m.snapshot.generation - 1}
+		for _, r := range stuck {
+			e.Readers = append(e.Readers, r.id)
+		}
+		return e
+	}
+
+	for _, r := range stuck {
+		r.detached = true
+		r.close()
+	}
+	w := make(map[K]*V, len(*m.readable))
+	m.writable = &w
+
+	// The abandoned map may still reference the retired values
+	m.retired = nil
+
+	// Make the next sync copy the readable map rather than replaying the oplog
+	m.unlogged++
+	return nil
+}
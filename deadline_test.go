@@ -0,0 +1,80 @@
+package eventual
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestMap_RefreshDeadline(t *testing.T) {
+	m := NewMap[string, int](WithRefreshDeadline(10 * time.Millisecond))
+	defer m.Close()
+	stuck := m.Reader()
+	other := m.Reader()
+	v := 1
+	m.Insert("foo", &v)
+	m.Refresh()
+
+	// A guard that isn't released pins the previous snapshot
+	g := stuck.Guard()
+	v2 := 2
+	m.Insert("foo", &v2)
+	err := m.Refresh()
+	var e *StuckReadersError
+	if assert.ErrorAs(t, err, &e) {
+		assert.Equal(t, []uint64{stuck.ID()}, e.Readers)
+		assert.Equal(t, uint64(1), e.Generation)
+	}
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.NotEqual(t, stuck.ID(), other.ID())
+
+	// The readers were moved to the new snapshot regardless
+	got, _ := other.Get("foo")
+	assert.Equal(t, 2, *got)
+
+	// The next refresh finishes once the reader leaves the previous snapshot
+	assert.ErrorAs(t, m.Refresh(), &e)
+	g.Release()
+	assert.NoError(t, m.Refresh())
+	got, _ = stuck.Get("foo")
+	assert.Equal(t, 2, *got)
+}
+
+func TestMap_RefreshDeadlineDetach(t *testing.T) {
+	m := NewMap[string, int](WithRefreshDeadline(10*time.Millisecond), WithStuckReaderDetach())
+	defer m.Close()
+	stuck := m.Reader()
+	other := m.Reader()
+	v := 1
+	m.Insert("foo", &v)
+	m.Refresh()
+
+	g := stuck.Guard()
+	v2 := 2
+	m.Insert("foo", &v2)
+	m.Insert("bar", &v2)
+	assert.NoError(t, m.Refresh(), "the stuck reader should be detached")
+
+	// The detached reader is closed, but its guard keeps reading the abandoned map
+	_, _, err := stuck.GetErr("foo")
+	assert.ErrorIs(t, err, ErrReaderClosed)
+	got, _ := g.Get("foo")
+	assert.Equal(t, 1, *got)
+	assert.False(t, g.Has("bar"))
+
+	// Writes and refreshes carry on without the detached reader
+	v3 := 3
+	m.Insert("foo", &v3)
+	m.Delete("bar")
+	assert.NoError(t, m.Refresh())
+	assert.NoError(t, m.Refresh())
+	got, _ = other.Get("foo")
+	assert.Equal(t, 3, *got)
+	assert.False(t, other.Has("bar"))
+	got, _ = g.Get("foo")
+	assert.Equal(t, 1, *got)
+	g.Release()
+	assert.Len(t, m.openReaders(), 1)
+}
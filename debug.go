@@ -0,0 +1,81 @@
+package eventual
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/clarkmcc/go-evmap/pkg/oplog"
+	"io"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// DebugDump writes a human-readable description of the internal state of the
+// map to w, for debugging production incidents: the sizes of both maps, the
+// length of the oplog broken down by entry type, and the generation and pins
+// of every reader. DebugDump never blocks on the map's locks. If the write lock
+// or the readers lock is held, which is itself a hint about what the map is
+// doing, that's reported instead of the state that the lock protects.
+func (m *Map[K, V]) DebugDump(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "%T\n", m)
+
+	if m.writeLock.TryLock() {
+		fmt.Fprintf(bw, "write lock: free\n")
+		fmt.Fprintf(bw, "closed: %t\n", m.closed)
+		fmt.Fprintf(bw, "generation: %d\n", m.snapshot.generation)
+		fmt.Fprintf(bw, "readable: %d keys\n", len(*m.readable))
+		fmt.Fprintf(bw, "writable: %d keys\n", len(*m.writable))
+		if m.unsynced {
+			fmt.Fprintf(bw, "unsynced: a refresh hasn't finished waiting for readers and the writable map is stale\n")
+		}
+		if m.unlogged > 0 {
+			fmt.Fprintf(bw, "unlogged: %d writes skipped the oplog, the next refresh copies the map\n", m.unlogged)
+		}
+		if m.replaying {
+			fmt.Fprintf(bw, "replaying: %d published entries left to replay to the writable map\n", m.replayBacklog)
+		}
+		fmt.Fprintf(bw, "oplog: %s\n", describeOplog(m.oplog.Entries()))
+		fmt.Fprintf(bw, "write handles: %d, %d buffered writes\n", len(m.handles), m.handleWrites.Load())
+		m.writeLock.Unlock()
+	} else {
+		fmt.Fprintf(bw, "write lock: held, a write or refresh is in progress\n")
+	}
+
+	if m.readersLock.TryLock() {
+		readers := m.openReaders()
+		fmt.Fprintf(bw, "readers: %d\n", len(readers))
+		for i, r := range readers {
+			s := (*snapshot[K, V])(atomic.LoadPointer(&r.snapshot))
+			fmt.Fprintf(bw, "  reader %d: generation=%d frozen=%t pins=%v", i, s.generation, r.frozen, r.loadPins())
+			// Pins of the side that the reader isn't looking at are held by reads
+			// that started before the last refresh, which the refresh waits for
+			if s.side != sidePrivate && r.pinned(1-s.side) {
+				fmt.Fprintf(bw, " (pinning the previous snapshot)")
+			}
+			fmt.Fprintln(bw)
+		}
+		m.readersLock.Unlock()
+	} else {
+		fmt.Fprintf(bw, "readers lock: held, a reader is being frozen or unfrozen, or a refresh is waiting for readers\n")
+	}
+	return bw.Flush()
+}
+
+// describeOplog returns the number of entries along with the number of entries
+// of each type, such as "3 entries (delete=1 insert=2)".
+func describeOplog[K comparable, V any](entries []*oplog.Entry[K, V]) string {
+	counts := make(map[string]int)
+	for _, e := range entries {
+		counts[e.Type().String()]++
+	}
+	types := make([]string, 0, len(counts))
+	for t, n := range counts {
+		types = append(types, fmt.Sprintf("%s=%d", t, n))
+	}
+	sort.Strings(types)
+	if len(types) == 0 {
+		return fmt.Sprintf("%d entries", len(entries))
+	}
+	return fmt.Sprintf("%d entries (%s)", len(entries), strings.Join(types, " "))
+}
@@ -0,0 +1,47 @@
+package eventual
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestMap_DebugDump(t *testing.T) {
+	m := NewMap[string, int]()
+	r := m.Reader()
+	v := 1
+	assert.NoError(t, m.Insert("foo", &v))
+	assert.NoError(t, m.Refresh())
+	assert.NoError(t, m.Insert("bar", &v))
+	assert.True(t, m.Delete("foo"))
+	assert.NoError(t, m.Insert("baz", &v))
+
+	// A read that started before a refresh pins the previous snapshot
+	g := r.Guard()
+	r.swapSnapshot(newSnapshot(m.writable, 1-g.s.side, g.s.generation+1, nil))
+
+	var buf bytes.Buffer
+	assert.NoError(t, m.DebugDump(&buf))
+	out := buf.String()
+	assert.Contains(t, out, "write lock: free\n")
+	assert.Contains(t, out, "generation: 1\n")
+	assert.Contains(t, out, "readable: 1 keys\n")
+	assert.Contains(t, out, "oplog: 3 entries (delete=1 insert=2)\n")
+	assert.Contains(t, out, "readers: 1\n")
+	assert.Contains(t, out, "reader 0: generation=2 frozen=false pins=[")
+	assert.Contains(t, out, "(pinning the previous snapshot)")
+	g.Release()
+
+	// Nothing protected by a held lock is reported
+	m.writeLock.Lock()
+	m.readersLock.Lock()
+	buf.Reset()
+	assert.NoError(t, m.DebugDump(&buf))
+	m.readersLock.Unlock()
+	m.writeLock.Unlock()
+	out = buf.String()
+	assert.Contains(t, out, "write lock: held")
+	assert.Contains(t, out, "readers lock: held")
+	assert.NotContains(t, out, "oplog:")
+	assert.NotContains(t, out, "reader 0")
+}
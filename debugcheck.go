@@ -0,0 +1,80 @@
+package eventual
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync/atomic"
+)
+
+// checkLocked validates the internal invariants of a map created with
+// WithDebugChecks after the given operation, and panics with a report of the
+// violations and the state of the map if any of them doesn't hold. This must be
+// called while holding the write lock.
+func (m *Map[K, V]) checkLocked(op string) {
+	if !m.options.DebugChecks || m.closed {
+		return
+	}
+
+	var violations []string
+	violate := func(format string, args ...any) {
+		violations = append(violations, fmt.Sprintf(format, args...))
+	}
+	if m.readable == m.writable {
+		violate("the readable and writable maps are the same map")
+	}
+	if m.snapshot.m != m.readable {
+		violate("the published snapshot doesn't point at the readable map")
+	}
+	if m.published.Load() != m.snapshot {
+		violate("the snapshot loaded by new readers isn't the published snapshot")
+	}
+
+	// Once a refresh has synced the writable map, both maps hold the same values
+	synced := op == "refresh" && !m.unsynced && !m.replaying
+	if synced {
+		if n := m.oplog.Len(); n > 0 {
+			violate("the oplog still has %d entries after the refresh", n)
+		}
+		if m.unlogged > 0 {
+			violate("%d unlogged writes weren't copied by the refresh", m.unlogged)
+		}
+		if len(*m.readable) != len(*m.writable) {
+			violate("the readable map has %d keys but the writable map has %d", len(*m.readable), len(*m.writable))
+		}
+		for k, v := range *m.readable {
+			if w, ok := (*m.writable)[k]; !ok || w != v && !m.equal(w, v) && !reflect.DeepEqual(w, v) {
+				violate("key %v differs between the readable and writable maps", k)
+				break
+			}
+		}
+	}
+
+	m.readersLock.Lock()
+	for r := range m.readers.all() {
+		if pins := r.loadPins(); pins[0] < 0 || pins[1] < 0 || pins[2] < 0 {
+			violate("reader %d has negative pins %v", r.id, pins)
+		}
+		s := (*snapshot[K, V])(atomic.LoadPointer(&r.snapshot))
+		if s == nil || r.frozen || r.detached || atomic.LoadUint32(&r.closed) != 0 {
+			continue
+		}
+		if s != m.snapshot {
+			violate("reader %d is looking at generation %d rather than the published generation %d", r.id, s.generation, m.snapshot.generation)
+		}
+	}
+	m.readersLock.Unlock()
+
+	if len(violations) == 0 {
+		return
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "evmap: invariants violated after %s:\n", op)
+	for _, v := range violations {
+		fmt.Fprintf(&b, "  - %s\n", v)
+	}
+	fmt.Fprintf(&b, "state: generation=%d readable=%d keys writable=%d keys unsynced=%t replaying=%t\n",
+		m.snapshot.generation, len(*m.readable), len(*m.writable), m.unsynced, m.replaying)
+	fmt.Fprintf(&b, "oplog: %s\n", describeOplog(m.oplog.Entries()))
+	panic(b.String())
+}
@@ -0,0 +1,56 @@
+package eventual
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestMap_DebugChecks(t *testing.T) {
+	m := NewMap[int, int](WithDebugChecks(), WithMaxReplicationWriteLag(10))
+	defer m.Close()
+	reader := m.Reader()
+	frozen := m.Reader()
+	frozen.Freeze()
+
+	// A correctly used map never violates its invariants
+	assert.NotPanics(t, func() {
+		for i := 0; i < 100; i++ {
+			v := i
+			m.Insert(i%30, &v)
+			m.Delete(i % 7)
+			if i%25 == 0 {
+				m.Clear()
+			}
+		}
+		m.Refresh()
+	})
+	assert.Equal(t, m.Len(), len(reader.Keys()))
+
+	// Corrupting the readable map is caught by the next refresh
+	v := 0
+	(*m.readable)[1000] = &v
+	report := fmt.Sprint(recoverPanic(func() { m.Refresh() }))
+	assert.Contains(t, report, "evmap: invariants violated after refresh:\n")
+	assert.Contains(t, report, "the readable map has")
+	assert.Contains(t, report, "state: generation=")
+}
+
+func TestMap_DebugChecksReaders(t *testing.T) {
+	m := NewMap[int, int](WithDebugChecks())
+	defer m.Close()
+	reader := m.Reader()
+	m.Refresh()
+
+	// A reader that is left on a stale snapshot is reported by the next write
+	reader.swapSnapshot(newSnapshot(m.writable, m.snapshot.side, 0, nil))
+	report := fmt.Sprint(recoverPanic(func() { m.Insert(1, nil) }))
+	assert.Contains(t, report, "evmap: invariants violated after write:\n")
+	assert.Contains(t, report, fmt.Sprintf("reader %d is looking at generation 0 rather than the published generation 1", reader.ID()))
+}
+
+func recoverPanic(fn func()) (v any) {
+	defer func() { v = recover() }()
+	fn()
+	return nil
+}
@@ -0,0 +1,102 @@
+package eventual
+
+import (
+	"fmt"
+)
+
+// Delta describes the keys whose visible values were changed between two
+// generations of a map.
+type Delta[K comparable] struct {
+	// From and To are the generations that were compared
+	From, To uint64
+
+	// Added are the keys that weren't visible at From and are visible at To,
+	// Removed are the keys that were visible at From and aren't visible at To,
+	// and Updated are the keys that are visible at both generations but whose
+	// value was replaced by at least one refresh in between.
+	Added, Updated, Removed []K
+}
+
+// generationChanges are the keys changed by the refresh that published a
+// generation, without the values, to keep the history small.
+type generationChanges[K comparable] struct {
+	generation uint64
+	keys       []K
+	ops        []ChangeOp
+}
+
+// Diff returns the keys that were added, updated and removed between two
+// generations of a map created with WithDiffHistory, so that consumers such as
+// caches can invalidate exactly the keys that changed. Changes are detected the
+// same way as by Changefeed. The map only remembers the changes of its most
+// recent refreshes, and Diff returns ErrDiffUnavailable if any of the
+// generations after from has been forgotten, or if to hasn't been published
+// yet.
+func (m *Map[K, V]) Diff(from, to uint64) (Delta[K], error) {
+	m.writeLock.Lock()
+	defer m.writeLock.Unlock()
+
+	d := Delta[K]{From: from, To: to}
+	if from > to || to > m.snapshot.generation {
+		return d, fmt.Errorf("%w: generations %d to %d", ErrDiffUnavailable, from, to)
+	}
+	if from == to {
+		return d, nil
+	}
+	if len(m.diffs) == 0 || m.diffs[0].generation > from+1 {
+		return d, fmt.Errorf("%w: generations %d to %d", ErrDiffUnavailable, from, to)
+	}
+
+	// Fold the changes of every refresh in between into whether each key was
+	// visible at from and whether it's visible at to.
+	type state struct{ existed, exists bool }
+	states := make(map[K]*state)
+	var order []K
+	for _, g := range m.diffs {
+		if g.generation <= from || g.generation > to {
+			continue
+		}
+		for i, k := range g.keys {
+			s, ok := states[k]
+			if !ok {
+				s = &state{existed: g.ops[i] != ChangeInsert}
+				states[k] = s
+				order = append(order, k)
+			}
+			s.exists = g.ops[i] != ChangeDelete
+		}
+	}
+	for _, k := range order {
+		switch s := states[k]; {
+		case !s.existed && s.exists:
+			d.Added = append(d.Added, k)
+		case s.existed && s.exists:
+			d.Updated = append(d.Updated, k)
+		case s.existed && !s.exists:
+			d.Removed = append(d.Removed, k)
+		}
+	}
+	return d, nil
+}
+
+// recordDiffLocked records the changes of a refresh for Diff, forgetting the
+// oldest refresh once the history is full. This must be called while holding
+// the write lock.
+func (m *Map[K, V]) recordDiffLocked(c Changes[K, V]) {
+	if m.options.DiffHistory <= 0 {
+		return
+	}
+	g := generationChanges[K]{
+		generation: c.Generation,
+		keys:       make([]K, len(c.Changes)),
+		ops:        make([]ChangeOp, len(c.Changes)),
+	}
+	for i, change := range c.Changes {
+		g.keys[i], g.ops[i] = change.Key, change.Op
+	}
+	if len(m.diffs) == m.options.DiffHistory {
+		copy(m.diffs, m.diffs[1:])
+		m.diffs = m.diffs[:len(m.diffs)-1]
+	}
+	m.diffs = append(m.diffs, g)
+}
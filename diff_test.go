@@ -0,0 +1,64 @@
+package eventual
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestMap_Diff(t *testing.T) {
+	m := NewMap[string, int](WithDiffHistory(2))
+	v1, v2 := 1, 2
+
+	assert.NoError(t, m.Insert("foo", &v1))
+	assert.NoError(t, m.Insert("bar", &v1))
+	assert.NoError(t, m.Refresh())
+
+	assert.NoError(t, m.Insert("foo", &v2))
+	assert.True(t, m.Delete("bar"))
+	assert.NoError(t, m.Insert("baz", &v1))
+	assert.NoError(t, m.Refresh())
+
+	d, err := m.Diff(1, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"baz"}, d.Added)
+	assert.Equal(t, []string{"foo"}, d.Updated)
+	assert.Equal(t, []string{"bar"}, d.Removed)
+
+	// Changes spanning several refreshes are folded per key
+	d, err = m.Diff(0, 2)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"foo", "baz"}, d.Added)
+	assert.Empty(t, d.Updated)
+	assert.Empty(t, d.Removed)
+
+	d, err = m.Diff(2, 2)
+	assert.NoError(t, err)
+	assert.Empty(t, d.Added)
+
+	// Only the two most recent refreshes are remembered
+	assert.True(t, m.Delete("baz"))
+	assert.NoError(t, m.Refresh())
+	_, err = m.Diff(0, 3)
+	assert.True(t, errors.Is(err, ErrDiffUnavailable))
+	d, err = m.Diff(1, 3)
+	assert.NoError(t, err)
+	assert.Empty(t, d.Added)
+	assert.Equal(t, []string{"foo"}, d.Updated)
+	assert.Equal(t, []string{"bar"}, d.Removed)
+
+	// Generations that haven't been published yet
+	_, err = m.Diff(3, 4)
+	assert.True(t, errors.Is(err, ErrDiffUnavailable))
+	_, err = m.Diff(3, 2)
+	assert.True(t, errors.Is(err, ErrDiffUnavailable))
+}
+
+func TestMap_DiffDisabled(t *testing.T) {
+	m := NewMap[string, int]()
+	v := 1
+	assert.NoError(t, m.Insert("foo", &v))
+	assert.NoError(t, m.Refresh())
+	_, err := m.Diff(0, 1)
+	assert.True(t, errors.Is(err, ErrDiffUnavailable))
+}
@@ -0,0 +1,308 @@
+package eventual
+
+import (
+	"context"
+	"errors"
+	"github.com/clarkmcc/go-evmap/pkg/oplog"
+	"github.com/clarkmcc/go-evmap/pkg/wal"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// walRecord is the encoded form of the oplog entries of a single write, and of
+// the contents of snapshots. The entries are flattened into a batch of inserts,
+// deletes and clears because entries such as updates can't be encoded as is,
+// and the batch is encoded with the map's entry codec.
+type walRecord[K comparable, V any] struct {
+	ops oplog.Batch[K, *V]
+}
+
+// appendWALLocked flattens the entries into a record and appends it to the
+// write-ahead log. This must be called while holding the write lock, before the
+// entries are applied to the writable map.
+func (m *Map[K, V]) appendWALLocked(entries []*oplog.Entry[K, *V]) error {
+	var rec walRecord[K, V]
+	for _, e := range entries {
+		rec.add(e, *m.writable)
+	}
+	data, err := rec.encode(entryCodec[K, V](m.options))
+	if err != nil {
+		return err
+	}
+	return m.wal.Append(data)
+}
+
+// checkpointIfFullLocked checkpoints the map if its write-ahead log has reached
+// the configured checkpoint size. This must be called while holding the write
+// lock, after the write that grew the log has been applied. The write is durable
+// at this point, so a failed checkpoint doesn't fail the write, and the log is
+// simply checkpointed again by the next write.
+func (m *Map[K, V]) checkpointIfFullLocked() {
+	if m.options.CheckpointSize > 0 && m.wal.Size() >= m.options.CheckpointSize {
+		if err := m.checkpointLocked(); err != nil {
+			m.walErr = err
+		}
+	}
+}
+
+// add appends the operations of the entry to the record. Updates are recorded
+// as an insert of the value that the update computes from the current map, and
+// user-defined operations as the inserts and deletes that they make to it.
+func (rec *walRecord[K, V]) add(e *oplog.Entry[K, *V], current map[K]*V) {
+	switch e.Type() {
+	case oplog.EntryInsert:
+		rec.insert(e.Key(), e.Value())
+	case oplog.EntryDelete:
+		rec.ops.Delete(e.Key())
+	case oplog.EntryClear:
+		rec.ops.Clear()
+	case oplog.EntryInsertMany:
+		for k, v := range e.Values() {
+			rec.insert(k, v)
+		}
+	case oplog.EntryDeleteMany:
+		for _, k := range e.Keys() {
+			rec.ops.Delete(k)
+		}
+	case oplog.EntryUpdate:
+		old, ok := current[e.Key()]
+		rec.insert(e.Key(), e.UpdateFunc()(old, ok))
+	case oplog.EntryBatch:
+		for _, e := range e.Entries() {
+			rec.add(e, current)
+		}
+	case oplog.EntryOperation:
+		// The effect of the operation is recorded as the inserts and deletes
+		// that turn the current map into the map that the operation produces.
+		next := make(map[K]*V, len(current))
+		for k, v := range current {
+			next[k] = v
+		}
+		e.Operation().Apply(next)
+		for k, old := range current {
+			if v, ok := next[k]; !ok {
+				rec.ops.Delete(k)
+			} else if v != old {
+				rec.insert(k, v)
+			}
+		}
+		for k, v := range next {
+			if _, ok := current[k]; !ok {
+				rec.insert(k, v)
+			}
+		}
+	}
+}
+
+func (rec *walRecord[K, V]) insert(key K, value *V) {
+	rec.ops.Insert(key, value)
+}
+
+// encode encodes the record as a single batch entry.
+func (rec *walRecord[K, V]) encode(codec *oplog.EntryCodec[K, *V]) ([]byte, error) {
+	return codec.Encode(rec.ops.Entry())
+}
+
+// decodeRecord decodes a record that was encoded by walRecord.encode into the
+// batch entry of its operations.
+func decodeRecord[K comparable, V any](codec *oplog.EntryCodec[K, *V], data []byte) (*oplog.Entry[K, *V], error) {
+	e, err := codec.Decode(data)
+	if err != nil {
+		return nil, err
+	}
+	if e.Type() != oplog.EntryBatch {
+		return nil, oplog.ErrMalformedEntry
+	}
+	return e, nil
+}
+
+// OpenMap creates a durable Map backed by a write-ahead log stored in the file
+// at path. Every write is appended to the log and synced to disk before it's
+// applied to the map, and the log is replayed when the map is opened, so the
+// map recovers every acknowledged write after a crash. Like NewMapFrom, readers
+// observe the replayed contents immediately. The records are encoded with the
+// map's key and value codecs, so the same codecs must be used every time the log
+// is opened.
+//
+// To keep the log from growing without bounds, the map can be checkpointed with
+// Checkpoint, or automatically with WithCheckpointSize and
+// WithCheckpointInterval. A checkpoint writes the contents of the map to a
+// snapshot file next to the log, named after the log with a ".snapshot" suffix,
+// and then truncates the log. The snapshot is loaded before the log is replayed.
+//
+// When a write can't be appended to the log it isn't applied. Writes that return
+// an error return the error, and writes that don't report that nothing was
+// written, in which case the error is available from WALErr. Closing the map
+// closes the log.
+func OpenMap[K comparable, V any](path string, opts ...OptionFunc) (_ *Map[K, V], err error) {
+	options := newOptions(opts...)
+	_, span := options.Tracer.Start(context.Background(), "evmap.OpenMap")
+	defer func() { span.End(err) }()
+
+	w := make(map[K]*V, options.InitialCapacity)
+	codec := entryCodec[K, V](options)
+	if err := readRecord(snapshotPath(path), codec, w); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	log, err := wal.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	var records int64
+	err = log.Replay(func(record []byte) error {
+		rec, err := decodeRecord(codec, record)
+		if err != nil {
+			return err
+		}
+		rec.Apply(&w)
+		records++
+		return nil
+	})
+	if err != nil {
+		_ = log.Close()
+		return nil, err
+	}
+	span.SetAttribute("evmap.records", records)
+	span.SetAttribute("evmap.keys", int64(len(w)))
+
+	r := make(map[K]*V, max(len(w), options.InitialCapacity))
+	for k, v := range w {
+		r[k] = v
+	}
+	m := newMap(r, w, options)
+	m.wal = log
+	m.walPath = path
+	if options.CheckpointInterval > 0 {
+		m.background.Add(1)
+		go m.autoCheckpoint(options.CheckpointInterval)
+	}
+	return m, nil
+}
+
+// snapshotPath returns the path of the snapshot file of the log at path.
+func snapshotPath(path string) string {
+	return path + ".snapshot"
+}
+
+// readRecord decodes the record in the file at path and applies it to m.
+func readRecord[K comparable, V any](path string, codec *oplog.EntryCodec[K, *V], m map[K]*V) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	rec, err := decodeRecord(codec, data)
+	if err != nil {
+		return err
+	}
+	rec.Apply(&m)
+	return nil
+}
+
+// Checkpoint writes the contents of the writable map to the snapshot file of a
+// map created with OpenMap and truncates the write-ahead log. The snapshot is
+// written to a temporary file that replaces the previous snapshot once it has
+// been synced, so a crash during a checkpoint never loses writes. Checkpoint
+// has no effect on maps that aren't durable.
+func (m *Map[K, V]) Checkpoint() error {
+	m.lockWriter()
+	defer m.writeLock.Unlock()
+	if m.closed {
+		return ErrClosed
+	}
+	if m.wal == nil {
+		return nil
+	}
+	return m.checkpointLocked()
+}
+
+// checkpointLocked performs the work of Checkpoint and must only be called while
+// holding the write lock.
+func (m *Map[K, V]) checkpointLocked() (err error) {
+	_, span := m.options.Tracer.Start(context.Background(), "evmap.Checkpoint")
+	defer func() { span.End(err) }()
+	span.SetAttribute("evmap.keys", int64(len(*m.writable)))
+
+	var rec walRecord[K, V]
+	for k, v := range *m.writable {
+		rec.insert(k, v)
+	}
+
+	data, err := rec.encode(entryCodec[K, V](m.options))
+	if err != nil {
+		return err
+	}
+
+	path := snapshotPath(m.walPath)
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	if err := syncDir(filepath.Dir(path)); err != nil {
+		return err
+	}
+
+	// Replaying the log on top of the new snapshot produces the same contents,
+	// so a crash before the log is truncated is harmless.
+	return m.wal.Truncate()
+}
+
+// syncDir syncs the directory so that a rename within it is durable.
+func syncDir(path string) error {
+	d, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// autoCheckpoint checkpoints the map every interval until the map is closed.
+// The checkpoint is skipped if the log is empty.
+func (m *Map[K, V]) autoCheckpoint(interval time.Duration) {
+	defer m.background.Done()
+
+	ticker := m.options.Clock.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-ticker.C():
+			m.labeled(context.Background(), checkpointLabels, func(context.Context) {
+				m.lockWriter()
+				if !m.closed && m.wal.Size() > 0 {
+					if err := m.checkpointLocked(); err != nil {
+						m.walErr = err
+					}
+				}
+				m.writeLock.Unlock()
+			})
+		}
+	}
+}
+
+// WALErr returns the last error that occurred while appending a write to the
+// write-ahead log of a map created with OpenMap, or nil if there wasn't one.
+func (m *Map[K, V]) WALErr() error {
+	m.writeLock.Lock()
+	defer m.writeLock.Unlock()
+	return m.walErr
+}
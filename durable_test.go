@@ -0,0 +1,146 @@
+package eventual
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestOpenMap(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "map.wal")
+	m, err := OpenMap[string, int](path)
+	assert.NoError(t, err)
+
+	v1, v2 := 1, 2
+	assert.NoError(t, m.Insert("foo", &v1))
+	assert.NoError(t, m.InsertMany(map[string]*int{"bar": &v2, "baz": nil}))
+	assert.True(t, m.Delete("baz"))
+	assert.NoError(t, m.Batch(func(b *Batch[string, int]) {
+		b.Insert("qux", &v2)
+	}))
+	assert.NoError(t, m.Update("foo", func(old *int, ok bool) *int {
+		v := *old + 10
+		return &v
+	}))
+
+	// Unrefreshed writes are durable too
+	assert.NoError(t, m.Close())
+
+	m, err = OpenMap[string, int](path)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"foo": 11, "bar": 2, "qux": 2}, m.Reader().Snapshot())
+
+	// Replace is recorded as a single record
+	assert.NoError(t, m.Replace(map[string]*int{"a": &v1}))
+	assert.NoError(t, m.Close())
+
+	m, err = OpenMap[string, int](path)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"a": 1}, m.Snapshot())
+	assert.NoError(t, m.WALErr())
+
+	// Writes fail once the log can't be appended to
+	assert.NoError(t, m.wal.Close())
+	assert.Error(t, m.Insert("b", &v1))
+	assert.False(t, m.Delete("a"))
+	assert.Error(t, m.WALErr())
+	assert.Equal(t, map[string]int{"a": 1}, m.Snapshot())
+}
+
+func TestOpenMap_CounterMap(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "map.wal")
+	m, err := OpenMap[string, int64](path)
+	assert.NoError(t, err)
+	counters := &CounterMap[string]{Map: m}
+	assert.NoError(t, counters.Increment("foo", 2))
+	assert.NoError(t, counters.Increment("foo", 3))
+	assert.NoError(t, counters.Close())
+
+	m, err = OpenMap[string, int64](path)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int64{"foo": 5}, m.Snapshot())
+	assert.NoError(t, m.Close())
+}
+
+func TestMap_Checkpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "map.wal")
+	m, err := OpenMap[string, int](path)
+	assert.NoError(t, err)
+
+	v1, v2 := 1, 2
+	assert.NoError(t, m.Insert("foo", &v1))
+	assert.NoError(t, m.Insert("bar", &v2))
+	assert.NoError(t, m.Checkpoint())
+	assert.Equal(t, int64(0), m.wal.Size())
+
+	// Writes after the checkpoint are replayed on top of the snapshot
+	assert.True(t, m.Delete("foo"))
+	assert.NoError(t, m.Insert("baz", nil))
+	assert.NoError(t, m.Close())
+
+	m, err = OpenMap[string, int](path)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"bar": 2, "baz": 0}, m.Snapshot())
+	v, _ := m.Get("baz")
+	assert.Nil(t, v)
+
+	// A crash between writing the snapshot and truncating the log is harmless
+	assert.NoError(t, m.Insert("qux", &v1))
+	assert.NoError(t, m.Clear())
+	assert.NoError(t, m.Insert("quux", &v2))
+	m.writeLock.Lock()
+	var rec walRecord[string, int]
+	for k, v := range *m.writable {
+		rec.insert(k, v)
+	}
+	data, err := rec.encode(entryCodec[string, int](m.options))
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(snapshotPath(path), data, 0o644))
+	m.writeLock.Unlock()
+	assert.NoError(t, m.Close())
+
+	m, err = OpenMap[string, int](path)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"quux": 2}, m.Snapshot())
+	assert.NoError(t, m.Close())
+	assert.ErrorIs(t, m.Checkpoint(), ErrClosed)
+
+	// Maps that aren't durable can't be checkpointed
+	assert.NoError(t, NewMap[string, int]().Checkpoint())
+}
+
+func TestWithCheckpointSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "map.wal")
+	m, err := OpenMap[int, int](path, WithCheckpointSize(256))
+	assert.NoError(t, err)
+	for i := 0; i < 100; i++ {
+		v := i
+		assert.NoError(t, m.Insert(i, &v))
+		assert.Less(t, m.wal.Size(), int64(256))
+	}
+	assert.NoError(t, m.WALErr())
+	assert.NoError(t, m.Close())
+
+	m, err = OpenMap[int, int](path)
+	assert.NoError(t, err)
+	assert.Equal(t, 100, m.Len())
+	assert.NoError(t, m.Close())
+}
+
+func TestWithCheckpointInterval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "map.wal")
+	m, err := OpenMap[string, int](path, WithCheckpointInterval(time.Millisecond))
+	assert.NoError(t, err)
+	v := 1
+	assert.NoError(t, m.Insert("foo", &v))
+	assert.Eventually(t, func() bool {
+		m.writeLock.Lock()
+		defer m.writeLock.Unlock()
+		return m.wal.Size() == 0
+	}, time.Second, time.Millisecond)
+	_, err = os.Stat(snapshotPath(path))
+	assert.NoError(t, err)
+	assert.NoError(t, m.Close())
+}
@@ -0,0 +1,35 @@
+package eventual
+
+import (
+	"errors"
+)
+
+var (
+	// ErrClosed is returned when attempting to write to a map that has already
+	// been closed.
+	ErrClosed = errors.New("map closed")
+
+	// ErrReaderClosed is returned when attempting to read from a reader that
+	// has already been closed.
+	ErrReaderClosed = errors.New("reader closed")
+
+	// ErrGuardReleased is returned when attempting to read through a read guard
+	// that has already been released.
+	ErrGuardReleased = errors.New("read guard released")
+
+	// ErrNoLoader is returned by GetOrLoad when the map was created without
+	// WithLoader and the key doesn't exist.
+	ErrNoLoader = errors.New("no loader configured")
+
+	// ErrOplogFull is returned by writes to a map created with WithMaxOplogSize
+	// and OverflowError when the write doesn't fit in the oplog.
+	ErrOplogFull = errors.New("oplog full")
+
+	// ErrCacheMiss is returned by Cache.Get when the key doesn't exist or has
+	// expired.
+	ErrCacheMiss = errors.New("cache miss")
+
+	// ErrDiffUnavailable is returned by Map.Diff when the changes between the
+	// requested generations are no longer, or not yet, known to the map.
+	ErrDiffUnavailable = errors.New("diff unavailable")
+)
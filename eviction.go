@@ -0,0 +1,88 @@
+package eventual
+
+import (
+	"container/list"
+)
+
+// EvictionPolicy decides which key is evicted when a map created with
+// WithMaxEntries grows beyond its maximum number of entries. The policy is
+// notified of every key that is written to the map and is only ever used while
+// holding the map's write lock, so it doesn't need to be thread-safe.
+//
+// Readers never coordinate with the writer, so reads made through a Reader are
+// not observed by the policy. Recency is based on writes to the map.
+type EvictionPolicy[K comparable] interface {
+	// Inserted is called when a value is inserted under the key, including when
+	// the key already existed.
+	Inserted(key K)
+
+	// Deleted is called when the key is removed from the map, including when
+	// the key didn't exist.
+	Deleted(key K)
+
+	// Cleared is called when every key is removed from the map.
+	Cleared()
+
+	// Victim returns the key that should be evicted next, or false if the
+	// policy isn't tracking any keys.
+	Victim() (K, bool)
+}
+
+// lruPolicy evicts the least recently written key.
+type lruPolicy[K comparable] struct {
+	order *list.List
+	keys  map[K]*list.Element
+}
+
+// NewLRUPolicy returns an EvictionPolicy that evicts the least recently
+// inserted or updated key. This is the default policy.
+func NewLRUPolicy[K comparable]() EvictionPolicy[K] {
+	return &lruPolicy[K]{order: list.New(), keys: map[K]*list.Element{}}
+}
+
+func (p *lruPolicy[K]) Inserted(key K) {
+	if e, ok := p.keys[key]; ok {
+		p.order.MoveToBack(e)
+		return
+	}
+	p.keys[key] = p.order.PushBack(key)
+}
+
+func (p *lruPolicy[K]) Deleted(key K) {
+	if e, ok := p.keys[key]; ok {
+		p.order.Remove(e)
+		delete(p.keys, key)
+	}
+}
+
+func (p *lruPolicy[K]) Cleared() {
+	p.order.Init()
+	clear(p.keys)
+}
+
+func (p *lruPolicy[K]) Victim() (K, bool) {
+	e := p.order.Front()
+	if e == nil {
+		var zero K
+		return zero, false
+	}
+	return e.Value.(K), true
+}
+
+// fifoPolicy evicts the oldest key, regardless of how often it was updated.
+type fifoPolicy[K comparable] struct {
+	lruPolicy[K]
+}
+
+// NewFIFOPolicy returns an EvictionPolicy that evicts the key that was first
+// inserted into the map. Updating the value of an existing key doesn't change
+// its position.
+func NewFIFOPolicy[K comparable]() EvictionPolicy[K] {
+	return &fifoPolicy[K]{lruPolicy[K]{order: list.New(), keys: map[K]*list.Element{}}}
+}
+
+func (p *fifoPolicy[K]) Inserted(key K) {
+	if _, ok := p.keys[key]; !ok {
+		p.keys[key] = p.order.PushBack(key)
+	}
+}
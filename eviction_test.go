@@ -0,0 +1,65 @@
+package eventual
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestWithMaxEntries(t *testing.T) {
+	m := NewMap[string, int](WithMaxEntries(2))
+	reader := m.Reader()
+
+	v := 1
+	assert.NoError(t, m.Insert("foo", &v))
+	assert.NoError(t, m.Insert("bar", &v))
+	assert.NoError(t, m.Refresh())
+
+	// Writing foo makes bar the least recently written key
+	assert.NoError(t, m.Insert("foo", &v))
+	assert.NoError(t, m.Insert("baz", &v))
+	assert.Equal(t, 2, m.Len())
+	assert.ElementsMatch(t, []string{"foo", "baz"}, m.Keys())
+
+	// The eviction is only visible after the next refresh
+	assert.True(t, reader.Has("bar"))
+	assert.NoError(t, m.Refresh())
+	assert.False(t, reader.Has("bar"))
+	assert.True(t, reader.Has("foo"))
+	assert.True(t, reader.Has("baz"))
+
+	// Deleted keys are no longer eviction candidates
+	assert.True(t, m.Delete("foo"))
+	assert.NoError(t, m.InsertMany(map[string]*int{"a": &v}))
+	assert.ElementsMatch(t, []string{"baz", "a"}, m.Keys())
+
+	assert.NoError(t, m.Clear())
+	assert.NoError(t, m.Insert("b", &v))
+	assert.NoError(t, m.Insert("c", &v))
+	assert.ElementsMatch(t, []string{"b", "c"}, m.Keys())
+}
+
+func TestWithEvictionPolicy(t *testing.T) {
+	m := NewMap[string, int](WithMaxEntries(2), WithEvictionPolicy(NewFIFOPolicy[string]))
+
+	v := 1
+	assert.NoError(t, m.Insert("foo", &v))
+	assert.NoError(t, m.Insert("bar", &v))
+
+	// Updating foo doesn't protect it from being evicted first
+	assert.NoError(t, m.Insert("foo", &v))
+	assert.NoError(t, m.Insert("baz", &v))
+	assert.ElementsMatch(t, []string{"bar", "baz"}, m.Keys())
+
+	assert.Panics(t, func() {
+		NewMap[int, int](WithMaxEntries(1), WithEvictionPolicy(NewLRUPolicy[string]))
+	})
+}
+
+func TestWithMaxEntries_NewMapFrom(t *testing.T) {
+	m := NewMapFrom(map[string]int{"foo": 1, "bar": 2}, WithMaxEntries(2))
+
+	v := 3
+	assert.NoError(t, m.Insert("baz", &v))
+	assert.Equal(t, 2, m.Len())
+	assert.Contains(t, m.Keys(), "baz")
+}
@@ -0,0 +1,42 @@
+package eventual
+
+import (
+	"expvar"
+)
+
+// expvarStats is the JSON object reported by the expvar.Var of a map.
+type expvarStats struct {
+	// Len is the number of keys including writes that haven't been refreshed,
+	// and VisibleLen is the number of keys visible to the readers.
+	Len        int `json:"len"`
+	VisibleLen int `json:"visible_len"`
+
+	Generation    uint64 `json:"generation"`
+	PendingWrites int    `json:"pending_writes"`
+	Readers       int    `json:"readers"`
+	Closed        bool   `json:"closed"`
+}
+
+// ExpvarVar returns an expvar.Var that reports the size, generation, pending
+// writes and number of readers of the map as a JSON object every time it's
+// read, so that the health of the map can be exposed on /debug/vars with
+// expvar.Publish("users", m.ExpvarVar()).
+func (m *Map[K, V]) ExpvarVar() expvar.Var {
+	return expvar.Func(func() any {
+		return m.expvarStats()
+	})
+}
+
+func (m *Map[K, V]) expvarStats() expvarStats {
+	m.lockWriter()
+	defer m.writeLock.Unlock()
+	readers := int(m.readerCount.Load())
+	return expvarStats{
+		Len:           len(*m.writable),
+		VisibleLen:    len(*m.readable),
+		Generation:    m.snapshot.generation,
+		PendingWrites: m.pendingWritesLocked(),
+		Readers:       readers,
+		Closed:        m.closed,
+	}
+}
@@ -0,0 +1,23 @@
+package eventual
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestMap_ExpvarVar(t *testing.T) {
+	m := NewMapFrom(map[string]int{"foo": 1})
+	v := m.ExpvarVar()
+	m.Reader()
+	m.Reader()
+	assert.JSONEq(t, `{"len":1,"visible_len":1,"generation":0,"pending_writes":0,"readers":2,"closed":false}`, v.String())
+
+	v2 := 2
+	assert.NoError(t, m.Insert("bar", &v2))
+	assert.JSONEq(t, `{"len":2,"visible_len":1,"generation":0,"pending_writes":1,"readers":2,"closed":false}`, v.String())
+	assert.NoError(t, m.Refresh())
+	assert.JSONEq(t, `{"len":2,"visible_len":2,"generation":1,"pending_writes":0,"readers":2,"closed":false}`, v.String())
+
+	assert.NoError(t, m.Close())
+	assert.JSONEq(t, `{"len":0,"visible_len":0,"generation":1,"pending_writes":0,"readers":0,"closed":true}`, v.String())
+}
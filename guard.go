@@ -0,0 +1,68 @@
+package eventual
+
+import (
+	"sync/atomic"
+)
+
+// ReadGuard pins the snapshot that a reader was looking at when the guard was
+// created. Every lookup performed through the guard observes the same
+// generation of the map until Release is called. Refresh waits for all guards
+// pinning the old readable map to be released, so guards should be short-lived.
+type ReadGuard[K comparable, V any] struct {
+	released uint32
+	r        *Reader[K, V]
+	s        *snapshot[K, V]
+}
+
+func (g *ReadGuard[K, V]) Get(key K) (*V, bool) {
+	v, ok := (*g.readable())[key]
+	g.r.read(ok)
+	return v, ok
+}
+
+func (g *ReadGuard[K, V]) Has(key K) bool {
+	_, ok := (*g.readable())[key]
+	g.r.read(ok)
+	return ok
+}
+
+// Len returns the number of keys in the pinned snapshot.
+func (g *ReadGuard[K, V]) Len() int {
+	return len(*g.readable())
+}
+
+// ForEach calls fn for every key and value in the pinned snapshot, stopping
+// early if fn returns false.
+func (g *ReadGuard[K, V]) ForEach(fn func(key K, value *V) bool) {
+	for k, v := range *g.readable() {
+		if !fn(k, v) {
+			return
+		}
+	}
+}
+
+// Generation returns the generation of the pinned snapshot.
+func (g *ReadGuard[K, V]) Generation() uint64 {
+	return g.s.generation
+}
+
+// Meta returns the meta value that was published along with the pinned snapshot.
+func (g *ReadGuard[K, V]) Meta() any {
+	return g.s.meta
+}
+
+// Release unpins the snapshot, allowing Refresh to modify it. The guard will
+// not be usable anymore and using it after release will result in a panic.
+// Release is safe to call multiple times.
+func (g *ReadGuard[K, V]) Release() {
+	if atomic.CompareAndSwapUint32(&g.released, 0, 1) {
+		g.r.exit(g.s)
+	}
+}
+
+func (g *ReadGuard[K, V]) readable() *map[K]*V {
+	if atomic.LoadUint32(&g.released) != 0 {
+		panic(ErrGuardReleased)
+	}
+	return g.s.m
+}
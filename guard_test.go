@@ -0,0 +1,60 @@
+package eventual
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestReadGuard(t *testing.T) {
+	m := NewMap[string, int]()
+	reader := m.Reader()
+	v := 1
+	m.Insert("foo", &v)
+	m.Refresh()
+
+	guard := reader.Guard()
+	assert.True(t, guard.Has("foo"))
+	assert.Equal(t, 1, guard.Len())
+	var keys []string
+	guard.ForEach(func(k string, _ *int) bool {
+		keys = append(keys, k)
+		return true
+	})
+	assert.Equal(t, []string{"foo"}, keys)
+
+	// Readers can still be used while a guard is held
+	assert.True(t, reader.Has("foo"))
+
+	done := make(chan struct{})
+	go func() {
+		m.Delete("foo")
+		m.Refresh()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("refresh shouldn't complete while a guard is held")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// The guard still observes the pinned generation
+	got, ok := guard.Get("foo")
+	assert.True(t, ok)
+	assert.Equal(t, v, *got)
+
+	guard.Release()
+	guard.Release()
+	<-done
+
+	assert.False(t, reader.Has("foo"))
+	assert.Panics(t, func() { guard.Has("foo") })
+
+	guard, err := reader.GuardErr()
+	assert.NoError(t, err)
+	guard.Release()
+	assert.NoError(t, reader.Close())
+	_, err = reader.GuardErr()
+	assert.ErrorIs(t, err, ErrReaderClosed)
+}
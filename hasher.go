@@ -0,0 +1,244 @@
+package eventual
+
+import (
+	"github.com/clarkmcc/go-evmap/pkg/oplog"
+)
+
+// HasherMap is a map that uses a caller-provided hash and equality function for
+// its keys instead of Go's built-in equality, which allows keys that are not
+// comparable, such as byte slices or structs containing slices, to be used.
+//
+// Under the hood the keys are bucketed by their hash in a regular Map, so a
+// HasherMap shares the refresh semantics of a Map, and its writes go through
+// the same oplog, overflow policy and write-ahead machinery. Buckets are never
+// modified after being inserted, instead writes replace the bucket with a
+// modified copy, so readers can safely scan a bucket without holding a pin.
+//
+// The buckets are stored in a Map rather than an open-addressed table of the
+// HasherMap's own because the oplog, refreshes, incremental replays and the
+// reader registry all operate on the built-in maps of a Map. A table of its own
+// would need a second copy of that machinery, like ValueMap, for a lookup that
+// only saves following the pointer to the bucket, since the built-in maps are
+// themselves open-addressed Swiss tables.
+type HasherMap[K any, V any] struct {
+	m     *Map[uint64, hashBucket[K, V]]
+	hash  func(K) uint64
+	equal func(a, b K) bool
+
+	// Copies values as they're inserted, or nil if values are stored as is
+	copy func(v *V) *V
+
+	// The number of keys across all buckets, protected by the map's write lock
+	len int
+}
+
+// hashBucket contains every key and value whose keys have the same hash.
+type hashBucket[K any, V any] []hashEntry[K, V]
+
+type hashEntry[K any, V any] struct {
+	key   K
+	value *V
+}
+
+// find returns the index of the key in the bucket, or -1 if it's not present.
+func (b *hashBucket[K, V]) find(key K, equal func(a, b K) bool) int {
+	if b == nil {
+		return -1
+	}
+	for i, e := range *b {
+		if equal(e.key, key) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Insert inserts the value into the map under the provided key.
+func (m *HasherMap[K, V]) Insert(key K, value *V) error {
+	m.m.lockForWrite()
+	defer m.m.writeLock.Unlock()
+	if m.m.closed {
+		return ErrClosed
+	}
+
+	h := m.hash(key)
+	old := (*m.m.writable)[h]
+	var b hashBucket[K, V]
+	i := old.find(key, m.equal)
+	if i >= 0 {
+		b = append(hashBucket[K, V](nil), *old...)
+		b[i].value = m.stored(value)
+	} else {
+		if old != nil {
+			b = append(b, *old...)
+		}
+		b = append(b, hashEntry[K, V]{key: key, value: m.stored(value)})
+	}
+	if err := m.m.pushLocked(oplog.Insert[uint64, *hashBucket[K, V]](h, &b)); err != nil {
+		return err
+	}
+	if i < 0 {
+		m.len++
+	}
+	m.m.metrics.Inserted(1)
+	m.m.writtenLocked()
+	return nil
+}
+
+// stored is the same as Map.stored but for the values of this map rather than
+// the buckets.
+func (m *HasherMap[K, V]) stored(v *V) *V {
+	if m.copy == nil || v == nil {
+		return v
+	}
+	return m.copy(v)
+}
+
+// Delete attempts to delete the key from the map and returns a boolean representing
+// whether the key existed.
+func (m *HasherMap[K, V]) Delete(key K) bool {
+	m.m.lockForWrite()
+	defer m.m.writeLock.Unlock()
+	if m.m.closed {
+		return false
+	}
+
+	h := m.hash(key)
+	old := (*m.m.writable)[h]
+	i := old.find(key, m.equal)
+	if i < 0 {
+		return false
+	}
+	e := oplog.Delete[uint64, *hashBucket[K, V]](h)
+	if len(*old) > 1 {
+		b := append(append(hashBucket[K, V](nil), (*old)[:i]...), (*old)[i+1:]...)
+		e = oplog.Insert[uint64, *hashBucket[K, V]](h, &b)
+	}
+	if m.m.pushLocked(e) != nil {
+		return false
+	}
+	m.len--
+	m.m.metrics.Deleted(1)
+	m.m.writtenLocked()
+	return true
+}
+
+// Get returns the value stored under the key, including writes that have not
+// been exposed to the readers yet.
+func (m *HasherMap[K, V]) Get(key K) (*V, bool) {
+	b, _ := m.m.Get(m.hash(key))
+	if i := b.find(key, m.equal); i >= 0 {
+		return (*b)[i].value, true
+	}
+	return nil, false
+}
+
+// Len returns the number of keys in the map, including writes that have not
+// been exposed to the readers yet.
+func (m *HasherMap[K, V]) Len() int {
+	m.m.writeLock.Lock()
+	defer m.m.writeLock.Unlock()
+	return m.len
+}
+
+// Clear removes all the keys from the map.
+func (m *HasherMap[K, V]) Clear() error {
+	m.m.lockForWrite()
+	defer m.m.writeLock.Unlock()
+	if m.m.closed {
+		return ErrClosed
+	}
+	if err := m.m.pushLocked(oplog.Clear[uint64, *hashBucket[K, V]]()); err != nil {
+		return err
+	}
+	m.len = 0
+	m.m.metrics.Cleared()
+	m.m.writtenLocked()
+	return nil
+}
+
+// Refresh exposes the current state of the map to the readers.
+func (m *HasherMap[K, V]) Refresh() error {
+	return m.m.Refresh()
+}
+
+// Close tears down the map, closing every reader created from it.
+func (m *HasherMap[K, V]) Close() error {
+	m.m.writeLock.Lock()
+	m.len = 0
+	m.m.writeLock.Unlock()
+	return m.m.Close()
+}
+
+// Reader creates and registers a new reader for the map.
+func (m *HasherMap[K, V]) Reader() *HasherReader[K, V] {
+	return &HasherReader[K, V]{m: m, r: m.m.Reader()}
+}
+
+// HasherReader reads from a HasherMap.
+type HasherReader[K any, V any] struct {
+	m *HasherMap[K, V]
+	r *Reader[uint64, hashBucket[K, V]]
+}
+
+func (r *HasherReader[K, V]) Get(key K) (*V, bool) {
+	b, _ := r.r.Get(r.m.hash(key))
+	if i := b.find(key, r.m.equal); i >= 0 {
+		return (*b)[i].value, true
+	}
+	return nil, false
+}
+
+func (r *HasherReader[K, V]) Has(key K) bool {
+	_, ok := r.Get(key)
+	return ok
+}
+
+// ForEach calls fn for every key and value visible to this reader, stopping
+// early if fn returns false. Like Reader.ForEach, the iteration is performed
+// against a single snapshot.
+func (r *HasherReader[K, V]) ForEach(fn func(key K, value *V) bool) {
+	r.r.ForEach(func(_ uint64, b *hashBucket[K, V]) bool {
+		for _, e := range *b {
+			if !fn(e.key, e.value) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// Len returns the number of keys visible to this reader.
+func (r *HasherReader[K, V]) Len() int {
+	n := 0
+	r.r.ForEach(func(_ uint64, b *hashBucket[K, V]) bool {
+		n += len(*b)
+		return true
+	})
+	return n
+}
+
+// Close removes the reader from the map.
+func (r *HasherReader[K, V]) Close() error {
+	return r.r.Close()
+}
+
+// NewMapWithHasher creates a new map whose keys are hashed and compared using
+// the provided functions. Keys that are equal must have the same hash.
+func NewMapWithHasher[K any, V any](hash func(K) uint64, equal func(a, b K) bool, opts ...OptionFunc) *HasherMap[K, V] {
+	options := newOptions(opts...)
+	copy := valueCopy[V](options)
+
+	// The value options apply to V rather than the buckets stored in the
+	// underlying map, and evicting buckets isn't supported.
+	options = options.withoutValueOptions()
+	options.MaxEntries = 0
+	r := make(map[uint64]*hashBucket[K, V], options.InitialCapacity)
+	w := make(map[uint64]*hashBucket[K, V], options.InitialCapacity)
+	return &HasherMap[K, V]{
+		m:     newMap(r, w, options),
+		hash:  hash,
+		equal: equal,
+		copy:  copy,
+	}
+}
@@ -0,0 +1,77 @@
+package eventual
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"hash/fnv"
+	"testing"
+)
+
+func TestHasherMap(t *testing.T) {
+	hash := func(key []byte) uint64 {
+		h := fnv.New64a()
+		h.Write(key)
+		return h.Sum64()
+	}
+	m := NewMapWithHasher[[]byte, int](hash, bytes.Equal)
+	reader := m.Reader()
+
+	v1, v2 := 1, 2
+	assert.NoError(t, m.Insert([]byte("foo"), &v1))
+	assert.NoError(t, m.Insert([]byte("bar"), &v2))
+	assert.Equal(t, 2, m.Len())
+	assert.False(t, reader.Has([]byte("foo")))
+
+	assert.NoError(t, m.Refresh())
+	got, ok := reader.Get([]byte("foo"))
+	assert.True(t, ok)
+	assert.Equal(t, v1, *got)
+	assert.Equal(t, 2, reader.Len())
+
+	// Overwriting a key doesn't add a new key
+	assert.NoError(t, m.Insert([]byte("foo"), &v2))
+	assert.Equal(t, 2, m.Len())
+	got, _ = m.Get([]byte("foo"))
+	assert.Equal(t, v2, *got)
+
+	assert.True(t, m.Delete([]byte("foo")))
+	assert.False(t, m.Delete([]byte("foo")))
+	assert.NoError(t, m.Refresh())
+	assert.False(t, reader.Has([]byte("foo")))
+	assert.True(t, reader.Has([]byte("bar")))
+
+	assert.NoError(t, m.Clear())
+	assert.NoError(t, m.Refresh())
+	assert.Equal(t, 0, reader.Len())
+	assert.Equal(t, 0, m.Len())
+}
+
+func TestHasherMap_collisions(t *testing.T) {
+	// Every key has the same hash
+	m := NewMapWithHasher[[]int, int](func([]int) uint64 { return 0 }, func(a, b []int) bool {
+		return len(a) == len(b) && (len(a) == 0 || a[0] == b[0])
+	})
+	reader := m.Reader()
+
+	for i := 0; i < 3; i++ {
+		v := i
+		assert.NoError(t, m.Insert([]int{i}, &v))
+	}
+	assert.NoError(t, m.Refresh())
+
+	// Deleting from a bucket mustn't affect the bucket that readers see
+	guard := reader.r.Guard()
+	assert.True(t, m.Delete([]int{1}))
+	b, _ := guard.Get(0)
+	assert.Len(t, *b, 3)
+	guard.Release()
+
+	assert.NoError(t, m.Refresh())
+	keys := 0
+	reader.ForEach(func(key []int, value *int) bool {
+		assert.Equal(t, key[0], *value)
+		keys++
+		return true
+	})
+	assert.Equal(t, 2, keys)
+}
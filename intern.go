@@ -0,0 +1,30 @@
+package eventual
+
+import (
+	"reflect"
+	"unique"
+	"unsafe"
+)
+
+// keyInterner returns the function that interns the keys of the map as
+// configured by the options, or nil if keys are stored as is. Only keys whose
+// type is a string type can be interned.
+func keyInterner[K comparable](o Options) func(key K) K {
+	if !o.InternKeys || reflect.TypeFor[K]().Kind() != reflect.String {
+		return nil
+	}
+	return func(key K) K {
+		// K's underlying type is string, so it has the same layout
+		s := unique.Make(*(*string)(unsafe.Pointer(&key))).Value()
+		return *(*K)(unsafe.Pointer(&s))
+	}
+}
+
+// storedKey returns the key that should be stored in the map when a value is
+// inserted under key, which is the interned key with WithKeyInterning.
+func (m *Map[K, V]) storedKey(key K) K {
+	if m.intern == nil {
+		return key
+	}
+	return m.intern(key)
+}
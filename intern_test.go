@@ -0,0 +1,64 @@
+package eventual
+
+import (
+	"github.com/stretchr/testify/assert"
+	"runtime"
+	"strings"
+	"testing"
+	"unique"
+	"unsafe"
+)
+
+func TestMap_KeyInterning(t *testing.T) {
+	m := NewMap[string, int](WithKeyInterning())
+	defer m.Close()
+	r := m.Reader()
+
+	// The handle keeps the interned copy of the key alive for the test
+	handle := unique.Make("foo")
+	interned := unsafe.StringData(handle.Value())
+
+	v := 1
+	body := "foo=bar"
+	assert.NoError(t, m.Insert(body[:3], &v))
+	assert.NoError(t, m.Refresh())
+	assert.NoError(t, m.InsertMany(map[string]*int{strings.Clone("foo"): &v}))
+	assert.NoError(t, m.Refresh())
+
+	for _, side := range []*map[string]*int{m.readable, m.writable} {
+		for k := range *side {
+			assert.Same(t, interned, unsafe.StringData(k))
+		}
+	}
+	got, ok := r.Get("foo")
+	assert.True(t, ok)
+	assert.Equal(t, &v, got)
+	runtime.KeepAlive(handle)
+}
+
+func TestNewMapFrom_KeyInterning(t *testing.T) {
+	handle := unique.Make("foo")
+	interned := unsafe.StringData(handle.Value())
+
+	m := NewMapFrom(map[string]int{strings.Clone("foo"): 1}, WithKeyInterning())
+	defer m.Close()
+	for _, side := range []*map[string]*int{m.readable, m.writable} {
+		for k := range *side {
+			assert.Same(t, interned, unsafe.StringData(k))
+		}
+	}
+	runtime.KeepAlive(handle)
+}
+
+func TestMap_KeyInterningKeyTypes(t *testing.T) {
+	type id string
+	named := NewMap[id, int](WithKeyInterning())
+	defer named.Close()
+	assert.NotNil(t, named.intern)
+	assert.Equal(t, id("foo"), named.intern("foo"))
+
+	// Keys that aren't strings are stored as is
+	ints := NewMap[int, int](WithKeyInterning())
+	defer ints.Close()
+	assert.Nil(t, ints.intern)
+}
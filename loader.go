@@ -0,0 +1,87 @@
+package eventual
+
+import (
+	"github.com/clarkmcc/go-evmap/pkg/oplog"
+)
+
+// load is a call to the map's loader that is in progress. Concurrent misses of
+// the same key wait for the same load instead of calling the loader again.
+type load[V any] struct {
+	done  chan struct{}
+	value *V
+	err   error
+}
+
+// GetOrLoad returns the value of the key that is visible to the reader. If the
+// key isn't visible, the value is loaded with the loader set by WithLoader and
+// inserted into the map. Like any other write, the loaded value becomes visible
+// to readers at the next refresh, but until then GetOrLoad returns it from the
+// writable map rather than loading it again. If the loader fails, its error is
+// returned and nothing is inserted.
+func (r *Reader[K, V]) GetOrLoad(key K) (*V, error) {
+	s, err := r.tryEnter()
+	if err != nil {
+		return nil, err
+	}
+	v, ok := (*s.m)[key]
+	r.exit(s)
+	if ok {
+		return v, nil
+	}
+	return r.m.load(key)
+}
+
+// load returns the value of the key from the writable map, loading it if it
+// doesn't exist. Only a single load of a key is in progress at a time.
+func (m *Map[K, V]) load(key K) (*V, error) {
+	m.loadsLock.Lock()
+	if l, ok := m.loads[key]; ok {
+		m.loadsLock.Unlock()
+		<-l.done
+		return l.value, l.err
+	}
+	l := &load[V]{done: make(chan struct{})}
+	if m.loads == nil {
+		m.loads = map[K]*load[V]{}
+	}
+	m.loads[key] = l
+	m.loadsLock.Unlock()
+
+	l.value, l.err = m.loadOnce(key)
+	m.loadsLock.Lock()
+	delete(m.loads, key)
+	m.loadsLock.Unlock()
+	close(l.done)
+	return l.value, l.err
+}
+
+// loadOnce performs the work of a single load.
+func (m *Map[K, V]) loadOnce(key K) (*V, error) {
+	// The key may have been loaded or written since the reader's snapshot
+	if v, ok := m.Get(key); ok {
+		return v, nil
+	}
+	if m.loader == nil {
+		return nil, ErrNoLoader
+	}
+
+	// The loader is called without holding the write lock so that a slow load
+	// doesn't block other writes.
+	v, err := m.loader(key)
+	if err != nil {
+		return nil, err
+	}
+
+	m.lockForWrite()
+	defer m.writeLock.Unlock()
+	if m.closed {
+		return nil, ErrClosed
+	}
+	v = m.stored(v)
+	if err := m.pushLocked(oplog.Insert(m.storedKey(key), v)); err != nil {
+		return nil, err
+	}
+	m.metrics.Inserted(1)
+	m.writtenLocked()
+	return v, nil
+}
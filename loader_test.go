@@ -0,0 +1,77 @@
+package eventual
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReader_GetOrLoad(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	m := NewMap[string, int](WithLoader(func(key string) (*int, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		if key == "bad" {
+			return nil, errors.New("bad key")
+		}
+		v := len(key)
+		return &v, nil
+	}))
+	reader := m.Reader()
+
+	// Concurrent misses share a single load
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := reader.GetOrLoad("foo")
+			assert.NoError(t, err)
+			assert.Equal(t, 3, *v)
+		}()
+	}
+	assert.Eventually(t, func() bool {
+		m.loadsLock.Lock()
+		defer m.loadsLock.Unlock()
+		return len(m.loads) == 1
+	}, time.Second, time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	// The loaded value is served from the writable map until the next refresh
+	calls = 0
+	v, err := reader.GetOrLoad("foo")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, *v)
+	assert.Equal(t, int32(0), calls)
+	assert.False(t, reader.Has("foo"))
+	assert.NoError(t, m.Refresh())
+	assert.True(t, reader.Has("foo"))
+
+	_, err = reader.GetOrLoad("bad")
+	assert.EqualError(t, err, "bad key")
+	_, ok := m.Get("bad")
+	assert.False(t, ok)
+}
+
+func TestReader_GetOrLoad_noLoader(t *testing.T) {
+	m := NewMap[string, int]()
+	reader := m.Reader()
+	_, err := reader.GetOrLoad("foo")
+	assert.ErrorIs(t, err, ErrNoLoader)
+
+	v := 1
+	assert.NoError(t, m.Insert("foo", &v))
+	got, err := reader.GetOrLoad("foo")
+	assert.NoError(t, err)
+	assert.Equal(t, &v, got)
+
+	assert.NoError(t, m.Close())
+	_, err = reader.GetOrLoad("foo")
+	assert.ErrorIs(t, err, ErrReaderClosed)
+}
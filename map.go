@@ -1,9 +1,13 @@
 package eventual
 
 import (
+	"context"
 	"github.com/clarkmcc/go-evmap/pkg/oplog"
+	"github.com/clarkmcc/go-evmap/pkg/wal"
+	"runtime"
 	"sync"
 	"sync/atomic"
+	"time"
 	"unsafe"
 )
 
@@ -30,9 +34,19 @@ type Map[K comparable, V any] struct {
 	// writer(s).
 	writable *map[K]*V
 
-	// A slice of references to every reader that we need to monitor
-	readers     []*Reader[K, V]
+	// Every reader that we need to monitor. Readers are registered and closed
+	// without holding the readers lock, which is only held by refreshes while
+	// they swap the readers' snapshots and wait on their pins, and by readers
+	// that are being frozen or unfrozen. readerIDs is the last ID that was
+	// handed to a reader.
+	readers     readerList[K, V]
 	readersLock sync.Mutex
+	readerIDs   atomic.Uint64
+
+	// The snapshot of m.readable that was most recently published to readers,
+	// and a copy of it that new readers can load without holding any lock
+	snapshot  *snapshot[K, V]
+	published atomic.Pointer[snapshot[K, V]]
 
 	// This should be acquired as soon as we swapLocked readable and writable pointers
 	// and should be released when we can prove that all readers are now looking
@@ -41,7 +55,142 @@ type Map[K comparable, V any] struct {
 
 	// Used for replicating writes to m.writable after it's just been swapped
 	// from m.readable
-	oplog *oplog.Log[K, V]
+	oplog *oplog.Log[K, *V]
+
+	// Signaled whenever a refresh replays the oplog, or the map is closed, to
+	// wake up the writers that are blocked on a full oplog
+	oplogRoom *sync.Cond
+
+	// The options that were used to create this map
+	options Options
+
+	// Receives the operations performed on the map, which are counted by stats
+	// for Stats before being forwarded to the configured MetricsCollector
+	metrics MetricsCollector
+	stats   *statsCollector
+
+	// Receives the lookups made by readers, or nil if the metrics collector
+	// doesn't implement ReadMetricsCollector
+	reads ReadMetricsCollector
+
+	// Compares values for operations like CompareAndSwap
+	equal func(a, b *V) bool
+
+	// Copies values as they're inserted, or nil if values are stored as is
+	copy func(v *V) *V
+
+	// Interns keys as they're inserted, or nil if keys are stored as is
+	intern func(key K) K
+
+	// Chooses the keys to evict when the map is bounded, or nil if it isn't
+	eviction EvictionPolicy[K]
+
+	// Loads missing keys for GetOrLoad, or nil if the map isn't read-through,
+	// and the loads that are in progress by key.
+	loader    func(key K) (*V, error)
+	loads     map[K]*load[V]
+	loadsLock sync.Mutex
+
+	// The write handles created by WriteHandle, the function that merges their
+	// writes, and the number of writes buffered by the handles that haven't been
+	// merged yet.
+	handles      []*WriteHandle[K, V]
+	resolve      func(existing, incoming HandleWrite[K, V]) HandleWrite[K, V]
+	handleWrites atomic.Int64
+
+	// Recycles the storage of removed values, or nil if the map wasn't created
+	// with WithValueRecycling. retiring are the values removed since the last
+	// refresh, and retired are the values whose removal has been published,
+	// which are recycled once both maps have been synced and no reader is
+	// frozen.
+	free     *valueFreelist[V]
+	retiring []*V
+	retired  []*V
+
+	// Scratch space for the values that may be removed by a write
+	removable []removableValue[K, V]
+
+	// Hands out empty maps to replace the cleared maps, or nil if the keys of
+	// the cleared maps are deleted
+	pool *mapPool[K, V]
+
+	// Hands published writes to the write-behind sink, or nil if there isn't one
+	writeBehind *writeBehind[K, V]
+
+	// The write-ahead log that every write is appended to before it's applied,
+	// or nil if the map isn't durable, the path of the log, and the last error
+	// appending to it or checkpointing it.
+	wal     *wal.Log
+	walPath string
+	walErr  error
+
+	// The meta value that will be published with the next Refresh
+	meta any
+
+	// The channels returned by Watch, by the key that they're watching
+	watchers map[K][]chan Change[K, V]
+
+	// The channels returned by Subscribe
+	subscribers []chan RefreshEvent
+
+	// The changefeeds created by Changefeed
+	feeds []*Changefeed[K, V]
+
+	// The changes of the most recent refreshes, oldest first, for Diff
+	diffs []generationChanges[K]
+
+	// index, if set, is called by every refresh to build an immutable index of
+	// the map that is published alongside the new snapshot.
+	index func() any
+
+	// unsynced is true when a refresh has swapped the maps but gave up waiting
+	// for the readers to leave the old readable map before syncing it, or left
+	// that to a background goroutine because of WithAsyncRefresh. The writable
+	// map is stale until the sync is finished. syncer is true while the
+	// goroutine that finishes the sync is running.
+	unsynced bool
+	syncer   bool
+
+	// replaying is true while an incremental refresh is replaying the oplog to
+	// the writable map. The first replayBacklog entries of the oplog have been
+	// published but not replayed yet, and they're followed by the entries of
+	// the writes made during the replay, the first replayApplied of which have
+	// been applied. replayer is true while the goroutine that continues the
+	// replay is running.
+	replaying     bool
+	replayBacklog int
+	replayApplied int
+	replayer      bool
+
+	// The number of writes applied to the writable map since the last refresh
+	// without being pushed to the oplog because of WithReaderlessWrites, in
+	// which case the next refresh copies the whole map instead of replaying the
+	// oplog, and the number of registered readers that haven't been closed.
+	unlogged    int
+	readerCount atomic.Int64
+
+	// shrinkRequested is set by ShrinkToFit until the next refresh rebuilds the
+	// writable map, and shrinkPending is set until the other map is rebuilt
+	// once it's synced.
+	shrinkRequested bool
+	shrinkPending   bool
+
+	// closed is true once Close has been called. It's protected by both the
+	// write lock and the readers lock, so holding either is enough to read it.
+	// readersClosed is set by Close before it closes the registered readers,
+	// so that readers registered concurrently can close themselves.
+	closed        bool
+	readersClosed atomic.Bool
+
+	// The time of the last refresh and the timer of the coalesced refresh that
+	// is waiting for the end of the coalesce window, if any.
+	lastRefresh   time.Time
+	coalesceTimer Timer
+
+	// done is closed by Close to stop the map's background goroutines, and
+	// background tracks those goroutines so that Close can wait for them.
+	done       chan struct{}
+	background sync.WaitGroup
 }
 
 // swapLocked takes the pointers to the readable and writable maps and swaps them
@@ -62,91 +211,1068 @@ func (m *Map[K, V]) swapLocked() {
 // that is least up to date (the map pointed to by m.readable before the swapLocked)
 // to be switched to writer mode. After performing the swapLocked, we want to replicate
 // of our writes syncLocked the previous syncLocked to the map that is now (after the swapLocked)
-// pointed to by m.writable.
+// pointed to by m.writable. With WithIncrementalRefresh, the replay is only
+// started, and the writable map is stale until it's finished.
 func (m *Map[K, V]) syncLocked() {
+	if m.unlogged > 0 {
+		m.copyReadableLocked()
+		return
+	}
+	if m.incrementalLocked() {
+		if m.options.CompactOplog {
+			m.oplog.Compact()
+		}
+		m.startReplayLocked()
+		return
+	}
+
 	// Clear the oplog after the syncLocked because we don't want to re-apply the same
 	// operations more than once.
 	defer m.oplog.Clear()
 
 	// Apply the operations from the oplog to the map currently pointed to by
 	// m.writable.
+	if m.options.CompactOplog {
+		m.oplog.Compact()
+	}
 	m.oplog.Apply(m.writable)
+	m.syncedLocked()
 }
 
 // Refresh exposes the current state of the map to the readers. Under the hood
 // refreshing causes the readable and writable maps to be swapped and the new
 // writable map to be synced with the old writable map (now m.readable) using
 // an internal oplog.
-func (m *Map[K, V]) Refresh() {
+func (m *Map[K, V]) Refresh() error {
 	// Writers should be unable to apply writes to the map while we're getting up
 	// to syncLocked. This same lock protects the oplog from being modified since all
 	// modifications to this map are also applied to the oplog.
 	m.writeLock.Lock()
 	defer m.writeLock.Unlock()
 
+	if m.options.RefreshCoalesceWindow > 0 {
+		return m.coalesceRefreshLocked()
+	}
+
+	// Without a deadline the refresh can only fail if the map is closed
+	return m.refreshLocked(context.Background())
+}
+
+// RefreshAndWait is like Refresh but gives up waiting for readers that are
+// still reading from the old readable map when the context is done, in which
+// case the context's error is returned. The readers have already been moved to
+// the new snapshot at that point, but the oplog can't be replayed until the
+// lagging readers finish their reads, so the next write or refresh blocks until
+// they do. A nil error means that every reader has moved to the new snapshot
+// and the oplog has been fully replayed, even with WithAsyncRefresh.
+func (m *Map[K, V]) RefreshAndWait(ctx context.Context) error {
+	m.writeLock.Lock()
+	defer m.writeLock.Unlock()
+	if err := m.refreshLocked(ctx); err != nil {
+		return err
+	}
+	ctx, cancel := m.refreshContext(ctx)
+	defer cancel()
+	return m.waitPendingLocked(ctx)
+}
+
+// refreshLocked performs the work of Refresh and must only be called while
+// holding the write lock.
+func (m *Map[K, V]) refreshLocked(ctx context.Context) (err error) {
+	ctx, cancel := m.refreshContext(ctx)
+	defer cancel()
+	m.labeled(ctx, refreshLabels, func(ctx context.Context) {
+		err = m.publishLocked(ctx)
+	})
+	m.oplogRoom.Broadcast()
+	if err == nil {
+		m.checkLocked("refresh")
+	}
+	return err
+}
+
+// publishLocked publishes the writes to the readers and syncs the writable map,
+// and must only be called by refreshLocked.
+func (m *Map[K, V]) publishLocked(ctx context.Context) (err error) {
+	if m.closed {
+		return ErrClosed
+	}
+	ctx, span := m.options.Tracer.Start(ctx, "evmap.Refresh")
+	defer func() { span.End(err) }()
+
+	// A previous refresh may have given up waiting for the readers, in which case
+	// we have to finish that refresh before we can start this one.
+	if err := m.syncPendingLocked(ctx); err != nil {
+		return err
+	}
+	if err := m.mergeHandlesLocked(); err != nil {
+		return err
+	}
+	m.shrinkBeforeSwapLocked()
+
+	// The readers lock prevents readers from being frozen or unfrozen while
+	// we're swapping their pointers and waiting on their pins. Readers that are
+	// registered in the meantime load the published snapshot themselves.
+	m.readersLock.Lock()
+	start := time.Now()
+	m.lastRefresh = m.options.Clock.Now()
+
 	// Swap the readable and writable maps globally. This only swaps the pointers
 	// in this data structure, but does not touch any of the readers.
 	m.swapLocked()
+	m.retired = append(m.retired, m.retiring...)
+	clear(m.retiring)
+	m.retiring = m.retiring[:0]
+	old := m.snapshot
+	m.snapshot = newSnapshot(m.readable, 1-old.side, old.generation+1, m.meta)
+	span.SetAttribute("evmap.generation", int64(m.snapshot.generation))
+	writes := m.oplog.Len() + m.unlogged
+	span.SetAttribute("evmap.writes", int64(writes))
+	if m.index != nil {
+		m.snapshot.index = m.index()
+	}
+
+	// The previously visible map isn't modified until it's synced below, so
+	// it's safe to compare against.
+	m.notifyWatchersLocked(m.writable, m.readable, m.snapshot.generation)
+	m.notifyFeedsLocked(m.writable, m.readable, m.snapshot.generation)
+	if m.writeBehind != nil && m.oplog.Len() > 0 {
+		m.writeBehind.push(m.oplog.Entries())
+	}
+	m.notifySubscribersLocked(RefreshEvent{
+		Generation: m.snapshot.generation,
+		Writes:     writes,
+		Len:        len(*m.readable),
+		Time:       m.lastRefresh,
+	})
 
-	// Swap each reader's readable pointer with the new readable pointer
-	for _, r := range m.readers {
-		r.swapReadable(m.readable)
+	// Swap each reader's snapshot pointer with the new snapshot pointer. Frozen
+	// readers are looking at a private copy so they can be left alone. Readers
+	// that are registered after the snapshot has been published aren't
+	// necessarily in the list yet, but they start reading from it.
+	m.published.Store(m.snapshot)
+	for r := range m.readers.all() {
+		if !r.frozen {
+			r.swapSnapshot(m.snapshot)
+		}
+	}
+
+	// Wake up anyone waiting for the old snapshot to be replaced
+	close(old.replaced)
+
+	// The readers are already looking at the new snapshot, so the rest of the
+	// refresh can be left to the first writer or the background goroutine that
+	// gets the write lock.
+	if m.options.AsyncRefresh {
+		m.readersLock.Unlock()
+		m.unsynced = true
+		m.metrics.Refreshed(time.Since(start), writes)
+		m.metrics.ReplicationLag(0)
+		m.startSyncLocked()
+		return nil
+	}
+
+	// Some readers may still be in the middle of a read against the old readable
+	// map, so wait for all of them to leave it before we modify it.
+	err = m.waitLaggingLocked(ctx, old.side)
+	m.readers.pruneLocked()
+	m.metrics.Readers(int(m.readerCount.Load()))
+	m.readersLock.Unlock()
+	if err != nil {
+		m.unsynced = true
+		return err
 	}
 
 	// We can assume at this point that all readers are now looking at the new
 	// readable map which means the writable map is safe to perform writes against.
 	m.syncLocked()
+	m.metrics.Refreshed(time.Since(start), writes)
+	m.metrics.ReplicationLag(0)
+	return nil
 }
 
-func (m *Map[K, V]) Reader() *Reader[K, V] {
+// syncPendingLocked finishes a refresh that previously gave up waiting for the
+// readers by waiting for them again and then syncing the writable map, and
+// finishes the incremental replay of the oplog, if one is in progress. This
+// must be called while holding the write lock.
+func (m *Map[K, V]) syncPendingLocked(ctx context.Context) error {
+	if err := m.waitPendingLocked(ctx); err != nil {
+		return err
+	}
+	m.finishReplayLocked()
+	return nil
+}
+
+// waitPendingLocked is like syncPendingLocked but leaves an incremental replay
+// of the oplog in progress.
+func (m *Map[K, V]) waitPendingLocked(ctx context.Context) error {
+	if !m.unsynced {
+		return nil
+	}
 	m.readersLock.Lock()
-	defer m.readersLock.Unlock()
-	r := NewReader(m)
-	m.readers = append(m.readers, r)
-	return r
+	err := m.waitLaggingLocked(ctx, 1-m.snapshot.side)
+	m.readersLock.Unlock()
+	if err != nil {
+		return err
+	}
+	m.unsynced = false
+	m.syncLocked()
+	return nil
+}
+
+// lockWriter acquires the write lock and makes sure that the writable map is
+// up-to-date and safe to modify before returning.
+func (m *Map[K, V]) lockWriter() {
+	m.writeLock.Lock()
+
+	// Without a deadline this can't fail
+	_ = m.syncPendingLocked(context.Background())
 }
 
-func (m *Map[K, V]) Insert(key K, value *V) {
+// lockAppender is like lockWriter but leaves an incremental replay of the oplog
+// in progress, for writes that only push entries to the oplog without
+// inspecting the writable map. Their entries are queued behind the replay.
+func (m *Map[K, V]) lockAppender() {
 	m.writeLock.Lock()
+
+	// Without a deadline this can't fail
+	_ = m.waitPendingLocked(context.Background())
+}
+
+// waitReadersLocked blocks until no reader has the given side of the map pinned,
+// or until the context is done. Any read that starts after the readers' snapshots
+// have been swapped is guaranteed to be performed against the new readable map,
+// so readers can't starve us by continuously pinning the old side. This must be
+// called while holding the readers lock.
+func (m *Map[K, V]) waitReadersLocked(ctx context.Context, side uint8) error {
+	for r := range m.readers.all() {
+		for !r.detached && r.pinned(side) {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			default:
+				runtime.Gosched()
+			}
+		}
+	}
+	return nil
+}
+
+// writtenLocked must be called after every modification to the map, while still
+// holding the write lock. It automatically refreshes the map if the number of
+// writes since the last refresh has reached the configured maximum replication
+// write lag.
+func (m *Map[K, V]) writtenLocked() {
+	m.evictLocked()
+	lag := m.oplog.Len() + m.unlogged
+	m.metrics.ReplicationLag(lag)
+	if m.options.MaxReplicationWriteLag > 0 && lag >= m.options.MaxReplicationWriteLag || m.oplogFullLocked() {
+		_ = m.refreshLocked(context.Background())
+	}
+	m.checkLocked("write")
+}
+
+// evictLocked deletes the keys chosen by the eviction policy until the map is
+// within its maximum number of entries. This must be called while holding the
+// write lock.
+func (m *Map[K, V]) evictLocked() {
+	if m.eviction == nil {
+		return
+	}
+	for len(*m.writable) > m.options.MaxEntries {
+		key, ok := m.eviction.Victim()
+		if !ok {
+			return
+		}
+		if err := m.pushUncheckedLocked(oplog.Delete[K, *V](key)); err != nil {
+			return
+		}
+		m.metrics.Deleted(1)
+	}
+}
+
+// pushLocked appends the entries of a single write to the write-ahead log, if
+// the map has one, and then pushes them to the oplog and applies them to the
+// writable map. Nothing is applied if the entries can't be appended to the log.
+// This must be called while holding the write lock. Writes that don't fit in an
+// oplog bounded by WithMaxOplogSize fail with ErrOplogFull.
+func (m *Map[K, V]) pushLocked(entries ...*oplog.Entry[K, *V]) error {
+	if err := m.checkOplogLocked(len(entries)); err != nil {
+		return err
+	}
+	return m.pushUncheckedLocked(entries...)
+}
+
+// pushUncheckedLocked is like pushLocked but ignores the maximum size of the
+// oplog, for writes that the map makes on its own such as evictions.
+func (m *Map[K, V]) pushUncheckedLocked(entries ...*oplog.Entry[K, *V]) error {
+	if m.wal != nil || m.free != nil {
+		// Recording operations, checkpointing and finding the values that are
+		// removed all need the writable map
+		m.finishReplayLocked()
+	}
+	if m.wal != nil {
+		if err := m.appendWALLocked(entries); err != nil {
+			m.walErr = err
+			return err
+		}
+	}
+	for _, e := range entries {
+		if m.free != nil {
+			m.removable = m.removableLocked(e, m.removable[:0])
+		}
+		if m.replaying {
+			m.oplog.Push(e)
+		} else if m.unloggedLocked() {
+			m.oplog.ApplyEntry(e, m.writable)
+			m.unlogged++
+		} else {
+			m.oplog.PushAndApply(e, m.writable)
+		}
+		if m.free != nil {
+			m.retireLocked(m.removable)
+			clear(m.removable)
+		}
+	}
+	if m.wal != nil {
+		m.checkpointIfFullLocked()
+	}
+	return nil
+}
+
+// Reader registers and returns a new reader for the map. Registering a reader
+// doesn't take any lock, so readers can be created and closed on hot paths
+// such as request handlers without contending with each other or waiting for
+// a refresh.
+func (m *Map[K, V]) Reader() *Reader[K, V] {
+	r := &Reader[K, V]{readerState: &readerState[K, V]{m: m, id: m.readerIDs.Add(1), reads: m.reads}}
+	m.stats.created.Add(1)
+	m.metrics.Readers(int(m.readerCount.Add(1)))
+	m.readers.push(r.readerState)
+	r.cleanup = runtime.AddCleanup(r, (*readerState[K, V]).abandon, r.readerState)
+
+	// A refresh that publishes a new snapshot after it has been loaded here
+	// swaps the reader's snapshot because the reader is already in the list,
+	// in which case the loaded snapshot is stale and mustn't be stored.
+	atomic.CompareAndSwapPointer(&r.snapshot, nil, unsafe.Pointer(m.published.Load()))
+
+	// Close may have closed the registered readers before this reader was in the
+	// list. Hand out a closed reader so that reads fail the same way they do for
+	// readers that were registered before the map was closed.
+	if m.readersClosed.Load() {
+		r.close()
+	}
+	return r
+}
+
+func (m *Map[K, V]) Insert(key K, value *V) error {
+	m.lockForAppend()
 	defer m.writeLock.Unlock()
+	if m.closed {
+		return ErrClosed
+	}
 
 	// This is a map modification so push the insert to the oplog and then apply
 	// the same modification to the map itself
-	m.oplog.PushAndApply(oplog.Insert[K, V](key, value), m.writable)
+	if err := m.pushLocked(oplog.Insert[K, *V](m.storedKey(key), m.stored(value))); err != nil {
+		return err
+	}
+	m.metrics.Inserted(1)
+	m.writtenLocked()
+	return nil
+}
+
+// MergeFrom inserts every key and value from src into the map in a single locked
+// pass. When a key already exists in the writable map, resolve is called with
+// the existing and incoming values and its result is inserted instead. A nil
+// resolve function means that incoming values always win. The merge is recorded
+// as a single oplog entry.
+func (m *Map[K, V]) MergeFrom(src map[K]*V, resolve func(key K, existing, incoming *V) *V) error {
+	m.lockForWrite()
+	defer m.writeLock.Unlock()
+	if m.closed {
+		return ErrClosed
+	}
+
+	merged := make(map[K]*V, len(src))
+	for k, incoming := range src {
+		if existing, ok := (*m.writable)[k]; ok && resolve != nil {
+			merged[k] = resolve(k, existing, incoming)
+		} else {
+			merged[k] = incoming
+		}
+	}
+	if err := m.pushLocked(oplog.InsertMany[K, *V](m.storedMany(merged))); err != nil {
+		return err
+	}
+	m.metrics.Inserted(len(merged))
+	m.writtenLocked()
+	return nil
+}
+
+// Swap inserts the value under the key and returns the value that was previously
+// stored under the key in the writable map, along with a boolean representing
+// whether the key existed. This lets writers clean up resources held by values
+// that were replaced. A write that fails is reported as if the key didn't exist,
+// use SwapErr to tell the two apart.
+func (m *Map[K, V]) Swap(key K, value *V) (*V, bool) {
+	previous, ok, _ := m.SwapErr(key, value)
+	return previous, ok
+}
+
+// SwapErr is like Swap but returns the error when the value can't be inserted,
+// such as ErrClosed or ErrOplogFull.
+func (m *Map[K, V]) SwapErr(key K, value *V) (*V, bool, error) {
+	m.lockForWrite()
+	defer m.writeLock.Unlock()
+	if m.closed {
+		return nil, false, ErrClosed
+	}
+
+	previous, ok := (*m.writable)[key]
+	if err := m.pushLocked(oplog.Insert[K, *V](m.storedKey(key), m.stored(value))); err != nil {
+		return nil, false, err
+	}
+	m.metrics.Inserted(1)
+	m.writtenLocked()
+	return previous, ok, nil
+}
+
+// InsertMany inserts every key and value from the provided map. The write lock
+// is acquired once and the inserts are recorded as a single oplog entry, which
+// makes this much cheaper than calling Insert for every key during bulk loads.
+func (m *Map[K, V]) InsertMany(entries map[K]*V) (err error) {
+	_, span := m.options.Tracer.Start(context.Background(), "evmap.InsertMany")
+	defer func() { span.End(err) }()
+	span.SetAttribute("evmap.keys", int64(len(entries)))
+
+	m.lockForAppend()
+	defer m.writeLock.Unlock()
+	if m.closed {
+		return ErrClosed
+	}
+
+	if err := m.pushLocked(oplog.InsertMany[K, *V](m.storedMany(entries))); err != nil {
+		return err
+	}
+	m.metrics.Inserted(len(entries))
+	m.writtenLocked()
+	return nil
 }
 
 // Delete attempts to delete the key from the map and returns a boolean representing
-// whether the key existed.
+// whether the key existed. A delete that fails is reported as if the key didn't
+// exist, use DeleteErr to tell the two apart.
 func (m *Map[K, V]) Delete(key K) bool {
-	m.writeLock.Lock()
+	ok, _ := m.DeleteErr(key)
+	return ok
+}
+
+// DeleteErr is like Delete but returns the error when the key can't be deleted,
+// such as ErrClosed or ErrOplogFull.
+func (m *Map[K, V]) DeleteErr(key K) (bool, error) {
+	m.lockForWrite()
 	defer m.writeLock.Unlock()
+	if m.closed {
+		return false, ErrClosed
+	}
 
 	// Check if the key exists before applying the deletion for obvious reasons
 	_, ok := (*m.writable)[key]
 
 	// This is a map modification so push the insert to the oplog and then apply
 	// the same modification to the map itself
-	m.oplog.PushAndApply(oplog.Delete[K, V](key), m.writable)
-	return ok
+	if err := m.pushLocked(oplog.Delete[K, *V](key)); err != nil {
+		return false, err
+	}
+	if ok {
+		m.metrics.Deleted(1)
+	}
+	m.writtenLocked()
+	return ok, nil
+}
+
+// Pop deletes the key from the map and returns the value that it held in the
+// writable map, along with a boolean representing whether the key existed. A
+// delete that fails is reported as if the key didn't exist, use PopErr to tell
+// the two apart.
+func (m *Map[K, V]) Pop(key K) (*V, bool) {
+	v, ok, _ := m.PopErr(key)
+	return v, ok
+}
+
+// PopErr is like Pop but returns the error when the key can't be deleted, such
+// as ErrClosed or ErrOplogFull.
+func (m *Map[K, V]) PopErr(key K) (*V, bool, error) {
+	m.lockForWrite()
+	defer m.writeLock.Unlock()
+	if m.closed {
+		return nil, false, ErrClosed
+	}
+
+	v, ok := (*m.writable)[key]
+	if !ok {
+		return nil, false, nil
+	}
+	if err := m.pushLocked(oplog.Delete[K, *V](key)); err != nil {
+		return nil, false, err
+	}
+	m.metrics.Deleted(1)
+	m.writtenLocked()
+	return v, true, nil
+}
+
+// DeleteMany deletes every provided key from the map and returns the number of
+// distinct keys that existed. Like InsertMany, the write lock is acquired once
+// and the deletes are recorded as a single oplog entry.
+func (m *Map[K, V]) DeleteMany(keys []K) int {
+	m.lockForWrite()
+	defer m.writeLock.Unlock()
+	if m.closed {
+		return 0
+	}
+
+	// Only the keys that exist need to be replicated, and only once each
+	existing := make([]K, 0, len(keys))
+	seen := make(map[K]struct{}, len(keys))
+	for _, k := range keys {
+		if _, ok := seen[k]; ok {
+			continue
+		}
+		seen[k] = struct{}{}
+		if _, ok := (*m.writable)[k]; ok {
+			existing = append(existing, k)
+		}
+	}
+	if len(existing) == 0 {
+		return 0
+	}
+	if err := m.pushLocked(oplog.DeleteMany[K, *V](existing)); err != nil {
+		return 0
+	}
+	m.metrics.Deleted(len(existing))
+	m.writtenLocked()
+	return len(existing)
+}
+
+// Retain removes every key and value from the map for which keep returns false.
+// The removals are recorded as a single oplog entry containing the removed keys,
+// so keep is only called once per key and doesn't need to be deterministic.
+func (m *Map[K, V]) Retain(keep func(key K, value *V) bool) error {
+	m.lockForWrite()
+	defer m.writeLock.Unlock()
+	if m.closed {
+		return ErrClosed
+	}
+
+	var removed []K
+	for k, v := range *m.writable {
+		if !keep(k, v) {
+			removed = append(removed, k)
+		}
+	}
+	if len(removed) == 0 {
+		return nil
+	}
+	if err := m.pushLocked(oplog.DeleteMany[K, *V](removed)); err != nil {
+		return err
+	}
+	m.metrics.Deleted(len(removed))
+	m.writtenLocked()
+	return nil
 }
 
 // Clear removes all the keys from the map. Under-the-hood this function does
 // not change the map pointer.
-func (m *Map[K, V]) Clear() {
+func (m *Map[K, V]) Clear() error {
+	m.lockForAppend()
+	defer m.writeLock.Unlock()
+	if m.closed {
+		return ErrClosed
+	}
+
+	if err := m.pushLocked(oplog.Clear[K, *V]()); err != nil {
+		return err
+	}
+	m.metrics.Cleared()
+	m.writtenLocked()
+	return nil
+}
+
+// Update atomically reads the current value of the key from the writable map,
+// passes it to fn, and inserts the value returned by fn under the key. The ok
+// argument to fn reports whether the key existed.
+func (m *Map[K, V]) Update(key K, fn func(old *V, ok bool) *V) error {
+	m.lockForWrite()
+	defer m.writeLock.Unlock()
+	if m.closed {
+		return ErrClosed
+	}
+
+	old, ok := (*m.writable)[key]
+	if err := m.pushLocked(oplog.Insert[K, *V](m.storedKey(key), m.stored(fn(old, ok)))); err != nil {
+		return err
+	}
+	m.metrics.Inserted(1)
+	m.writtenLocked()
+	return nil
+}
+
+// GetOrInsert returns the existing value of the key from the writable map if
+// the key exists. Otherwise, it inserts the provided value and returns it. The
+// boolean result is true if the value already existed and false if it was
+// inserted. A value that can't be inserted, such as on a closed map, is
+// reported as a nil value that wasn't loaded, use GetOrInsertErr to tell the
+// two apart.
+func (m *Map[K, V]) GetOrInsert(key K, value *V) (*V, bool) {
+	got, loaded, _ := m.GetOrInsertErr(key, value)
+	return got, loaded
+}
+
+// GetOrInsertErr is like GetOrInsert but returns the error when the value
+// can't be inserted, such as ErrClosed or ErrOplogFull.
+func (m *Map[K, V]) GetOrInsertErr(key K, value *V) (*V, bool, error) {
+	m.lockForWrite()
+	defer m.writeLock.Unlock()
+	if m.closed {
+		return nil, false, ErrClosed
+	}
+
+	if existing, ok := (*m.writable)[key]; ok {
+		return existing, true, nil
+	}
+	value = m.stored(value)
+	if err := m.pushLocked(oplog.Insert[K, *V](m.storedKey(key), value)); err != nil {
+		return nil, false, err
+	}
+	m.metrics.Inserted(1)
+	m.writtenLocked()
+	return value, false, nil
+}
+
+// CompareAndSwap inserts the new value under the key only if the key currently
+// holds a value equal to old in the writable map, and reports whether the swap
+// was performed. Values are compared using the function configured with
+// WithValueEqual, or by pointer identity by default. A swap that fails is
+// reported as not performed, use CompareAndSwapErr to tell the two apart.
+func (m *Map[K, V]) CompareAndSwap(key K, old, new *V) bool {
+	swapped, _ := m.CompareAndSwapErr(key, old, new)
+	return swapped
+}
+
+// CompareAndSwapErr is like CompareAndSwap but returns the error when the new
+// value can't be inserted, such as ErrClosed or ErrOplogFull.
+func (m *Map[K, V]) CompareAndSwapErr(key K, old, new *V) (bool, error) {
+	m.lockForWrite()
+	defer m.writeLock.Unlock()
+	if m.closed {
+		return false, ErrClosed
+	}
+
+	existing, ok := (*m.writable)[key]
+	if !ok || !m.equal(existing, old) {
+		return false, nil
+	}
+	if err := m.pushLocked(oplog.Insert[K, *V](m.storedKey(key), m.stored(new))); err != nil {
+		return false, err
+	}
+	m.metrics.Inserted(1)
+	m.writtenLocked()
+	return true, nil
+}
+
+// CompareAndDelete deletes the key only if it currently holds a value equal to
+// old in the writable map, and reports whether the key was deleted. Values are
+// compared the same way as in CompareAndSwap. A delete that fails is reported
+// as not performed, use CompareAndDeleteErr to tell the two apart.
+func (m *Map[K, V]) CompareAndDelete(key K, old *V) bool {
+	deleted, _ := m.CompareAndDeleteErr(key, old)
+	return deleted
+}
+
+// CompareAndDeleteErr is like CompareAndDelete but returns the error when the
+// key can't be deleted, such as ErrClosed or ErrOplogFull.
+func (m *Map[K, V]) CompareAndDeleteErr(key K, old *V) (bool, error) {
+	m.lockForWrite()
+	defer m.writeLock.Unlock()
+	if m.closed {
+		return false, ErrClosed
+	}
+
+	existing, ok := (*m.writable)[key]
+	if !ok || !m.equal(existing, old) {
+		return false, nil
+	}
+	if err := m.pushLocked(oplog.Delete[K, *V](key)); err != nil {
+		return false, err
+	}
+	m.metrics.Deleted(1)
+	m.writtenLocked()
+	return true, nil
+}
+
+// Replace atomically replaces the entire contents of the map with the provided
+// contents. The replacement is recorded as a clear followed by a bulk insert so
+// readers observe either the old contents or the new contents, never a mix of
+// the two, once the next Refresh happens.
+func (m *Map[K, V]) Replace(contents map[K]*V) error {
+	m.lockForAppend()
+	defer m.writeLock.Unlock()
+	if m.closed {
+		return ErrClosed
+	}
+
+	if err := m.pushLocked(oplog.Clear[K, *V](), oplog.InsertMany[K, *V](m.storedMany(contents))); err != nil {
+		return err
+	}
+	m.metrics.Cleared()
+	m.metrics.Inserted(len(contents))
+	m.writtenLocked()
+	return nil
+}
+
+// SetMeta sets a meta value, such as the source version or timestamp of the
+// data, that becomes visible to readers together with the data at the next
+// Refresh, similar to the meta value in Rust's evmap.
+func (m *Map[K, V]) SetMeta(meta any) error {
+	m.lockWriter()
+	defer m.writeLock.Unlock()
+	if m.closed {
+		return ErrClosed
+	}
+	m.meta = meta
+	return nil
+}
+
+// Get returns the value stored under the key in the writable map. Unlike the
+// readers, Get observes writes that have not been exposed by Refresh yet.
+func (m *Map[K, V]) Get(key K) (*V, bool) {
+	m.lockWriter()
+	defer m.writeLock.Unlock()
+	v, ok := (*m.writable)[key]
+	return v, ok
+}
+
+// Len returns the number of keys in the writable map, which includes writes
+// that have not been exposed to the readers yet.
+func (m *Map[K, V]) Len() int {
+	m.lockWriter()
+	defer m.writeLock.Unlock()
+	return len(*m.writable)
+}
+
+// Keys returns the keys in the writable map, including writes that have not been
+// exposed to the readers yet. The order of the keys is unspecified.
+func (m *Map[K, V]) Keys() []K {
+	m.lockWriter()
+	defer m.writeLock.Unlock()
+	keys := make([]K, 0, len(*m.writable))
+	for k := range *m.writable {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// Values returns the values in the writable map, including writes that have not
+// been exposed to the readers yet. The order of the values is unspecified.
+func (m *Map[K, V]) Values() []*V {
+	m.lockWriter()
+	defer m.writeLock.Unlock()
+	values := make([]*V, 0, len(*m.writable))
+	for _, v := range *m.writable {
+		values = append(values, v)
+	}
+	return values
+}
+
+// Range calls fn for every key and value in the writable map, stopping early if
+// fn returns false. The write lock is held for the duration of the iteration, so
+// fn must not modify the map or it will deadlock.
+func (m *Map[K, V]) Range(fn func(key K, value *V) bool) {
+	m.lockWriter()
+	defer m.writeLock.Unlock()
+	for k, v := range *m.writable {
+		if !fn(k, v) {
+			return
+		}
+	}
+}
+
+// Snapshot returns a copy of the writable map, including writes that have not
+// been exposed to the readers yet, as a plain Go map. The values are copied out
+// of their pointers and nil values are returned as the zero value of V.
+func (m *Map[K, V]) Snapshot() map[K]V {
+	m.lockWriter()
+	defer m.writeLock.Unlock()
+	return copyValues(*m.writable)
+}
+
+// Clone creates an independent map seeded from the current state of the writable
+// map, including writes that have not been exposed to the readers yet. The clone
+// has its own readers and oplog, and readers of the clone observe the seeded
+// state immediately without needing a Refresh. The values themselves are not
+// copied, so both maps share the same value pointers.
+func (m *Map[K, V]) Clone() *Map[K, V] {
+	m.lockWriter()
+	defer m.writeLock.Unlock()
+
+	r := make(map[K]*V, len(*m.writable))
+	w := make(map[K]*V, len(*m.writable))
+	for k, v := range *m.writable {
+		r[k] = v
+		w[k] = v
+	}
+	return newMap(r, w, m.options)
+}
+
+// Generation returns the number of times the map has been refreshed. Readers
+// that have observed the latest refresh report the same generation from
+// Reader.Generation.
+func (m *Map[K, V]) Generation() uint64 {
+	m.writeLock.Lock()
+	defer m.writeLock.Unlock()
+	return m.snapshot.generation
+}
+
+// PendingWrites returns the number of oplog entries that have been written since
+// the last refresh and are not visible to the readers yet. Batched writes such as
+// InsertMany are counted as a single entry, and every write buffered by a write
+// handle is counted individually.
+func (m *Map[K, V]) PendingWrites() int {
+	m.writeLock.Lock()
+	defer m.writeLock.Unlock()
+	return m.pendingWritesLocked()
+}
+
+// PendingEntries returns the oplog entries of the writes that will be published
+// by the next refresh, in the order they were written, the last of which is the
+// latest write. Writes buffered by write handles aren't in the oplog until the
+// next refresh merges them, so they're not returned. Entries are immutable and
+// are described by their accessors, such as Type, Key and HasValue. Writes that
+// skipped the oplog because of WithReaderlessWrites aren't returned either.
+func (m *Map[K, V]) PendingEntries() []*oplog.Entry[K, *V] {
+	m.writeLock.Lock()
+	defer m.writeLock.Unlock()
+
+	// Like in pendingWritesLocked, the oplog of a refresh that is waiting to be
+	// synced only contains writes that have already been published
+	if m.unsynced {
+		return nil
+	}
+	return m.oplog.Entries()[m.replayBacklog:]
+}
+
+// Dirty reports whether there are writes that are not visible to the readers yet.
+func (m *Map[K, V]) Dirty() bool {
+	return m.PendingWrites() > 0
+}
+
+// isClosed reports whether the map has been closed.
+func (m *Map[K, V]) isClosed() bool {
 	m.writeLock.Lock()
 	defer m.writeLock.Unlock()
+	return m.closed
+}
+
+// pendingWritesLocked returns the number of unpublished oplog entries and
+// writes buffered by write handles. If a refresh is waiting to be synced then
+// the oplog contains writes that have already been published, and nothing else
+// can have been written to it since. During an incremental replay, the oplog
+// starts with the published writes that haven't been replayed yet.
+func (m *Map[K, V]) pendingWritesLocked() int {
+	n := int(m.handleWrites.Load())
+	if !m.unsynced {
+		n += m.oplog.Len() - m.replayBacklog + m.unlogged
+	}
+	return n
+}
+
+// Close tears down the map. Every registered reader is closed, background
+// goroutines are stopped, and the contents of the map and the oplog are cleared.
+// After Close, writes that return an error return ErrClosed, writes that report
+// a result behave as if the map were empty, and new readers are created closed.
+// Calling Close more than once returns ErrClosed.
+func (m *Map[K, V]) Close() error {
+	m.writeLock.Lock()
+	if m.closed {
+		m.writeLock.Unlock()
+		return ErrClosed
+	}
+	m.readersLock.Lock()
+	m.closed = true
+	m.readersClosed.Store(true)
+	close(m.done)
+	m.oplogRoom.Broadcast()
+	m.closeWatchersLocked()
+	m.closeSubscribersLocked()
+	m.closeFeedsLocked()
+	m.closeHandlesLocked()
+	if m.coalesceTimer != nil {
+		m.coalesceTimer.Stop()
+	}
+
+	// Close the readers and wait for any in-flight reads against either map to
+	// finish before clearing them.
+	for r := range m.readers.all() {
+		r.close()
+	}
+	_ = m.waitReadersLocked(context.Background(), 0)
+	_ = m.waitReadersLocked(context.Background(), 1)
+	m.readers.clear()
+	m.readersLock.Unlock()
+
+	clear(*m.readable)
+	clear(*m.writable)
+	m.oplog.Clear()
+	m.unsynced = false
+	m.replaying = false
+	m.replayBacklog, m.replayApplied = 0, 0
+	m.unlogged = 0
+	m.shrinkRequested, m.shrinkPending = false, false
+	m.retiring, m.retired = nil, nil
+	var err error
+	if m.wal != nil {
+		err = m.wal.Close()
+	}
+	m.writeLock.Unlock()
 
-	m.oplog.PushAndApply(oplog.Clear[K, V](), m.writable)
+	// Background goroutines may need the write lock to notice that the map has
+	// been closed, so wait for them after releasing it.
+	m.background.Wait()
+	return err
 }
 
 // NewMap creates a new Map of the given type with the provided options.
-func NewMap[K comparable, V any]() *Map[K, V] {
-	r := make(map[K]*V)
-	w := make(map[K]*V)
-	return &Map[K, V]{
-		readable: &r,
-		writable: &w,
-		readers:  []*Reader[K, V]{},
-		oplog:    oplog.NewLog[K, V](),
+func NewMap[K comparable, V any](opts ...OptionFunc) *Map[K, V] {
+	options := newOptions(opts...)
+	r := make(map[K]*V, options.InitialCapacity)
+	w := make(map[K]*V, options.InitialCapacity)
+	return newMap(r, w, options)
+}
+
+// NewMapFrom creates a new Map populated with the keys and values from src. Both
+// internal maps are populated directly without going through the oplog, and
+// readers observe the data immediately without needing a Refresh, which makes
+// warm starts from a snapshot cheap. The values are stored the same way as
+// inserted ones, so they're copied with WithValueCopy and their keys are
+// interned with WithKeyInterning.
+func NewMapFrom[K comparable, V any](src map[K]V, opts ...OptionFunc) *Map[K, V] {
+	options := newOptions(opts...)
+	r := make(map[K]*V, max(len(src), options.InitialCapacity))
+	w := make(map[K]*V, max(len(src), options.InitialCapacity))
+	m := newMap(r, w, options)
+
+	// The background goroutines may already be running, so the maps are
+	// populated under the write lock
+	m.writeLock.Lock()
+	defer m.writeLock.Unlock()
+	for k, v := range src {
+		k, stored := m.storedKey(k), m.stored(&v)
+		(*m.readable)[k] = stored
+		(*m.writable)[k] = stored
+		if m.eviction != nil {
+			m.eviction.Inserted(k)
+		}
+	}
+	return m
+}
+
+// newMap creates a new Map using the provided maps as the readable and writable
+// maps, which must have the same contents.
+func newMap[K comparable, V any](r, w map[K]*V, options Options) *Map[K, V] {
+	if options.ShardCount > 1 {
+		panic("eventual: WithShardCount is only supported by NewShardedMap")
+	}
+	m := &Map[K, V]{}
+	m.init(r, w, options)
+	return m
+}
+
+// init initializes a zero Map in place using the provided maps as the readable
+// and writable maps, which must have the same contents.
+func (m *Map[K, V]) init(r, w map[K]*V, options Options) {
+	m.readable = &r
+	m.writable = &w
+	m.snapshot = newSnapshot(&r, 0, 0, nil)
+	m.published.Store(m.snapshot)
+	m.oplog = oplog.NewLog[K, *V]()
+	if options.EntryTimestamps {
+		m.oplog.SetClock(options.Clock.Now)
+	}
+	m.oplogRoom = sync.NewCond(&m.writeLock)
+	m.options = options
+	m.stats = &statsCollector{next: options.Metrics}
+	m.metrics = m.stats
+	m.reads, _ = options.Metrics.(ReadMetricsCollector)
+	m.equal = valueEqual[V](options)
+	m.copy = valueCopy[V](options)
+	m.intern = keyInterner[K](options)
+	m.eviction = evictionPolicy[K](options)
+	m.loader = loader[K, V](options)
+	m.resolve = conflictResolver[K, V](options)
+	m.done = make(chan struct{})
+	if m.eviction != nil {
+		// The policy has to know about the keys that the map starts with
+		for k := range w {
+			m.eviction.Inserted(k)
+		}
+		m.oplog.SetObserver(m.eviction)
+	}
+	if options.AutoRefreshInterval > 0 {
+		m.background.Add(1)
+		go m.autoRefresh(options.AutoRefreshInterval)
+	}
+	if options.PooledClears {
+		m.pool = newMapPool[K, V](options.InitialCapacity)
+		m.oplog.SetClearFunc(m.pool.empty)
+		m.background.Add(1)
+		go m.recycleMaps()
+	}
+	if sink := writeBehindSink[K, V](options); sink != nil {
+		m.writeBehind = newWriteBehind(sink)
+		m.background.Add(1)
+		go m.runWriteBehind()
+	} else if options.RecycleValues {
+		// The sink may still be reading the values after they're removed
+		m.free = &valueFreelist[V]{}
+	}
+}
+
+// stored returns the value that should be stored in the map when v is inserted,
+// which is a copy of v if the map was created with WithValueCopy.
+func (m *Map[K, V]) stored(v *V) *V {
+	if m.free != nil && v != nil {
+		return m.free.copy(v)
+	}
+	if m.copy == nil || v == nil {
+		return v
+	}
+	return m.copy(v)
+}
+
+// storedMany is like stored but for every value in the provided map.
+func (m *Map[K, V]) storedMany(entries map[K]*V) map[K]*V {
+	if m.copy == nil && m.free == nil && m.intern == nil {
+		return entries
+	}
+	c := make(map[K]*V, len(entries))
+	for k, v := range entries {
+		c[m.storedKey(k)] = m.stored(v)
+	}
+	return c
+}
+
+// copyValues copies the provided map into a map of plain values. Nil values are
+// copied as the zero value of V.
+func copyValues[K comparable, V any](m map[K]*V) map[K]V {
+	c := make(map[K]V, len(m))
+	for k, v := range m {
+		if v != nil {
+			c[k] = *v
+		} else {
+			var zero V
+			c[k] = zero
+		}
 	}
+	return c
 }
@@ -39,6 +39,7 @@ func BenchmarkReads(b *testing.B) {
 		m.Refresh()
 
 		// Read from the map
+		b.ReportAllocs()
 		b.ResetTimer()
 		for i := 0; i < b.N; i++ {
 			reader.Get(i)
@@ -98,6 +99,15 @@ func BenchmarkWrites(b *testing.B) {
 	b.Run("evmap", func(b *testing.B) {
 		m := NewMap[int, int]()
 
+		// Fill the map
+		b.ResetTimer()
+		for i := 0; i < 1_000_000; i++ {
+			m.Insert(i, &i)
+		}
+	})
+	b.Run("evmap-presized", func(b *testing.B) {
+		m := NewMap[int, int](WithInitialCapacity(1_000_000))
+
 		// Fill the map
 		b.ResetTimer()
 		for i := 0; i < 1_000_000; i++ {
@@ -183,8 +193,170 @@ func (t *stdMap) Get(key int) (*int, bool) {
 	return v, ok
 }
 
+func (t *stdMap) Delete(key int) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	delete(t.m, key)
+}
+
+func (t *stdMap) Clear() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	clear(t.m)
+}
+
+// Snapshot copies the keys and values of the map.
+func (t *stdMap) Snapshot() map[int]int {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	s := make(map[int]int, len(t.m))
+	for k, v := range t.m {
+		s[k] = *v
+	}
+	return s
+}
+
 func newStdMap() *stdMap {
 	return &stdMap{
 		m: map[int]*int{},
 	}
 }
+
+func BenchmarkValueMapReads(b *testing.B) {
+	m := NewValueMap[int, int]()
+	reader := m.Reader()
+
+	// Fill the map
+	for i := 0; i < 1_000_000; i++ {
+		m.Insert(i, i)
+	}
+
+	// Expose the writes to the readers
+	m.Refresh()
+
+	// Read from the map
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		reader.Get(i)
+	}
+}
+
+func BenchmarkChurnRefresh(b *testing.B) {
+	churn := func(b *testing.B, m *Map[int, int]) {
+		for i := 0; i < b.N; i++ {
+			for j := 0; j < 10_000; j++ {
+				v := j
+				m.Insert(j%100, &v)
+			}
+			m.Refresh()
+		}
+	}
+	b.Run("evmap", func(b *testing.B) {
+		churn(b, NewMap[int, int]())
+	})
+	b.Run("evmap-compacted", func(b *testing.B) {
+		churn(b, NewMap[int, int](WithOplogCompaction()))
+	})
+}
+
+func BenchmarkClearRefresh(b *testing.B) {
+	entries := make(map[int]*int, 100_000)
+	for i := 0; i < 100_000; i++ {
+		v := i
+		entries[i] = &v
+	}
+	clearRefresh := func(b *testing.B, m *Map[int, int]) {
+		defer m.Close()
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			m.InsertMany(entries)
+			m.Refresh()
+			b.StartTimer()
+			m.Clear()
+			m.Refresh()
+		}
+	}
+	b.Run("evmap", func(b *testing.B) {
+		clearRefresh(b, NewMap[int, int]())
+	})
+	b.Run("evmap-pooled", func(b *testing.B) {
+		clearRefresh(b, NewMap[int, int](WithPooledClears()))
+	})
+}
+
+func BenchmarkSteadyStateWrites(b *testing.B) {
+	b.Run("evmap", func(b *testing.B) {
+		m := NewMap[int, int]()
+		values := make([]int, 1000)
+		for i := range values {
+			values[i] = i
+			m.Insert(i, &values[i])
+		}
+		m.Refresh()
+		m.Refresh()
+
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			m.Insert(i%1000, &values[i%1000])
+			if i%1000 == 999 {
+				m.Refresh()
+			}
+		}
+	})
+	b.Run("valuemap", func(b *testing.B) {
+		m := NewValueMap[int, int]()
+		for i := 0; i < 1000; i++ {
+			m.Insert(i, i)
+		}
+		m.Refresh()
+		m.Refresh()
+
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			m.Insert(i%1000, i)
+			if i%1000 == 999 {
+				m.Refresh()
+			}
+		}
+	})
+}
+
+func BenchmarkLargeValueChurn(b *testing.B) {
+	type large [64]int64
+	churn := func(b *testing.B, m *Map[int, large]) {
+		defer m.Close()
+		var v large
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			v[0] = int64(i)
+			m.Insert(i%1000, &v)
+			if i%1000 == 999 {
+				m.Refresh()
+			}
+		}
+	}
+	b.Run("evmap-copied", func(b *testing.B) {
+		churn(b, NewMap[int, large](WithValueCopy(func(v *large) *large {
+			c := *v
+			return &c
+		})))
+	})
+	b.Run("evmap-recycled", func(b *testing.B) {
+		churn(b, NewMap[int, large](WithValueRecycling()))
+	})
+}
+
+func BenchmarkParallelReaderRegistration(b *testing.B) {
+	m := NewMap[int, int]()
+	defer m.Close()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			r := m.Reader()
+			r.Get(0)
+			r.Close()
+		}
+	})
+}
@@ -1,8 +1,13 @@
 package eventual
 
 import (
+	"context"
+	"github.com/clarkmcc/go-evmap/pkg/oplog"
 	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestMap(t *testing.T) {
@@ -97,3 +102,642 @@ func TestMap_sync(t *testing.T) {
 	m.syncLocked()
 	assert.Len(t, *m.writable, 1, "the new writable has been synced with the old writable and should have the inserted value")
 }
+
+func TestMap_MaxReplicationWriteLag(t *testing.T) {
+	m := NewMap[string, any](WithMaxReplicationWriteLag(2))
+	reader := m.Reader()
+
+	m.Insert("foo", nil)
+	assert.False(t, reader.Has("foo"), "the map shouldn't refresh before reaching the write lag")
+
+	m.Insert("bar", nil)
+	assert.True(t, reader.Has("foo"), "the map should refresh after reaching the write lag")
+	assert.True(t, reader.Has("bar"))
+	assert.Equal(t, 0, m.oplog.Len(), "the oplog should be empty after the automatic refresh")
+}
+
+func TestMap_RefreshWaitsForReaders(t *testing.T) {
+	m := NewMap[string, any]()
+	reader := m.Reader()
+
+	// Simulate a read that is in progress against the current readable map
+	s := reader.enter()
+
+	m.Insert("foo", nil)
+	done := make(chan struct{})
+	go func() {
+		m.Refresh()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("refresh shouldn't complete while a read is in progress")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// The in-flight read must not observe the oplog being replayed
+	assert.Len(t, *s.m, 0)
+
+	reader.exit(s)
+	<-done
+	assert.True(t, reader.Has("foo"))
+}
+
+func TestMap_ConcurrentReadsAndRefreshes(t *testing.T) {
+	m := NewMap[int, int]()
+	done := make(chan struct{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		reader := m.Reader()
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+					reader.Get(rand.Intn(100))
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < 1000; i++ {
+		v := i
+		m.Insert(i%100, &v)
+		if i%10 == 0 {
+			m.Refresh()
+		}
+	}
+	close(done)
+	wg.Wait()
+}
+
+func TestMap_Len(t *testing.T) {
+	m := NewMap[string, any]()
+	assert.Equal(t, 0, m.Len())
+
+	m.Insert("foo", nil)
+	m.Insert("bar", nil)
+	assert.Equal(t, 2, m.Len(), "the length should include unpublished writes")
+
+	m.Refresh()
+	m.Delete("foo")
+	assert.Equal(t, 1, m.Len())
+}
+
+func TestMap_Get(t *testing.T) {
+	m := NewMap[string, int]()
+	reader := m.Reader()
+
+	v := 1
+	m.Insert("foo", &v)
+	got, ok := m.Get("foo")
+	assert.True(t, ok, "the writer should see its own unpublished writes")
+	assert.Equal(t, v, *got)
+	assert.False(t, reader.Has("foo"))
+
+	m.Delete("foo")
+	_, ok = m.Get("foo")
+	assert.False(t, ok)
+}
+
+func TestMap_Update(t *testing.T) {
+	m := NewMap[string, int]()
+	reader := m.Reader()
+
+	increment := func(old *int, ok bool) *int {
+		v := 1
+		if ok {
+			v += *old
+		}
+		return &v
+	}
+	m.Update("foo", increment)
+	m.Update("foo", increment)
+	m.Update("foo", increment)
+
+	got, _ := m.Get("foo")
+	assert.Equal(t, 3, *got)
+
+	m.Refresh()
+	got, _ = reader.Get("foo")
+	assert.Equal(t, 3, *got)
+	assert.Equal(t, 3, *(*m.writable)["foo"], "the update should have been replicated to the new writable map")
+}
+
+func TestMap_GetOrInsert(t *testing.T) {
+	m := NewMap[string, int]()
+	v1, v2 := 1, 2
+
+	got, loaded := m.GetOrInsert("foo", &v1)
+	assert.False(t, loaded)
+	assert.Equal(t, &v1, got)
+
+	got, loaded = m.GetOrInsert("foo", &v2)
+	assert.True(t, loaded)
+	assert.Equal(t, &v1, got, "the existing value should be returned")
+	assert.Equal(t, 1, m.oplog.Len(), "nothing should be written when the key exists")
+}
+
+func TestMap_CompareAndSwap(t *testing.T) {
+	t.Run("pointer identity", func(t *testing.T) {
+		m := NewMap[string, int]()
+		v1, v2, v3 := 1, 2, 1
+		m.Insert("foo", &v1)
+
+		assert.False(t, m.CompareAndSwap("bar", nil, &v2), "missing keys can't be swapped")
+		assert.False(t, m.CompareAndSwap("foo", &v3, &v2), "equal values with different pointers aren't the same")
+		assert.True(t, m.CompareAndSwap("foo", &v1, &v2))
+
+		got, _ := m.Get("foo")
+		assert.Equal(t, &v2, got)
+	})
+	t.Run("custom equality", func(t *testing.T) {
+		m := NewMap[string, int](WithValueEqual(func(a, b *int) bool {
+			return a != nil && b != nil && *a == *b
+		}))
+		v1, v2, v3 := 1, 2, 1
+		m.Insert("foo", &v1)
+
+		assert.True(t, m.CompareAndSwap("foo", &v3, &v2))
+		got, _ := m.Get("foo")
+		assert.Equal(t, &v2, got)
+	})
+	t.Run("mismatched types", func(t *testing.T) {
+		assert.Panics(t, func() {
+			NewMap[string, int](WithValueEqual(func(a, b *string) bool { return true }))
+		})
+	})
+}
+
+func TestMap_CompareAndDelete(t *testing.T) {
+	m := NewMap[string, int]()
+	v1, v2 := 1, 2
+	m.Insert("foo", &v1)
+
+	assert.False(t, m.CompareAndDelete("bar", &v1))
+	assert.False(t, m.CompareAndDelete("foo", &v2))
+	assert.Equal(t, 1, m.Len())
+
+	assert.True(t, m.CompareAndDelete("foo", &v1))
+	assert.Equal(t, 0, m.Len())
+}
+
+func TestMap_InsertMany(t *testing.T) {
+	m := NewMap[string, int]()
+	reader := m.Reader()
+	v1, v2 := 1, 2
+
+	m.InsertMany(map[string]*int{"foo": &v1, "bar": &v2})
+	assert.Equal(t, 2, m.Len())
+	assert.Equal(t, 1, m.oplog.Len(), "the inserts should be recorded as a single entry")
+
+	m.Refresh()
+	assert.ElementsMatch(t, []string{"foo", "bar"}, reader.Keys())
+	assert.Len(t, *m.writable, 2)
+}
+
+func TestMap_DeleteMany(t *testing.T) {
+	m := NewMap[string, any]()
+	reader := m.Reader()
+	m.Insert("foo", nil)
+	m.Insert("bar", nil)
+	m.Insert("baz", nil)
+	m.Refresh()
+
+	assert.Equal(t, 2, m.DeleteMany([]string{"foo", "bar", "qux"}))
+	assert.Equal(t, 1, m.oplog.Len(), "the deletes should be recorded as a single entry")
+	assert.Equal(t, 0, m.DeleteMany([]string{"qux"}))
+	assert.Equal(t, 1, m.oplog.Len(), "nothing should be recorded when no keys exist")
+
+	m.Refresh()
+	assert.Equal(t, []string{"baz"}, reader.Keys())
+	assert.Len(t, *m.writable, 1)
+
+	// Repeated keys are only counted once
+	assert.Equal(t, 1, m.DeleteMany([]string{"baz", "baz", "baz"}))
+	assert.Equal(t, uint64(3), m.Stats().Deletes)
+	assert.Equal(t, 1, m.oplog.Len())
+}
+
+func TestMap_Pop(t *testing.T) {
+	m := NewMap[string, int]()
+	reader := m.Reader()
+	v := 1
+	m.Insert("foo", &v)
+	m.Refresh()
+
+	got, ok := m.Pop("foo")
+	assert.True(t, ok)
+	assert.Equal(t, &v, got)
+	assert.True(t, reader.Has("foo"), "readers shouldn't see the pop before refresh")
+
+	got, ok = m.Pop("foo")
+	assert.False(t, ok)
+	assert.Nil(t, got)
+
+	m.Refresh()
+	assert.False(t, reader.Has("foo"))
+}
+
+func TestMap_Swap(t *testing.T) {
+	m := NewMap[string, int]()
+	v1, v2 := 1, 2
+
+	previous, ok := m.Swap("foo", &v1)
+	assert.False(t, ok)
+	assert.Nil(t, previous)
+
+	previous, ok = m.Swap("foo", &v2)
+	assert.True(t, ok)
+	assert.Equal(t, &v1, previous)
+
+	got, _ := m.Get("foo")
+	assert.Equal(t, &v2, got)
+}
+
+func TestMap_Retain(t *testing.T) {
+	m := NewMap[int, int]()
+	reader := m.Reader()
+	for i := 0; i < 10; i++ {
+		v := i
+		m.Insert(i, &v)
+	}
+	m.Refresh()
+
+	m.Retain(func(key int, value *int) bool {
+		return *value%2 == 0
+	})
+	assert.Equal(t, 5, m.Len())
+	assert.Equal(t, 1, m.oplog.Len(), "the removals should be recorded as a single entry")
+
+	m.Refresh()
+	assert.ElementsMatch(t, []int{0, 2, 4, 6, 8}, reader.Keys())
+	assert.Len(t, *m.writable, 5)
+}
+
+func TestMap_MergeFrom(t *testing.T) {
+	sum := func(key string, existing, incoming *int) *int {
+		v := *existing + *incoming
+		return &v
+	}
+	one, two, three := 1, 2, 3
+
+	t.Run("resolve", func(t *testing.T) {
+		m := NewMap[string, int]()
+		m.Insert("foo", &one)
+		m.MergeFrom(map[string]*int{"foo": &two, "bar": &three}, sum)
+
+		foo, _ := m.Get("foo")
+		bar, _ := m.Get("bar")
+		assert.Equal(t, 3, *foo)
+		assert.Equal(t, &three, bar)
+	})
+	t.Run("incoming wins", func(t *testing.T) {
+		m := NewMap[string, int]()
+		m.Insert("foo", &one)
+		m.MergeFrom(map[string]*int{"foo": &two}, nil)
+
+		foo, _ := m.Get("foo")
+		assert.Equal(t, &two, foo)
+	})
+}
+
+func TestMap_Replace(t *testing.T) {
+	m := NewMap[string, any]()
+	reader := m.Reader()
+	m.Insert("foo", nil)
+	m.Insert("bar", nil)
+	m.Refresh()
+
+	m.Replace(map[string]*any{"baz": nil})
+	assert.ElementsMatch(t, []string{"foo", "bar"}, reader.Keys(), "readers shouldn't see the replacement before refresh")
+
+	m.Refresh()
+	assert.Equal(t, []string{"baz"}, reader.Keys())
+	assert.Len(t, *m.writable, 1)
+}
+
+func TestMap_Clone(t *testing.T) {
+	m := NewMap[string, any](WithMaxReplicationWriteLag(100))
+	m.Insert("foo", nil)
+	m.Refresh()
+	m.Insert("bar", nil)
+
+	clone := m.Clone()
+	reader := clone.Reader()
+	assert.ElementsMatch(t, []string{"foo", "bar"}, reader.Keys(), "the clone should include unpublished writes")
+	assert.Equal(t, 0, clone.oplog.Len())
+	assert.Len(t, clone.openReaders(), 1, "the clone shouldn't share readers with the original")
+	assert.Equal(t, m.options, clone.options)
+
+	// Writes to either map are independent
+	clone.Delete("foo")
+	m.Insert("baz", nil)
+	assert.Equal(t, 1, clone.Len())
+	assert.Equal(t, 3, m.Len())
+}
+
+func TestMap_Snapshot(t *testing.T) {
+	m := NewMap[string, int]()
+	reader := m.Reader()
+	v := 1
+	m.Insert("foo", &v)
+	m.Insert("bar", nil)
+
+	assert.Equal(t, map[string]int{"foo": 1, "bar": 0}, m.Snapshot())
+	assert.Empty(t, reader.Snapshot())
+
+	m.Refresh()
+	snapshot := reader.Snapshot()
+	assert.Equal(t, map[string]int{"foo": 1, "bar": 0}, snapshot)
+
+	// Modifying the snapshot doesn't affect the map
+	snapshot["foo"] = 2
+	assert.Equal(t, 1, *(*m.readable)["foo"])
+}
+
+func TestMap_KeysValuesRange(t *testing.T) {
+	m := NewMap[string, int]()
+	v1, v2 := 1, 2
+	m.Insert("foo", &v1)
+	m.Insert("bar", &v2)
+
+	assert.ElementsMatch(t, []string{"foo", "bar"}, m.Keys())
+	assert.ElementsMatch(t, []*int{&v1, &v2}, m.Values())
+
+	got := map[string]*int{}
+	m.Range(func(key string, value *int) bool {
+		got[key] = value
+		return true
+	})
+	assert.Equal(t, map[string]*int{"foo": &v1, "bar": &v2}, got)
+
+	calls := 0
+	m.Range(func(key string, value *int) bool {
+		calls++
+		return false
+	})
+	assert.Equal(t, 1, calls)
+}
+
+func TestNewMapFrom(t *testing.T) {
+	m := NewMapFrom(map[string]int{"foo": 1, "bar": 2})
+	reader := m.Reader()
+	assert.Equal(t, map[string]int{"foo": 1, "bar": 2}, reader.Snapshot(), "readers should see the data without a refresh")
+	assert.Equal(t, 0, m.oplog.Len())
+
+	m.Delete("foo")
+	m.Refresh()
+	assert.Equal(t, map[string]int{"bar": 2}, reader.Snapshot())
+	assert.Len(t, *m.writable, 1)
+}
+
+func TestNewMapFrom_ValueCopy(t *testing.T) {
+	// The seeded values are copied like inserted ones
+	copies := 0
+	m := NewMapFrom(map[string]int{"foo": 1}, WithValueCopy(func(v *int) *int {
+		copies++
+		c := *v
+		return &c
+	}))
+	defer m.Close()
+	assert.Equal(t, 1, copies)
+	assert.Equal(t, map[string]int{"foo": 1}, m.Reader().Snapshot())
+}
+
+func TestMap_RefreshAndWait(t *testing.T) {
+	m := NewMap[string, any]()
+	reader := m.Reader()
+
+	t.Run("success", func(t *testing.T) {
+		m.Insert("foo", nil)
+		assert.NoError(t, m.RefreshAndWait(context.Background()))
+		assert.True(t, reader.Has("foo"))
+		assert.Len(t, *m.writable, 1)
+		assert.Equal(t, 0, m.oplog.Len())
+	})
+	t.Run("stuck reader", func(t *testing.T) {
+		s := reader.enter()
+
+		m.Insert("bar", nil)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		assert.ErrorIs(t, m.RefreshAndWait(ctx), context.DeadlineExceeded)
+
+		// New reads observe the new snapshot even though the refresh gave up
+		assert.True(t, reader.Has("bar"))
+
+		// Writes block until the stuck reader leaves the old map
+		done := make(chan struct{})
+		go func() {
+			m.Insert("baz", nil)
+			close(done)
+		}()
+		select {
+		case <-done:
+			t.Fatal("writes shouldn't complete while the old map is pinned")
+		case <-time.After(50 * time.Millisecond):
+		}
+		assert.Len(t, *s.m, 1, "the pinned map must not be modified")
+
+		reader.exit(s)
+		<-done
+		assert.ElementsMatch(t, []string{"foo", "bar", "baz"}, m.Keys())
+
+		m.Refresh()
+		assert.ElementsMatch(t, []string{"foo", "bar", "baz"}, reader.Keys())
+	})
+}
+
+func TestMap_PendingWrites(t *testing.T) {
+	m := NewMap[string, any]()
+	reader := m.Reader()
+	assert.False(t, m.Dirty())
+
+	m.Insert("foo", nil)
+	m.Insert("bar", nil)
+	assert.Equal(t, 2, m.PendingWrites())
+	assert.True(t, m.Dirty())
+
+	m.Refresh()
+	assert.Equal(t, 0, m.PendingWrites())
+	assert.False(t, m.Dirty())
+
+	// Writes that were published by a refresh that's still waiting on readers
+	// aren't pending
+	s := reader.enter()
+	m.Insert("baz", nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Error(t, m.RefreshAndWait(ctx))
+	assert.False(t, m.Dirty())
+	assert.Empty(t, m.PendingEntries())
+	reader.exit(s)
+}
+
+func TestMap_PendingEntries(t *testing.T) {
+	m := NewMap[string, int]()
+	v := 1
+	assert.NoError(t, m.Insert("foo", &v))
+	assert.True(t, m.Delete("foo"))
+	assert.NoError(t, m.InsertMany(map[string]*int{"bar": &v}))
+
+	entries := m.PendingEntries()
+	assert.Len(t, entries, 3)
+	assert.Equal(t, oplog.EntryInsert, entries[0].Type())
+	assert.Equal(t, "foo", entries[0].Key())
+	assert.True(t, entries[0].HasValue())
+	assert.Equal(t, oplog.EntryDelete, entries[1].Type())
+	assert.False(t, entries[1].HasValue())
+	assert.Equal(t, map[string]*int{"bar": &v}, entries[2].Values())
+
+	// The entries remain valid after they've been published
+	assert.NoError(t, m.Refresh())
+	assert.Empty(t, m.PendingEntries())
+	assert.Equal(t, "foo", entries[0].Key())
+}
+
+func TestMap_Generation(t *testing.T) {
+	m := NewMap[string, any]()
+	reader := m.Reader()
+	assert.Equal(t, uint64(0), m.Generation())
+
+	m.Refresh()
+	m.Refresh()
+	assert.Equal(t, uint64(2), m.Generation())
+	assert.Equal(t, m.Generation(), reader.Generation())
+}
+
+func TestMap_Close(t *testing.T) {
+	m := NewMap[string, any]()
+	reader := m.Reader()
+	m.Insert("foo", nil)
+	m.Refresh()
+	m.Insert("bar", nil)
+
+	assert.NoError(t, m.Close())
+	assert.ErrorIs(t, m.Close(), ErrClosed)
+
+	// Readers are closed and deregistered
+	_, err := reader.HasErr("foo")
+	assert.ErrorIs(t, err, ErrReaderClosed)
+	assert.Empty(t, m.openReaders())
+	_, err = m.Reader().HasErr("foo")
+	assert.ErrorIs(t, err, ErrReaderClosed, "readers created after close should be closed")
+	assert.Empty(t, m.openReaders())
+
+	// The maps and the oplog are cleared
+	assert.Len(t, *m.readable, 0)
+	assert.Len(t, *m.writable, 0)
+	assert.Equal(t, 0, m.oplog.Len())
+
+	// Writes fail
+	assert.ErrorIs(t, m.Insert("foo", nil), ErrClosed)
+	assert.ErrorIs(t, m.Clear(), ErrClosed)
+	assert.ErrorIs(t, m.Refresh(), ErrClosed)
+	assert.False(t, m.Delete("foo"))
+	_, err = m.DeleteErr("foo")
+	assert.ErrorIs(t, err, ErrClosed)
+	got, loaded := m.GetOrInsert("foo", nil)
+	assert.Nil(t, got)
+	assert.False(t, loaded)
+	_, _, err = m.GetOrInsertErr("foo", nil)
+	assert.ErrorIs(t, err, ErrClosed)
+	assert.Equal(t, 0, m.Len())
+}
+
+func TestMap_CloseConcurrentReads(t *testing.T) {
+	// Reads that race with Close either finish before the maps are cleared or
+	// fail with ErrReaderClosed, which the race detector checks
+	for i := 0; i < 10; i++ {
+		m := NewMap[int, int]()
+		for k := 0; k < 100; k++ {
+			m.Insert(k, &k)
+		}
+		m.Refresh()
+
+		// Close once every goroutine is reading
+		var wg, reading sync.WaitGroup
+		for g := 0; g < 4; g++ {
+			wg.Add(1)
+			reading.Add(1)
+			go func(reader *Reader[int, int]) {
+				defer wg.Done()
+				for k := 0; ; k++ {
+					_, ok, err := reader.GetErr(k % 100)
+					if err != nil {
+						assert.ErrorIs(t, err, ErrReaderClosed)
+						return
+					}
+					assert.True(t, ok, "reads must not observe the map being cleared")
+					if k == 0 {
+						reading.Done()
+					}
+				}
+			}(m.Reader())
+		}
+		reading.Wait()
+		assert.NoError(t, m.Close())
+		wg.Wait()
+	}
+}
+
+func TestMap_InitialCapacity(t *testing.T) {
+	m := NewMap[int, int](WithInitialCapacity(1000))
+	assert.Equal(t, 1000, m.options.InitialCapacity)
+
+	m = NewMapFrom(map[int]int{1: 1}, WithInitialCapacity(1000))
+	assert.Equal(t, 1, m.Len())
+}
+
+func TestMap_ValueCopy(t *testing.T) {
+	m := NewMap[string, int](WithValueCopy(func(v *int) *int {
+		c := *v
+		return &c
+	}))
+	reader := m.Reader()
+
+	v := 1
+	m.Insert("foo", &v)
+	m.InsertMany(map[string]*int{"bar": &v})
+	m.Batch(func(b *Batch[string, int]) {
+		b.Insert("baz", &v)
+	})
+	m.Refresh()
+
+	// Modifying the value after inserting it shouldn't affect the map
+	v = 2
+	assert.Equal(t, map[string]int{"foo": 1, "bar": 1, "baz": 1}, reader.Snapshot())
+
+	got, _ := m.GetOrInsert("qux", &v)
+	assert.NotSame(t, &v, got, "the stored copy should be returned")
+
+	assert.Panics(t, func() {
+		NewMap[string, int](WithValueCopy(func(v *string) *string { return v }))
+	})
+}
+
+func TestMap_OplogCompaction(t *testing.T) {
+	m := NewMap[int, int](WithOplogCompaction())
+	assert.True(t, m.options.CompactOplog)
+	reader := m.Reader()
+
+	for i := 0; i < 100; i++ {
+		v := i
+		m.Insert(i%10, &v)
+		if i%3 == 0 {
+			m.Delete(i % 10)
+		}
+	}
+	m.Refresh()
+	assert.Equal(t, m.Snapshot(), reader.Snapshot())
+
+	// The compacted oplog was replayed into the other map
+	m.Refresh()
+	assert.Equal(t, map[int]int{1: 91, 2: 92, 4: 94, 5: 95, 7: 97, 8: 98}, reader.Snapshot())
+}
@@ -0,0 +1,55 @@
+package eventual
+
+import (
+	"time"
+)
+
+// MetricsCollector receives callbacks about the operations performed on a map
+// so that the map can be instrumented with any metrics backend. The callbacks
+// are made while holding the map's locks, so they should return quickly and
+// must not call back into the map.
+type MetricsCollector interface {
+	// Inserted is called when keys are inserted or updated in the map.
+	Inserted(keys int)
+
+	// Deleted is called when keys that existed are deleted from the map.
+	Deleted(keys int)
+
+	// Cleared is called when every key is removed from the map.
+	Cleared()
+
+	// Refreshed is called after every refresh with the time that the refresh
+	// took and the number of oplog entries that were replayed.
+	Refreshed(duration time.Duration, entries int)
+
+	// ReplicationLag is called whenever the number of oplog entries that have
+	// not been exposed to the readers changes.
+	ReplicationLag(entries int)
+
+	// Readers is called whenever the number of registered readers changes.
+	// Readers are registered and closed without holding any lock, so Readers
+	// may be called concurrently, and the counts reported by concurrent calls
+	// may arrive out of order. The current count is reported again by every
+	// refresh that waits for the readers.
+	Readers(n int)
+}
+
+// ReadMetricsCollector is an optional interface that a MetricsCollector can
+// implement to also be told about the lookups made by readers through Get, Has
+// and GetMany. Unlike the other callbacks, Read is called on the read path from
+// every reader concurrently without holding any lock, so it must be cheap and
+// thread-safe.
+type ReadMetricsCollector interface {
+	// Read is called for every key that is looked up with whether it was found.
+	Read(hit bool)
+}
+
+// nopMetrics is the MetricsCollector used when no collector is configured.
+type nopMetrics struct{}
+
+func (nopMetrics) Inserted(int)                 {}
+func (nopMetrics) Deleted(int)                  {}
+func (nopMetrics) Cleared()                     {}
+func (nopMetrics) Refreshed(time.Duration, int) {}
+func (nopMetrics) ReplicationLag(int)           {}
+func (nopMetrics) Readers(int)                  {}
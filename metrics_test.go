@@ -0,0 +1,88 @@
+package eventual
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type testMetrics struct {
+	inserted, deleted, cleared, refreshes, replayed, lag, readers int
+}
+
+func (m *testMetrics) Inserted(keys int) { m.inserted += keys }
+func (m *testMetrics) Deleted(keys int)  { m.deleted += keys }
+func (m *testMetrics) Cleared()          { m.cleared++ }
+func (m *testMetrics) Refreshed(duration time.Duration, entries int) {
+	m.refreshes++
+	m.replayed += entries
+}
+func (m *testMetrics) ReplicationLag(entries int) { m.lag = entries }
+func (m *testMetrics) Readers(n int)              { m.readers = n }
+
+func TestMap_Metrics(t *testing.T) {
+	metrics := &testMetrics{}
+	m := NewMap[string, any](WithMetrics(metrics))
+
+	reader := m.Reader()
+	m.Reader()
+	assert.Equal(t, 2, metrics.readers)
+	assert.NoError(t, reader.Close())
+	assert.Equal(t, 1, metrics.readers)
+
+	m.Insert("foo", nil)
+	m.InsertMany(map[string]*any{"bar": nil, "baz": nil})
+	assert.Equal(t, 3, metrics.inserted)
+	assert.Equal(t, 2, metrics.lag)
+
+	m.Delete("foo")
+	m.Delete("qux")
+	assert.Equal(t, 1, metrics.deleted, "only keys that existed are counted as deleted")
+
+	m.Batch(func(b *Batch[string, any]) {
+		b.Clear()
+		b.Insert("foo", nil)
+	})
+	assert.Equal(t, 1, metrics.cleared)
+	assert.Equal(t, 4, metrics.inserted)
+
+	m.Refresh()
+	assert.Equal(t, 1, metrics.refreshes)
+	assert.Equal(t, 5, metrics.replayed)
+	assert.Equal(t, 0, metrics.lag)
+
+	assert.NoError(t, m.Close())
+	assert.Equal(t, 0, metrics.readers)
+}
+
+type testReadMetrics struct {
+	testMetrics
+	hits, misses int
+}
+
+func (m *testReadMetrics) Read(hit bool) {
+	if hit {
+		m.hits++
+	} else {
+		m.misses++
+	}
+}
+
+func TestReadMetricsCollector(t *testing.T) {
+	metrics := &testReadMetrics{}
+	m := NewMapFrom(map[string]int{"foo": 1}, WithMetrics(metrics))
+	reader := m.Reader()
+	reader.Get("foo")
+	reader.Has("bar")
+	reader.GetMany([]string{"foo", "bar", "baz"})
+	assert.Equal(t, 2, metrics.hits)
+	assert.Equal(t, 3, metrics.misses)
+
+	// Lookups through a guard are counted too
+	g := reader.Guard()
+	g.Get("foo")
+	g.Has("bar")
+	g.Release()
+	assert.Equal(t, 3, metrics.hits)
+	assert.Equal(t, 4, metrics.misses)
+}
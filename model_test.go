@@ -0,0 +1,159 @@
+package eventual
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+// modelObservation is a snapshot of the map observed by a reader.
+type modelObservation struct {
+	generation uint64
+	state      map[int]int
+}
+
+// checkModel runs a random history of operations against both the map and a
+// reference map protected by an RWMutex, while readers observe the map
+// concurrently, and checks that every snapshot that a reader observed equals
+// the state of the reference map when that snapshot's generation was
+// published, and that readers never go back to an older generation. The map
+// must only be refreshed by the history, or by its writes.
+func checkModel(t *testing.T, seed int64, ops int, opts ...OptionFunc) {
+	t.Helper()
+	m := NewMap[int, int](opts...)
+	defer m.Close()
+	ref := newStdMap()
+
+	// The state of the reference map at every published generation
+	var mu sync.Mutex
+	published := map[uint64]map[int]int{0: {}}
+	publish := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		if _, ok := published[m.Generation()]; !ok {
+			published[m.Generation()] = ref.Snapshot()
+		}
+	}
+
+	done := make(chan struct{})
+	var wg, started sync.WaitGroup
+	observed := make([][]modelObservation, 4)
+	for i := range observed {
+		wg.Add(1)
+		started.Add(1)
+		go func(rng *rand.Rand) {
+			defer wg.Done()
+			r := m.Reader()
+			defer func() { r.Close() }()
+			started.Done()
+			for len(observed[i]) < ops/4 {
+				select {
+				case <-done:
+					return
+				default:
+					runtime.Gosched()
+				}
+				switch rng.Intn(20) {
+				case 0:
+					r.Close()
+					r = m.Reader()
+				case 1:
+					r.Freeze()
+				case 2:
+					r.Unfreeze()
+				}
+				g := r.Guard()
+				o := modelObservation{generation: g.Generation(), state: make(map[int]int, g.Len())}
+				g.ForEach(func(key int, value *int) bool {
+					o.state[key] = *value
+					return true
+				})
+				g.Release()
+				observed[i] = append(observed[i], o)
+			}
+		}(rand.New(rand.NewSource(seed + int64(i) + 1)))
+	}
+
+	started.Wait()
+	rng := rand.New(rand.NewSource(seed))
+	for i := 0; i < ops; i++ {
+		if rng.Intn(10) == 0 {
+			runtime.Gosched()
+		}
+		key, v := rng.Intn(32), i
+		switch n := rng.Intn(100); {
+		case n < 50:
+			assert.NoError(t, m.Insert(key, &v))
+			ref.Insert(key, &v)
+		case n < 65:
+			m.Delete(key)
+			ref.Delete(key)
+		case n < 75:
+			assert.NoError(t, m.Update(key, func(*int, bool) *int { return &v }))
+			ref.Insert(key, &v)
+		case n < 82:
+			other := rng.Intn(32)
+			assert.NoError(t, m.Batch(func(b *Batch[int, int]) {
+				b.Insert(key, &v)
+				b.Delete(other)
+			}))
+			ref.Insert(key, &v)
+			ref.Delete(other)
+		case n < 83:
+			assert.NoError(t, m.Clear())
+			ref.Clear()
+		case n < 95:
+			assert.NoError(t, m.Refresh())
+		default:
+			ctx, cancel := context.WithTimeout(context.Background(), time.Duration(rng.Intn(20))*time.Microsecond)
+			_ = m.RefreshAndWait(ctx)
+			cancel()
+		}
+
+		// Refreshes made by the writes happen once the write has been applied
+		publish()
+	}
+	close(done)
+	wg.Wait()
+
+	for i, observations := range observed {
+		assert.NotEmpty(t, observations, "reader %d didn't observe the map", i)
+		var last uint64
+		for j, o := range observations {
+			want, ok := published[o.generation]
+			if !assert.True(t, ok, "reader %d observed generation %d, which was never published", i, o.generation) {
+				return
+			}
+			if !assert.Equal(t, want, o.state, fmt.Sprintf("reader %d observation %d at generation %d", i, j, o.generation)) {
+				return
+			}
+			if !assert.GreaterOrEqual(t, o.generation, last, "reader %d went back to an older generation", i) {
+				return
+			}
+			last = o.generation
+		}
+	}
+}
+
+func TestMap_Model(t *testing.T) {
+	for name, opts := range map[string][]OptionFunc{
+		"default":     nil,
+		"compacted":   {WithOplogCompaction()},
+		"incremental": {WithIncrementalRefresh(time.Microsecond)},
+		"async":       {WithAsyncRefresh()},
+		"recycled":    {WithValueRecycling(), WithPooledClears()},
+		"readerless":  {WithReaderlessWrites()},
+		"lagged":      {WithMaxReplicationWriteLag(8), WithDebugChecks()},
+	} {
+		t.Run(name, func(t *testing.T) {
+			seed := time.Now().UnixNano()
+			t.Logf("seed: %d", seed)
+			checkModel(t, seed, 2000, opts...)
+		})
+	}
+}
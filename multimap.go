@@ -0,0 +1,177 @@
+package eventual
+
+import (
+	"github.com/clarkmcc/go-evmap/pkg/oplog"
+)
+
+// Multimap is a map that holds a bag of values per key, similar to the default
+// map of Rust's evmap. Inserting a value appends it to the key's bag rather than
+// replacing the existing values.
+//
+// Under the hood the bags are stored in a regular Map, so a Multimap shares the
+// refresh semantics of a Map. Bags are never modified after being inserted,
+// instead writes replace the bag with a modified copy, so the bags handed out
+// by readers stay valid after a refresh but must not be modified.
+type Multimap[K comparable, V comparable] struct {
+	m *Map[K, []V]
+}
+
+// Insert appends the value to the bag of values of the key.
+func (m *Multimap[K, V]) Insert(key K, value V) error {
+	m.m.lockForWrite()
+	defer m.m.writeLock.Unlock()
+	if m.m.closed {
+		return ErrClosed
+	}
+
+	var bag []V
+	if old := (*m.m.writable)[key]; old != nil {
+		bag = append(bag, *old...)
+	}
+	bag = append(bag, value)
+	if err := m.m.pushLocked(oplog.Insert[K, *[]V](key, &bag)); err != nil {
+		return err
+	}
+	m.m.metrics.Inserted(1)
+	m.m.writtenLocked()
+	return nil
+}
+
+// Remove removes a single occurrence of the value from the bag of values of
+// the key and returns a boolean representing whether the value existed. The key
+// is removed from the map once its bag is empty.
+func (m *Multimap[K, V]) Remove(key K, value V) bool {
+	m.m.lockForWrite()
+	defer m.m.writeLock.Unlock()
+	if m.m.closed {
+		return false
+	}
+
+	old := (*m.m.writable)[key]
+	if old == nil {
+		return false
+	}
+	i := 0
+	for ; i < len(*old); i++ {
+		if (*old)[i] == value {
+			break
+		}
+	}
+	if i == len(*old) {
+		return false
+	}
+	e := oplog.Delete[K, *[]V](key)
+	if len(*old) > 1 {
+		bag := append(append([]V(nil), (*old)[:i]...), (*old)[i+1:]...)
+		e = oplog.Insert[K, *[]V](key, &bag)
+	}
+	if m.m.pushLocked(e) != nil {
+		return false
+	}
+	m.m.metrics.Deleted(1)
+	m.m.writtenLocked()
+	return true
+}
+
+// RemoveAll removes the key and its entire bag of values from the map and
+// returns a boolean representing whether the key existed.
+func (m *Multimap[K, V]) RemoveAll(key K) bool {
+	return m.m.Delete(key)
+}
+
+// Get returns the bag of values of the key, including writes that have not
+// been exposed to the readers yet. The returned slice must not be modified.
+func (m *Multimap[K, V]) Get(key K) []V {
+	if bag, ok := m.m.Get(key); ok {
+		return *bag
+	}
+	return nil
+}
+
+// Len returns the number of keys in the map, including writes that have not
+// been exposed to the readers yet.
+func (m *Multimap[K, V]) Len() int {
+	return m.m.Len()
+}
+
+// Clear removes all the keys from the map.
+func (m *Multimap[K, V]) Clear() error {
+	return m.m.Clear()
+}
+
+// Refresh exposes the current state of the map to the readers.
+func (m *Multimap[K, V]) Refresh() error {
+	return m.m.Refresh()
+}
+
+// Close tears down the map, closing every reader created from it.
+func (m *Multimap[K, V]) Close() error {
+	return m.m.Close()
+}
+
+// Reader creates and registers a new reader for the map.
+func (m *Multimap[K, V]) Reader() *MultimapReader[K, V] {
+	return &MultimapReader[K, V]{r: m.m.Reader()}
+}
+
+// MultimapReader reads from a Multimap.
+type MultimapReader[K comparable, V comparable] struct {
+	r *Reader[K, []V]
+}
+
+// Get returns the bag of values of the key that is visible to this reader, or
+// nil if the key doesn't exist. The returned slice must not be modified.
+func (r *MultimapReader[K, V]) Get(key K) []V {
+	if bag, ok := r.r.Get(key); ok {
+		return *bag
+	}
+	return nil
+}
+
+func (r *MultimapReader[K, V]) Has(key K) bool {
+	return r.r.Has(key)
+}
+
+// Contains reports whether the bag of values of the key contains the value.
+func (r *MultimapReader[K, V]) Contains(key K, value V) bool {
+	for _, v := range r.Get(key) {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Len returns the number of keys visible to this reader.
+func (r *MultimapReader[K, V]) Len() int {
+	n := 0
+	r.r.With(func(m map[K]*[]V) {
+		n = len(m)
+	})
+	return n
+}
+
+// ForEach calls fn for every key and bag of values visible to this reader,
+// stopping early if fn returns false. The bags must not be modified.
+func (r *MultimapReader[K, V]) ForEach(fn func(key K, values []V) bool) {
+	r.r.ForEach(func(key K, bag *[]V) bool {
+		return fn(key, *bag)
+	})
+}
+
+// Close removes the reader from the map.
+func (r *MultimapReader[K, V]) Close() error {
+	return r.r.Close()
+}
+
+// NewMultimap creates a new Multimap of the given type with the provided options.
+func NewMultimap[K comparable, V comparable](opts ...OptionFunc) *Multimap[K, V] {
+	options := newOptions(opts...)
+
+	// The value options apply to V rather than the bags stored in the
+	// underlying map, and bags are never modified so they never need copying.
+	options = options.withoutValueOptions()
+	r := make(map[K]*[]V, options.InitialCapacity)
+	w := make(map[K]*[]V, options.InitialCapacity)
+	return &Multimap[K, V]{m: newMap(r, w, options)}
+}
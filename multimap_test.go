@@ -0,0 +1,66 @@
+package eventual
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestMultimap(t *testing.T) {
+	m := NewMultimap[string, int]()
+	reader := m.Reader()
+
+	assert.NoError(t, m.Insert("foo", 1))
+	assert.NoError(t, m.Insert("foo", 2))
+	assert.NoError(t, m.Insert("foo", 2))
+	assert.NoError(t, m.Insert("bar", 3))
+	assert.Equal(t, []int{1, 2, 2}, m.Get("foo"))
+	assert.Equal(t, 2, m.Len())
+	assert.Nil(t, reader.Get("foo"))
+
+	assert.NoError(t, m.Refresh())
+	bag := reader.Get("foo")
+	assert.Equal(t, []int{1, 2, 2}, bag)
+	assert.True(t, reader.Contains("foo", 2))
+	assert.False(t, reader.Contains("foo", 3))
+	assert.Equal(t, 2, reader.Len())
+
+	// Only a single occurrence of the value is removed
+	assert.True(t, m.Remove("foo", 2))
+	assert.False(t, m.Remove("foo", 4))
+	assert.False(t, m.Remove("baz", 1))
+	assert.NoError(t, m.Refresh())
+	assert.Equal(t, []int{1, 2}, reader.Get("foo"))
+
+	// Bags handed out by readers are not modified by later writes
+	assert.Equal(t, []int{1, 2, 2}, bag)
+
+	// Removing the last value removes the key
+	assert.True(t, m.Remove("bar", 3))
+	assert.NoError(t, m.Refresh())
+	assert.False(t, reader.Has("bar"))
+
+	assert.True(t, m.RemoveAll("foo"))
+	assert.False(t, m.RemoveAll("foo"))
+	assert.NoError(t, m.Refresh())
+	assert.Equal(t, 0, reader.Len())
+}
+
+func TestMultimapReader_ForEach(t *testing.T) {
+	m := NewMultimap[string, int]()
+	reader := m.Reader()
+	assert.NoError(t, m.Insert("foo", 1))
+	assert.NoError(t, m.Insert("foo", 2))
+	assert.NoError(t, m.Insert("bar", 3))
+	assert.NoError(t, m.Refresh())
+
+	got := map[string][]int{}
+	reader.ForEach(func(key string, values []int) bool {
+		got[key] = values
+		return true
+	})
+	assert.Equal(t, map[string][]int{"foo": {1, 2}, "bar": {3}}, got)
+
+	assert.NoError(t, m.Close())
+	assert.ErrorIs(t, m.Insert("foo", 1), ErrClosed)
+	assert.False(t, m.Remove("foo", 1))
+}
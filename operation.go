@@ -0,0 +1,38 @@
+package eventual
+
+import (
+	"github.com/clarkmcc/go-evmap/pkg/oplog"
+)
+
+// Operation is a user-defined modification of a map, such as incrementing a
+// field of a value. Operations are recorded in the oplog and replayed into both
+// of the maps, each time with whatever is in that map, so Apply must be
+// deterministic. Apply must not modify the values that are already in the map,
+// since they may be visible to readers through the other map, and must insert
+// newly allocated values instead.
+type Operation[K comparable, V any] interface {
+	Apply(m map[K]*V)
+}
+
+// ApplyOp applies the operation to the writable map and records it in the
+// oplog so that it's replayed into the other map on refresh. The operation is
+// not visible to readers until the next call to Refresh.
+//
+// The keys modified by an operation aren't known to the map, so changefeeds
+// compare every key when a refresh publishes an operation, and keys inserted by
+// an operation aren't tracked by the eviction policy of WithMaxEntries. On maps
+// created with OpenMap the operation is applied to a copy of the writable map
+// to record its effect in the write-ahead log, which takes time proportional to
+// the size of the map.
+func (m *Map[K, V]) ApplyOp(op Operation[K, V]) error {
+	m.lockForAppend()
+	defer m.writeLock.Unlock()
+	if m.closed {
+		return ErrClosed
+	}
+	if err := m.pushLocked(oplog.Custom[K, *V](op)); err != nil {
+		return err
+	}
+	m.writtenLocked()
+	return nil
+}
@@ -0,0 +1,77 @@
+package eventual
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+)
+
+// scaleOp multiplies every value in the map by a factor
+type scaleOp struct {
+	factor int
+}
+
+func (o scaleOp) Apply(m map[string]*int) {
+	for k, v := range m {
+		if v != nil {
+			n := *v * o.factor
+			m[k] = &n
+		}
+	}
+}
+
+// dropOp deletes a key and inserts another
+type dropOp struct {
+	drop, add string
+}
+
+func (o dropOp) Apply(m map[string]*int) {
+	delete(m, o.drop)
+	v := 0
+	m[o.add] = &v
+}
+
+func TestMap_ApplyOp(t *testing.T) {
+	m := NewMapFrom(map[string]int{"foo": 1, "bar": 2})
+	r := m.Reader()
+	feed := m.Changefeed()
+
+	assert.NoError(t, m.ApplyOp(scaleOp{factor: 10}))
+	assert.Equal(t, map[string]int{"foo": 1, "bar": 2}, r.Snapshot())
+	assert.NoError(t, m.Refresh())
+	assert.Equal(t, map[string]int{"foo": 10, "bar": 20}, r.Snapshot())
+
+	// The operation is replayed into the other map after the writes before it
+	v := 3
+	assert.NoError(t, m.Insert("baz", &v))
+	assert.NoError(t, m.ApplyOp(scaleOp{factor: 2}))
+	assert.NoError(t, m.Refresh())
+	assert.NoError(t, m.Refresh())
+	assert.Equal(t, map[string]int{"foo": 20, "bar": 40, "baz": 6}, r.Snapshot())
+	assert.Equal(t, map[string]int{"foo": 20, "bar": 40, "baz": 6}, m.Snapshot())
+
+	c, err := feed.Next(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, c.Changes, 2)
+
+	assert.NoError(t, m.Close())
+	assert.ErrorIs(t, m.ApplyOp(scaleOp{factor: 2}), ErrClosed)
+}
+
+func TestMap_ApplyOp_Durable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "map.wal")
+	m, err := OpenMap[string, int](path)
+	assert.NoError(t, err)
+	v := 1
+	assert.NoError(t, m.Insert("foo", &v))
+	assert.NoError(t, m.Insert("bar", &v))
+	assert.NoError(t, m.ApplyOp(scaleOp{factor: 5}))
+	assert.NoError(t, m.ApplyOp(dropOp{drop: "bar", add: "baz"}))
+	assert.NoError(t, m.Close())
+
+	m, err = OpenMap[string, int](path)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"foo": 5, "baz": 0}, m.Snapshot())
+	assert.NoError(t, m.Close())
+}
@@ -0,0 +1,711 @@
+package eventual
+
+import (
+	"fmt"
+	"github.com/clarkmcc/go-evmap/pkg/oplog"
+	"reflect"
+	"slices"
+	"time"
+)
+
+// Options contains the configurable behavior of a Map.
+type Options struct {
+	// MaxReplicationWriteLag is the maximum number of writes that can be made to
+	// the map before the map automatically calls Refresh to expose those writes
+	// to the readers. A value of zero disables automatic refreshes.
+	MaxReplicationWriteLag int
+
+	// AutoRefreshInterval is the interval at which a background goroutine
+	// refreshes the map if there are writes that haven't been exposed to the
+	// readers. A value of zero disables the background goroutine.
+	AutoRefreshInterval time.Duration
+
+	// RefreshCoalesceWindow is the minimum amount of time between two refreshes
+	// triggered by Refresh. Calls to Refresh within the window of the previous
+	// refresh are collapsed into a single refresh at the end of the window. A
+	// value of zero disables coalescing.
+	RefreshCoalesceWindow time.Duration
+
+	// InitialCapacity is the number of keys that both internal maps are sized
+	// for when the map is created.
+	InitialCapacity int
+
+	// ShardCount is the number of shards that a ShardedMap partitions its keys
+	// across. A Map isn't sharded, so it can only be one.
+	ShardCount int
+
+	// Metrics receives callbacks about the operations performed on the map.
+	Metrics MetricsCollector
+
+	// Tracer starts spans around refreshes, bulk writes and persistence.
+	Tracer Tracer
+
+	// TTLSweepInterval is the interval at which a TTLMap deletes its expired
+	// keys. A value of zero uses a default of one second.
+	TTLSweepInterval time.Duration
+
+	// CheckpointSize is the size in bytes that the write-ahead log of a map
+	// created with OpenMap can grow to before the map is checkpointed. A value
+	// of zero disables size-triggered checkpoints.
+	CheckpointSize int64
+
+	// CheckpointInterval is the interval at which a map created with OpenMap is
+	// checkpointed. A value of zero disables periodic checkpoints.
+	CheckpointInterval time.Duration
+
+	// MaxEntries is the maximum number of keys in the map, after which writes
+	// evict keys chosen by the eviction policy. A value of zero means that the
+	// map is unbounded.
+	MaxEntries int
+
+	// MaxOplogSize is the maximum number of entries in the oplog, after which
+	// writes are handled according to OverflowPolicy. A value of zero means that
+	// the oplog is unbounded.
+	MaxOplogSize int
+
+	// OverflowPolicy determines what happens to writes once the oplog has
+	// reached MaxOplogSize.
+	OverflowPolicy OverflowPolicy
+
+	// EntryTimestamps records the time of every write on its oplog entry.
+	EntryTimestamps bool
+
+	// DiffHistory is the number of refreshes whose changes are remembered for
+	// Diff. A value of zero disables Diff.
+	DiffHistory int
+
+	// MaxRefreshPause is the longest that a refresh replays the oplog to the
+	// writable map before releasing the write lock. A value of zero replays the
+	// whole oplog during the refresh.
+	MaxRefreshPause time.Duration
+
+	// AsyncRefresh leaves waiting for the readers and syncing the writable map
+	// after a refresh to a background goroutine.
+	AsyncRefresh bool
+
+	// ReaderlessWrites skips the oplog for writes that are made while no reader
+	// is registered.
+	ReaderlessWrites bool
+
+	// PooledClears replaces the internal maps with empty maps from a pool when
+	// they're cleared.
+	PooledClears bool
+
+	// RecycleValues reuses the storage of removed values for inserted values.
+	RecycleValues bool
+
+	// InternKeys interns string keys as they're inserted.
+	InternKeys bool
+
+	// RefreshDeadline is the longest that a refresh waits for the readers to
+	// leave the previous snapshot. A value of zero waits for as long as it
+	// takes.
+	RefreshDeadline time.Duration
+
+	// DetachStuckReaders detaches the readers that are still reading from the
+	// previous snapshot once RefreshDeadline has passed, rather than failing the
+	// refresh.
+	DetachStuckReaders bool
+
+	// DebugChecks validates the internal invariants of the map after every write
+	// and refresh.
+	DebugChecks bool
+
+	// Clock is the source of time of the map. The default is the real time.
+	Clock Clock
+
+	// CompactOplog compacts the oplog before it's replayed into the second map
+	// after each refresh.
+	CompactOplog bool
+
+	// ProfilerLabels enables pprof labels on refreshes and on the background
+	// goroutines of the map.
+	ProfilerLabels bool
+
+	// valueEqual is a func(a, b *V) bool used to compare values. It's stored
+	// as an interface because Options is not generic and it's asserted to the
+	// map's value type when the map is created.
+	valueEqual any
+
+	// valueCopy is a func(v *V) *V used to copy values on insert, stored as an
+	// interface for the same reason as valueEqual.
+	valueCopy any
+
+	// loader is a func(K) (*V, error) used to load missing keys, stored as an
+	// interface for the same reason as valueEqual.
+	loader any
+
+	// writeBehind is a func([]*oplog.Entry[K, *V]) error that persists the
+	// published writes, stored as an interface for the same reason as valueEqual.
+	writeBehind any
+
+	// keyCodec and valueCodec are the Codec[K] and Codec[V] used to encode the
+	// keys and values, stored as interfaces for the same reason as valueEqual.
+	keyCodec   any
+	valueCodec any
+
+	// conflictResolver is a func(existing, incoming HandleWrite[K, V])
+	// HandleWrite[K, V] that merges the writes of write handles, stored as an
+	// interface for the same reason as valueEqual.
+	conflictResolver any
+
+	// evictionPolicy is a func() EvictionPolicy[K] used to create the eviction
+	// policy of a map, stored as an interface for the same reason as valueEqual.
+	evictionPolicy any
+}
+
+// OptionFunc modifies the Options used when creating a Map.
+type OptionFunc func(o *Options)
+
+// WithMaxReplicationWriteLag causes the map to automatically refresh after n
+// writes have been made since the last refresh.
+func WithMaxReplicationWriteLag(n int) OptionFunc {
+	return func(o *Options) {
+		o.MaxReplicationWriteLag = n
+	}
+}
+
+// WithAutoRefreshInterval starts a background goroutine that refreshes the map
+// every interval, skipping the refresh when there are no pending writes. The
+// goroutine is stopped by Map.Close, which must be called to release the map.
+func WithAutoRefreshInterval(interval time.Duration) OptionFunc {
+	return func(o *Options) {
+		o.AutoRefreshInterval = interval
+	}
+}
+
+// WithRefreshCoalesceWindow collapses calls to Refresh that happen within the
+// window of the previous refresh into a single refresh at the end of the window.
+// This is useful when Refresh is called very frequently, such as after every
+// write, where swapping pointers and waiting on readers would dominate. Calls to
+// RefreshAndWait are never coalesced.
+func WithRefreshCoalesceWindow(window time.Duration) OptionFunc {
+	return func(o *Options) {
+		o.RefreshCoalesceWindow = window
+	}
+}
+
+// WithInitialCapacity creates both internal maps with enough space for n keys,
+// which avoids repeatedly growing the maps during large initial loads.
+func WithInitialCapacity(n int) OptionFunc {
+	return func(o *Options) {
+		o.InitialCapacity = n
+	}
+}
+
+// WithShardCount sets the number of shards that a ShardedMap partitions its keys
+// across, each shard being a Map with its own readable and writable maps. Maps
+// aren't sharded themselves, so the constructors of Map panic if n is larger
+// than one rather than silently ignoring it, and a sharded map must be created
+// with NewShardedMap.
+func WithShardCount(n int) OptionFunc {
+	return func(o *Options) {
+		o.ShardCount = n
+	}
+}
+
+// WithTracer traces refreshes, bulk writes and persistence with the tracer.
+func WithTracer(tracer Tracer) OptionFunc {
+	return func(o *Options) {
+		o.Tracer = tracer
+	}
+}
+
+// WithMetrics reports the operations performed on the map to the collector.
+func WithMetrics(collector MetricsCollector) OptionFunc {
+	return func(o *Options) {
+		o.Metrics = collector
+	}
+}
+
+// WithTTLSweepInterval sets the interval at which a TTLMap deletes its expired
+// keys. It has no effect on a Map.
+func WithTTLSweepInterval(interval time.Duration) OptionFunc {
+	return func(o *Options) {
+		o.TTLSweepInterval = interval
+	}
+}
+
+// WithKeyCodec sets the codec used to encode keys by the persistence and
+// replication features of the map. By default keys are encoded with GobCodec.
+// The type of the codec must match the key type of the map.
+func WithKeyCodec[K comparable](codec Codec[K]) OptionFunc {
+	return func(o *Options) {
+		o.keyCodec = codec
+	}
+}
+
+// WithValueCodec sets the codec used to encode values by the persistence and
+// replication features of the map. By default values are encoded with GobCodec.
+// The type of the codec must match the value type of the map.
+func WithValueCodec[V any](codec Codec[V]) OptionFunc {
+	return func(o *Options) {
+		o.valueCodec = codec
+	}
+}
+
+// WithCheckpointSize checkpoints a map created with OpenMap whenever a write
+// grows its write-ahead log to n bytes or more.
+func WithCheckpointSize(n int64) OptionFunc {
+	return func(o *Options) {
+		o.CheckpointSize = n
+	}
+}
+
+// WithCheckpointInterval starts a background goroutine that checkpoints a map
+// created with OpenMap every interval, skipping the checkpoint when nothing has
+// been written since the previous one. The goroutine is stopped by Map.Close.
+func WithCheckpointInterval(interval time.Duration) OptionFunc {
+	return func(o *Options) {
+		o.CheckpointInterval = interval
+	}
+}
+
+// WithMaxOplogSize bounds the oplog to n entries, which keeps its memory from
+// growing without bounds when the map isn't refreshed. Once the oplog is full,
+// writes are handled according to the policy: OverflowRefresh refreshes the
+// map, OverflowBlock blocks the writers until the map is refreshed, and
+// OverflowError fails the writes with ErrOplogFull. The size is checked before
+// each write and a single write can push several entries, so the oplog can
+// briefly exceed n with OverflowRefresh and OverflowBlock. Writes merged from
+// write handles and evictions are never blocked or failed.
+func WithMaxOplogSize(n int, policy OverflowPolicy) OptionFunc {
+	return func(o *Options) {
+		o.MaxOplogSize = n
+		o.OverflowPolicy = policy
+	}
+}
+
+// WithEntryTimestamps records the time at which every write was made on its
+// oplog entry, which is available from the entry's Time method to the sink of
+// WithWriteBehind and to PendingEntries, for audit logging or for merging the
+// writes of several maps. Reading the clock adds to the cost of every write, so
+// entries aren't timestamped by default.
+func WithEntryTimestamps() OptionFunc {
+	return func(o *Options) {
+		o.EntryTimestamps = true
+	}
+}
+
+// WithDiffHistory remembers the keys changed by the n most recent refreshes so
+// that Diff can describe the changes between any two of the generations they
+// published. Remembering the changes requires comparing the keys written by
+// every refresh, like a Changefeed does.
+func WithDiffHistory(n int) OptionFunc {
+	return func(o *Options) {
+		o.DiffHistory = n
+	}
+}
+
+// WithIncrementalRefresh bounds the time that a refresh pauses writers while it
+// replays the oplog to the second map. Once the readers have moved to the new
+// snapshot, the oplog is replayed in slices of at most maxPause, between which
+// the write lock is released, and the refresh returns after the first slice
+// while a background goroutine replays the rest.
+//
+// Writes that don't depend on the contents of the map, such as Insert,
+// InsertMany, Clear, Replace, Batch and ApplyOp, are queued behind the replay
+// and only wait for the slice in progress. Writes that do, such as Delete or
+// Update, as well as Get and the next refresh, first finish the replay, so they
+// may still pause for its remainder. The oplog is always replayed in full by
+// maps with a maximum number of entries, and before every write to a durable
+// map.
+func WithIncrementalRefresh(maxPause time.Duration) OptionFunc {
+	return func(o *Options) {
+		o.MaxRefreshPause = maxPause
+	}
+}
+
+// WithAsyncRefresh makes Refresh return as soon as the readers have been moved
+// to the new snapshot, rather than once the readers have left the old readable
+// map and the oplog has been replayed to it. A background goroutine finishes
+// the refresh, and writes, reads of the writable map and the next refresh wait
+// until it's finished, or finish it themselves if they get the write lock
+// first. This cuts the latency of Refresh, but not the time until the next
+// write can be made. RefreshAndWait still waits for the readers.
+func WithAsyncRefresh() OptionFunc {
+	return func(o *Options) {
+		o.AsyncRefresh = true
+	}
+}
+
+// WithReaderlessWrites applies writes that are made while no reader is
+// registered to the writable map without pushing them to the oplog, and makes
+// the next refresh copy the whole map to the second map instead of replaying
+// the oplog. This saves recording every write twice while a map is populated
+// before it's read, such as during a warm start, at the cost of a refresh that
+// takes time proportional to the size of the map rather than to the number of
+// writes. The oplog is always used by maps with WithWriteBehind. The maps built
+// on top of a Map, such as BiMap and Multimap, skip it the same way.
+func WithReaderlessWrites() OptionFunc {
+	return func(o *Options) {
+		o.ReaderlessWrites = true
+	}
+}
+
+// WithPooledClears makes Clear and Replace swap an empty map in for each of the
+// internal maps, rather than deleting every key from them, which makes clearing
+// a large map and replaying the clear cost as little as clearing an empty map.
+// The empty maps come from an internal pool, which is refilled with the maps
+// that were swapped out once a background goroutine has emptied them, and with
+// new maps sized for InitialCapacity keys otherwise. Close must be called to
+// stop the goroutine.
+func WithPooledClears() OptionFunc {
+	return func(o *Options) {
+		o.PooledClears = true
+	}
+}
+
+// WithValueRecycling makes the map store its own copy of every inserted value,
+// in the storage of a value that was previously removed when there is one,
+// which cuts the garbage collector's work for maps that replace large values
+// at a high rate. Values are copied by assignment, in place of WithValueCopy.
+//
+// The storage of a value that is deleted or overwritten is zeroed and reused
+// once the refresh that publishes the removal has synced both maps, and no
+// reader is frozen. A pointer to a value that was handed out by the map, such
+// as by Reader.Get, Map.Pop or a Change, must therefore not be used after the
+// value has been removed and the map has been refreshed; values that must
+// outlive that have to be copied. Values removed by operations applied with
+// ApplyOp are left to the garbage collector, and values are never recycled by
+// maps with WithWriteBehind or by the map variants that wrap their values, such
+// as TTLMap. PrefixMap stores its values as is and recycles them like a Map.
+func WithValueRecycling() OptionFunc {
+	return func(o *Options) {
+		o.RecycleValues = true
+	}
+}
+
+// WithKeyInterning interns the keys of maps whose keys are strings as they're
+// inserted, using the unique package, so that identical keys share a single
+// copy of their bytes across both internal maps and the oplog, however many
+// times and from however many different strings they're inserted. Interned
+// keys are copies, so keys that are sliced from larger strings, such as a
+// request body, don't keep those strings alive. Interning costs a lookup in a
+// global table per insert, and has no effect on maps whose keys aren't strings.
+func WithKeyInterning() OptionFunc {
+	return func(o *Options) {
+		o.InternKeys = true
+	}
+}
+
+// WithRefreshDeadline bounds how long a refresh waits for the readers that are
+// still reading from the previous snapshot, such as a reader whose goroutine
+// stalled in the middle of a read, or a guard that was never released. Once
+// the deadline has passed, the refresh returns a *StuckReadersError with the
+// IDs of the stuck readers, or detaches them with WithStuckReaderDetach. The
+// deadline applies to the refreshes made by Refresh, RefreshAndWait, automatic
+// refreshes and refreshes that finish a previous refresh, but not to writes
+// that have to wait for the readers, which wait for as long as it takes.
+func WithRefreshDeadline(deadline time.Duration) OptionFunc {
+	return func(o *Options) {
+		o.RefreshDeadline = deadline
+	}
+}
+
+// WithStuckReaderDetach makes a refresh whose deadline set with
+// WithRefreshDeadline has passed detach the stuck readers rather than fail.
+// Detached readers are closed, so later reads fail like reads of a closed
+// reader, while the reads that are in progress keep reading from the previous
+// map, which is abandoned to them and never modified again. The writable map
+// is replaced with a copy of the readable map, which makes the refresh as
+// expensive as copying the map.
+func WithStuckReaderDetach() OptionFunc {
+	return func(o *Options) {
+		o.DetachStuckReaders = true
+	}
+}
+
+// WithDebugChecks validates the internal invariants of the map after every
+// write and refresh, such as the readable and writable maps being distinct,
+// the oplog being empty and both maps holding the same values once a refresh
+// has synced the writable map, and every reader looking at the published
+// snapshot, and panics with a report of the violations and the state of the
+// map if any of them doesn't hold. The checks compare both maps key by key
+// after every refresh, so they're meant for tests rather than production.
+func WithDebugChecks() OptionFunc {
+	return func(o *Options) {
+		o.DebugChecks = true
+	}
+}
+
+// WithClock replaces the source of time of the map, which is used by automatic,
+// coalesced and timestamped features such as WithAutoRefreshInterval,
+// WithRefreshCoalesceWindow, WithEntryTimestamps and TTLMap, so that tests can
+// advance time deterministically rather than sleeping.
+func WithClock(clock Clock) OptionFunc {
+	return func(o *Options) {
+		o.Clock = clock
+	}
+}
+
+// WithOplogCompaction compacts the oplog before it's replayed into the second
+// map after each refresh, so that writes that were overwritten by a later write
+// of the same key or by a clear aren't replayed. This shortens the sync for
+// workloads that write the same keys repeatedly between refreshes, at the cost
+// of a pass over the oplog that is wasted for workloads that don't.
+func WithOplogCompaction() OptionFunc {
+	return func(o *Options) {
+		o.CompactOplog = true
+	}
+}
+
+// WithProfilerLabels attaches pprof labels with the "evmap" key to refreshes,
+// and to the work of the background goroutines of the map, so that CPU profiles
+// attribute their cost to the map. Refreshes are labeled "refresh", and the work
+// of the goroutines started by WithAutoRefreshInterval, WithWriteBehind,
+// WithCheckpointInterval and NewTTLMap is labeled "auto-refresh",
+// "write-behind", "checkpoint" and "ttl-sweep", except for the refreshes that
+// they perform.
+//
+// The labels of a refresh are added to the labels of the context passed to
+// RefreshAndWait. Refresh has no context, so it resets the labels of the
+// calling goroutine when it returns, and applications that label the goroutines
+// that call Refresh should use RefreshAndWait with the labeled context instead.
+func WithProfilerLabels() OptionFunc {
+	return func(o *Options) {
+		o.ProfilerLabels = true
+	}
+}
+
+// WithMaxEntries bounds the map to n keys. Once a write grows the map beyond
+// n keys, keys chosen by the eviction policy are deleted until the map fits
+// again. Evictions are recorded as regular deletes in the oplog, so they become
+// visible to readers at the next refresh. Keys are evicted least recently
+// written first unless WithEvictionPolicy is used.
+func WithMaxEntries(n int) OptionFunc {
+	return func(o *Options) {
+		o.MaxEntries = n
+	}
+}
+
+// WithEvictionPolicy sets the function used to create the eviction policy of a
+// map created with WithMaxEntries. A function is used rather than a policy so
+// that maps created from the same options, such as the shards of a ShardedMap,
+// don't share a policy. The type of the keys must match the key type of the map.
+func WithEvictionPolicy[K comparable](fn func() EvictionPolicy[K]) OptionFunc {
+	return func(o *Options) {
+		o.evictionPolicy = fn
+	}
+}
+
+// WithLoader turns the map into a read-through cache. When Reader.GetOrLoad
+// misses, fn is called to load the value, which is then inserted into the map
+// and returned. Concurrent misses of the same key share a single call to fn. The
+// types of the keys and values must match the types of the map.
+func WithLoader[K comparable, V any](fn func(key K) (*V, error)) OptionFunc {
+	return func(o *Options) {
+		o.loader = fn
+	}
+}
+
+// WithWriteBehind hands the oplog entries published by every refresh to sink,
+// which can persist them, for example to a database. The sink is called from a
+// background goroutine with the entries of one refresh at a time, in the order
+// they were published, so the writer never waits for it. Map.Flush waits for the
+// sink to catch up and reports its errors, and Map.Close waits for every queued
+// refresh to be handed to the sink. The types of the keys and values must match
+// the types of the map.
+func WithWriteBehind[K comparable, V any](sink func(entries []*oplog.Entry[K, *V]) error) OptionFunc {
+	return func(o *Options) {
+		o.writeBehind = sink
+	}
+}
+
+// WithConflictResolver sets the function used to merge writes to the same key
+// made through different write handles, which are only resolved against each
+// other when they are merged by the same refresh. fn is called with the write
+// chosen so far and another write, and returns the write to keep. By default the
+// write with the latest time wins. The types of the keys and values must match
+// the types of the map.
+func WithConflictResolver[K comparable, V any](fn func(existing, incoming HandleWrite[K, V]) HandleWrite[K, V]) OptionFunc {
+	return func(o *Options) {
+		o.conflictResolver = fn
+	}
+}
+
+// WithValueEqual sets the function used to compare values in operations such as
+// CompareAndSwap. By default, values are compared by pointer identity. The type
+// of the values must match the value type of the map.
+func WithValueEqual[V any](equal func(a, b *V) bool) OptionFunc {
+	return func(o *Options) {
+		o.valueEqual = equal
+	}
+}
+
+// WithValueCopy causes the map to store a copy of every inserted value, made
+// by calling fn, rather than the pointer that was passed in. This protects the
+// readers from callers that modify a value after inserting it. The type of the
+// values must match the value type of the map.
+func WithValueCopy[V any](fn func(v *V) *V) OptionFunc {
+	return func(o *Options) {
+		o.valueCopy = fn
+	}
+}
+
+// newOptions returns the default options with the provided option functions
+// applied on top of them.
+func newOptions(opts ...OptionFunc) Options {
+	o := Options{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.Metrics == nil {
+		o.Metrics = nopMetrics{}
+	}
+	if o.Clock == nil {
+		o.Clock = realClock{}
+	}
+	if o.Tracer == nil {
+		o.Tracer = nopTracer{}
+	}
+
+	return o
+}
+
+// unsupportedOptions returns the names of the fields of the options that were
+// changed from their defaults, other than the supported ones, for the types
+// that only honor a subset of the options.
+func unsupportedOptions(o Options, supported ...string) []string {
+	defaults := reflect.ValueOf(newOptions())
+	set := reflect.ValueOf(o)
+	var names []string
+	for i := 0; i < set.NumField(); i++ {
+		name := set.Type().Field(i).Name
+		if slices.Contains(supported, name) {
+			continue
+		}
+		// Only exported fields have defaults, and the other fields can't be
+		// compared through reflection
+		field, def := set.Field(i), defaults.Field(i)
+		if def.IsZero() && !field.IsZero() || !def.IsZero() && !reflect.DeepEqual(field.Interface(), def.Interface()) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// withoutValueOptions returns a copy of the options without the options that
+// are specific to the value type of the map. This is used by the map variants
+// that store a different value type in their underlying Map than their own.
+func (o Options) withoutValueOptions() Options {
+	o.valueEqual = nil
+	o.valueCopy = nil
+	o.RecycleValues = false
+	o.loader = nil
+	o.writeBehind = nil
+	o.valueCodec = nil
+	o.conflictResolver = nil
+	return o
+}
+
+// valueEqual returns the value equality function from the options, panicking if
+// it was configured for a different value type.
+func valueEqual[V any](o Options) func(a, b *V) bool {
+	if o.valueEqual == nil {
+		return func(a, b *V) bool {
+			return a == b
+		}
+	}
+	equal, ok := o.valueEqual.(func(a, b *V) bool)
+	if !ok {
+		panic(fmt.Sprintf("eventual: WithValueEqual expects a %T", equal))
+	}
+	return equal
+}
+
+// valueCopy returns the value copy function from the options, or nil if values
+// shouldn't be copied, panicking if it was configured for a different value type.
+func valueCopy[V any](o Options) func(v *V) *V {
+	if o.valueCopy == nil {
+		return nil
+	}
+	fn, ok := o.valueCopy.(func(v *V) *V)
+	if !ok {
+		panic(fmt.Sprintf("eventual: WithValueCopy expects a %T", fn))
+	}
+	return fn
+}
+
+// evictionPolicy returns a new eviction policy as configured by the options, or
+// nil if the map is unbounded, panicking if the policy was configured for a
+// different key type.
+func evictionPolicy[K comparable](o Options) EvictionPolicy[K] {
+	if o.MaxEntries <= 0 {
+		return nil
+	}
+	if o.evictionPolicy == nil {
+		return NewLRUPolicy[K]()
+	}
+	fn, ok := o.evictionPolicy.(func() EvictionPolicy[K])
+	if !ok {
+		panic(fmt.Sprintf("eventual: WithEvictionPolicy expects a %T", fn))
+	}
+	return fn()
+}
+
+// loader returns the loader from the options, or nil if there isn't one,
+// panicking if it was configured for different key or value types.
+func loader[K comparable, V any](o Options) func(key K) (*V, error) {
+	if o.loader == nil {
+		return nil
+	}
+	fn, ok := o.loader.(func(key K) (*V, error))
+	if !ok {
+		panic(fmt.Sprintf("eventual: WithLoader expects a %T", fn))
+	}
+	return fn
+}
+
+// writeBehindSink returns the write-behind sink from the options, or nil if
+// there isn't one, panicking if it was configured for different key or value
+// types.
+func writeBehindSink[K comparable, V any](o Options) func(entries []*oplog.Entry[K, *V]) error {
+	if o.writeBehind == nil {
+		return nil
+	}
+	fn, ok := o.writeBehind.(func(entries []*oplog.Entry[K, *V]) error)
+	if !ok {
+		panic(fmt.Sprintf("eventual: WithWriteBehind expects a %T", fn))
+	}
+	return fn
+}
+
+// conflictResolver returns the conflict resolver from the options, panicking if
+// it was configured for different key or value types.
+func conflictResolver[K comparable, V any](o Options) func(existing, incoming HandleWrite[K, V]) HandleWrite[K, V] {
+	if o.conflictResolver == nil {
+		return lastWriterWins[K, V]
+	}
+	fn, ok := o.conflictResolver.(func(existing, incoming HandleWrite[K, V]) HandleWrite[K, V])
+	if !ok {
+		panic(fmt.Sprintf("eventual: WithConflictResolver expects a %T", fn))
+	}
+	return fn
+}
+
+// keyCodec returns the key codec from the options, panicking if it was
+// configured for a different key type.
+func keyCodec[K comparable](o Options) Codec[K] {
+	if o.keyCodec == nil {
+		return GobCodec[K]{}
+	}
+	codec, ok := o.keyCodec.(Codec[K])
+	if !ok {
+		panic(fmt.Sprintf("eventual: WithKeyCodec expects a %T", &codec))
+	}
+	return codec
+}
+
+// valueCodec returns the value codec from the options, panicking if it was
+// configured for a different value type.
+func valueCodec[V any](o Options) Codec[V] {
+	if o.valueCodec == nil {
+		return GobCodec[V]{}
+	}
+	codec, ok := o.valueCodec.(Codec[V])
+	if !ok {
+		panic(fmt.Sprintf("eventual: WithValueCodec expects a %T", &codec))
+	}
+	return codec
+}
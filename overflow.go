@@ -0,0 +1,76 @@
+package eventual
+
+import (
+	"context"
+)
+
+// OverflowPolicy determines what happens to the writes to a map whose oplog has
+// reached the maximum size set by WithMaxOplogSize.
+type OverflowPolicy int
+
+const (
+	// OverflowRefresh refreshes the map as soon as a write fills the oplog,
+	// which bounds the oplog without ever failing or blocking a write.
+	OverflowRefresh OverflowPolicy = iota
+
+	// OverflowBlock blocks writes while the oplog is full, until the map is
+	// refreshed by another goroutine or closed. The map must be refreshed
+	// independently of the blocked writers, for example with
+	// WithAutoRefreshInterval, or the writers block forever.
+	OverflowBlock
+
+	// OverflowError fails writes that don't fit in the oplog with ErrOplogFull.
+	// Writes that report a result rather than returning an error report that
+	// nothing was written.
+	OverflowError
+)
+
+// lockForWrite acquires the write lock like lockWriter before a write. If the
+// oplog is full and the overflow policy is OverflowBlock, it then waits until
+// the oplog has been replayed by a refresh or the map has been closed. This
+// must be called before the state of the writable map is inspected, since the
+// write lock is released while waiting.
+func (m *Map[K, V]) lockForWrite() {
+	m.lockWriter()
+	m.waitOplogRoomLocked(m.syncPendingLocked)
+}
+
+// lockForAppend is like lockForWrite but acquires the write lock like
+// lockAppender, for writes that don't inspect the writable map.
+func (m *Map[K, V]) lockForAppend() {
+	m.lockAppender()
+	m.waitOplogRoomLocked(m.waitPendingLocked)
+}
+
+// waitOplogRoomLocked waits while the oplog is full and the overflow policy is
+// OverflowBlock, calling sync after every refresh that it wakes up to.
+func (m *Map[K, V]) waitOplogRoomLocked(sync func(ctx context.Context) error) {
+	if m.options.MaxOplogSize <= 0 || m.options.OverflowPolicy != OverflowBlock {
+		return
+	}
+	for !m.closed && m.oplog.Len() >= m.options.MaxOplogSize {
+		m.oplogRoom.Wait()
+
+		// The refresh that woke us up may have given up waiting for the readers
+		_ = sync(context.Background())
+	}
+}
+
+// checkOplogLocked returns ErrOplogFull if n more entries don't fit in the oplog
+// and the overflow policy is OverflowError. This must be called while holding
+// the write lock, before any of the entries are pushed.
+func (m *Map[K, V]) checkOplogLocked(n int) error {
+	if m.options.MaxOplogSize <= 0 || m.options.OverflowPolicy != OverflowError {
+		return nil
+	}
+	if m.oplog.Len()+n > m.options.MaxOplogSize {
+		return ErrOplogFull
+	}
+	return nil
+}
+
+// oplogFullLocked reports whether the oplog has reached its maximum size and
+// the overflow policy is OverflowRefresh, in which case the map is refreshed.
+func (m *Map[K, V]) oplogFullLocked() bool {
+	return m.options.MaxOplogSize > 0 && m.options.OverflowPolicy == OverflowRefresh && m.oplog.Len() >= m.options.MaxOplogSize
+}
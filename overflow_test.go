@@ -0,0 +1,129 @@
+package eventual
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestWithMaxOplogSize_Refresh(t *testing.T) {
+	m := NewMap[int, int](WithMaxOplogSize(3, OverflowRefresh))
+	reader := m.Reader()
+	for i := 0; i < 7; i++ {
+		v := i
+		assert.NoError(t, m.Insert(i, &v))
+		assert.Less(t, m.oplog.Len(), 3)
+	}
+	assert.Len(t, reader.Snapshot(), 6)
+	assert.Equal(t, uint64(2), m.Generation())
+}
+
+func TestWithMaxOplogSize_Error(t *testing.T) {
+	m := NewMap[int, int](WithMaxOplogSize(2, OverflowError))
+	v := 1
+	assert.NoError(t, m.Insert(1, &v))
+	assert.NoError(t, m.Insert(2, &v))
+	assert.ErrorIs(t, m.Insert(3, &v), ErrOplogFull)
+	assert.False(t, m.Delete(1))
+	assert.Equal(t, 2, m.Len())
+
+	// The writes that report a boolean have variants returning the error
+	w := 2
+	_, _, err := m.SwapErr(1, &w)
+	assert.ErrorIs(t, err, ErrOplogFull)
+	_, err = m.DeleteErr(1)
+	assert.ErrorIs(t, err, ErrOplogFull)
+	_, _, err = m.PopErr(1)
+	assert.ErrorIs(t, err, ErrOplogFull)
+	_, err = m.CompareAndSwapErr(1, &v, &w)
+	assert.ErrorIs(t, err, ErrOplogFull)
+	_, err = m.CompareAndDeleteErr(1, &v)
+	assert.ErrorIs(t, err, ErrOplogFull)
+	_, _, err = m.GetOrInsertErr(3, &w)
+	assert.ErrorIs(t, err, ErrOplogFull)
+	got, _ := m.Get(1)
+	assert.Same(t, &v, got)
+
+	// Keys that don't exist or don't match aren't errors
+	_, ok, err := m.PopErr(3)
+	assert.False(t, ok)
+	assert.NoError(t, err)
+	ok, err = m.CompareAndSwapErr(1, &w, &v)
+	assert.False(t, ok)
+	assert.NoError(t, err)
+
+	// Refreshing makes room in the oplog
+	assert.NoError(t, m.Refresh())
+	assert.True(t, m.Delete(1))
+	assert.ErrorIs(t, m.Replace(map[int]*int{}), ErrOplogFull)
+
+	// The maps built on top of a Map are bounded too
+	ttl := NewTTLMap[int, int](WithMaxOplogSize(1, OverflowError))
+	defer ttl.Close()
+	assert.NoError(t, ttl.Insert(1, &v))
+	assert.ErrorIs(t, ttl.Insert(2, &v), ErrOplogFull)
+
+	hasher := NewMapWithHasher[int, int](func(k int) uint64 { return uint64(k) }, func(a, b int) bool { return a == b }, WithMaxOplogSize(1, OverflowError))
+	assert.NoError(t, hasher.Insert(1, &v))
+	assert.ErrorIs(t, hasher.Insert(2, &v), ErrOplogFull)
+	assert.False(t, hasher.Delete(1))
+	assert.Equal(t, 1, hasher.Len())
+
+	multi := NewMultimap[int, int](WithMaxOplogSize(1, OverflowError))
+	assert.NoError(t, multi.Insert(1, 1))
+	assert.ErrorIs(t, multi.Insert(1, 2), ErrOplogFull)
+	assert.False(t, multi.Remove(1, 1))
+	assert.Equal(t, []int{1}, multi.Get(1))
+
+	prefix := NewPrefixMap[int](WithMaxOplogSize(1, OverflowError))
+	assert.NoError(t, prefix.Insert("a", &v))
+	assert.ErrorIs(t, prefix.Insert("b", &v), ErrOplogFull)
+	assert.False(t, prefix.Delete("a"))
+	assert.NoError(t, prefix.Refresh())
+	assert.Equal(t, []string{"a"}, prefix.Reader().Prefix(""))
+
+	// A BiMap insert that replaces a pair is written entirely or not at all
+	bi := NewBiMap[int, string](WithMaxOplogSize(4, OverflowError))
+	assert.NoError(t, bi.Insert(1, "a"))
+	assert.ErrorIs(t, bi.Insert(1, "b"), ErrOplogFull)
+	value, ok := bi.Get(1)
+	assert.True(t, ok)
+	assert.Equal(t, "a", value)
+	key, ok := bi.GetByValue("a")
+	assert.True(t, ok)
+	assert.Equal(t, 1, key)
+	assert.NoError(t, bi.Insert(2, "b"))
+	assert.False(t, bi.Delete(1))
+}
+
+func TestWithMaxOplogSize_Block(t *testing.T) {
+	m := NewMap[int, int](WithMaxOplogSize(1, OverflowBlock))
+	reader := m.Reader()
+	v := 1
+	assert.NoError(t, m.Insert(1, &v))
+
+	inserted := make(chan error)
+	go func() {
+		inserted <- m.Insert(2, &v)
+	}()
+	select {
+	case <-inserted:
+		t.Fatal("insert should block while the oplog is full")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	// Refreshing unblocks the writer
+	assert.NoError(t, m.Refresh())
+	assert.NoError(t, <-inserted)
+	assert.NoError(t, m.Refresh())
+	assert.Len(t, reader.Snapshot(), 2)
+
+	// Closing the map unblocks the writer too
+	assert.NoError(t, m.Insert(3, &v))
+	go func() {
+		inserted <- m.Insert(4, &v)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	assert.NoError(t, m.Close())
+	assert.ErrorIs(t, <-inserted, ErrClosed)
+}
@@ -0,0 +1,142 @@
+package eventual
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+)
+
+// WriteTo encodes the state of the map that is visible to the readers to w
+// using the map's key and value codecs, so that it can be restored with
+// ReadMapFrom, for example to save the map at shutdown and restore it at
+// startup. Writes that have not been exposed to the readers yet are not
+// included. The key and value pointers of the visible map are copied before
+// encoding, so writers are not blocked while w is written to.
+func (m *Map[K, V]) WriteTo(w io.Writer) (n int64, err error) {
+	_, span := m.options.Tracer.Start(context.Background(), "evmap.WriteTo")
+	defer func() {
+		span.SetAttribute("evmap.bytes", n)
+		span.End(err)
+	}()
+
+	m.writeLock.Lock()
+	if m.closed {
+		m.writeLock.Unlock()
+		return 0, ErrClosed
+	}
+
+	// The readable map is only swapped while holding the write lock, so it can
+	// be copied without waiting for readers. The values are encoded after the
+	// lock is released though, and with WithValueRecycling a refresh may zero and
+	// reuse the storage of a value that was removed in the meantime, so copy the
+	// values themselves in that case.
+	var rec walRecord[K, V]
+	for k, v := range *m.readable {
+		if m.free != nil && v != nil {
+			c := *v
+			v = &c
+		}
+		rec.insert(k, v)
+	}
+	m.writeLock.Unlock()
+	span.SetAttribute("evmap.keys", int64(rec.ops.Len()))
+
+	data, err := rec.encode(entryCodec[K, V](m.options))
+	if err != nil {
+		return 0, err
+	}
+	cw := &countingWriter{w: w}
+	_, err = cw.Write(data)
+	return cw.n, err
+}
+
+// ReadMapFrom creates a new Map populated with the contents decoded from r,
+// which were written by Map.WriteTo. The codecs set with WithKeyCodec and
+// WithValueCodec must match the codecs that were used to write the contents.
+// Like NewMapFrom, readers of the new map observe the contents immediately.
+func ReadMapFrom[K comparable, V any](r io.Reader, opts ...OptionFunc) (_ *Map[K, V], err error) {
+	options := newOptions(opts...)
+	_, span := options.Tracer.Start(context.Background(), "evmap.ReadMapFrom")
+	defer func() { span.End(err) }()
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	span.SetAttribute("evmap.bytes", int64(len(data)))
+	rec, err := decodeRecord(entryCodec[K, V](options), data)
+	if err != nil {
+		return nil, err
+	}
+	span.SetAttribute("evmap.keys", int64(len(rec.Entries())))
+	w := make(map[K]*V, max(len(rec.Entries()), options.InitialCapacity))
+	rec.Apply(&w)
+	readable := make(map[K]*V, len(w))
+	for k, v := range w {
+		readable[k] = v
+	}
+	return newMap(readable, w, options), nil
+}
+
+// countingWriter counts the bytes written to w.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// MarshalJSON encodes the state of the map that is visible to the readers as a
+// JSON object, which is useful for debug endpoints. Like WriteTo, writes that
+// have not been exposed to the readers yet are not included. The keys must be
+// supported as JSON object keys by encoding/json.
+func (m *Map[K, V]) MarshalJSON() ([]byte, error) {
+	m.writeLock.Lock()
+	if m.closed {
+		m.writeLock.Unlock()
+		return nil, ErrClosed
+	}
+	contents := copyValues(*m.readable)
+	m.writeLock.Unlock()
+	return json.Marshal(contents)
+}
+
+// UnmarshalJSON decodes a JSON object into the map. Unmarshaling into an
+// existing map inserts the decoded keys and values with a single InsertMany,
+// so like any other write they only become visible to the readers at the next
+// refresh. Unmarshaling into a zero Map initializes it with the default options
+// and the decoded contents, which like NewMapFrom are visible immediately.
+func (m *Map[K, V]) UnmarshalJSON(data []byte) error {
+	var contents map[K]V
+	if err := json.Unmarshal(data, &contents); err != nil {
+		return err
+	}
+	entries := make(map[K]*V, len(contents))
+	for k, v := range contents {
+		entries[k] = &v
+	}
+	if m.oplog == nil {
+		r := make(map[K]*V, len(entries))
+		for k, v := range entries {
+			r[k] = v
+		}
+		m.init(r, entries, newOptions())
+		return nil
+	}
+	return m.InsertMany(entries)
+}
+
+// MarshalJSON encodes the state of the map that is visible to this reader as a
+// JSON object.
+func (r *Reader[K, V]) MarshalJSON() ([]byte, error) {
+	s, err := r.tryEnter()
+	if err != nil {
+		return nil, err
+	}
+	defer r.exit(s)
+	return json.Marshal(copyValues(*s.m))
+}
@@ -0,0 +1,146 @@
+package eventual
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestMap_WriteTo(t *testing.T) {
+	m := NewMap[string, int]()
+	v1, v2 := 1, 2
+	assert.NoError(t, m.Insert("foo", &v1))
+	assert.NoError(t, m.Insert("bar", &v2))
+	assert.NoError(t, m.Refresh())
+
+	// Writes that aren't visible yet aren't saved
+	assert.NoError(t, m.Insert("baz", &v1))
+
+	var buf bytes.Buffer
+	n, err := m.WriteTo(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(buf.Len()), n)
+
+	restored, err := ReadMapFrom[string, int](&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"foo": 1, "bar": 2}, restored.Reader().Snapshot())
+
+	_, err = ReadMapFrom[string, int](bytes.NewBufferString("garbage"))
+	assert.Error(t, err)
+
+	assert.NoError(t, m.Close())
+	_, err = m.WriteTo(&buf)
+	assert.ErrorIs(t, err, ErrClosed)
+}
+
+// upperCodec is a Codec that stores strings in upper case.
+type upperCodec struct{}
+
+func (upperCodec) Encode(v string) ([]byte, error) {
+	return []byte(strings.ToUpper(v)), nil
+}
+
+func (upperCodec) Decode(data []byte) (string, error) {
+	return string(data), nil
+}
+
+func TestWithKeyCodec(t *testing.T) {
+	m := NewMapFrom(map[string]int{"foo": 1}, WithKeyCodec[string](upperCodec{}), WithValueCodec[int](JSONCodec[int]{}))
+
+	var buf bytes.Buffer
+	_, err := m.WriteTo(&buf)
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), "FOO")
+
+	restored, err := ReadMapFrom[string, int](&buf, WithKeyCodec[string](upperCodec{}), WithValueCodec[int](JSONCodec[int]{}))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"FOO": 1}, restored.Snapshot())
+
+	assert.Panics(t, func() {
+		_, _ = ReadMapFrom[int, int](&buf, WithKeyCodec[string](upperCodec{}))
+	})
+}
+
+// hookCodec is a JSONCodec that calls hook before encoding a value.
+type hookCodec struct {
+	JSONCodec[int]
+	hook func()
+}
+
+func (c hookCodec) Encode(v int) ([]byte, error) {
+	c.hook()
+	return c.JSONCodec.Encode(v)
+}
+
+func TestMap_WriteToRecycled(t *testing.T) {
+	var m *Map[string, int]
+	var once sync.Once
+	codec := hookCodec{hook: func() {
+		// The values are encoded after the write lock is released, and
+		// removing them and refreshing recycles the storage of the values
+		// that haven't been encoded yet
+		once.Do(func() {
+			assert.NoError(t, m.Clear())
+			assert.NoError(t, m.Refresh())
+		})
+	}}
+	m = NewMapFrom(map[string]int{"foo": 1, "bar": 2}, WithValueRecycling(), WithValueCodec[int](codec))
+	defer m.Close()
+
+	var buf bytes.Buffer
+	_, err := m.WriteTo(&buf)
+	assert.NoError(t, err)
+	assert.Empty(t, m.Snapshot())
+
+	restored, err := ReadMapFrom[string, int](&buf, WithValueCodec[int](codec))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"foo": 1, "bar": 2}, restored.Snapshot())
+}
+
+func TestMap_MarshalJSON(t *testing.T) {
+	m := NewMapFrom(map[string]int{"foo": 1})
+	reader := m.Reader()
+	v := 2
+	assert.NoError(t, m.Insert("bar", &v))
+
+	data, err := json.Marshal(m)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"foo":1}`, string(data))
+
+	assert.NoError(t, m.Refresh())
+	data, err = json.Marshal(reader)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"foo":1,"bar":2}`, string(data))
+
+	assert.NoError(t, reader.Close())
+	_, err = json.Marshal(reader)
+	assert.ErrorIs(t, err, ErrReaderClosed)
+}
+
+func TestMap_UnmarshalJSON(t *testing.T) {
+	t.Run("existing map", func(t *testing.T) {
+		m := NewMap[string, int]()
+		reader := m.Reader()
+		assert.NoError(t, json.Unmarshal([]byte(`{"foo":1}`), m))
+		assert.False(t, reader.Has("foo"))
+		assert.NoError(t, m.Refresh())
+		v, ok := reader.Get("foo")
+		assert.True(t, ok)
+		assert.Equal(t, 1, *v)
+	})
+	t.Run("zero map", func(t *testing.T) {
+		var fixture struct {
+			Users *Map[string, int] `json:"users"`
+		}
+		assert.NoError(t, json.Unmarshal([]byte(`{"users":{"foo":1,"bar":2}}`), &fixture))
+		assert.Equal(t, map[string]int{"foo": 1, "bar": 2}, fixture.Users.Reader().Snapshot())
+		assert.NoError(t, fixture.Users.Close())
+	})
+	t.Run("invalid", func(t *testing.T) {
+		m := NewMap[string, int]()
+		assert.Error(t, json.Unmarshal([]byte(`[1]`), m))
+	})
+}
@@ -0,0 +1,110 @@
+package eventual
+
+import (
+	"runtime"
+	"sync/atomic"
+	"unsafe"
+)
+
+// snapshotOf is a readable map of type M as it was published by a single
+// refresh. The snapshots of a Map are snapshots of a map[K]*V, and those of a
+// ValueMap are snapshots of a map[K]V.
+type snapshotOf[M any] struct {
+	m *M
+
+	// side identifies which of the two maps m is, and which of the reader's pin
+	// counts must be incremented while reading from it.
+	side uint8
+
+	// generation is the number of refreshes that preceded this snapshot
+	generation uint64
+
+	// replaced is closed once this snapshot has been replaced by a newer one
+	replaced chan struct{}
+
+	// meta is the value that was set with Map.SetMeta when this snapshot was
+	// published
+	meta any
+
+	// index is an optional immutable index of m that was built by Map.index
+	// when this snapshot was published
+	index any
+}
+
+// pinState is the part of a reader that refreshes synchronize with, shared by
+// the readers of a Map and of a ValueMap.
+type pinState[M any] struct {
+	// pins counts the reads that are currently in progress against each side
+	// of the map. Refresh uses these counts to wait for in-flight reads against
+	// the old readable map to finish before it starts modifying that map. This
+	// is a count rather than a flag so that a reader can be shared between
+	// goroutines and pinned more than once at a time.
+	pins [3]int64
+
+	// The *snapshotOf[M] that reads should be performed against
+	snapshot unsafe.Pointer
+
+	closed uint32
+}
+
+// tryEnter pins the reader's current snapshot and returns it, or returns
+// ErrReaderClosed if the reader has been closed. The snapshot must be unpinned
+// with exit once the read is done.
+func (p *pinState[M]) tryEnter() (*snapshotOf[M], error) {
+	if atomic.LoadUint32(&p.closed) != 0 {
+		return nil, ErrReaderClosed
+	}
+	for {
+		s := (*snapshotOf[M])(atomic.LoadPointer(&p.snapshot))
+		atomic.AddInt64(&p.pins[s.side], 1)
+
+		// Refresh may have swapped the snapshot before it could observe our pin,
+		// in which case the map may already be in the process of being modified
+		// and we need to try again with the new snapshot.
+		if atomic.LoadPointer(&p.snapshot) != unsafe.Pointer(s) {
+			atomic.AddInt64(&p.pins[s.side], -1)
+			continue
+		}
+
+		// Closing the reader, or the map, may have happened after the check above
+		// but before it could observe our pin, in which case nothing waits for us
+		// before the snapshot is cleared or reused, so we have to back out.
+		if atomic.LoadUint32(&p.closed) != 0 {
+			atomic.AddInt64(&p.pins[s.side], -1)
+			return nil, ErrReaderClosed
+		}
+		return s, nil
+	}
+}
+
+// exit unpins a snapshot that was returned by tryEnter.
+func (p *pinState[M]) exit(s *snapshotOf[M]) {
+	atomic.AddInt64(&p.pins[s.side], -1)
+}
+
+// swapSnapshot makes the reader read from s from now on. Reads that are in
+// progress keep the previous snapshot pinned until they're done.
+func (p *pinState[M]) swapSnapshot(s *snapshotOf[M]) {
+	atomic.StorePointer(&p.snapshot, unsafe.Pointer(s))
+}
+
+// pinned reports whether a read is in progress against the side.
+func (p *pinState[M]) pinned(side uint8) bool {
+	return atomic.LoadInt64(&p.pins[side]) != 0
+}
+
+// waitUnpinned waits for the reads in progress against the side to finish.
+func (p *pinState[M]) waitUnpinned(side uint8) {
+	for p.pinned(side) {
+		runtime.Gosched()
+	}
+}
+
+// loadPins returns the reader's pin counts of each side.
+func (p *pinState[M]) loadPins() [3]int64 {
+	var pins [3]int64
+	for i := range pins {
+		pins[i] = atomic.LoadInt64(&p.pins[i])
+	}
+	return pins
+}
@@ -0,0 +1,155 @@
+package evgrpc
+
+import (
+	"context"
+	"github.com/clarkmcc/go-evmap"
+	"google.golang.org/grpc"
+)
+
+// Client reads a map served by Register. Its methods mirror the lookups of an
+// eventual.Reader, but because every call is a remote call, they take a context
+// and return an error.
+type Client[K comparable, V any] struct {
+	cc     grpc.ClientConnInterface
+	codecs codecs[K, V]
+}
+
+// NewClient creates a client that reads the map served on the connection.
+func NewClient[K comparable, V any](cc grpc.ClientConnInterface, opts ...OptionFunc) *Client[K, V] {
+	return &Client[K, V]{cc: cc, codecs: newCodecs[K, V](opts...)}
+}
+
+func (c *Client[K, V]) invoke(ctx context.Context, method string, req, resp message) error {
+	return c.cc.Invoke(ctx, "/"+ServiceName+"/"+method, req, resp, grpc.CallContentSubtype(codecName))
+}
+
+// Get returns the value of the key that is visible to the server's reader.
+func (c *Client[K, V]) Get(ctx context.Context, key K) (*V, bool, error) {
+	data, err := c.codecs.keys.Encode(key)
+	if err != nil {
+		return nil, false, err
+	}
+	resp := &valueMessage{}
+	if err := c.invoke(ctx, "Get", &keyRequest{key: data}, resp); err != nil {
+		return nil, false, err
+	}
+	return c.codecs.decodeValue(resp)
+}
+
+// Has reports whether the key is visible to the server's reader.
+func (c *Client[K, V]) Has(ctx context.Context, key K) (bool, error) {
+	_, ok, err := c.Get(ctx, key)
+	return ok, err
+}
+
+// GetMany looks up every key against a single snapshot of the server's reader.
+// Like Reader.GetMany, keys that are not visible are omitted from the result.
+func (c *Client[K, V]) GetMany(ctx context.Context, keys []K) (map[K]*V, error) {
+	req := &keysMessage{keys: make([][]byte, 0, len(keys))}
+	for _, k := range keys {
+		data, err := c.codecs.keys.Encode(k)
+		if err != nil {
+			return nil, err
+		}
+		req.keys = append(req.keys, data)
+	}
+	resp := &entriesMessage{}
+	if err := c.invoke(ctx, "GetMany", req, resp); err != nil {
+		return nil, err
+	}
+
+	values := make(map[K]*V, len(resp.entries))
+	for _, e := range resp.entries {
+		k, err := c.codecs.keys.Decode(e.key)
+		if err != nil {
+			return nil, err
+		}
+		v, _, err := c.codecs.decodeValue(e)
+		if err != nil {
+			return nil, err
+		}
+		values[k] = v
+	}
+	return values, nil
+}
+
+// Keys returns the keys that are visible to the server's reader, in no
+// particular order.
+func (c *Client[K, V]) Keys(ctx context.Context) ([]K, error) {
+	resp := &keysMessage{}
+	if err := c.invoke(ctx, "Keys", &emptyMessage{}, resp); err != nil {
+		return nil, err
+	}
+	keys := make([]K, 0, len(resp.keys))
+	for _, data := range resp.keys {
+		k, err := c.codecs.keys.Decode(data)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+// Watch returns a channel that receives a Change every time a refresh on the
+// server changes the value of the key. Like Map.Watch, values are compared by
+// pointer identity on the server, and changes that happen faster than they're
+// received are collapsed. The channel is closed when the context is done or
+// the stream fails.
+func (c *Client[K, V]) Watch(ctx context.Context, key K) (<-chan eventual.Change[K, V], error) {
+	data, err := c.codecs.keys.Encode(key)
+	if err != nil {
+		return nil, err
+	}
+	stream, err := c.cc.NewStream(ctx, &serviceDesc.Streams[0], "/"+ServiceName+"/Watch", grpc.CallContentSubtype(codecName))
+	if err != nil {
+		return nil, err
+	}
+	if err := stream.SendMsg(&keyRequest{key: data}); err != nil {
+		return nil, err
+	}
+	if err := stream.CloseSend(); err != nil {
+		return nil, err
+	}
+
+	// The first message is the current value, which the changes are relative to
+	resp := &valueMessage{}
+	if err := stream.RecvMsg(resp); err != nil {
+		return nil, err
+	}
+	old, existed, err := c.codecs.decodeValue(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan eventual.Change[K, V])
+	go func() {
+		defer close(ch)
+		for {
+			resp := &valueMessage{}
+			if err := stream.RecvMsg(resp); err != nil {
+				return
+			}
+			v, ok, err := c.codecs.decodeValue(resp)
+			if err != nil {
+				return
+			}
+			change := eventual.Change[K, V]{Key: key, Old: old, New: v, Generation: resp.generation}
+			switch {
+			case !ok:
+				change.Op, change.Deleted = eventual.ChangeDelete, true
+			case existed:
+				change.Op = eventual.ChangeUpdate
+			default:
+				change.Op = eventual.ChangeInsert
+			}
+			select {
+			case ch <- change:
+			case <-ctx.Done():
+				return
+			}
+			old, existed = v, ok
+		}
+	}()
+	return ch, nil
+}
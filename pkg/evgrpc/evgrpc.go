@@ -0,0 +1,104 @@
+// Package evgrpc serves an eventual.Reader over gRPC, so that other services
+// can read a map remotely. Register adds the service to a gRPC server, and a
+// Client provides the same lookups as a Reader on top of a client connection.
+//
+// The service doesn't require generated code. Its messages are encoded in the
+// protobuf wire format by a gRPC codec that this package registers under the
+// "evgrpc" content-subtype, and the keys and values within them are encoded
+// with an eventual.Codec, gob by default. The codecs of the client and the
+// server must match.
+//
+// Like the other integrations, evgrpc is a module of its own, so the map
+// doesn't require gRPC or protobuf.
+package evgrpc
+
+import (
+	"fmt"
+	"github.com/clarkmcc/go-evmap"
+)
+
+// ServiceName is the full name of the gRPC service.
+const ServiceName = "eventual.Reader"
+
+// Options contains the configurable behavior of a server or a Client.
+type Options struct {
+	// keyCodec and valueCodec are the eventual.Codec[K] and eventual.Codec[V]
+	// used to encode the keys and values. They're stored as interfaces because
+	// Options is not generic.
+	keyCodec   any
+	valueCodec any
+}
+
+type OptionFunc func(o *Options)
+
+// WithKeyCodec sets the codec used to encode keys. By default keys are encoded
+// with eventual.GobCodec.
+func WithKeyCodec[K comparable](codec eventual.Codec[K]) OptionFunc {
+	return func(o *Options) {
+		o.keyCodec = codec
+	}
+}
+
+// WithValueCodec sets the codec used to encode values. By default values are
+// encoded with eventual.GobCodec.
+func WithValueCodec[V any](codec eventual.Codec[V]) OptionFunc {
+	return func(o *Options) {
+		o.valueCodec = codec
+	}
+}
+
+// codecs are the key and value codecs resolved from the options.
+type codecs[K comparable, V any] struct {
+	keys   eventual.Codec[K]
+	values eventual.Codec[V]
+}
+
+func newCodecs[K comparable, V any](opts ...OptionFunc) codecs[K, V] {
+	var o Options
+	for _, fn := range opts {
+		fn(&o)
+	}
+	c := codecs[K, V]{keys: eventual.GobCodec[K]{}, values: eventual.GobCodec[V]{}}
+	if o.keyCodec != nil {
+		codec, ok := o.keyCodec.(eventual.Codec[K])
+		if !ok {
+			panic(fmt.Sprintf("evgrpc: WithKeyCodec expects a %T", &codec))
+		}
+		c.keys = codec
+	}
+	if o.valueCodec != nil {
+		codec, ok := o.valueCodec.(eventual.Codec[V])
+		if !ok {
+			panic(fmt.Sprintf("evgrpc: WithValueCodec expects a %T", &codec))
+		}
+		c.values = codec
+	}
+	return c
+}
+
+// encodeValue encodes the result of a lookup into the message.
+func (c codecs[K, V]) encodeValue(m *valueMessage, v *V, ok bool) error {
+	m.found = ok
+	m.isNil = ok && v == nil
+	if !ok || v == nil {
+		return nil
+	}
+	data, err := c.values.Encode(*v)
+	if err != nil {
+		return err
+	}
+	m.value = data
+	return nil
+}
+
+// decodeValue decodes the result of a lookup from the message.
+func (c codecs[K, V]) decodeValue(m *valueMessage) (*V, bool, error) {
+	if !m.found || m.isNil {
+		return nil, m.found, nil
+	}
+	v, err := c.values.Decode(m.value)
+	if err != nil {
+		return nil, false, err
+	}
+	return &v, true, nil
+}
@@ -0,0 +1,110 @@
+package evgrpc
+
+import (
+	"context"
+	"github.com/clarkmcc/go-evmap"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"net"
+	"testing"
+	"time"
+)
+
+// serve serves the reader on an in-memory connection and returns a client for
+// it.
+func serve[K comparable, V any](t *testing.T, r *eventual.Reader[K, V], opts ...OptionFunc) *Client[K, V] {
+	ln := bufconn.Listen(1 << 20)
+	s := grpc.NewServer()
+	Register(s, r, opts...)
+	go s.Serve(ln)
+	t.Cleanup(s.Stop)
+
+	cc, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return ln.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.NoError(t, err)
+	t.Cleanup(func() { cc.Close() })
+	return NewClient[K, V](cc, opts...)
+}
+
+func TestClient(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	m := eventual.NewMapFrom(map[string]int{"foo": 1, "bar": 2})
+	assert.NoError(t, m.Insert("baz", nil))
+	assert.NoError(t, m.Refresh())
+	client := serve(t, m.Reader(), WithValueCodec[int](eventual.JSONCodec[int]{}))
+
+	v, ok, err := client.Get(ctx, "foo")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, 1, *v)
+	v, ok, err = client.Get(ctx, "baz")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Nil(t, v)
+	ok, err = client.Has(ctx, "qux")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	values, err := client.GetMany(ctx, []string{"foo", "baz", "qux"})
+	assert.NoError(t, err)
+	assert.Len(t, values, 2)
+	assert.Equal(t, 1, *values["foo"])
+	assert.Nil(t, values["baz"])
+
+	keys, err := client.Keys(ctx)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"foo", "bar", "baz"}, keys)
+}
+
+func TestClient_Watch(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	m := eventual.NewMap[string, int]()
+	reader := m.Reader()
+	client := serve(t, reader)
+	changes, err := client.Watch(ctx, "foo")
+	assert.NoError(t, err)
+
+	v1, v2 := 1, 2
+	assert.NoError(t, m.Insert("foo", &v1))
+	assert.NoError(t, m.Refresh())
+	c := <-changes
+	assert.Equal(t, eventual.ChangeInsert, c.Op)
+	assert.Nil(t, c.Old)
+	assert.Equal(t, 1, *c.New)
+	assert.Equal(t, m.Generation(), c.Generation)
+
+	// Refreshes that don't change the key aren't sent
+	assert.NoError(t, m.Insert("bar", &v1))
+	assert.NoError(t, m.Refresh())
+	assert.NoError(t, m.Insert("foo", &v2))
+	assert.NoError(t, m.Refresh())
+	c = <-changes
+	assert.Equal(t, eventual.ChangeUpdate, c.Op)
+	assert.Equal(t, 1, *c.Old)
+	assert.Equal(t, 2, *c.New)
+
+	assert.True(t, m.Delete("foo"))
+	assert.NoError(t, m.Refresh())
+	c = <-changes
+	assert.Equal(t, eventual.ChangeDelete, c.Op)
+	assert.True(t, c.Deleted)
+	assert.Nil(t, c.New)
+
+	// Closing the map ends the stream, and other calls fail
+	assert.NoError(t, m.Close())
+	_, ok := <-changes
+	assert.False(t, ok)
+	_, _, err = client.Get(ctx, "foo")
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
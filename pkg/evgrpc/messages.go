@@ -0,0 +1,225 @@
+package evgrpc
+
+import (
+	"fmt"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// codecName is the content-subtype of the requests sent by a Client, which
+// selects the codec that the server uses to decode them.
+const codecName = "evgrpc"
+
+func init() {
+	encoding.RegisterCodec(codec{})
+}
+
+// message is implemented by every request and response of the service. The
+// messages are encoded in the protobuf wire format, with the keys and values
+// encoded by the codecs of the client and the server.
+type message interface {
+	marshal() []byte
+	unmarshal(data []byte) error
+}
+
+// codec is the gRPC codec of the messages of the service.
+type codec struct{}
+
+func (codec) Marshal(v any) ([]byte, error) {
+	m, ok := v.(message)
+	if !ok {
+		return nil, fmt.Errorf("evgrpc: can't marshal %T", v)
+	}
+	return m.marshal(), nil
+}
+
+func (codec) Unmarshal(data []byte, v any) error {
+	m, ok := v.(message)
+	if !ok {
+		return fmt.Errorf("evgrpc: can't unmarshal %T", v)
+	}
+	return m.unmarshal(data)
+}
+
+func (codec) Name() string {
+	return codecName
+}
+
+// keyRequest is the request of Get and Watch.
+type keyRequest struct {
+	key []byte
+}
+
+func (m *keyRequest) marshal() []byte {
+	return appendBytesField(nil, 1, m.key)
+}
+
+func (m *keyRequest) unmarshal(data []byte) error {
+	return unmarshalFields(data, func(num protowire.Number, v []byte) {
+		if num == 1 {
+			m.key = v
+		}
+	}, nil)
+}
+
+// keysMessage is the request of GetMany and the response of Keys.
+type keysMessage struct {
+	keys [][]byte
+}
+
+func (m *keysMessage) marshal() []byte {
+	var b []byte
+	for _, k := range m.keys {
+		b = appendBytesField(b, 1, k)
+	}
+	return b
+}
+
+func (m *keysMessage) unmarshal(data []byte) error {
+	return unmarshalFields(data, func(num protowire.Number, v []byte) {
+		if num == 1 {
+			m.keys = append(m.keys, v)
+		}
+	}, nil)
+}
+
+// valueMessage is the response of Get and Watch, and an entry of the response
+// of GetMany.
+type valueMessage struct {
+	key        []byte
+	found      bool
+	isNil      bool
+	value      []byte
+	generation uint64
+}
+
+func (m *valueMessage) marshal() []byte {
+	var b []byte
+	if m.key != nil {
+		b = appendBytesField(b, 1, m.key)
+	}
+	b = appendBoolField(b, 2, m.found)
+	b = appendBoolField(b, 3, m.isNil)
+	if m.value != nil {
+		b = appendBytesField(b, 4, m.value)
+	}
+	if m.generation != 0 {
+		b = protowire.AppendTag(b, 5, protowire.VarintType)
+		b = protowire.AppendVarint(b, m.generation)
+	}
+	return b
+}
+
+func (m *valueMessage) unmarshal(data []byte) error {
+	return unmarshalFields(data, func(num protowire.Number, v []byte) {
+		switch num {
+		case 1:
+			m.key = v
+		case 4:
+			m.value = v
+		}
+	}, func(num protowire.Number, v uint64) {
+		switch num {
+		case 2:
+			m.found = v != 0
+		case 3:
+			m.isNil = v != 0
+		case 5:
+			m.generation = v
+		}
+	})
+}
+
+// entriesMessage is the response of GetMany.
+type entriesMessage struct {
+	entries []*valueMessage
+}
+
+func (m *entriesMessage) marshal() []byte {
+	var b []byte
+	for _, e := range m.entries {
+		b = appendBytesField(b, 1, e.marshal())
+	}
+	return b
+}
+
+func (m *entriesMessage) unmarshal(data []byte) error {
+	var err error
+	uerr := unmarshalFields(data, func(num protowire.Number, v []byte) {
+		if num == 1 && err == nil {
+			e := &valueMessage{}
+			err = e.unmarshal(v)
+			m.entries = append(m.entries, e)
+		}
+	}, nil)
+	if uerr != nil {
+		return uerr
+	}
+	return err
+}
+
+// emptyMessage is the request of Keys.
+type emptyMessage struct{}
+
+func (*emptyMessage) marshal() []byte {
+	return nil
+}
+
+func (*emptyMessage) unmarshal(data []byte) error {
+	return unmarshalFields(data, nil, nil)
+}
+
+// appendBytesField appends a length-delimited protobuf field to b.
+func appendBytesField(b []byte, num protowire.Number, v []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, v)
+}
+
+// appendBoolField appends a varint protobuf field to b if v is true.
+func appendBoolField(b []byte, num protowire.Number, v bool) []byte {
+	if !v {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, 1)
+}
+
+// unmarshalFields calls onBytes for every length-delimited field and onVarint
+// for every varint field of the message, skipping fields of other types. Either
+// function may be nil.
+func unmarshalFields(data []byte, onBytes func(protowire.Number, []byte), onVarint func(protowire.Number, uint64)) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		switch typ {
+		case protowire.BytesType:
+			v, n := protowire.ConsumeBytes(data)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			if onBytes != nil {
+				onBytes(num, v)
+			}
+			data = data[n:]
+		case protowire.VarintType:
+			v, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			if onVarint != nil {
+				onVarint(num, v)
+			}
+			data = data[n:]
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			data = data[n:]
+		}
+	}
+	return nil
+}
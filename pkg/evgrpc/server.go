@@ -0,0 +1,204 @@
+package evgrpc
+
+import (
+	"context"
+	"errors"
+	"github.com/clarkmcc/go-evmap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// service is the handler type of the service description.
+type service interface {
+	get(ctx context.Context, req *keyRequest) (*valueMessage, error)
+	getMany(ctx context.Context, req *keysMessage) (*entriesMessage, error)
+	keys(ctx context.Context, req *emptyMessage) (*keysMessage, error)
+	watch(req *keyRequest, stream grpc.ServerStream) error
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*service)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "Get", Handler: unaryHandler("Get", service.get)},
+		{MethodName: "GetMany", Handler: unaryHandler("GetMany", service.getMany)},
+		{MethodName: "Keys", Handler: unaryHandler("Keys", service.keys)},
+	},
+	Streams: []grpc.StreamDesc{
+		{StreamName: "Watch", Handler: watchHandler, ServerStreams: true},
+	},
+}
+
+// unaryHandler adapts a method of the service to a gRPC method handler.
+func unaryHandler[Req any, Resp any, PReq interface {
+	*Req
+	message
+}](name string, fn func(service, context.Context, PReq) (Resp, error)) grpc.MethodHandler {
+	return func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+		req := PReq(new(Req))
+		if err := dec(req); err != nil {
+			return nil, err
+		}
+		if interceptor == nil {
+			return fn(srv.(service), ctx, req)
+		}
+		info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + ServiceName + "/" + name}
+		return interceptor(ctx, req, info, func(ctx context.Context, req any) (any, error) {
+			return fn(srv.(service), ctx, req.(PReq))
+		})
+	}
+}
+
+func watchHandler(srv any, stream grpc.ServerStream) error {
+	req := &keyRequest{}
+	if err := stream.RecvMsg(req); err != nil {
+		return err
+	}
+	return srv.(service).watch(req, stream)
+}
+
+// server serves a reader.
+type server[K comparable, V any] struct {
+	r      *eventual.Reader[K, V]
+	codecs codecs[K, V]
+}
+
+// Register registers a service on s that serves the map visible to the reader.
+// The reader is shared between requests and must not be closed while s is
+// serving, and like every read through the reader, requests only observe the
+// writes that have been refreshed.
+func Register[K comparable, V any](s grpc.ServiceRegistrar, r *eventual.Reader[K, V], opts ...OptionFunc) {
+	s.RegisterService(&serviceDesc, &server[K, V]{r: r, codecs: newCodecs[K, V](opts...)})
+}
+
+func (s *server[K, V]) get(_ context.Context, req *keyRequest) (*valueMessage, error) {
+	key, err := s.codecs.keys.Decode(req.key)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "decoding key: %v", err)
+	}
+	v, ok, err := s.r.GetErr(key)
+	if err != nil {
+		return nil, readerError(err)
+	}
+	resp := &valueMessage{}
+	if err := s.codecs.encodeValue(resp, v, ok); err != nil {
+		return nil, status.Errorf(codes.Internal, "encoding value: %v", err)
+	}
+	return resp, nil
+}
+
+// getMany and keys copy what they need while the snapshot is pinned and encode
+// it afterwards, so that encoding doesn't block refreshes.
+func (s *server[K, V]) getMany(_ context.Context, req *keysMessage) (*entriesMessage, error) {
+	keys := make([]K, 0, len(req.keys))
+	for _, data := range req.keys {
+		key, err := s.codecs.keys.Decode(data)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "decoding key: %v", err)
+		}
+		keys = append(keys, key)
+	}
+	g, err := s.r.GuardErr()
+	if err != nil {
+		return nil, readerError(err)
+	}
+	values := make([]*V, len(keys))
+	found := make([]bool, len(keys))
+	for i, key := range keys {
+		values[i], found[i] = g.Get(key)
+	}
+	g.Release()
+
+	resp := &entriesMessage{}
+	for i := range keys {
+		if !found[i] {
+			continue
+		}
+		e := &valueMessage{key: req.keys[i]}
+		if err := s.codecs.encodeValue(e, values[i], true); err != nil {
+			return nil, status.Errorf(codes.Internal, "encoding value: %v", err)
+		}
+		resp.entries = append(resp.entries, e)
+	}
+	return resp, nil
+}
+
+func (s *server[K, V]) keys(context.Context, *emptyMessage) (*keysMessage, error) {
+	g, err := s.r.GuardErr()
+	if err != nil {
+		return nil, readerError(err)
+	}
+	keys := make([]K, 0, g.Len())
+	g.ForEach(func(k K, _ *V) bool {
+		keys = append(keys, k)
+		return true
+	})
+	g.Release()
+
+	resp := &keysMessage{keys: make([][]byte, 0, len(keys))}
+	for _, k := range keys {
+		data, err := s.codecs.keys.Encode(k)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "encoding key: %v", err)
+		}
+		resp.keys = append(resp.keys, data)
+	}
+	return resp, nil
+}
+
+// watch sends the current value of the key, followed by the value every time a
+// refresh changes it. Like Map.Watch, values are compared by pointer identity
+// and refreshes that happen faster than the client receives are collapsed.
+func (s *server[K, V]) watch(req *keyRequest, stream grpc.ServerStream) error {
+	key, err := s.codecs.keys.Decode(req.key)
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "decoding key: %v", err)
+	}
+	ctx := stream.Context()
+	var prev *V
+	var prevOk bool
+	for first := true; ; first = false {
+		v, ok, gen, err := s.current(key)
+		if err != nil {
+			return err
+		}
+		if first || v != prev || ok != prevOk {
+			resp := &valueMessage{generation: gen}
+			if err := s.codecs.encodeValue(resp, v, ok); err != nil {
+				return status.Errorf(codes.Internal, "encoding value: %v", err)
+			}
+			if err := stream.SendMsg(resp); err != nil {
+				return err
+			}
+			prev, prevOk = v, ok
+		}
+		if err := s.r.WaitForGeneration(ctx, gen+1); err != nil {
+			return readerError(err)
+		}
+	}
+}
+
+// current returns the value of the key and the generation it was read from.
+func (s *server[K, V]) current(key K) (*V, bool, uint64, error) {
+	g, err := s.r.GuardErr()
+	if err != nil {
+		return nil, false, 0, readerError(err)
+	}
+	defer g.Release()
+	v, ok := g.Get(key)
+	return v, ok, g.Generation(), nil
+}
+
+// readerError converts an error returned by the reader to a gRPC status.
+func readerError(err error) error {
+	switch {
+	case errors.Is(err, eventual.ErrReaderClosed):
+		return status.Error(codes.Unavailable, err.Error())
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	}
+	return err
+}
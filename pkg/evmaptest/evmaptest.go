@@ -0,0 +1,348 @@
+// Package evmaptest stress tests an eventual.Map by running readers, writers
+// and refreshers against it concurrently on random schedules, and validating
+// that every snapshot observed by a reader is the state of the map after some
+// prefix of the writes, and that readers never observe an older snapshot than
+// one they already observed. It's meant to be run with -race, to check that a
+// combination of options behaves in CI:
+//
+//	func TestUsersMapOptions(t *testing.T) {
+//		evmaptest.Run(t, evmaptest.Config{
+//			Options: []eventual.OptionFunc{eventual.WithAsyncRefresh(), eventual.WithValueRecycling()},
+//		})
+//	}
+package evmaptest
+
+import (
+	"context"
+	"fmt"
+	"github.com/clarkmcc/go-evmap"
+	"math"
+	"math/rand"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Config configures a stress test. The zero value of every field is replaced
+// with its default.
+type Config struct {
+	// Readers, Writers and Refreshers are the numbers of goroutines that read
+	// from, write to and refresh the map. The defaults are 4, 2 and 1.
+	Readers    int
+	Writers    int
+	Refreshers int
+
+	// Keys is the number of distinct keys that are written to. The default is
+	// 64.
+	Keys int
+
+	// Writes is the number of writes made by every writer, and Reads is the
+	// number of snapshots observed by every reader. The defaults are 1000 and
+	// 200.
+	Writes int
+	Reads  int
+
+	// Seed seeds the random schedules of the goroutines, so that a failing
+	// schedule can be retried. The default is the current time, which is
+	// reported when the test fails.
+	Seed int64
+
+	// Options are the options that the map is created with. Options that remove
+	// keys on their own, such as WithMaxEntries, aren't supported.
+	Options []eventual.OptionFunc
+}
+
+// Result counts the operations performed by a stress test.
+type Result struct {
+	Writes    int
+	Reads     int
+	Refreshes int
+}
+
+// maxViolations is the number of violations that are reported before the
+// rest are dropped.
+const maxViolations = 10
+
+func (c Config) withDefaults() Config {
+	orDefault := func(v *int, def int) {
+		if *v <= 0 {
+			*v = def
+		}
+	}
+	orDefault(&c.Readers, 4)
+	orDefault(&c.Writers, 2)
+	orDefault(&c.Refreshers, 1)
+	orDefault(&c.Keys, 64)
+	orDefault(&c.Writes, 1000)
+	orDefault(&c.Reads, 200)
+	if c.Seed == 0 {
+		c.Seed = time.Now().UnixNano()
+	}
+	return c
+}
+
+// stress is the state of a single stress test.
+type stress struct {
+	config  Config
+	m       *eventual.Map[int, uint64]
+	history *history
+
+	// The snapshots observed by every reader
+	observations [][]observation
+
+	mu         sync.Mutex
+	violations []string
+	result     Result
+}
+
+// Run runs a stress test with the provided configuration against a new map,
+// and fails t with the violations that it finds.
+func Run(t testing.TB, config Config) Result {
+	t.Helper()
+	config = config.withDefaults()
+	s := &stress{
+		config:       config,
+		m:            eventual.NewMap[int, uint64](config.Options...),
+		history:      newHistory(config.Keys),
+		observations: make([][]observation, config.Readers),
+	}
+	defer s.m.Close()
+
+	var writers, others sync.WaitGroup
+	done := make(chan struct{})
+	for i := 0; i < config.Writers; i++ {
+		writers.Add(1)
+		go func(rng *rand.Rand) {
+			defer writers.Done()
+			s.write(rng)
+		}(s.rand(i))
+	}
+	for i := 0; i < config.Refreshers; i++ {
+		others.Add(1)
+		go func(rng *rand.Rand) {
+			defer others.Done()
+			s.refresh(rng, done)
+		}(s.rand(config.Writers + i))
+	}
+	for i := 0; i < config.Readers; i++ {
+		others.Add(1)
+		go func(i int, rng *rand.Rand) {
+			defer others.Done()
+			s.observations[i] = s.read(rng)
+		}(i, s.rand(config.Writers+config.Refreshers+i))
+	}
+	writers.Wait()
+	close(done)
+	others.Wait()
+
+	// The history is complete once every goroutine is done
+	for _, observations := range s.observations {
+		s.checkObservations(observations)
+	}
+	s.checkFinal()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, v := range s.violations {
+		t.Errorf("evmaptest: %s", v)
+	}
+	if len(s.violations) > 0 {
+		t.Errorf("evmaptest: run with Config.Seed = %d to retry the schedule", config.Seed)
+	}
+	return s.result
+}
+
+// rand returns the random source of the i-th goroutine.
+func (s *stress) rand(i int) *rand.Rand {
+	return rand.New(rand.NewSource(s.config.Seed + int64(i)))
+}
+
+func (s *stress) violate(format string, args ...any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.violations) < maxViolations {
+		s.violations = append(s.violations, fmt.Sprintf(format, args...))
+	}
+}
+
+func (s *stress) count(fn func(r *Result)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(&s.result)
+}
+
+// pause yields to the other goroutines for a random amount of time.
+func pause(rng *rand.Rand) {
+	switch n := rng.Intn(100); {
+	case n < 80:
+	case n < 95:
+		runtime.Gosched()
+	default:
+		time.Sleep(time.Duration(rng.Intn(100)) * time.Microsecond)
+	}
+}
+
+// write makes random writes to the map and records them in the history.
+func (s *stress) write(rng *rand.Rand) {
+	h := s.history
+	for i := 0; i < s.config.Writes; i++ {
+		pause(rng)
+		key := rng.Intn(s.config.Keys)
+
+		h.mu.Lock()
+		seq := h.next()
+		v := seq
+		switch n := rng.Intn(100); {
+		case n < 55:
+			if s.m.Insert(key, &v) == nil {
+				h.record(key, seq, true)
+			}
+		case n < 75:
+			s.m.Delete(key)
+			h.record(key, seq, false)
+		case n < 85:
+			err := s.m.Update(key, func(*uint64, bool) *uint64 { return &v })
+			if err == nil {
+				h.record(key, seq, true)
+			}
+		case n < 99:
+			// The batch may write to the same key more than once, in which case
+			// only its last write is recorded
+			deleted := rng.Intn(s.config.Keys)
+			inserted := rng.Intn(s.config.Keys)
+			err := s.m.Batch(func(b *eventual.Batch[int, uint64]) {
+				b.Insert(key, &v)
+				b.Delete(deleted)
+				b.Insert(inserted, &v)
+			})
+			if err == nil {
+				written := map[int]bool{key: true}
+				written[deleted] = false
+				written[inserted] = true
+				for k, present := range written {
+					h.record(k, seq, present)
+				}
+			}
+		default:
+			if s.m.Clear() == nil {
+				for k := range h.writes {
+					h.record(k, seq, false)
+				}
+			}
+		}
+		h.mu.Unlock()
+		s.count(func(r *Result) { r.Writes++ })
+	}
+}
+
+// refresh refreshes the map until done is closed.
+func (s *stress) refresh(rng *rand.Rand, done chan struct{}) {
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		pause(rng)
+		if rng.Intn(4) == 0 {
+			// Give up waiting for the readers from time to time
+			ctx, cancel := context.WithTimeout(context.Background(), time.Duration(rng.Intn(50))*time.Microsecond)
+			_ = s.m.RefreshAndWait(ctx)
+			cancel()
+		} else {
+			_ = s.m.Refresh()
+		}
+		s.count(func(r *Result) { r.Refreshes++ })
+	}
+}
+
+// observation is a snapshot of the map observed by a reader.
+type observation struct {
+	generation uint64
+	state      map[int]uint64
+}
+
+// read observes snapshots of the map through readers that are occasionally
+// frozen, unfrozen and replaced.
+func (s *stress) read(rng *rand.Rand) []observation {
+	observations := make([]observation, 0, s.config.Reads)
+	r := s.m.Reader()
+	for i := 0; i < s.config.Reads; i++ {
+		pause(rng)
+		switch n := rng.Intn(100); {
+		case n < 5:
+			_ = r.Close()
+			r = s.m.Reader()
+		case n < 8:
+			r.Freeze()
+		case n < 12:
+			r.Unfreeze()
+		}
+
+		g := r.Guard()
+		o := observation{generation: g.Generation(), state: make(map[int]uint64, g.Len())}
+		g.ForEach(func(key int, value *uint64) bool {
+			o.state[key] = *value
+			return true
+		})
+		g.Release()
+		observations = append(observations, o)
+		s.count(func(r *Result) { r.Reads++ })
+	}
+	_ = r.Close()
+	return observations
+}
+
+// checkObservations checks that every snapshot observed by a reader is the
+// state of the map after some prefix of the history, and that the reader never
+// observed an older snapshot than one it had already observed.
+func (s *stress) checkObservations(observations []observation) {
+	var after uint64
+	for i, o := range observations {
+		prefixes, err := s.history.check(o.state)
+		if err != nil {
+			s.violate("snapshot %d at generation %d isn't a state of the map: %v", i, o.generation, err)
+			return
+		}
+		if i > 0 && o.generation < observations[i-1].generation {
+			s.violate("snapshot %d went back from generation %d to %d", i, observations[i-1].generation, o.generation)
+			return
+		}
+
+		// The snapshot must be the state after a prefix that is at least as long
+		// as the shortest prefix of the previous snapshot
+		prefixes = intersect(prefixes, []interval{{after, math.MaxUint64}})
+		if len(prefixes) == 0 {
+			s.violate("snapshot %d at generation %d is older than the previous snapshot", i, o.generation)
+			return
+		}
+		after = prefixes[0].from
+	}
+}
+
+// checkFinal checks that the map converges to the state after every write
+// once it's refreshed.
+func (s *stress) checkFinal() {
+	if err := s.m.RefreshAndWait(context.Background()); err != nil {
+		s.violate("refreshing the map after the writes failed: %v", err)
+		return
+	}
+	r := s.m.Reader()
+	defer r.Close()
+	g := r.Guard()
+	defer g.Release()
+	state := make(map[int]uint64, g.Len())
+	g.ForEach(func(key int, value *uint64) bool {
+		state[key] = *value
+		return true
+	})
+	prefixes, err := s.history.check(state)
+	if err != nil {
+		s.violate("the refreshed map isn't a state of the map: %v", err)
+		return
+	}
+	if last := prefixes[len(prefixes)-1]; last.to != math.MaxUint64 {
+		s.violate("the refreshed map is the state after write %d rather than after every write", last.to-1)
+	}
+}
@@ -0,0 +1,55 @@
+package evmaptest
+
+import (
+	"github.com/clarkmcc/go-evmap"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	for name, options := range map[string][]eventual.OptionFunc{
+		"default":     nil,
+		"async":       {eventual.WithAsyncRefresh()},
+		"incremental": {eventual.WithIncrementalRefresh(time.Microsecond)},
+		"recycled":    {eventual.WithValueRecycling(), eventual.WithPooledClears()},
+		"readerless":  {eventual.WithReaderlessWrites(), eventual.WithOplogCompaction()},
+		"lagged":      {eventual.WithMaxReplicationWriteLag(10), eventual.WithDebugChecks()},
+	} {
+		t.Run(name, func(t *testing.T) {
+			result := Run(t, Config{Writes: 500, Reads: 100, Options: options})
+			assert.Equal(t, 2*500, result.Writes)
+			assert.Equal(t, 4*100, result.Reads)
+		})
+	}
+}
+
+func TestHistory_Check(t *testing.T) {
+	h := newHistory(2)
+	h.record(0, h.next(), true)  // 1: 0=1
+	h.record(1, h.next(), true)  // 2: 0=1 1=2
+	h.record(0, h.next(), false) // 3: 1=2
+	h.record(1, h.next(), true)  // 4: 1=4
+
+	prefixes, err := h.check(map[int]uint64{})
+	assert.NoError(t, err)
+	assert.Equal(t, []interval{{0, 1}}, prefixes)
+
+	prefixes, err = h.check(map[int]uint64{0: 1, 1: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, []interval{{2, 3}}, prefixes)
+
+	prefixes, err = h.check(map[int]uint64{1: 4})
+	assert.NoError(t, err)
+	assert.Equal(t, []interval{{4, math.MaxUint64}}, prefixes)
+
+	// Key 0 was deleted before key 1 was updated
+	_, err = h.check(map[int]uint64{0: 1, 1: 4})
+	assert.ErrorContains(t, err, "inconsistent with the other keys")
+
+	_, err = h.check(map[int]uint64{0: 2})
+	assert.ErrorContains(t, err, "never written to it")
+	_, err = h.check(map[int]uint64{2: 1})
+	assert.ErrorContains(t, err, "key 2 was never written to")
+}
@@ -0,0 +1,119 @@
+package evmaptest
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+)
+
+// write is a single write to a key in the history. Every write is identified by
+// its sequence number, which is also the value that it inserted, if any.
+type write struct {
+	seq     uint64
+	present bool
+}
+
+// history records the writes made to every key in the order in which they
+// were applied to the map. Writes are made while holding mu so that the order
+// of the history is the order of the map.
+type history struct {
+	mu     sync.Mutex
+	seq    uint64
+	writes [][]write
+}
+
+func newHistory(keys int) *history {
+	return &history{writes: make([][]write, keys)}
+}
+
+// next returns the sequence number of the next write, starting from one. This
+// must be called while holding mu.
+func (h *history) next() uint64 {
+	h.seq++
+	return h.seq
+}
+
+// record records a write to the key. This must be called while holding mu.
+func (h *history) record(key int, seq uint64, present bool) {
+	h.writes[key] = append(h.writes[key], write{seq: seq, present: present})
+}
+
+// interval is a half-open range of sequence numbers.
+type interval struct {
+	from, to uint64
+}
+
+// intervals returns the prefixes of the history, identified by the sequence
+// number of their last write, after which the key had the observed value. The
+// value is the sequence number of the write that inserted it, and ok is false
+// if the key was observed to be missing.
+func (h *history) intervals(key int, value uint64, ok bool) ([]interval, error) {
+	writes := h.writes[key]
+	end := func(i int) uint64 {
+		if i+1 < len(writes) {
+			return writes[i+1].seq
+		}
+		return math.MaxUint64
+	}
+	if ok {
+		i := sort.Search(len(writes), func(i int) bool { return writes[i].seq >= value })
+		if i == len(writes) || writes[i].seq != value || !writes[i].present {
+			return nil, fmt.Errorf("key %d has value %d, which was never written to it", key, value)
+		}
+		return []interval{{value, end(i)}}, nil
+	}
+
+	// Every key is missing until it's first written to
+	missing := []interval{{0, end(-1)}}
+	for i, w := range writes {
+		if !w.present {
+			missing = append(missing, interval{w.seq, end(i)})
+		}
+	}
+	return missing, nil
+}
+
+// intersect returns the intersection of two sorted lists of disjoint intervals.
+func intersect(a, b []interval) []interval {
+	var out []interval
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		from, to := max(a[i].from, b[j].from), min(a[i].to, b[j].to)
+		if from < to {
+			out = append(out, interval{from, to})
+		}
+		if a[i].to < b[j].to {
+			i++
+		} else {
+			j++
+		}
+	}
+	return out
+}
+
+// check verifies that the observed state of the map, which maps every key that
+// was present to its value, is the state of the map after some prefix of the
+// history, and returns the prefixes that it could be the state after.
+func (h *history) check(state map[int]uint64) ([]interval, error) {
+	for key := range state {
+		if key < 0 || key >= len(h.writes) {
+			return nil, fmt.Errorf("key %d was never written to", key)
+		}
+	}
+	prefixes := []interval{{0, math.MaxUint64}}
+	for key := range h.writes {
+		value, ok := state[key]
+		observed, err := h.intervals(key, value, ok)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = intersect(prefixes, observed)
+		if len(prefixes) == 0 {
+			if ok {
+				return nil, fmt.Errorf("key %d has value %d, which is inconsistent with the other keys of the snapshot", key, value)
+			}
+			return nil, fmt.Errorf("key %d is missing, which is inconsistent with the other keys of the snapshot", key)
+		}
+	}
+	return prefixes, nil
+}
@@ -0,0 +1,49 @@
+// Package evotel traces the operations of an eventual.Map with OpenTelemetry.
+// It's a separate module so that depending on the map doesn't pull
+// OpenTelemetry into the module graph:
+//
+//	m := eventual.NewMap[string, User](eventual.WithTracer(evotel.NewTracer(otel.Tracer("users"))))
+package evotel
+
+import (
+	"context"
+	"github.com/clarkmcc/go-evmap"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracer is an eventual.Tracer that starts OpenTelemetry spans.
+type Tracer struct {
+	tracer trace.Tracer
+}
+
+var _ eventual.Tracer = (*Tracer)(nil)
+
+// NewTracer creates a tracer that starts spans with the OpenTelemetry tracer.
+func NewTracer(tracer trace.Tracer) *Tracer {
+	return &Tracer{tracer: tracer}
+}
+
+func (t *Tracer) Start(ctx context.Context, operation string) (context.Context, eventual.Span) {
+	ctx, span := t.tracer.Start(ctx, operation, trace.WithSpanKind(trace.SpanKindInternal))
+	return ctx, spanAdapter{span}
+}
+
+// spanAdapter adapts an OpenTelemetry span to an eventual.Span.
+type spanAdapter struct {
+	span trace.Span
+}
+
+func (s spanAdapter) SetAttribute(key string, value int64) {
+	s.span.SetAttributes(attribute.Int64(key, value))
+}
+
+// End records the error on the span, if there is one, and ends it.
+func (s spanAdapter) End(err error) {
+	if err != nil {
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+	}
+	s.span.End()
+}
@@ -0,0 +1,41 @@
+package evotel
+
+import (
+	"context"
+	"github.com/clarkmcc/go-evmap"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"testing"
+)
+
+func TestTracer(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	m := eventual.NewMap[string, int](eventual.WithTracer(NewTracer(provider.Tracer("test"))))
+
+	// Refreshes made with a context are children of its span
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "parent")
+	v := 1
+	assert.NoError(t, m.Insert("foo", &v))
+	assert.NoError(t, m.RefreshAndWait(ctx))
+	parent.End()
+
+	assert.NoError(t, m.Close())
+	assert.Error(t, m.InsertMany(map[string]*int{"foo": &v}))
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 3)
+	refresh := spans[0]
+	assert.Equal(t, "evmap.Refresh", refresh.Name())
+	assert.Equal(t, parent.SpanContext().SpanID(), refresh.Parent().SpanID())
+	assert.Contains(t, refresh.Attributes(), attribute.Int64("evmap.generation", 1))
+	assert.Contains(t, refresh.Attributes(), attribute.Int64("evmap.writes", 1))
+
+	insert := spans[2]
+	assert.Equal(t, "evmap.InsertMany", insert.Name())
+	assert.Equal(t, codes.Error, insert.Status().Code)
+	assert.Len(t, insert.Events(), 1)
+}
@@ -0,0 +1,193 @@
+// Package evprom exports the metrics of an eventual.Map to Prometheus. A
+// Collector is both an eventual.MetricsCollector, which is passed to the map
+// with eventual.WithMetrics, and a prometheus.Collector, which is registered
+// with a Prometheus registry:
+//
+//	c := evprom.NewCollector(evprom.Opts{ConstLabels: prometheus.Labels{"map": "users"}})
+//	prometheus.MustRegister(c)
+//	users := eventual.NewMap[string, User](eventual.WithMetrics(c))
+//
+// The package lives in its own module, so only the programs that import it
+// depend on the Prometheus client.
+package evprom
+
+import (
+	"github.com/clarkmcc/go-evmap"
+	"github.com/prometheus/client_golang/prometheus"
+	"sync"
+	"time"
+)
+
+var (
+	_ eventual.MetricsCollector     = (*Collector)(nil)
+	_ eventual.ReadMetricsCollector = (*Collector)(nil)
+	_ prometheus.Collector          = (*Collector)(nil)
+)
+
+// Opts configures the names and labels of the metrics of a Collector. Every
+// metric is named evmap_<metric>, prefixed by the namespace and subsystem if
+// they're set.
+type Opts struct {
+	Namespace   string
+	Subsystem   string
+	ConstLabels prometheus.Labels
+
+	// Buckets are the buckets of the refresh duration histogram, in seconds.
+	// The default is prometheus.DefBuckets.
+	Buckets []float64
+}
+
+// Collector collects the metrics of a single map. It must only be passed to one
+// map, and maps that are exported to the same registry must be distinguished by
+// their ConstLabels.
+type Collector struct {
+	refreshDuration prometheus.Histogram
+	refreshEntries  prometheus.Counter
+	oplogEntries    prometheus.Gauge
+	replicationLag  prometheus.GaugeFunc
+	readers         prometheus.Gauge
+	inserts         prometheus.Counter
+	deletes         prometheus.Counter
+	clears          prometheus.Counter
+	hits            prometheus.Counter
+	misses          prometheus.Counter
+
+	// lagSince is the time of the oldest write that hasn't been refreshed, or
+	// zero if every write has been refreshed.
+	mu       sync.Mutex
+	lagSince time.Time
+}
+
+// NewCollector creates a collector with the provided options.
+func NewCollector(opts Opts) *Collector {
+	name := func(metric string) string {
+		return prometheus.BuildFQName(opts.Namespace, opts.Subsystem, "evmap_"+metric)
+	}
+	buckets := opts.Buckets
+	if buckets == nil {
+		buckets = prometheus.DefBuckets
+	}
+	c := &Collector{
+		refreshDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:        name("refresh_duration_seconds"),
+			Help:        "The time taken by refreshes of the map.",
+			ConstLabels: opts.ConstLabels,
+			Buckets:     buckets,
+		}),
+		refreshEntries: prometheus.NewCounter(prometheus.CounterOpts{
+			Name:        name("refresh_entries_total"),
+			Help:        "The number of oplog entries replayed by refreshes of the map.",
+			ConstLabels: opts.ConstLabels,
+		}),
+		oplogEntries: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name:        name("oplog_entries"),
+			Help:        "The number of oplog entries that haven't been exposed to the readers.",
+			ConstLabels: opts.ConstLabels,
+		}),
+		readers: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name:        name("readers"),
+			Help:        "The number of readers registered with the map.",
+			ConstLabels: opts.ConstLabels,
+		}),
+		inserts: prometheus.NewCounter(prometheus.CounterOpts{
+			Name:        name("inserts_total"),
+			Help:        "The number of keys inserted or updated in the map.",
+			ConstLabels: opts.ConstLabels,
+		}),
+		deletes: prometheus.NewCounter(prometheus.CounterOpts{
+			Name:        name("deletes_total"),
+			Help:        "The number of keys deleted from the map.",
+			ConstLabels: opts.ConstLabels,
+		}),
+		clears: prometheus.NewCounter(prometheus.CounterOpts{
+			Name:        name("clears_total"),
+			Help:        "The number of times the map was cleared.",
+			ConstLabels: opts.ConstLabels,
+		}),
+	}
+	reads := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:        name("reads_total"),
+		Help:        "The number of keys looked up by readers of the map, by whether they were found.",
+		ConstLabels: opts.ConstLabels,
+	}, []string{"result"})
+	c.hits = reads.WithLabelValues("hit")
+	c.misses = reads.WithLabelValues("miss")
+	c.replicationLag = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name:        name("replication_lag_seconds"),
+		Help:        "The age of the oldest write that hasn't been exposed to the readers.",
+		ConstLabels: opts.ConstLabels,
+	}, c.lag)
+	return c
+}
+
+// lag returns the age of the oldest write that hasn't been refreshed.
+func (c *Collector) lag() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lagSince.IsZero() {
+		return 0
+	}
+	return time.Since(c.lagSince).Seconds()
+}
+
+func (c *Collector) Inserted(keys int) {
+	c.inserts.Add(float64(keys))
+}
+
+func (c *Collector) Deleted(keys int) {
+	c.deletes.Add(float64(keys))
+}
+
+func (c *Collector) Cleared() {
+	c.clears.Inc()
+}
+
+func (c *Collector) Refreshed(duration time.Duration, entries int) {
+	c.refreshDuration.Observe(duration.Seconds())
+	c.refreshEntries.Add(float64(entries))
+}
+
+func (c *Collector) ReplicationLag(entries int) {
+	c.oplogEntries.Set(float64(entries))
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch {
+	case entries == 0:
+		c.lagSince = time.Time{}
+	case c.lagSince.IsZero():
+		c.lagSince = time.Now()
+	}
+}
+
+func (c *Collector) Readers(n int) {
+	c.readers.Set(float64(n))
+}
+
+// Read implements eventual.ReadMetricsCollector.
+func (c *Collector) Read(hit bool) {
+	if hit {
+		c.hits.Inc()
+	} else {
+		c.misses.Inc()
+	}
+}
+
+// metrics returns every metric of the collector.
+func (c *Collector) metrics() []prometheus.Collector {
+	return []prometheus.Collector{
+		c.refreshDuration, c.refreshEntries, c.oplogEntries, c.replicationLag, c.readers,
+		c.inserts, c.deletes, c.clears, c.hits, c.misses,
+	}
+}
+
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, m := range c.metrics() {
+		m.Describe(ch)
+	}
+}
+
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	for _, m := range c.metrics() {
+		m.Collect(ch)
+	}
+}
@@ -0,0 +1,61 @@
+package evprom
+
+import (
+	"github.com/clarkmcc/go-evmap"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestCollector(t *testing.T) {
+	c := NewCollector(Opts{Namespace: "app", ConstLabels: prometheus.Labels{"map": "users"}})
+	registry := prometheus.NewPedanticRegistry()
+	assert.NoError(t, registry.Register(c))
+
+	m := eventual.NewMap[string, int](eventual.WithMetrics(c))
+	reader := m.Reader()
+	v := 1
+	assert.NoError(t, m.Insert("foo", &v))
+	assert.NoError(t, m.Insert("bar", &v))
+	assert.True(t, m.Delete("bar"))
+	assert.Equal(t, 3.0, testutil.ToFloat64(c.oplogEntries))
+	assert.Greater(t, c.lag(), 0.0)
+
+	assert.NoError(t, m.Refresh())
+	reader.Get("foo")
+	reader.Get("bar")
+	assert.NoError(t, m.Clear())
+
+	assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(`
+# HELP app_evmap_inserts_total The number of keys inserted or updated in the map.
+# TYPE app_evmap_inserts_total counter
+app_evmap_inserts_total{map="users"} 2
+# HELP app_evmap_deletes_total The number of keys deleted from the map.
+# TYPE app_evmap_deletes_total counter
+app_evmap_deletes_total{map="users"} 1
+# HELP app_evmap_clears_total The number of times the map was cleared.
+# TYPE app_evmap_clears_total counter
+app_evmap_clears_total{map="users"} 1
+# HELP app_evmap_reads_total The number of keys looked up by readers of the map, by whether they were found.
+# TYPE app_evmap_reads_total counter
+app_evmap_reads_total{map="users",result="hit"} 1
+app_evmap_reads_total{map="users",result="miss"} 1
+# HELP app_evmap_readers The number of readers registered with the map.
+# TYPE app_evmap_readers gauge
+app_evmap_readers{map="users"} 1
+# HELP app_evmap_refresh_entries_total The number of oplog entries replayed by refreshes of the map.
+# TYPE app_evmap_refresh_entries_total counter
+app_evmap_refresh_entries_total{map="users"} 3
+# HELP app_evmap_oplog_entries The number of oplog entries that haven't been exposed to the readers.
+# TYPE app_evmap_oplog_entries gauge
+app_evmap_oplog_entries{map="users"} 1
+`), "app_evmap_inserts_total", "app_evmap_deletes_total", "app_evmap_clears_total", "app_evmap_reads_total",
+		"app_evmap_readers", "app_evmap_refresh_entries_total", "app_evmap_oplog_entries"))
+	assert.Equal(t, 1, testutil.CollectAndCount(c, "app_evmap_refresh_duration_seconds"))
+
+	assert.NoError(t, m.Refresh())
+	assert.Equal(t, 0.0, c.lag())
+	assert.NoError(t, m.Close())
+}
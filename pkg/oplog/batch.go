@@ -0,0 +1,41 @@
+package oplog
+
+// Batch buffers a sequence of oplog entries so that they can be pushed to the
+// oplog as a single entry. Like Log, a Batch is not thread-safe.
+type Batch[K comparable, V any] struct {
+	entries []*Entry[K, V]
+}
+
+// Insert buffers an insert of the value under the key
+func (b *Batch[K, V]) Insert(key K, value V) {
+	b.entries = append(b.entries, Insert(key, value))
+}
+
+// Delete buffers a delete of the key
+func (b *Batch[K, V]) Delete(key K) {
+	b.entries = append(b.entries, Delete[K, V](key))
+}
+
+// Clear buffers a clear of the entire map
+func (b *Batch[K, V]) Clear() {
+	b.entries = append(b.entries, Clear[K, V]())
+}
+
+// Len returns the number of buffered entries
+func (b *Batch[K, V]) Len() int {
+	return len(b.entries)
+}
+
+// Entry creates a single oplog entry that applies every buffered entry in the
+// order they were buffered.
+func (b *Batch[K, V]) Entry() *Entry[K, V] {
+	return &Entry[K, V]{
+		t:       EntryBatch,
+		entries: append([]*Entry[K, V](nil), b.entries...),
+	}
+}
+
+// NewBatch creates a new empty batch with the given types
+func NewBatch[K comparable, V any]() *Batch[K, V] {
+	return &Batch[K, V]{}
+}
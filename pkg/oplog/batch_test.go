@@ -0,0 +1,28 @@
+package oplog
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestBatch(t *testing.T) {
+	log := NewLog[string, *int]()
+	m := map[string]*int{}
+
+	v1 := 1
+	v2 := 2
+	b := NewBatch[string, *int]()
+	b.Insert("foo", &v1)
+	b.Clear()
+	b.Insert("bar", &v1)
+	b.Insert("baz", &v2)
+	b.Delete("bar")
+	assert.Equal(t, 5, b.Len())
+
+	log.Push(b.Entry())
+	assert.Equal(t, 1, log.Len())
+
+	log.Apply(&m)
+	assert.Len(t, m, 1)
+	assert.Equal(t, v2, *m["baz"])
+}
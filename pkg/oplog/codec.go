@@ -0,0 +1,315 @@
+package oplog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrMalformedEntry is returned when decoding data that wasn't encoded by an
+	// EntryCodec.
+	ErrMalformedEntry = errors.New("oplog: malformed entry")
+
+	// ErrNotSerializable is returned when encoding an update or an operation,
+	// whose functions can't be encoded.
+	ErrNotSerializable = errors.New("oplog: entry is not serializable")
+)
+
+// Codec encodes and decodes a single key or value. The Codec of the eventual
+// package is an alias of Codec, so the codecs of a map encode its oplog entries.
+type Codec[T any] interface {
+	Encode(v T) ([]byte, error)
+	Decode(data []byte) (T, error)
+}
+
+// GobCodec is a Codec that uses encoding/gob. It's the codec used by
+// MarshalBinary and UnmarshalBinary.
+type GobCodec[T any] struct{}
+
+func (GobCodec[T]) Encode(v T) ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(&v)
+	return buf.Bytes(), err
+}
+
+func (GobCodec[T]) Decode(data []byte) (T, error) {
+	var v T
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&v)
+	return v, err
+}
+
+// EntryCodec is a Codec of entries that encodes their keys and values with a
+// codec for the keys and a codec for the values. It's the format in which the
+// eventual package writes its write-ahead logs and snapshots and replicates
+// maps, so entries can be shipped over the network or written to disk alike.
+// An entry is encoded as its type, its time in nanoseconds since the Unix epoch
+// or zero if it hasn't got one, and its length-prefixed tag, followed by its
+// contents: the length-prefixed key of inserts and deletes, the length-prefixed
+// value of inserts, the number of keys followed by the keys, and values, of
+// batched inserts and deletes, and the number of entries followed by every
+// length-prefixed entry of batches. Updates and operations can't be encoded.
+type EntryCodec[K comparable, V any] struct {
+	keys   Codec[K]
+	values Codec[V]
+}
+
+// NewEntryCodec creates an EntryCodec that encodes keys with keys and values
+// with values.
+func NewEntryCodec[K comparable, V any](keys Codec[K], values Codec[V]) *EntryCodec[K, V] {
+	return &EntryCodec[K, V]{keys: keys, values: values}
+}
+
+// Encode encodes the entry, returning ErrNotSerializable if it's or contains an
+// update or an operation.
+func (c *EntryCodec[K, V]) Encode(e *Entry[K, V]) ([]byte, error) {
+	return c.append(nil, e)
+}
+
+func (c *EntryCodec[K, V]) append(buf []byte, e *Entry[K, V]) ([]byte, error) {
+	buf = append(buf, byte(e.t))
+	var nanos int64
+	if !e.time.IsZero() {
+		nanos = e.time.UnixNano()
+	}
+	buf = binary.AppendVarint(buf, nanos)
+	buf = appendBytes(buf, []byte(e.tag))
+	var err error
+	switch e.t {
+	case EntryInsert:
+		if buf, err = c.appendKey(buf, e.k); err != nil {
+			return nil, err
+		}
+		return c.appendValue(buf, e.v)
+	case EntryDelete:
+		return c.appendKey(buf, e.k)
+	case EntryClear:
+		return buf, nil
+	case EntryInsertMany:
+		buf = binary.AppendUvarint(buf, uint64(len(e.batch)))
+		for k, v := range e.batch {
+			if buf, err = c.appendKey(buf, k); err != nil {
+				return nil, err
+			}
+			if buf, err = c.appendValue(buf, v); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	case EntryDeleteMany:
+		buf = binary.AppendUvarint(buf, uint64(len(e.keys)))
+		for _, k := range e.keys {
+			if buf, err = c.appendKey(buf, k); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	case EntryBatch:
+		buf = binary.AppendUvarint(buf, uint64(len(e.entries)))
+		for _, e := range e.entries {
+			data, err := c.Encode(e)
+			if err != nil {
+				return nil, err
+			}
+			buf = appendBytes(buf, data)
+		}
+		return buf, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrNotSerializable, e.t)
+}
+
+func (c *EntryCodec[K, V]) appendKey(buf []byte, k K) ([]byte, error) {
+	data, err := c.keys.Encode(k)
+	if err != nil {
+		return nil, err
+	}
+	return appendBytes(buf, data), nil
+}
+
+func (c *EntryCodec[K, V]) appendValue(buf []byte, v V) ([]byte, error) {
+	data, err := c.values.Encode(v)
+	if err != nil {
+		return nil, err
+	}
+	return appendBytes(buf, data), nil
+}
+
+// Decode decodes an entry that was encoded by Encode.
+func (c *EntryCodec[K, V]) Decode(data []byte) (*Entry[K, V], error) {
+	r := bytes.NewReader(data)
+	e, err := c.read(r)
+	if err != nil {
+		return nil, err
+	}
+	if r.Len() > 0 {
+		return nil, ErrMalformedEntry
+	}
+	return e, nil
+}
+
+func (c *EntryCodec[K, V]) read(r *bytes.Reader) (*Entry[K, V], error) {
+	t, err := r.ReadByte()
+	if err != nil {
+		return nil, ErrMalformedEntry
+	}
+	e := &Entry[K, V]{t: EntryType(t)}
+	nanos, err := binary.ReadVarint(r)
+	if err != nil {
+		return nil, ErrMalformedEntry
+	}
+	if nanos != 0 {
+		e.time = time.Unix(0, nanos)
+	}
+	tag, err := readBytes(r)
+	if err != nil {
+		return nil, err
+	}
+	e.tag = string(tag)
+	switch e.t {
+	case EntryInsert:
+		if e.k, err = c.readKey(r); err != nil {
+			return nil, err
+		}
+		if e.v, err = c.readValue(r); err != nil {
+			return nil, err
+		}
+	case EntryDelete:
+		if e.k, err = c.readKey(r); err != nil {
+			return nil, err
+		}
+	case EntryClear:
+	case EntryInsertMany:
+		n, err := readCount(r)
+		if err != nil {
+			return nil, err
+		}
+		e.batch = make(map[K]V, n)
+		for i := 0; i < n; i++ {
+			k, err := c.readKey(r)
+			if err != nil {
+				return nil, err
+			}
+			if e.batch[k], err = c.readValue(r); err != nil {
+				return nil, err
+			}
+		}
+	case EntryDeleteMany:
+		n, err := readCount(r)
+		if err != nil {
+			return nil, err
+		}
+		e.keys = make([]K, n)
+		for i := range e.keys {
+			if e.keys[i], err = c.readKey(r); err != nil {
+				return nil, err
+			}
+		}
+	case EntryBatch:
+		n, err := readCount(r)
+		if err != nil {
+			return nil, err
+		}
+		e.entries = make([]*Entry[K, V], n)
+		for i := range e.entries {
+			data, err := readBytes(r)
+			if err != nil {
+				return nil, err
+			}
+			if e.entries[i], err = c.Decode(data); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, ErrMalformedEntry
+	}
+	return e, nil
+}
+
+func (c *EntryCodec[K, V]) readKey(r *bytes.Reader) (K, error) {
+	data, err := readBytes(r)
+	if err != nil {
+		var zero K
+		return zero, err
+	}
+	return c.keys.Decode(data)
+}
+
+func (c *EntryCodec[K, V]) readValue(r *bytes.Reader) (V, error) {
+	data, err := readBytes(r)
+	if err != nil {
+		var zero V
+		return zero, err
+	}
+	return c.values.Decode(data)
+}
+
+// MarshalBinary encodes the entry with an EntryCodec that encodes the keys and
+// values with encoding/gob.
+func (e *Entry[K, V]) MarshalBinary() ([]byte, error) {
+	return gobEntryCodec[K, V]().Encode(e)
+}
+
+// UnmarshalBinary decodes an entry that was encoded by MarshalBinary into the
+// entry. It must only be called on a new entry, since entries are otherwise
+// never modified.
+func (e *Entry[K, V]) UnmarshalBinary(data []byte) error {
+	decoded, err := gobEntryCodec[K, V]().Decode(data)
+	if err != nil {
+		return err
+	}
+	*e = *decoded
+	return nil
+}
+
+// MarshalBinary encodes the buffered entries like Entry.MarshalBinary encodes
+// the entry returned by Entry.
+func (b *Batch[K, V]) MarshalBinary() ([]byte, error) {
+	return b.Entry().MarshalBinary()
+}
+
+// UnmarshalBinary replaces the buffered entries with the entries of a batch
+// that was encoded by MarshalBinary.
+func (b *Batch[K, V]) UnmarshalBinary(data []byte) error {
+	var e Entry[K, V]
+	if err := e.UnmarshalBinary(data); err != nil {
+		return err
+	}
+	if e.t != EntryBatch {
+		return ErrMalformedEntry
+	}
+	b.entries = e.entries
+	return nil
+}
+
+func gobEntryCodec[K comparable, V any]() *EntryCodec[K, V] {
+	return NewEntryCodec[K, V](GobCodec[K]{}, GobCodec[V]{})
+}
+
+// appendBytes appends the length-prefixed bytes to buf.
+func appendBytes(buf, b []byte) []byte {
+	return append(binary.AppendUvarint(buf, uint64(len(b))), b...)
+}
+
+// readBytes reads length-prefixed bytes from r.
+func readBytes(r *bytes.Reader) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil || n > uint64(r.Len()) {
+		return nil, ErrMalformedEntry
+	}
+	b := make([]byte, n)
+	_, _ = r.Read(b)
+	return b, nil
+}
+
+// readCount reads a number of keys or entries from r. Since every key or entry
+// takes at least one byte, a count larger than the remaining data is malformed.
+func readCount(r *bytes.Reader) (int, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil || n > uint64(r.Len()) {
+		return 0, ErrMalformedEntry
+	}
+	return int(n), nil
+}
@@ -0,0 +1,66 @@
+package oplog
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestEntry_MarshalBinary(t *testing.T) {
+	entries := []*Entry[string, int]{
+		Insert("foo", 1),
+		Delete[string, int]("foo"),
+		Clear[string, int](),
+		InsertMany(map[string]int{"foo": 1, "bar": 2}),
+		DeleteMany[string, int]([]string{"foo", "bar"}),
+	}
+	for _, e := range entries {
+		data, err := e.MarshalBinary()
+		assert.NoError(t, err)
+		var decoded Entry[string, int]
+		assert.NoError(t, decoded.UnmarshalBinary(data))
+		assert.Equal(t, e, &decoded)
+	}
+
+	// Functions can't be encoded
+	_, err := Update("foo", func(old int, ok bool) int { return old + 1 }).MarshalBinary()
+	assert.ErrorIs(t, err, ErrNotSerializable)
+
+	var e Entry[string, int]
+	assert.ErrorIs(t, e.UnmarshalBinary(nil), ErrMalformedEntry)
+	assert.ErrorIs(t, e.UnmarshalBinary([]byte{byte(EntryInsert), 100}), ErrMalformedEntry)
+	assert.ErrorIs(t, e.UnmarshalBinary([]byte{byte(EntryClear), 0, 0, 0}), ErrMalformedEntry)
+	assert.ErrorIs(t, e.UnmarshalBinary([]byte{byte(EntryUpdate)}), ErrMalformedEntry)
+}
+
+func TestEntry_MarshalBinaryTimeAndTag(t *testing.T) {
+	now := time.Unix(100, 200)
+	data, err := Insert("foo", 1).WithTime(now).WithTag("user").MarshalBinary()
+	assert.NoError(t, err)
+	var e Entry[string, int]
+	assert.NoError(t, e.UnmarshalBinary(data))
+	assert.True(t, now.Equal(e.Time()))
+	assert.Equal(t, "user", e.Tag())
+}
+
+func TestBatch_MarshalBinary(t *testing.T) {
+	b := NewBatch[string, int]()
+	b.Insert("foo", 1)
+	b.Clear()
+	b.Delete("bar")
+	data, err := b.MarshalBinary()
+	assert.NoError(t, err)
+
+	decoded := NewBatch[string, int]()
+	assert.NoError(t, decoded.UnmarshalBinary(data))
+	assert.Equal(t, b, decoded)
+
+	m := map[string]int{"baz": 1}
+	decoded.Entry().Apply(&m)
+	assert.Empty(t, m)
+
+	// Only batches can be decoded into a batch
+	data, err = Insert("foo", 1).MarshalBinary()
+	assert.NoError(t, err)
+	assert.ErrorIs(t, decoded.UnmarshalBinary(data), ErrMalformedEntry)
+}
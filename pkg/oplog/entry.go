@@ -1,25 +1,87 @@
 package oplog
 
-// Indicates the supported types of oplog entries that can be stored in the oplog. These
-// types are limited to the modifications that can be made to a map.
-type entryType uint8
+import (
+	"fmt"
+	"time"
+)
+
+// EntryType indicates the supported types of oplog entries that can be stored in the
+// oplog. These types are limited to the modifications that can be made to a map.
+type EntryType uint8
 
 const (
-	entryTypeInsert entryType = iota
-	entryTypeDelete
-	entryTypeClear
+	EntryInsert EntryType = iota
+	EntryDelete
+	EntryClear
+	EntryInsertMany
+	EntryDeleteMany
+	EntryBatch
+	EntryUpdate
+	EntryOperation
 )
 
-// entry is an oplog entry that may (but not always) be associated with a v
-type entry[K comparable, V any] struct {
-	t entryType
+// String returns the name of the entry type, such as "insert".
+func (t EntryType) String() string {
+	switch t {
+	case EntryInsert:
+		return "insert"
+	case EntryDelete:
+		return "delete"
+	case EntryClear:
+		return "clear"
+	case EntryInsertMany:
+		return "insert-many"
+	case EntryDeleteMany:
+		return "delete-many"
+	case EntryBatch:
+		return "batch"
+	case EntryUpdate:
+		return "update"
+	case EntryOperation:
+		return "operation"
+	}
+	return fmt.Sprintf("EntryType(%d)", uint8(t))
+}
+
+// Entry is an oplog entry that may (but not always) be associated with a v.
+// Entries are never modified after they're created.
+type Entry[K comparable, V any] struct {
+	t EntryType
 	k K
-	v *V
+	v V
+
+	// The keys and values of a batched entry
+	batch map[K]V
+
+	// The keys of a batched delete
+	keys []K
+
+	// The entries of a batch, applied in order
+	entries []*Entry[K, V]
+
+	// Computes the new value of an update from the value in the map
+	update func(old V, ok bool) V
+
+	// The user-defined operation of an operation entry
+	op Operation[K, V]
+
+	// When the entry was pushed to a log with a clock, and the tag that it was
+	// given by the application, if any
+	time time.Time
+	tag  string
+}
+
+// Operation is a user-defined modification of a map. Like an update, the entry
+// of an operation applies the operation to whatever is in each destination map,
+// so Apply must be deterministic, must not modify the values that are already
+// in the map, and must not insert values that are shared between maps.
+type Operation[K comparable, V any] interface {
+	Apply(m map[K]V)
 }
 
 // newEntry creates a new oplog entry with the associated type and v
-func newEntry[K comparable, V any](t entryType, key K, value *V) *entry[K, V] {
-	return &entry[K, V]{
+func newEntry[K comparable, V any](t EntryType, key K, value V) *Entry[K, V] {
+	return &Entry[K, V]{
 		t: t,
 		k: key,
 		v: value,
@@ -27,18 +89,151 @@ func newEntry[K comparable, V any](t entryType, key K, value *V) *entry[K, V] {
 }
 
 // Insert creates an oplog entry that inserts a v into the map
-func Insert[K comparable, V any](key K, value *V) *entry[K, V] {
-	return newEntry(entryTypeInsert, key, value)
+func Insert[K comparable, V any](key K, value V) *Entry[K, V] {
+	return newEntry(EntryInsert, key, value)
 }
 
 // Delete creates an oplog entry that deletes a v from the map
-func Delete[K comparable, V any](key K) *entry[K, V] {
-	return newEntry[K, V](entryTypeDelete, key, nil)
+func Delete[K comparable, V any](key K) *Entry[K, V] {
+	var zero V
+	return newEntry(EntryDelete, key, zero)
 }
 
 // Clear clears the entire contents from the map
-func Clear[K comparable, V any]() *entry[K, V] {
-	return &entry[K, V]{
-		t: entryTypeClear,
+func Clear[K comparable, V any]() *Entry[K, V] {
+	return &Entry[K, V]{
+		t: EntryClear,
+	}
+}
+
+// InsertMany creates a single oplog entry that inserts every key and value from
+// the provided map into the map. The entries are copied, so the provided map
+// can be modified after this function returns.
+func InsertMany[K comparable, V any](entries map[K]V) *Entry[K, V] {
+	batch := make(map[K]V, len(entries))
+	for k, v := range entries {
+		batch[k] = v
+	}
+	return &Entry[K, V]{
+		t:     EntryInsertMany,
+		batch: batch,
+	}
+}
+
+// DeleteMany creates a single oplog entry that deletes every provided key from
+// the map. The keys are copied, so the provided slice can be modified after this
+// function returns.
+func DeleteMany[K comparable, V any](keys []K) *Entry[K, V] {
+	return &Entry[K, V]{
+		t:    EntryDeleteMany,
+		keys: append([]K(nil), keys...),
+	}
+}
+
+// Update creates an oplog entry that replaces the value of the key with the
+// value returned by fn. Unlike Insert, fn is called every time the entry is
+// applied with the value that is currently in the destination map, so fn must
+// not modify old and must return a value that is not shared between maps.
+func Update[K comparable, V any](key K, fn func(old V, ok bool) V) *Entry[K, V] {
+	return &Entry[K, V]{
+		t:      EntryUpdate,
+		k:      key,
+		update: fn,
 	}
 }
+
+// Custom creates an oplog entry that applies the user-defined operation to the
+// map.
+func Custom[K comparable, V any](op Operation[K, V]) *Entry[K, V] {
+	return &Entry[K, V]{
+		t:  EntryOperation,
+		op: op,
+	}
+}
+
+// Type returns the type of the entry
+func (e *Entry[K, V]) Type() EntryType {
+	return e.t
+}
+
+// ModifiedKeys is like Log.ModifiedKeys but for the keys modified by this entry.
+func (e *Entry[K, V]) ModifiedKeys() (keys []K, cleared bool) {
+	return modifiedKeys(e, nil, false)
+}
+
+// Key returns the key of an insert, delete or update entry
+func (e *Entry[K, V]) Key() K {
+	return e.k
+}
+
+// Value returns the value of an insert entry
+func (e *Entry[K, V]) Value() V {
+	return e.v
+}
+
+// HasValue reports whether the entry carries values, which is the case for
+// inserts and batched inserts. Values of other entries are the zero value.
+func (e *Entry[K, V]) HasValue() bool {
+	return e.t == EntryInsert || e.t == EntryInsertMany
+}
+
+// Values returns the keys and values of an insert many entry. The map must not
+// be modified.
+func (e *Entry[K, V]) Values() map[K]V {
+	return e.batch
+}
+
+// Keys returns the keys of a delete many entry. The slice must not be modified.
+func (e *Entry[K, V]) Keys() []K {
+	return e.keys
+}
+
+// Entries returns the entries of a batch entry in the order that they're
+// applied. The slice must not be modified.
+func (e *Entry[K, V]) Entries() []*Entry[K, V] {
+	return e.entries
+}
+
+// UpdateFunc returns the function of an update entry, which computes the new
+// value of the key from its current value.
+func (e *Entry[K, V]) UpdateFunc() func(old V, ok bool) V {
+	return e.update
+}
+
+// Time returns the time at which the entry was pushed to a log with a clock,
+// or the time set by WithTime. It's the zero time otherwise, which is the case
+// for the entries within a batch, which share the time of the batch.
+func (e *Entry[K, V]) Time() time.Time {
+	return e.time
+}
+
+// Tag returns the tag set by WithTag, or an empty string.
+func (e *Entry[K, V]) Tag() string {
+	return e.tag
+}
+
+// WithTime sets the time of the entry, which is then kept when the entry is
+// pushed to a log with a clock, and returns the entry. Like WithTag, it must
+// only be called on a new entry before it's pushed or shared.
+func (e *Entry[K, V]) WithTime(t time.Time) *Entry[K, V] {
+	e.time = t
+	return e
+}
+
+// WithTag sets a tag of the application's choosing on the entry, such as the
+// name of the user or process that made the write for audit logging, and
+// returns the entry.
+func (e *Entry[K, V]) WithTag(tag string) *Entry[K, V] {
+	e.tag = tag
+	return e
+}
+
+// Operation returns the user-defined operation of an operation entry.
+func (e *Entry[K, V]) Operation() Operation[K, V] {
+	return e.op
+}
+
+// Apply applies the entry to the map.
+func (e *Entry[K, V]) Apply(m *map[K]V) {
+	applyEntry(e, m, nil, nil)
+}
@@ -10,3 +10,80 @@ func Test(t *testing.T) {
 	e := Insert("foo", &v)
 	fmt.Println(*e.v)
 }
+
+func TestEntry_accessors(t *testing.T) {
+	v := "bar"
+	e := Insert("foo", &v)
+	if e.Type() != EntryInsert || e.Key() != "foo" || e.Value() != &v {
+		t.Fatalf("unexpected insert entry %+v", e)
+	}
+
+	b := NewBatch[string, *string]()
+	b.Insert("foo", &v)
+	b.Delete("baz")
+	batch := b.Entry()
+	if batch.Type() != EntryBatch || len(batch.Entries()) != 2 || batch.Entries()[1].Type() != EntryDelete {
+		t.Fatalf("unexpected batch entry %+v", batch)
+	}
+
+	m := map[string]*string{"baz": &v}
+	batch.Apply(&m)
+	if len(m) != 1 || m["foo"] != &v {
+		t.Fatalf("unexpected map after apply %v", m)
+	}
+}
+
+func TestEntryType_String(t *testing.T) {
+	if s := EntryInsertMany.String(); s != "insert-many" {
+		t.Fatalf("unexpected name %q", s)
+	}
+	if s := EntryType(100).String(); s != "EntryType(100)" {
+		t.Fatalf("unexpected name %q", s)
+	}
+}
+
+// doubleOp doubles every value in the map
+type doubleOp struct{}
+
+func (doubleOp) Apply(m map[string]int) {
+	for k, v := range m {
+		m[k] = v * 2
+	}
+}
+
+func TestCustom(t *testing.T) {
+	l := NewLog[string, int]()
+	a := map[string]int{"foo": 1}
+	b := NewBatch[string, int]()
+	b.Insert("bar", 2)
+	l.PushAndApply(b.Entry(), &a)
+	l.PushAndApply(Custom[string, int](doubleOp{}), &a)
+	if a["foo"] != 2 || a["bar"] != 4 {
+		t.Fatalf("unexpected map after push %v", a)
+	}
+	if !l.Contains(EntryOperation) || !l.Contains(EntryInsert) || l.Contains(EntryClear) {
+		t.Fatal("unexpected entry types in log")
+	}
+
+	// Replaying the log applies the operation to what's in the other map
+	c := map[string]int{"foo": 1}
+	l.Apply(&c)
+	if c["foo"] != 2 || c["bar"] != 4 {
+		t.Fatalf("unexpected map after replay %v", c)
+	}
+}
+
+func TestEntry_ModifiedKeys(t *testing.T) {
+	b := NewBatch[string, int]()
+	b.Insert("foo", 1)
+	b.Clear()
+	b.Delete("bar")
+	keys, cleared := b.Entry().ModifiedKeys()
+	if !cleared || len(keys) != 1 || keys[0] != "bar" {
+		t.Fatalf("unexpected modified keys %v, cleared %t", keys, cleared)
+	}
+	keys, cleared = Insert("foo", 1).ModifiedKeys()
+	if cleared || len(keys) != 1 || keys[0] != "foo" {
+		t.Fatalf("unexpected modified keys %v, cleared %t", keys, cleared)
+	}
+}
@@ -1,39 +1,255 @@
 package oplog
 
+import (
+	"time"
+)
+
 // Log stores a slice of oplog entries that can be applied to a map. This
 // data structure is not thread-safe, which means that any implementors
 // should provide the concurrency synchronization guarantees.
+//
+// V is the type of the values stored in the map as is, so the log of a map of
+// pointers is a Log[K, *T]. Before ValueMap, V was the type that the values
+// pointed to and the log applied to a map[K]*V.
 type Log[K comparable, V any] struct {
-	entries []*entry[K, V]
+	// The entries are stored by value, and the slice is reused after the log is
+	// cleared, so that pushing an entry doesn't allocate once the log has grown
+	// to its usual size.
+	entries []Entry[K, V]
+
+	// Notified of the keys modified by PushAndApply, if set
+	observer Observer[K]
+
+	// Timestamps the pushed entries, if set
+	clock func() time.Time
+
+	// Empties the map for clear entries, or nil to delete every key
+	empty func(m *map[K]V)
+}
+
+// Observer is notified of the keys that are modified when entries are pushed
+// and applied with PushAndApply. Entries that are replayed with Apply are not
+// observed.
+type Observer[K comparable] interface {
+	// Inserted is called when a value is inserted under the key, including when
+	// the key already existed.
+	Inserted(key K)
+
+	// Deleted is called when the key is deleted, including when the key didn't
+	// exist.
+	Deleted(key K)
+
+	// Cleared is called when every key is removed.
+	Cleared()
+}
+
+// SetObserver sets the observer that is notified by PushAndApply.
+func (l *Log[K, V]) SetObserver(o Observer[K]) {
+	l.observer = o
+}
 
-	// The most recent entry applied to the log
-	latest *entry[K, V]
+// SetClock sets the clock that timestamps the entries pushed from now on, which
+// is usually time.Now. Entries that already have a time keep it.
+func (l *Log[K, V]) SetClock(now func() time.Time) {
+	l.clock = now
 }
 
-// Push pushes a new entry into the oplog and updates the oplog's latest entry
-func (l *Log[K, V]) Push(e *entry[K, V]) {
-	l.entries = append(l.entries, e)
-	l.latest = e
+// SetClearFunc sets the function that empties the map when a clear entry is
+// applied, instead of deleting every key from it. The function may replace the
+// map pointed to by m with a different, empty map.
+func (l *Log[K, V]) SetClearFunc(fn func(m *map[K]V)) {
+	l.empty = fn
 }
 
-// PushAndApply pushes a new entry to the oplog and applies that same entry to
-// the provided map.
-func (l *Log[K, V]) PushAndApply(e *entry[K, V], m *map[K]*V) {
-	l.entries = append(l.entries, e)
-	l.latest = e
-	applyEntry(e, m)
+// Push pushes a copy of the entry into the oplog
+func (l *Log[K, V]) Push(e *Entry[K, V]) {
+	l.entries = append(l.entries, *e)
+	l.stamp(&l.entries[len(l.entries)-1])
+}
+
+// PushAndApply pushes a copy of the entry to the oplog and applies that same
+// entry to the provided map.
+func (l *Log[K, V]) PushAndApply(e *Entry[K, V], m *map[K]V) {
+	l.entries = append(l.entries, *e)
+	l.stamp(&l.entries[len(l.entries)-1])
+	applyEntry(e, m, l.observer, l.empty)
+}
+
+// stamp sets the time of a pushed entry that doesn't have one yet.
+func (l *Log[K, V]) stamp(e *Entry[K, V]) {
+	if l.clock != nil && e.time.IsZero() {
+		e.time = l.clock()
+	}
+}
+
+// ApplyEntry applies the entry to the specified map, notifying the observer,
+// without pushing it to the oplog.
+func (l *Log[K, V]) ApplyEntry(e *Entry[K, V], m *map[K]V) {
+	applyEntry(e, m, l.observer, l.empty)
 }
 
 // Apply applies the oplog to the specified map
-func (l *Log[K, V]) Apply(m *map[K]*V) {
-	for _, e := range l.entries {
-		applyEntry(e, m)
+func (l *Log[K, V]) Apply(m *map[K]V) {
+	for i := range l.entries {
+		applyEntry(&l.entries[i], m, nil, l.empty)
+	}
+}
+
+// ApplyN applies the first n entries of the oplog to the specified map, or every
+// entry if the oplog has fewer than n, and returns the number of entries that
+// were applied. Together with Truncate, this makes it possible to apply the
+// oplog in bounded chunks.
+func (l *Log[K, V]) ApplyN(m *map[K]V, n int) int {
+	n = max(min(n, len(l.entries)), 0)
+	for i := range l.entries[:n] {
+		applyEntry(&l.entries[i], m, nil, l.empty)
 	}
+	return n
 }
 
-// Clear empties the oplog
+// ApplyRange applies the entries of the oplog from index i up to but excluding
+// index j to the specified map, and returns the number of entries that were
+// applied. Both indexes are clamped to the entries of the oplog.
+func (l *Log[K, V]) ApplyRange(m *map[K]V, i, j int) int {
+	j = max(min(j, len(l.entries)), 0)
+	i = max(min(i, j), 0)
+	for k := range l.entries[i:j] {
+		applyEntry(&l.entries[i+k], m, nil, l.empty)
+	}
+	return j - i
+}
+
+// Truncate discards the first n entries of the oplog, or every entry if the
+// oplog has fewer than n, keeping the entries that follow them.
+func (l *Log[K, V]) Truncate(n int) {
+	n = max(min(n, len(l.entries)), 0)
+	clear(l.entries[:n])
+	l.entries = l.entries[n:]
+}
+
+// Clear empties the oplog, keeping its capacity for the entries that are pushed
+// next.
 func (l *Log[K, V]) Clear() {
-	l.entries = []*entry[K, V]{}
+	clear(l.entries)
+	l.entries = l.entries[:0]
+}
+
+// Compact rewrites the log so that applying it has the same effect with fewer
+// entries. Every entry before a clear is dropped, and so is every entry of a key
+// that is followed by an insert or delete of the key, which overwrites it. The
+// entries of batches are compacted individually, and since the keys modified
+// by operations aren't known, entries are never moved across an operation.
+// Compact can be called before the log is applied to the second map to avoid
+// replaying churn that was overwritten.
+func (l *Log[K, V]) Compact() {
+	var flat []*Entry[K, V]
+	for i := range l.entries {
+		flat = flatten(&l.entries[i], flat)
+	}
+	compacted := make([]*Entry[K, V], 0, len(flat))
+	start := 0
+	for i, e := range flat {
+		if e.t == EntryOperation {
+			compacted = compactEntries(flat[start:i], compacted)
+			compacted = append(compacted, e)
+			start = i + 1
+		}
+	}
+	compacted = compactEntries(flat[start:], compacted)
+
+	// The compacted entries point into the current entries, so they're copied
+	// into a new slice rather than over the entries.
+	entries := make([]Entry[K, V], len(compacted))
+	for i, e := range compacted {
+		entries[i] = *e
+	}
+	l.entries = entries
+}
+
+// flatten appends the entry to dst as single-key entries, clears and
+// operations. The flattened entries inherit the time and tag of the entry.
+func flatten[K comparable, V any](e *Entry[K, V], dst []*Entry[K, V]) []*Entry[K, V] {
+	switch e.t {
+	case EntryInsertMany:
+		for k, v := range e.batch {
+			dst = append(dst, Insert(k, v).WithTime(e.time).WithTag(e.tag))
+		}
+	case EntryDeleteMany:
+		for _, k := range e.keys {
+			dst = append(dst, Delete[K, V](k).WithTime(e.time).WithTag(e.tag))
+		}
+	case EntryBatch:
+		for _, child := range e.entries {
+			if child.time.IsZero() {
+				// The entries of the batch may be shared, so they're copied
+				c := *child
+				c.time, c.tag = e.time, e.tag
+				child = &c
+			}
+			dst = flatten(child, dst)
+		}
+	default:
+		dst = append(dst, e)
+	}
+	return dst
+}
+
+// compactEntries appends the entries that have an effect to dst. The entries
+// must have been flattened and must not contain operations.
+func compactEntries[K comparable, V any](entries []*Entry[K, V], dst []*Entry[K, V]) []*Entry[K, V] {
+	// Everything before the last clear is discarded by it
+	var cleared bool
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].t == EntryClear {
+			entries, cleared = entries[i:], true
+			break
+		}
+	}
+
+	// The last insert or delete of a key overwrites every earlier entry of it
+	last := make(map[K]int)
+	for i, e := range entries {
+		if e.t == EntryInsert || e.t == EntryDelete {
+			last[e.k] = i
+		}
+	}
+	for i, e := range entries {
+		if e.t != EntryClear {
+			j, ok := last[e.k]
+			if ok && i < j {
+				continue
+			}
+
+			// After a clear, a delete of a key that wasn't inserted since is a no-op
+			if cleared && e.t == EntryDelete {
+				continue
+			}
+		}
+		dst = append(dst, e)
+	}
+	return dst
+}
+
+// Entries returns a copy of the entries in the oplog in the order that they
+// were pushed.
+func (l *Log[K, V]) Entries() []*Entry[K, V] {
+	// The entries are copied because the log reuses its slice once it's cleared
+	copies := append([]Entry[K, V](nil), l.entries...)
+	entries := make([]*Entry[K, V], len(copies))
+	for i := range copies {
+		entries[i] = &copies[i]
+	}
+	return entries
+}
+
+// Latest returns a copy of the most recently pushed entry, or nil if the log is
+// empty.
+func (l *Log[K, V]) Latest() *Entry[K, V] {
+	if len(l.entries) == 0 {
+		return nil
+	}
+	e := l.entries[len(l.entries)-1]
+	return &e
 }
 
 // Len returns the current length of the oplog
@@ -41,22 +257,119 @@ func (l *Log[K, V]) Len() int {
 	return len(l.entries)
 }
 
+// ModifiedKeys returns the keys modified by the entries in the log since the
+// most recent clear, in the order they were modified and possibly repeated, and
+// reports whether the log contains a clear. The keys modified by operations
+// aren't known, so they aren't returned.
+func (l *Log[K, V]) ModifiedKeys() (keys []K, cleared bool) {
+	for i := range l.entries {
+		keys, cleared = modifiedKeys(&l.entries[i], keys, cleared)
+	}
+	return keys, cleared
+}
+
+// Contains reports whether the log contains an entry of the given type,
+// including entries within batches.
+func (l *Log[K, V]) Contains(t EntryType) bool {
+	for i := range l.entries {
+		if containsType(&l.entries[i], t) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsType[K comparable, V any](e *Entry[K, V], t EntryType) bool {
+	if e.t == t {
+		return true
+	}
+	for _, e := range e.entries {
+		if containsType(e, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// modifiedKeys appends the keys modified by the entry to keys, discarding the
+// keys that were modified before any clear.
+func modifiedKeys[K comparable, V any](e *Entry[K, V], keys []K, cleared bool) ([]K, bool) {
+	switch e.t {
+	case EntryInsert, EntryDelete, EntryUpdate:
+		keys = append(keys, e.k)
+	case EntryClear:
+		keys, cleared = keys[:0], true
+	case EntryInsertMany:
+		for k := range e.batch {
+			keys = append(keys, k)
+		}
+	case EntryDeleteMany:
+		keys = append(keys, e.keys...)
+	case EntryBatch:
+		for _, e := range e.entries {
+			keys, cleared = modifiedKeys(e, keys, cleared)
+		}
+	}
+	return keys, cleared
+}
+
 // NewLog creates a new oplog with the given types
 func NewLog[K comparable, V any]() *Log[K, V] {
-	return &Log[K, V]{entries: []*entry[K, V]{}}
+	return &Log[K, V]{}
 }
 
 // applyEntry is a helper function for applying a single oplog entry to
-// the destination map.
-func applyEntry[K comparable, V any](e *entry[K, V], m *map[K]*V) {
+// the destination map, notifying the observer if it's not nil. Clear entries
+// are applied with empty if it's not nil.
+func applyEntry[K comparable, V any](e *Entry[K, V], m *map[K]V, o Observer[K], empty func(m *map[K]V)) {
 	switch e.t {
-	case entryTypeInsert:
+	case EntryInsert:
 		(*m)[e.k] = e.v
-	case entryTypeDelete:
+		if o != nil {
+			o.Inserted(e.k)
+		}
+	case EntryDelete:
 		delete(*m, e.k)
-	case entryTypeClear:
-		for k := range *m {
+		if o != nil {
+			o.Deleted(e.k)
+		}
+	case EntryClear:
+		if empty != nil {
+			empty(m)
+		} else {
+			for k := range *m {
+				delete(*m, k)
+			}
+		}
+		if o != nil {
+			o.Cleared()
+		}
+	case EntryInsertMany:
+		for k, v := range e.batch {
+			(*m)[k] = v
+			if o != nil {
+				o.Inserted(k)
+			}
+		}
+	case EntryDeleteMany:
+		for _, k := range e.keys {
 			delete(*m, k)
+			if o != nil {
+				o.Deleted(k)
+			}
+		}
+	case EntryUpdate:
+		old, ok := (*m)[e.k]
+		(*m)[e.k] = e.update(old, ok)
+		if o != nil {
+			o.Inserted(e.k)
+		}
+	case EntryBatch:
+		for _, e := range e.entries {
+			applyEntry(e, m, o, empty)
 		}
+	case EntryOperation:
+		// The keys that the operation modifies aren't known, so it's not observed
+		e.op.Apply(*m)
 	}
 }
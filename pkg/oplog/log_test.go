@@ -3,10 +3,11 @@ package oplog
 import (
 	"github.com/stretchr/testify/assert"
 	"testing"
+	"time"
 )
 
 func TestLog(t *testing.T) {
-	log := NewLog[string, int]()
+	log := NewLog[string, *int]()
 	m := map[string]*int{}
 
 	// Each of these tests piggyback on each other and cannot be run separately
@@ -22,21 +23,285 @@ func TestLog(t *testing.T) {
 		assert.Equal(t, v1, *m["foo"])
 	})
 	t.Run("Delete", func(t *testing.T) {
-		log.Push(Delete[string, int]("foo"))
+		log.Push(Delete[string, *int]("foo"))
 		log.Apply(&m)
 		log.Clear()
 
 		assert.Len(t, m, 1)
 	})
 	t.Run("Clear", func(t *testing.T) {
-		log.Push(Clear[string, int]())
+		log.Push(Clear[string, *int]())
+		log.Apply(&m)
+
+		assert.Len(t, m, 0)
+	})
+	t.Run("InsertMany", func(t *testing.T) {
+		v1 := 1
+		v2 := 2
+		entries := map[string]*int{"foo": &v1, "bar": &v2}
+		log.Push(InsertMany(entries))
+
+		// Modifying the source map shouldn't affect the entry
+		delete(entries, "bar")
 		log.Apply(&m)
+		log.Clear()
+
+		assert.Len(t, m, 2)
+		assert.Equal(t, v2, *m["bar"])
+	})
+	t.Run("DeleteMany", func(t *testing.T) {
+		log.Push(DeleteMany[string, *int]([]string{"foo", "bar", "baz"}))
+		log.Apply(&m)
+		log.Clear()
 
 		assert.Len(t, m, 0)
 	})
+	t.Run("Update", func(t *testing.T) {
+		increment := func(old *int, ok bool) *int {
+			n := 1
+			if ok {
+				n += *old
+			}
+			return &n
+		}
+		log.Push(Update("foo", increment))
+		log.Push(Update("foo", increment))
+
+		// The update is computed against the destination map every time the
+		// entry is applied
+		a, b := map[string]*int{}, map[string]*int{}
+		log.Apply(&a)
+		log.Apply(&b)
+		log.Apply(&b)
+		log.Clear()
+
+		assert.Equal(t, 2, *a["foo"])
+		assert.Equal(t, 4, *b["foo"])
+	})
 	t.Run("PushAndApply", func(t *testing.T) {
 		v1 := 1
 		log.PushAndApply(Insert("foo", &v1), &m)
 		assert.Len(t, m, 1)
 	})
 }
+
+func TestLog_ModifiedKeys(t *testing.T) {
+	log := NewLog[string, *int]()
+	v := 1
+	log.Push(Insert("foo", &v))
+	log.Push(DeleteMany[string, *int]([]string{"bar"}))
+	keys, cleared := log.ModifiedKeys()
+	assert.Equal(t, []string{"foo", "bar"}, keys)
+	assert.False(t, cleared)
+
+	// Keys modified before a clear are discarded
+	b := NewBatch[string, *int]()
+	b.Clear()
+	b.Insert("baz", &v)
+	log.Push(b.Entry())
+	log.Push(Delete[string, *int]("foo"))
+	keys, cleared = log.ModifiedKeys()
+	assert.Equal(t, []string{"baz", "foo"}, keys)
+	assert.True(t, cleared)
+}
+
+func TestLog_Compact(t *testing.T) {
+	v1, v2, v3 := 1, 2, 3
+	increment := func(old *int, ok bool) *int {
+		n := 1
+		if ok {
+			n += *old
+		}
+		return &n
+	}
+
+	// The log compacts to the same effect with fewer entries
+	log := NewLog[string, *int]()
+	log.Push(Insert("foo", &v1))
+	log.Push(Insert("bar", &v1))
+	log.Push(Update("foo", increment))
+	log.Push(Delete[string, *int]("foo"))
+	log.Push(InsertMany(map[string]*int{"foo": &v2, "baz": &v1}))
+	log.Push(Update("foo", increment))
+	b := NewBatch[string, *int]()
+	b.Insert("bar", &v3)
+	b.Delete("baz")
+	log.Push(b.Entry())
+	log.Push(Custom[string, *int](keepFoo{}))
+	log.Push(Insert("qux", &v1))
+	log.Push(Insert("qux", &v2))
+
+	want := map[string]*int{"old": &v1}
+	log.Apply(&want)
+	log.Compact()
+	got := map[string]*int{"old": &v1}
+	log.Apply(&got)
+	assert.Equal(t, want, got)
+
+	var types []EntryType
+	for _, e := range log.Entries() {
+		types = append(types, e.Type())
+	}
+	assert.Equal(t, []EntryType{EntryInsert, EntryUpdate, EntryInsert, EntryDelete, EntryOperation, EntryInsert}, types)
+
+	// Everything before a clear is dropped, including deletes after it
+	log = NewLog[string, *int]()
+	log.Push(Insert("foo", &v1))
+	log.Push(Clear[string, *int]())
+	log.Push(Insert("bar", &v1))
+	log.Push(Delete[string, *int]("bar"))
+	log.Push(Delete[string, *int]("foo"))
+	log.Push(Insert("baz", &v2))
+	log.Compact()
+	assert.Len(t, log.Entries(), 2)
+	m := map[string]*int{"old": &v1}
+	log.Apply(&m)
+	assert.Equal(t, map[string]*int{"baz": &v2}, m)
+}
+
+// keepFoo is an operation that deletes every key except for foo
+type keepFoo struct{}
+
+func (keepFoo) Apply(m map[string]*int) {
+	for k := range m {
+		if k != "foo" {
+			delete(m, k)
+		}
+	}
+}
+
+func TestLog_PushAndApplyAllocs(t *testing.T) {
+	log := NewLog[int, *int]()
+	m := map[int]*int{}
+	v := 1
+	log.PushAndApply(Insert(0, &v), &m)
+	log.Clear()
+
+	// Once the log has grown, the entries are pushed without allocating
+	allocs := testing.AllocsPerRun(100, func() {
+		log.PushAndApply(Insert(0, &v), &m)
+		log.Push(Delete[int, *int](0))
+		log.Clear()
+	})
+	assert.Zero(t, allocs)
+}
+
+func BenchmarkLog_PushAndApply(b *testing.B) {
+	log := NewLog[int, *int]()
+	m := map[int]*int{}
+	v := 1
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		log.PushAndApply(Insert(i%1000, &v), &m)
+		if i%1000 == 999 {
+			log.Clear()
+		}
+	}
+}
+
+func TestLog_SetClock(t *testing.T) {
+	now := time.Unix(100, 0)
+	log := NewLog[string, int]()
+	log.Push(Insert("foo", 1))
+	log.SetClock(func() time.Time { return now })
+	log.Push(Insert("bar", 1).WithTag("user"))
+	log.Push(Delete[string, int]("bar").WithTime(time.Unix(50, 0)))
+
+	entries := log.Entries()
+	assert.True(t, entries[0].Time().IsZero())
+	assert.Equal(t, now, entries[1].Time())
+	assert.Equal(t, "user", entries[1].Tag())
+	assert.Equal(t, time.Unix(50, 0), entries[2].Time())
+
+	// Compacted entries keep the time of the entry they were flattened from
+	log = NewLog[string, int]()
+	log.SetClock(func() time.Time { return now })
+	b := NewBatch[string, int]()
+	b.Insert("foo", 1)
+	log.Push(b.Entry().WithTag("batch"))
+	log.Compact()
+	assert.Equal(t, now, log.Latest().Time())
+	assert.Equal(t, "batch", log.Latest().Tag())
+}
+
+func TestLog_Latest(t *testing.T) {
+	log := NewLog[string, int]()
+	assert.Nil(t, log.Latest())
+	log.Push(Insert("foo", 1))
+	log.Push(Delete[string, int]("bar"))
+	latest := log.Latest()
+	assert.Equal(t, EntryDelete, latest.Type())
+	assert.Equal(t, "bar", latest.Key())
+	assert.False(t, latest.HasValue())
+
+	// The latest entry is a copy that outlives the log's entries
+	log.Clear()
+	assert.Nil(t, log.Latest())
+	log.Push(Insert("baz", 1))
+	assert.Equal(t, "bar", latest.Key())
+}
+
+func TestLog_ApplyNAndTruncate(t *testing.T) {
+	log := NewLog[string, int]()
+	for _, k := range []string{"a", "b", "c", "d", "e"} {
+		log.Push(Insert(k, 1))
+	}
+	m := map[string]int{}
+
+	// The log is applied in chunks, discarding each applied chunk
+	assert.Equal(t, 2, log.ApplyN(&m, 2))
+	log.Truncate(2)
+	assert.Equal(t, map[string]int{"a": 1, "b": 1}, m)
+	assert.Equal(t, 3, log.Len())
+	assert.Equal(t, "c", log.Entries()[0].Key())
+
+	assert.Equal(t, 3, log.ApplyN(&m, 10))
+	log.Truncate(10)
+	assert.Len(t, m, 5)
+	assert.Equal(t, 0, log.Len())
+	assert.Equal(t, 0, log.ApplyN(&m, -1))
+
+	// The log remains usable after being truncated
+	log.Push(Delete[string, int]("a"))
+	log.Apply(&m)
+	assert.Len(t, m, 4)
+}
+
+func TestLog_ApplyRange(t *testing.T) {
+	log := NewLog[string, int]()
+	for _, k := range []string{"a", "b", "c", "d"} {
+		log.Push(Insert(k, 1))
+	}
+	m := map[string]int{}
+
+	assert.Equal(t, 2, log.ApplyRange(&m, 1, 3))
+	assert.Equal(t, map[string]int{"b": 1, "c": 1}, m)
+	assert.Equal(t, 4, log.Len())
+
+	// The indexes are clamped to the entries of the log
+	assert.Equal(t, 1, log.ApplyRange(&m, 3, 10))
+	assert.Equal(t, 0, log.ApplyRange(&m, 3, 1))
+	assert.Equal(t, 1, log.ApplyRange(&m, -1, 1))
+	assert.Len(t, m, 4)
+}
+
+type countingObserver struct {
+	inserted, deleted, cleared int
+}
+
+func (o *countingObserver) Inserted(string) { o.inserted++ }
+func (o *countingObserver) Deleted(string)  { o.deleted++ }
+func (o *countingObserver) Cleared()        { o.cleared++ }
+
+func TestLog_ApplyEntry(t *testing.T) {
+	log := NewLog[string, int]()
+	o := &countingObserver{}
+	log.SetObserver(o)
+	m := map[string]int{}
+
+	log.ApplyEntry(Insert("a", 1), &m)
+	log.ApplyEntry(Delete[string, int]("b"), &m)
+	assert.Equal(t, map[string]int{"a": 1}, m)
+	assert.Equal(t, 0, log.Len())
+	assert.Equal(t, &countingObserver{inserted: 1, deleted: 1}, o)
+}
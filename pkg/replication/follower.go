@@ -0,0 +1,176 @@
+package replication
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"github.com/clarkmcc/go-evmap"
+	"io"
+	"net"
+	"sync"
+)
+
+// Follower maintains a local replica of a map served by a Leader. The local map
+// is refreshed once for every batch received from the leader, so its readers
+// only ever observe snapshots that were published by the leader.
+//
+// A follower doesn't reconnect. When the connection to the leader is lost the
+// local map keeps serving the last replicated snapshot, Done is closed and Err
+// returns the reason, and a new follower must be created to resume replication.
+type Follower[K comparable, V any] struct {
+	m     *eventual.Map[K, V]
+	conn  net.Conn
+	codec frameCodec[K, V]
+	done  chan struct{}
+
+	mu         sync.Mutex
+	generation uint64
+	synced     bool
+	err        error
+
+	// applied is closed and replaced every time a batch is applied
+	applied chan struct{}
+}
+
+// Follow creates a follower that replicates the map served by the leader on the
+// other end of the connection. The connection is closed when the follower is
+// closed.
+func Follow[K comparable, V any](conn net.Conn, opts ...OptionFunc) *Follower[K, V] {
+	options := newOptions(opts...)
+	f := &Follower[K, V]{
+		m:       eventual.NewMap[K, V](options.MapOptions...),
+		conn:    conn,
+		codec:   newFrameCodec[K, V](options),
+		done:    make(chan struct{}),
+		applied: make(chan struct{}),
+	}
+	go f.run()
+	return f
+}
+
+// Dial connects to the leader at the address and creates a follower for it.
+func Dial[K comparable, V any](ctx context.Context, network, address string, opts ...OptionFunc) (*Follower[K, V], error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+	return Follow[K, V](conn, opts...), nil
+}
+
+// run applies every frame received from the leader until the connection fails.
+func (f *Follower[K, V]) run() {
+	defer close(f.done)
+	r := bufio.NewReader(f.conn)
+	for {
+		fr, err := f.codec.read(r)
+		if err == nil {
+			err = f.apply(fr)
+		}
+		if err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) {
+				err = eventual.ErrClosed
+			}
+			f.mu.Lock()
+			f.err = err
+			f.mu.Unlock()
+			_ = f.conn.Close()
+			return
+		}
+	}
+}
+
+// apply applies the frame to the local map and refreshes it.
+func (f *Follower[K, V]) apply(fr frame[K, V]) error {
+	if fr.snapshot {
+		contents := make(map[K]*V, len(fr.ops))
+		for _, o := range fr.ops {
+			contents[o.key] = o.value
+		}
+		if err := f.m.Replace(contents); err != nil {
+			return err
+		}
+	} else {
+		err := f.m.Batch(func(b *eventual.Batch[K, V]) {
+			for _, o := range fr.ops {
+				if o.deleted {
+					b.Delete(o.key)
+				} else {
+					b.Insert(o.key, o.value)
+				}
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := f.m.Refresh(); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	f.generation = fr.generation
+	f.synced = true
+	close(f.applied)
+	f.applied = make(chan struct{})
+	f.mu.Unlock()
+	return nil
+}
+
+// Reader creates and registers a new reader for the local map.
+func (f *Follower[K, V]) Reader() *eventual.Reader[K, V] {
+	return f.m.Reader()
+}
+
+// Generation returns the generation of the leader's map that was last applied
+// to the local map. The local map has its own generations, which don't match
+// the leader's.
+func (f *Follower[K, V]) Generation() uint64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.generation
+}
+
+// WaitForGeneration blocks until a batch at or beyond the provided generation
+// of the leader's map has been applied, the connection to the leader is lost,
+// in which case Err is returned, or the context is done.
+func (f *Follower[K, V]) WaitForGeneration(ctx context.Context, generation uint64) error {
+	for {
+		f.mu.Lock()
+		ready := f.synced && f.generation >= generation
+		applied := f.applied
+		f.mu.Unlock()
+		if ready {
+			return nil
+		}
+		select {
+		case <-applied:
+		case <-f.done:
+			return f.Err()
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Done returns a channel that is closed when the follower stops replicating.
+func (f *Follower[K, V]) Done() <-chan struct{} {
+	return f.done
+}
+
+// Err returns the reason that the follower stopped replicating, or nil if it's
+// still replicating. It returns eventual.ErrClosed if the leader or the follower
+// was closed.
+func (f *Follower[K, V]) Err() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.err
+}
+
+// Close disconnects from the leader and closes the local map, closing every
+// reader created from it.
+func (f *Follower[K, V]) Close() error {
+	_ = f.conn.Close()
+	<-f.done
+	return f.m.Close()
+}
@@ -0,0 +1,258 @@
+package replication
+
+import (
+	"bufio"
+	"context"
+	"github.com/clarkmcc/go-evmap"
+	"net"
+	"sync"
+)
+
+// Leader streams the changes made visible by every refresh of a map to the
+// followers connected to it. The leader keeps its own copy of the map's visible
+// keys and value pointers, so that a follower that connects at any time
+// receives a snapshot that is consistent with the batches that follow it.
+//
+// Followers that fall more than SendBuffer batches behind are disconnected
+// rather than slowing down the other followers or the map.
+type Leader[K comparable, V any] struct {
+	codec      frameCodec[K, V]
+	sendBuffer int
+	feed       *eventual.Changefeed[K, V]
+	cancel     context.CancelFunc
+	done       chan struct{}
+
+	mu         sync.Mutex
+	state      map[K]*V
+	generation uint64
+	followers  map[*peer]struct{}
+	listeners  map[net.Listener]struct{}
+	closed     bool
+	background sync.WaitGroup
+}
+
+// peer is a follower connected to a leader.
+type peer struct {
+	conn net.Conn
+
+	// send receives the encoded batches to write to the follower, and is closed
+	// when the follower is disconnected
+	send chan []byte
+}
+
+// NewLeader creates a leader that replicates the map. The leader stops when
+// it's closed or when the map is closed.
+func NewLeader[K comparable, V any](m *eventual.Map[K, V], opts ...OptionFunc) *Leader[K, V] {
+	options := newOptions(opts...)
+	ctx, cancel := context.WithCancel(context.Background())
+	l := &Leader[K, V]{
+		codec:      newFrameCodec[K, V](options),
+		sendBuffer: options.SendBuffer,
+		cancel:     cancel,
+		done:       make(chan struct{}),
+		state:      make(map[K]*V),
+		followers:  make(map[*peer]struct{}),
+		listeners:  make(map[net.Listener]struct{}),
+	}
+
+	// The changefeed is created first, so that it receives every refresh that
+	// isn't part of the initial state.
+	l.feed = m.Changefeed()
+	r := m.Reader()
+	g := r.Guard()
+	g.ForEach(func(k K, v *V) bool {
+		l.state[k] = v
+		return true
+	})
+	l.generation = g.Generation()
+	g.Release()
+	_ = r.Close()
+
+	go l.run(ctx)
+	return l
+}
+
+// run applies every batch of changes from the changefeed to the state of the
+// leader and sends it to the followers.
+func (l *Leader[K, V]) run(ctx context.Context) {
+	defer close(l.done)
+	defer l.feed.Close()
+	for {
+		c, err := l.feed.Next(ctx)
+		if err != nil {
+			// The map or the leader was closed
+			l.stop()
+			return
+		}
+
+		l.mu.Lock()
+		if c.Generation <= l.generation {
+			// Already part of the initial state
+			l.mu.Unlock()
+			continue
+		}
+		f := frame[K, V]{generation: c.Generation, ops: make([]op[K, V], 0, len(c.Changes))}
+		for _, change := range c.Changes {
+			if change.Deleted {
+				delete(l.state, change.Key)
+			} else {
+				l.state[change.Key] = change.New
+			}
+			f.ops = append(f.ops, op[K, V]{key: change.Key, value: change.New, deleted: change.Deleted})
+		}
+		l.generation = c.Generation
+		data, err := l.codec.encode(f)
+		if err != nil {
+			// Followers can't be kept consistent without the batch
+			for p := range l.followers {
+				l.disconnectLocked(p)
+			}
+			l.mu.Unlock()
+			continue
+		}
+		for p := range l.followers {
+			select {
+			case p.send <- data:
+			default:
+				l.disconnectLocked(p)
+			}
+		}
+		l.mu.Unlock()
+	}
+}
+
+// Serve accepts followers from the listener until the listener fails or the
+// leader is closed, in which case eventual.ErrClosed is returned. The listener
+// is closed when Serve returns.
+func (l *Leader[K, V]) Serve(ln net.Listener) error {
+	defer ln.Close()
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return eventual.ErrClosed
+	}
+	l.listeners[ln] = struct{}{}
+	l.mu.Unlock()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			l.mu.Lock()
+			delete(l.listeners, ln)
+			closed := l.closed
+			l.mu.Unlock()
+			if closed {
+				return eventual.ErrClosed
+			}
+			return err
+		}
+		_ = l.ServeConn(conn)
+	}
+}
+
+// ServeConn starts replicating the map to the follower on the other end of the
+// connection, which makes it possible to use transports other than a
+// net.Listener. The connection is closed when the follower is disconnected.
+func (l *Leader[K, V]) ServeConn(conn net.Conn) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		_ = conn.Close()
+		return eventual.ErrClosed
+	}
+	f := frame[K, V]{snapshot: true, generation: l.generation, ops: make([]op[K, V], 0, len(l.state))}
+	for k, v := range l.state {
+		f.ops = append(f.ops, op[K, V]{key: k, value: v})
+	}
+	p := &peer{conn: conn, send: make(chan []byte, l.sendBuffer)}
+	l.followers[p] = struct{}{}
+	l.background.Add(1)
+	go l.write(p, f)
+	return nil
+}
+
+// write encodes and writes the snapshot to the follower, followed by every
+// batch that is sent to it, until the follower is disconnected.
+func (l *Leader[K, V]) write(p *peer, snapshot frame[K, V]) {
+	defer l.background.Done()
+	defer p.conn.Close()
+
+	data, err := l.codec.encode(snapshot)
+	if err != nil {
+		l.disconnect(p)
+		return
+	}
+	w := bufio.NewWriter(p.conn)
+	for {
+		if _, err := w.Write(data); err != nil {
+			l.disconnect(p)
+			return
+		}
+
+		// Batches that are already queued are written together
+		var ok bool
+		select {
+		case data, ok = <-p.send:
+		default:
+			if err := w.Flush(); err != nil {
+				l.disconnect(p)
+				return
+			}
+			data, ok = <-p.send
+		}
+		if !ok {
+			return
+		}
+	}
+}
+
+func (l *Leader[K, V]) disconnect(p *peer) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.disconnectLocked(p)
+}
+
+// disconnectLocked closes the connection of the follower, if it's still
+// connected. This must be called while holding the lock.
+func (l *Leader[K, V]) disconnectLocked(p *peer) {
+	if _, ok := l.followers[p]; !ok {
+		return
+	}
+	delete(l.followers, p)
+	close(p.send)
+	_ = p.conn.Close()
+}
+
+// Followers returns the number of followers that are connected to the leader.
+func (l *Leader[K, V]) Followers() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.followers)
+}
+
+// Close stops the leader, disconnecting every follower and closing every
+// listener passed to Serve. The map is not closed.
+func (l *Leader[K, V]) Close() error {
+	l.stop()
+	<-l.done
+	l.background.Wait()
+	return nil
+}
+
+// stop performs the work of Close without waiting for the goroutines of the
+// leader to exit.
+func (l *Leader[K, V]) stop() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return
+	}
+	l.closed = true
+	l.cancel()
+	for p := range l.followers {
+		l.disconnectLocked(p)
+	}
+	for ln := range l.listeners {
+		_ = ln.Close()
+	}
+}
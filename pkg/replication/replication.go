@@ -0,0 +1,201 @@
+// Package replication replicates an eventual.Map across processes. A Leader
+// streams the changes made visible by every refresh of a map to its followers
+// as a batch tagged with the refresh's generation, and every Follower applies
+// the batches to a local map that is refreshed on batch boundaries, so the
+// readers of a follower observe exactly the snapshots that were published by
+// the leader, only later.
+package replication
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/clarkmcc/go-evmap"
+	"github.com/clarkmcc/go-evmap/pkg/oplog"
+	"io"
+)
+
+// ErrMalformedFrame is returned by a follower when it receives a frame that
+// wasn't sent by a leader.
+var ErrMalformedFrame = errors.New("replication: malformed frame")
+
+// maxFrameSize is the largest frame that a follower accepts.
+const maxFrameSize = 1 << 30
+
+// Options contains the configurable behavior of a Leader or Follower. The
+// codecs of the leader and its followers must match.
+type Options struct {
+	// SendBuffer is the number of batches that can be queued for a follower
+	// that isn't keeping up before it's disconnected.
+	SendBuffer int
+
+	// MapOptions are the options of the local map of a follower.
+	MapOptions []eventual.OptionFunc
+
+	// keyCodec and valueCodec are the eventual.Codec[K] and eventual.Codec[V]
+	// used to encode the keys and values. They're stored as interfaces because
+	// Options is not generic.
+	keyCodec   any
+	valueCodec any
+}
+
+type OptionFunc func(o *Options)
+
+// WithSendBuffer sets the number of batches that can be queued for a follower
+// before the leader disconnects it. The default is 1024.
+func WithSendBuffer(n int) OptionFunc {
+	return func(o *Options) {
+		o.SendBuffer = n
+	}
+}
+
+// WithMapOptions sets the options used to create the local map of a follower.
+func WithMapOptions(opts ...eventual.OptionFunc) OptionFunc {
+	return func(o *Options) {
+		o.MapOptions = append(o.MapOptions, opts...)
+	}
+}
+
+// WithKeyCodec sets the codec used to encode keys. By default keys are encoded
+// with eventual.GobCodec.
+func WithKeyCodec[K comparable](codec eventual.Codec[K]) OptionFunc {
+	return func(o *Options) {
+		o.keyCodec = codec
+	}
+}
+
+// WithValueCodec sets the codec used to encode values. By default values are
+// encoded with eventual.GobCodec.
+func WithValueCodec[V any](codec eventual.Codec[V]) OptionFunc {
+	return func(o *Options) {
+		o.valueCodec = codec
+	}
+}
+
+func newOptions(opts ...OptionFunc) Options {
+	o := Options{}
+	for _, fn := range opts {
+		fn(&o)
+	}
+	if o.SendBuffer <= 0 {
+		o.SendBuffer = 1024
+	}
+	return o
+}
+
+// frameCodec encodes and decodes frames, encoding their operations with the
+// entry codec of the map, configured with the codecs from the options.
+type frameCodec[K comparable, V any] struct {
+	entries *oplog.EntryCodec[K, *V]
+}
+
+func newFrameCodec[K comparable, V any](o Options) frameCodec[K, V] {
+	var keys eventual.Codec[K] = eventual.GobCodec[K]{}
+	var values eventual.Codec[V] = eventual.GobCodec[V]{}
+	if o.keyCodec != nil {
+		codec, ok := o.keyCodec.(eventual.Codec[K])
+		if !ok {
+			panic(fmt.Sprintf("replication: WithKeyCodec expects a %T", &codec))
+		}
+		keys = codec
+	}
+	if o.valueCodec != nil {
+		codec, ok := o.valueCodec.(eventual.Codec[V])
+		if !ok {
+			panic(fmt.Sprintf("replication: WithValueCodec expects a %T", &codec))
+		}
+		values = codec
+	}
+	return frameCodec[K, V]{entries: eventual.NewEntryCodec[K, V](eventual.WithKeyCodec(keys), eventual.WithValueCodec(values))}
+}
+
+// frame is the unit sent from a leader to a follower. The first frame sent to a
+// follower is a snapshot of the leader's visible map, and every following frame
+// is the batch of changes made visible by a single refresh.
+type frame[K comparable, V any] struct {
+	snapshot   bool
+	generation uint64
+	ops        []op[K, V]
+}
+
+// op sets or deletes a single key.
+type op[K comparable, V any] struct {
+	key     K
+	value   *V
+	deleted bool
+}
+
+// encode encodes the frame as its length followed by a snapshot flag, the
+// generation, and the operations encoded as a batch of inserts and deletes
+// with the entry codec.
+func (c frameCodec[K, V]) encode(f frame[K, V]) ([]byte, error) {
+	var body []byte
+	if f.snapshot {
+		body = append(body, 1)
+	} else {
+		body = append(body, 0)
+	}
+	body = binary.AppendUvarint(body, f.generation)
+	var batch oplog.Batch[K, *V]
+	for _, o := range f.ops {
+		if o.deleted {
+			batch.Delete(o.key)
+		} else {
+			batch.Insert(o.key, o.value)
+		}
+	}
+	ops, err := c.entries.Encode(batch.Entry())
+	if err != nil {
+		return nil, err
+	}
+	body = append(body, ops...)
+	return append(binary.AppendUvarint(nil, uint64(len(body))), body...), nil
+}
+
+// read reads and decodes the next frame from r.
+func (c frameCodec[K, V]) read(r *bufio.Reader) (frame[K, V], error) {
+	var f frame[K, V]
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return f, err
+	}
+	if n > maxFrameSize {
+		return f, ErrMalformedFrame
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return f, err
+	}
+
+	if len(body) == 0 {
+		return f, ErrMalformedFrame
+	}
+	f.snapshot = body[0] == 1
+	generation, size := binary.Uvarint(body[1:])
+	if size <= 0 {
+		return f, ErrMalformedFrame
+	}
+	f.generation = generation
+	batch, err := c.entries.Decode(body[1+size:])
+	if errors.Is(err, oplog.ErrMalformedEntry) {
+		return f, ErrMalformedFrame
+	} else if err != nil {
+		return f, fmt.Errorf("replication: decoding frame: %w", err)
+	}
+	if batch.Type() != oplog.EntryBatch {
+		return f, ErrMalformedFrame
+	}
+	f.ops = make([]op[K, V], 0, len(batch.Entries()))
+	for _, e := range batch.Entries() {
+		switch e.Type() {
+		case oplog.EntryInsert:
+			f.ops = append(f.ops, op[K, V]{key: e.Key(), value: e.Value()})
+		case oplog.EntryDelete:
+			f.ops = append(f.ops, op[K, V]{key: e.Key(), deleted: true})
+		default:
+			return f, ErrMalformedFrame
+		}
+	}
+	return f, nil
+}
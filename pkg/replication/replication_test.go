@@ -0,0 +1,101 @@
+package replication
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"github.com/clarkmcc/go-evmap"
+	"github.com/clarkmcc/go-evmap/pkg/oplog"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestFrameCodec(t *testing.T) {
+	codec := newFrameCodec[string, int](newOptions(WithValueCodec[int](eventual.JSONCodec[int]{})))
+	v := 1
+	f := frame[string, int]{snapshot: true, generation: 3, ops: []op[string, int]{
+		{key: "foo", value: &v},
+		{key: "bar"},
+		{key: "baz", deleted: true},
+	}}
+	data, err := codec.encode(f)
+	assert.NoError(t, err)
+	decoded, err := codec.read(bufio.NewReader(bytes.NewReader(data)))
+	assert.NoError(t, err)
+	assert.Equal(t, f, decoded)
+
+	// After the length, the snapshot flag and the generation, the operations
+	// are a batch entry that any entry codec of the map decodes
+	e, err := eventual.NewEntryCodec[string, int](eventual.WithValueCodec[int](eventual.JSONCodec[int]{})).Decode(data[3:])
+	assert.NoError(t, err)
+	assert.Equal(t, oplog.EntryBatch, e.Type())
+	assert.Len(t, e.Entries(), 3)
+
+	_, err = codec.read(bufio.NewReader(bytes.NewReader([]byte{2, 0, 0})))
+	assert.ErrorIs(t, err, ErrMalformedFrame)
+}
+
+func TestReplication(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	m := eventual.NewMapFrom(map[string]int{"foo": 1})
+	leader := NewLeader(m)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	served := make(chan error, 1)
+	go func() { served <- leader.Serve(ln) }()
+
+	follower, err := Dial[string, int](ctx, "tcp", ln.Addr().String())
+	assert.NoError(t, err)
+	assert.NoError(t, follower.WaitForGeneration(ctx, 0))
+	reader := follower.Reader()
+	assert.Equal(t, map[string]int{"foo": 1}, reader.Snapshot())
+
+	// Writes are replicated on refresh
+	v := 2
+	assert.NoError(t, m.Insert("bar", &v))
+	assert.True(t, m.Delete("foo"))
+	assert.NoError(t, m.Refresh())
+	assert.NoError(t, follower.WaitForGeneration(ctx, m.Generation()))
+	assert.Equal(t, map[string]int{"bar": 2}, reader.Snapshot())
+	assert.Equal(t, m.Generation(), follower.Generation())
+
+	// Followers that connect later start from the current state
+	late, err := Dial[string, int](ctx, "tcp", ln.Addr().String())
+	assert.NoError(t, err)
+	assert.NoError(t, late.WaitForGeneration(ctx, m.Generation()))
+	assert.Equal(t, map[string]int{"bar": 2}, late.Reader().Snapshot())
+	assert.Equal(t, 2, leader.Followers())
+	assert.NoError(t, late.Close())
+
+	// Closing the map stops the leader, and the follower keeps the last snapshot
+	assert.NoError(t, m.Close())
+	<-follower.Done()
+	assert.ErrorIs(t, follower.Err(), eventual.ErrClosed)
+	assert.ErrorIs(t, <-served, eventual.ErrClosed)
+	assert.Equal(t, map[string]int{"bar": 2}, reader.Snapshot())
+	assert.NoError(t, follower.Close())
+	assert.NoError(t, leader.Close())
+}
+
+func TestLeader_SendBuffer(t *testing.T) {
+	m := eventual.NewMap[string, int]()
+	defer m.Close()
+	leader := NewLeader(m, WithSendBuffer(1))
+	defer leader.Close()
+
+	// The follower end of the pipe is never read, so the leader blocks writing
+	// the snapshot and the queue overflows.
+	conn, _ := net.Pipe()
+	assert.NoError(t, leader.ServeConn(conn))
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, m.Insert("foo", &i))
+		assert.NoError(t, m.Refresh())
+	}
+	assert.Eventually(t, func() bool {
+		return leader.Followers() == 0
+	}, time.Second, time.Millisecond)
+}
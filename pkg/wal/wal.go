@@ -0,0 +1,164 @@
+package wal
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+// headerSize is the size of the header that precedes every record, which
+// contains the length of the record and its CRC-32 checksum.
+const headerSize = 8
+
+// MaxRecordSize is the size of the largest record that can be appended to a
+// log. Replay treats a header with a larger length as corrupt rather than
+// allocating a buffer for it.
+const MaxRecordSize = 256 << 20
+
+var (
+	// ErrCorrupt is returned by Replay when a record other than the last one in
+	// the log fails its checksum, or when a record is longer than MaxRecordSize.
+	ErrCorrupt = errors.New("wal: corrupt record")
+
+	// ErrTooLarge is returned by Append when a record is longer than
+	// MaxRecordSize.
+	ErrTooLarge = errors.New("wal: record too large")
+)
+
+// file is the part of *os.File that a Log uses.
+type file interface {
+	io.ReadWriteSeeker
+	io.Closer
+	Sync() error
+	Truncate(size int64) error
+}
+
+// Log is an append-only log of records stored in a file. Every record is
+// written with a length and a checksum, and the file is synced after every
+// append, so a record is durable once Append returns. A record that was only
+// partially written because of a crash is discarded by Replay. Like the oplog,
+// a Log is not thread-safe.
+type Log struct {
+	f    file
+	size int64
+}
+
+// Open opens the log stored in the file at path, creating it if it doesn't
+// exist. Records should be replayed with Replay before new ones are appended.
+func Open(path string) (*Log, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &Log{f: f}, nil
+}
+
+// Replay calls fn with every record in the log in the order they were appended,
+// stopping at the first error returned by fn. A partially written record at the
+// end of the log is truncated so that new records are appended after the last
+// complete one.
+func (l *Log) Replay(fn func(record []byte) error) error {
+	if _, err := l.f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	r := bufio.NewReader(l.f)
+	var offset int64
+	header := make([]byte, headerSize)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				break
+			}
+			return err
+		}
+		n := binary.LittleEndian.Uint32(header[0:4])
+		if n > MaxRecordSize {
+			return ErrCorrupt
+		}
+		record := make([]byte, n)
+		if _, err := io.ReadFull(r, record); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				break
+			}
+			return err
+		}
+		if crc32.ChecksumIEEE(record) != binary.LittleEndian.Uint32(header[4:8]) {
+			// Only the last record can be torn by a crash
+			if _, err := r.Peek(1); err == io.EOF {
+				break
+			}
+			return ErrCorrupt
+		}
+		if err := fn(record); err != nil {
+			return err
+		}
+		offset += headerSize + int64(len(record))
+	}
+
+	// Drop anything after the last complete record
+	if err := l.f.Truncate(offset); err != nil {
+		return err
+	}
+	l.size = offset
+	_, err := l.f.Seek(offset, io.SeekStart)
+	return err
+}
+
+// Append appends the record to the log and syncs the file. If the record can't
+// be written or synced, whatever was written of it is removed again, so a record
+// whose append failed is never replayed and the next one follows the last
+// record that was appended.
+func (l *Log) Append(record []byte) error {
+	if len(record) > MaxRecordSize {
+		return ErrTooLarge
+	}
+	buf := make([]byte, headerSize+len(record))
+	binary.LittleEndian.PutUint32(buf[0:4], uint32(len(record)))
+	binary.LittleEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(record))
+	copy(buf[headerSize:], record)
+	if _, err := l.f.Write(buf); err != nil {
+		return l.rollback(err)
+	}
+	if err := l.f.Sync(); err != nil {
+		return l.rollback(err)
+	}
+	l.size += int64(len(buf))
+	return nil
+}
+
+// rollback truncates the file back to the end of the last record that was
+// appended, after an append failed with err.
+func (l *Log) rollback(err error) error {
+	if terr := l.f.Truncate(l.size); terr != nil {
+		return errors.Join(err, terr)
+	}
+	if _, serr := l.f.Seek(l.size, io.SeekStart); serr != nil {
+		return errors.Join(err, serr)
+	}
+	return err
+}
+
+// Size returns the size of the log in bytes.
+func (l *Log) Size() int64 {
+	return l.size
+}
+
+// Truncate removes every record from the log.
+func (l *Log) Truncate() error {
+	if err := l.f.Truncate(0); err != nil {
+		return err
+	}
+	l.size = 0
+	if _, err := l.f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return l.f.Sync()
+}
+
+// Close closes the file of the log.
+func (l *Log) Close() error {
+	return l.f.Close()
+}
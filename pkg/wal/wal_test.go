@@ -0,0 +1,154 @@
+package wal
+
+import (
+	"encoding/binary"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// faultyFile is a file whose writes and syncs can be made to fail. A failing
+// write still writes half of the data, like a write that runs out of space.
+type faultyFile struct {
+	*os.File
+	failWrite, failSync bool
+}
+
+var errFault = errors.New("fault")
+
+func (f *faultyFile) Write(p []byte) (int, error) {
+	if f.failWrite {
+		n, _ := f.File.Write(p[:len(p)/2])
+		return n, errFault
+	}
+	return f.File.Write(p)
+}
+
+func (f *faultyFile) Sync() error {
+	if f.failSync {
+		return errFault
+	}
+	return f.File.Sync()
+}
+
+func replayAll(t *testing.T, l *Log) []string {
+	var records []string
+	assert.NoError(t, l.Replay(func(record []byte) error {
+		records = append(records, string(record))
+		return nil
+	}))
+	return records
+}
+
+func TestLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wal")
+	l, err := Open(path)
+	assert.NoError(t, err)
+	assert.Empty(t, replayAll(t, l))
+	assert.NoError(t, l.Append([]byte("foo")))
+	assert.NoError(t, l.Append([]byte("bar")))
+	assert.Equal(t, int64(2*headerSize+6), l.Size())
+	assert.NoError(t, l.Close())
+
+	l, err = Open(path)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"foo", "bar"}, replayAll(t, l))
+	assert.Equal(t, int64(2*headerSize+6), l.Size())
+
+	assert.NoError(t, l.Truncate())
+	assert.NoError(t, l.Append([]byte("baz")))
+	assert.NoError(t, l.Close())
+
+	l, err = Open(path)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"baz"}, replayAll(t, l))
+	assert.NoError(t, l.Close())
+}
+
+func TestLog_tornRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wal")
+	l, err := Open(path)
+	assert.NoError(t, err)
+	assert.NoError(t, l.Append([]byte("foo")))
+	assert.NoError(t, l.Append([]byte("bar")))
+	assert.NoError(t, l.Close())
+
+	// Simulate a crash in the middle of writing the last record
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.NoError(t, os.Truncate(path, info.Size()-1))
+
+	l, err = Open(path)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"foo"}, replayAll(t, l))
+	assert.NoError(t, l.Append([]byte("baz")))
+	assert.NoError(t, l.Close())
+
+	l, err = Open(path)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"foo", "baz"}, replayAll(t, l))
+	assert.NoError(t, l.Close())
+}
+
+func TestLog_corrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wal")
+	l, err := Open(path)
+	assert.NoError(t, err)
+	assert.NoError(t, l.Append([]byte("foo")))
+	assert.NoError(t, l.Append([]byte("bar")))
+	assert.NoError(t, l.Close())
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	data[headerSize] = 'x'
+	assert.NoError(t, os.WriteFile(path, data, 0o644))
+
+	l, err = Open(path)
+	assert.NoError(t, err)
+	assert.ErrorIs(t, l.Replay(func([]byte) error { return nil }), ErrCorrupt)
+	assert.NoError(t, l.Close())
+}
+
+func TestLog_failedAppend(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wal")
+	l, err := Open(path)
+	assert.NoError(t, err)
+	f := &faultyFile{File: l.f.(*os.File)}
+	l.f = f
+	assert.NoError(t, l.Append([]byte("foo")))
+
+	// Neither a torn write nor a write that wasn't synced is left in the log
+	f.failWrite = true
+	assert.ErrorIs(t, l.Append([]byte("bar")), errFault)
+	f.failWrite, f.failSync = false, true
+	assert.ErrorIs(t, l.Append([]byte("baz")), errFault)
+	f.failSync = false
+	assert.Equal(t, int64(headerSize+3), l.Size())
+	assert.NoError(t, l.Append([]byte("qux")))
+	assert.NoError(t, l.Close())
+
+	l, err = Open(path)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"foo", "qux"}, replayAll(t, l))
+	assert.NoError(t, l.Close())
+}
+
+func TestLog_tooLarge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wal")
+	l, err := Open(path)
+	assert.NoError(t, err)
+	assert.ErrorIs(t, l.Append(make([]byte, MaxRecordSize+1)), ErrTooLarge)
+	assert.Equal(t, int64(0), l.Size())
+	assert.NoError(t, l.Close())
+
+	// A length beyond the maximum is rejected without allocating the record
+	header := make([]byte, headerSize)
+	binary.LittleEndian.PutUint32(header[0:4], 1<<32-1)
+	assert.NoError(t, os.WriteFile(path, header, 0o644))
+	l, err = Open(path)
+	assert.NoError(t, err)
+	assert.ErrorIs(t, l.Replay(func([]byte) error { return nil }), ErrCorrupt)
+	assert.NoError(t, l.Close())
+}
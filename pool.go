@@ -0,0 +1,82 @@
+package eventual
+
+import (
+	"sync"
+)
+
+// mapPoolSize is the number of empty maps kept by a map pool, which is enough
+// for a clear of each of the two internal maps.
+const mapPoolSize = 2
+
+// mapPool hands out empty maps to replace the internal maps that are cleared,
+// when the map is created with WithPooledClears. The maps that are replaced are
+// emptied by a background goroutine and then returned to the pool, so a clear
+// costs a pointer swap rather than deleting every key.
+type mapPool[K comparable, V any] struct {
+	mu   sync.Mutex
+	free []map[K]*V
+
+	// The capacity of the maps created when the pool is empty
+	capacity int
+
+	// The maps waiting to be emptied by the background goroutine
+	dirty chan map[K]*V
+}
+
+func newMapPool[K comparable, V any](capacity int) *mapPool[K, V] {
+	return &mapPool[K, V]{
+		capacity: capacity,
+		dirty:    make(chan map[K]*V, mapPoolSize),
+	}
+}
+
+// empty replaces the map with an empty map from the pool. It's used as the
+// clear function of the oplog, so it's only called while holding the write lock
+// on the writable map, which no reader can be looking at.
+func (p *mapPool[K, V]) empty(m *map[K]*V) {
+	old := *m
+	*m = p.get()
+
+	// Maps that can't be emptied right away are left to the garbage collector
+	select {
+	case p.dirty <- old:
+	default:
+	}
+}
+
+// get returns an empty map from the pool, or a new one if the pool is empty.
+func (p *mapPool[K, V]) get() map[K]*V {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if n := len(p.free); n > 0 {
+		m := p.free[n-1]
+		p.free[n-1] = nil
+		p.free = p.free[:n-1]
+		return m
+	}
+	return make(map[K]*V, p.capacity)
+}
+
+// put returns an empty map to the pool, unless the pool is full.
+func (p *mapPool[K, V]) put(m map[K]*V) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.free) < mapPoolSize {
+		p.free = append(p.free, m)
+	}
+}
+
+// recycleMaps empties the maps that were replaced by clears and returns them to
+// the pool until the map is closed.
+func (m *Map[K, V]) recycleMaps() {
+	defer m.background.Done()
+	for {
+		select {
+		case <-m.done:
+			return
+		case cleared := <-m.pool.dirty:
+			clear(cleared)
+			m.pool.put(cleared)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package eventual
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestMap_PooledClears(t *testing.T) {
+	m := NewMap[int, int](WithPooledClears(), WithInitialCapacity(16))
+	defer m.Close()
+	r := m.Reader()
+
+	for round := 0; round < 3; round++ {
+		for i := 0; i < 100; i++ {
+			assert.NoError(t, m.Insert(i, &i))
+		}
+		assert.NoError(t, m.Refresh())
+		assert.Equal(t, 100, len(r.Snapshot()))
+
+		v := -1
+		assert.NoError(t, m.Clear())
+		assert.NoError(t, m.Insert(0, &v))
+		assert.Equal(t, 1, m.Len())
+		assert.Equal(t, 100, len(r.Snapshot()))
+		assert.NoError(t, m.Refresh())
+		assert.Equal(t, map[int]int{0: -1}, r.Snapshot())
+		assert.NoError(t, m.Replace(map[int]*int{1: &v}))
+		assert.NoError(t, m.Refresh())
+		assert.Equal(t, map[int]int{1: -1}, r.Snapshot())
+		assert.Equal(t, map[int]int{1: -1}, m.Snapshot())
+	}
+
+	// The cleared maps are emptied and returned to the pool
+	assert.Eventually(t, func() bool {
+		m.pool.mu.Lock()
+		defer m.pool.mu.Unlock()
+		if len(m.pool.free) == 0 {
+			return false
+		}
+		for _, free := range m.pool.free {
+			if len(free) != 0 {
+				return false
+			}
+		}
+		return true
+	}, time.Second, time.Millisecond)
+}
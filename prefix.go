@@ -0,0 +1,181 @@
+package eventual
+
+import (
+	"github.com/clarkmcc/go-evmap/pkg/oplog"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// PrefixMap is a string-keyed map whose readers can efficiently look up every
+// key under a prefix, which is useful for namespace-style lookups such as
+// hierarchical configuration keys.
+//
+// Under the hood the values are stored in a regular Map, so a PrefixMap shares
+// the refresh semantics of a Map. The writer additionally maintains a sorted
+// index of the keys which is published alongside every refresh, so prefix
+// lookups are a binary search against the same snapshot that the values are
+// read from. Publishing the index copies it when keys were added or removed
+// since the previous refresh.
+type PrefixMap[V any] struct {
+	m *Map[string, V]
+
+	// The sorted keys of the writable map and the copy of them that was most
+	// recently published, both protected by the map's write lock.
+	keys      []string
+	published []string
+	dirty     bool
+}
+
+// Insert inserts the value into the map under the provided key.
+func (m *PrefixMap[V]) Insert(key string, value *V) error {
+	m.m.lockForWrite()
+	defer m.m.writeLock.Unlock()
+	if m.m.closed {
+		return ErrClosed
+	}
+	if err := m.m.pushLocked(oplog.Insert(key, m.m.stored(value))); err != nil {
+		return err
+	}
+	if i, ok := slices.BinarySearch(m.keys, key); !ok {
+		m.keys = slices.Insert(m.keys, i, key)
+		m.dirty = true
+	}
+	m.m.metrics.Inserted(1)
+	m.m.writtenLocked()
+	return nil
+}
+
+// Delete attempts to delete the key from the map and returns a boolean representing
+// whether the key existed.
+func (m *PrefixMap[V]) Delete(key string) bool {
+	m.m.lockForWrite()
+	defer m.m.writeLock.Unlock()
+	if m.m.closed {
+		return false
+	}
+
+	i, ok := slices.BinarySearch(m.keys, key)
+	if !ok || m.m.pushLocked(oplog.Delete[string, *V](key)) != nil {
+		return false
+	}
+	m.keys = slices.Delete(m.keys, i, i+1)
+	m.dirty = true
+	m.m.metrics.Deleted(1)
+	m.m.writtenLocked()
+	return true
+}
+
+// Clear removes all the keys from the map.
+func (m *PrefixMap[V]) Clear() error {
+	m.m.lockForWrite()
+	defer m.m.writeLock.Unlock()
+	if m.m.closed {
+		return ErrClosed
+	}
+	if err := m.m.pushLocked(oplog.Clear[string, *V]()); err != nil {
+		return err
+	}
+	m.keys = nil
+	m.dirty = true
+	m.m.metrics.Cleared()
+	m.m.writtenLocked()
+	return nil
+}
+
+// Get returns the value stored under the key, including writes that have not
+// been exposed to the readers yet.
+func (m *PrefixMap[V]) Get(key string) (*V, bool) {
+	return m.m.Get(key)
+}
+
+// Len returns the number of keys in the map, including writes that have not
+// been exposed to the readers yet.
+func (m *PrefixMap[V]) Len() int {
+	return m.m.Len()
+}
+
+// Refresh exposes the current state of the map to the readers.
+func (m *PrefixMap[V]) Refresh() error {
+	return m.m.Refresh()
+}
+
+// Close tears down the map, closing every reader created from it.
+func (m *PrefixMap[V]) Close() error {
+	m.m.writeLock.Lock()
+	m.keys, m.published = nil, nil
+	m.m.writeLock.Unlock()
+	return m.m.Close()
+}
+
+// Reader creates and registers a new reader for the map.
+func (m *PrefixMap[V]) Reader() *PrefixReader[V] {
+	return &PrefixReader[V]{r: m.m.Reader()}
+}
+
+// index publishes the sorted keys. It's called by every refresh while holding
+// the write lock.
+func (m *PrefixMap[V]) index() any {
+	if m.dirty {
+		m.published = slices.Clone(m.keys)
+		m.dirty = false
+	}
+	return m.published
+}
+
+// PrefixReader reads from a PrefixMap.
+type PrefixReader[V any] struct {
+	r *Reader[string, V]
+}
+
+func (r *PrefixReader[V]) Get(key string) (*V, bool) {
+	return r.r.Get(key)
+}
+
+func (r *PrefixReader[V]) Has(key string) bool {
+	return r.r.Has(key)
+}
+
+// Prefix returns the keys visible to this reader that start with the prefix,
+// in sorted order.
+func (r *PrefixReader[V]) Prefix(prefix string) []string {
+	var keys []string
+	r.ForEachPrefix(prefix, func(key string, _ *V) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys
+}
+
+// ForEachPrefix calls fn in sorted key order for every key visible to this
+// reader that starts with the prefix, stopping early if fn returns false. Like
+// Reader.ForEach, the iteration is performed against a single snapshot.
+func (r *PrefixReader[V]) ForEachPrefix(prefix string, fn func(key string, value *V) bool) {
+	s := r.r.enter()
+	defer r.r.exit(s)
+
+	keys, _ := s.index.([]string)
+	for i := sort.SearchStrings(keys, prefix); i < len(keys) && strings.HasPrefix(keys[i], prefix); i++ {
+		if !fn(keys[i], (*s.m)[keys[i]]) {
+			return
+		}
+	}
+}
+
+// Close removes the reader from the map.
+func (r *PrefixReader[V]) Close() error {
+	return r.r.Close()
+}
+
+// NewPrefixMap creates a new PrefixMap with the provided options.
+func NewPrefixMap[V any](opts ...OptionFunc) *PrefixMap[V] {
+	options := newOptions(opts...)
+
+	// Evictions would bypass the sorted index, so they aren't supported
+	options.MaxEntries = 0
+	r := make(map[string]*V, options.InitialCapacity)
+	w := make(map[string]*V, options.InitialCapacity)
+	m := &PrefixMap[V]{m: newMap(r, w, options)}
+	m.m.index = m.index
+	return m
+}
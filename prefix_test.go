@@ -0,0 +1,69 @@
+package eventual
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestPrefixMap(t *testing.T) {
+	m := NewPrefixMap[int]()
+	reader := m.Reader()
+	assert.Empty(t, reader.Prefix(""))
+
+	for i, key := range []string{"app/db/host", "app/db/port", "app/name", "apple", "b"} {
+		v := i
+		assert.NoError(t, m.Insert(key, &v))
+	}
+	assert.Equal(t, 5, m.Len())
+	assert.Empty(t, reader.Prefix("app/"))
+
+	assert.NoError(t, m.Refresh())
+	assert.Equal(t, []string{"app/db/host", "app/db/port", "app/name"}, reader.Prefix("app/"))
+	assert.Equal(t, []string{"app/db/host", "app/db/port"}, reader.Prefix("app/db/"))
+	assert.Equal(t, []string{"app/db/host", "app/db/port", "app/name", "apple"}, reader.Prefix("app"))
+	assert.Len(t, reader.Prefix(""), 5)
+	assert.Empty(t, reader.Prefix("c"))
+
+	values := map[string]int{}
+	reader.ForEachPrefix("app/db/", func(key string, value *int) bool {
+		values[key] = *value
+		return true
+	})
+	assert.Equal(t, map[string]int{"app/db/host": 0, "app/db/port": 1}, values)
+
+	// Stops early
+	n := 0
+	reader.ForEachPrefix("app", func(string, *int) bool {
+		n++
+		return false
+	})
+	assert.Equal(t, 1, n)
+
+	// Overwriting a key doesn't duplicate it in the index
+	v := 10
+	assert.NoError(t, m.Insert("app/name", &v))
+	assert.True(t, m.Delete("app/db/host"))
+	assert.False(t, m.Delete("app/db/host"))
+	assert.NoError(t, m.Refresh())
+	assert.Equal(t, []string{"app/db/port", "app/name"}, reader.Prefix("app/"))
+	got, ok := reader.Get("app/name")
+	assert.True(t, ok)
+	assert.Equal(t, 10, *got)
+
+	assert.NoError(t, m.Clear())
+	assert.NoError(t, m.Refresh())
+	assert.Empty(t, reader.Prefix(""))
+
+	assert.NoError(t, m.Close())
+	assert.ErrorIs(t, m.Insert("foo", &v), ErrClosed)
+}
+
+func TestPrefixMap_autoRefresh(t *testing.T) {
+	m := NewPrefixMap[int](WithMaxReplicationWriteLag(2))
+	reader := m.Reader()
+
+	v := 1
+	assert.NoError(t, m.Insert("a/1", &v))
+	assert.NoError(t, m.Insert("a/2", &v))
+	assert.Equal(t, []string{"a/1", "a/2"}, reader.Prefix("a/"))
+}
@@ -0,0 +1,27 @@
+package eventual
+
+import (
+	"context"
+	"runtime/pprof"
+)
+
+// The profiler labels that are attached to the work done by the map when it's
+// created with WithProfilerLabels. Every label uses the "evmap" key so that the
+// work can be filtered by task, for example with pprof's -tagfocus=evmap=refresh.
+var (
+	refreshLabels     = pprof.Labels("evmap", "refresh")
+	autoRefreshLabels = pprof.Labels("evmap", "auto-refresh")
+	writeBehindLabels = pprof.Labels("evmap", "write-behind")
+	checkpointLabels  = pprof.Labels("evmap", "checkpoint")
+	ttlSweepLabels    = pprof.Labels("evmap", "ttl-sweep")
+)
+
+// labeled calls fn with the labels added to the labels in ctx if the map was
+// created with WithProfilerLabels, and calls fn with ctx otherwise.
+func (m *Map[K, V]) labeled(ctx context.Context, labels pprof.LabelSet, fn func(ctx context.Context)) {
+	if !m.options.ProfilerLabels {
+		fn(ctx)
+		return
+	}
+	pprof.Do(ctx, labels, fn)
+}
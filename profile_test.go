@@ -0,0 +1,67 @@
+package eventual
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"runtime/pprof"
+	"sync"
+	"testing"
+	"time"
+)
+
+// labelTracer records the profiler labels of the context of every span.
+type labelTracer struct {
+	mu     sync.Mutex
+	labels []map[string]string
+}
+
+func (t *labelTracer) Start(ctx context.Context, operation string) (context.Context, Span) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	labels := map[string]string{}
+	pprof.ForLabels(ctx, func(key, value string) bool {
+		labels[key] = value
+		return true
+	})
+	t.labels = append(t.labels, labels)
+	return ctx, nopSpan{}
+}
+
+func (t *labelTracer) last() map[string]string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.labels) == 0 {
+		return nil
+	}
+	return t.labels[len(t.labels)-1]
+}
+
+func TestWithProfilerLabels(t *testing.T) {
+	tracer := &labelTracer{}
+	m := NewMap[string, int](WithProfilerLabels(), WithTracer(tracer))
+	assert.NoError(t, m.Refresh())
+	assert.Equal(t, map[string]string{"evmap": "refresh"}, tracer.last())
+
+	// The labels are added to the labels of the caller's context
+	pprof.Do(context.Background(), pprof.Labels("request", "foo"), func(ctx context.Context) {
+		assert.NoError(t, m.RefreshAndWait(ctx))
+	})
+	assert.Equal(t, map[string]string{"evmap": "refresh", "request": "foo"}, tracer.last())
+	assert.NoError(t, m.Close())
+
+	// Without the option nothing is labeled
+	m = NewMap[string, int](WithTracer(tracer))
+	assert.NoError(t, m.Refresh())
+	assert.Equal(t, map[string]string{}, tracer.last())
+	assert.NoError(t, m.Close())
+}
+
+func TestWithProfilerLabels_AutoRefresh(t *testing.T) {
+	tracer := &labelTracer{}
+	m := NewMap[string, int](WithProfilerLabels(), WithTracer(tracer), WithAutoRefreshInterval(time.Millisecond))
+	v := 1
+	assert.NoError(t, m.Insert("foo", &v))
+	assert.Eventually(t, func() bool { return tracer.last() != nil }, time.Second, time.Millisecond)
+	assert.Equal(t, map[string]string{"evmap": "refresh"}, tracer.last())
+	assert.NoError(t, m.Close())
+}
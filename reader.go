@@ -1,64 +1,442 @@
 package eventual
 
 import (
-	"sync"
-	"unsafe"
+	"context"
+	"iter"
+	"runtime"
+	"sync/atomic"
 )
 
+// sidePrivate is the side of a snapshot that is private to a single reader,
+// such as the copy made by Freeze. Refresh never modifies a private snapshot
+// so it never waits for the pins on this side.
+const sidePrivate = 2
+
 type Reader[K comparable, V any] struct {
-	closed bool
-	m      *Map[K, V]
-	lock   sync.Mutex
+	*readerState[K, V]
 
-	readable unsafe.Pointer
+	// Closes the reader if it's garbage collected without being closed
+	cleanup runtime.Cleanup
 }
 
-func (r *Reader[K, V]) Get(key K) (*V, bool) {
-	r.lock.Lock()
-	defer r.lock.Unlock()
+// readerState is the state of a reader that the map tracks in its list of
+// readers. It's separate from the Reader so that a reader that is abandoned
+// without being closed can still be garbage collected, at which point its
+// state is closed and unlinked from the list like a closed reader's.
+type readerState[K comparable, V any] struct {
+	pinState[map[K]*V]
+	m *Map[K, V]
+
+	// The ID of the reader, which is unique within its map
+	id uint64
+
+	// frozen indicates that Refresh should not swap this reader's snapshot, and
+	// detached indicates that the reader was closed by a refresh that gave up
+	// waiting for it, which no longer waits on its pins. Both are protected by
+	// the map's readers lock.
+	frozen   bool
+	detached bool
+
+	// The next reader in the map's list of readers
+	next atomic.Pointer[readerState[K, V]]
+
+	// The map's ReadMetricsCollector, copied so that lookups don't have to load
+	// it from the map, or nil if it doesn't have one
+	reads ReadMetricsCollector
+}
 
-	if r.closed {
-		panic("reader closed")
+// snapshot is a readable map of a Map as it was published by a single call to
+// Refresh.
+type snapshot[K comparable, V any] = snapshotOf[map[K]*V]
+
+// newSnapshot creates a snapshot of the provided readable map.
+func newSnapshot[K comparable, V any](m *map[K]*V, side uint8, generation uint64, meta any) *snapshot[K, V] {
+	return &snapshot[K, V]{
+		m:          m,
+		side:       side,
+		generation: generation,
+		replaced:   make(chan struct{}),
+		meta:       meta,
 	}
-	v, ok := (*((*map[K]*V)(r.readable)))[key]
+}
+
+func (r *Reader[K, V]) Get(key K) (*V, bool) {
+	s := r.enter()
+	defer r.exit(s)
+	m := s.m
+	v, ok := (*m)[key]
+	r.read(ok)
 	return v, ok
 }
 
 func (r *Reader[K, V]) Has(key K) bool {
-	r.lock.Lock()
-	defer r.lock.Unlock()
+	s := r.enter()
+	defer r.exit(s)
+	m := s.m
+	_, ok := (*m)[key]
+	r.read(ok)
+	return ok
+}
 
-	if r.closed {
-		panic("reader closed")
+// GetErr is like Get but returns ErrReaderClosed rather than panicking if the
+// reader has been closed.
+func (r *Reader[K, V]) GetErr(key K) (*V, bool, error) {
+	s, err := r.tryEnter()
+	if err != nil {
+		return nil, false, err
 	}
-	_, ok := (*((*map[K]*V)(r.readable)))[key]
-	return ok
+	defer r.exit(s)
+	v, ok := (*s.m)[key]
+	r.read(ok)
+	return v, ok, nil
+}
+
+// HasErr is like Has but returns ErrReaderClosed rather than panicking if the
+// reader has been closed.
+func (r *Reader[K, V]) HasErr(key K) (bool, error) {
+	s, err := r.tryEnter()
+	if err != nil {
+		return false, err
+	}
+	defer r.exit(s)
+	_, ok := (*s.m)[key]
+	r.read(ok)
+	return ok, nil
+}
+
+// read reports a lookup to the map's ReadMetricsCollector, if it has one.
+func (r *Reader[K, V]) read(hit bool) {
+	if r.reads != nil {
+		r.reads.Read(hit)
+	}
+}
+
+// Keys returns the keys that are visible to this reader as of the last refresh.
+// The order of the keys is unspecified.
+func (r *Reader[K, V]) Keys() []K {
+	s := r.enter()
+	defer r.exit(s)
+	m := s.m
+	keys := make([]K, 0, len(*m))
+	for k := range *m {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// Values returns the values that are visible to this reader as of the last
+// refresh. The order of the values is unspecified.
+func (r *Reader[K, V]) Values() []*V {
+	s := r.enter()
+	defer r.exit(s)
+	m := s.m
+	values := make([]*V, 0, len(*m))
+	for _, v := range *m {
+		values = append(values, v)
+	}
+	return values
+}
+
+// ValuesCopy is like Values but returns copies of the values rather than the
+// pointers stored in the map. A nil value is returned as the zero value of V.
+func (r *Reader[K, V]) ValuesCopy() []V {
+	s := r.enter()
+	defer r.exit(s)
+	m := s.m
+	values := make([]V, 0, len(*m))
+	for _, v := range *m {
+		var c V
+		if v != nil {
+			c = *v
+		}
+		values = append(values, c)
+	}
+	return values
+}
+
+// Snapshot returns a copy of the map visible to this reader as a plain Go map.
+// The values are copied out of their pointers and nil values are returned as
+// the zero value of V.
+func (r *Reader[K, V]) Snapshot() map[K]V {
+	s := r.enter()
+	defer r.exit(s)
+	return copyValues(*s.m)
 }
 
-// Close removes the reader from the map. The caller will not be able
-// to use the reader anymore. Reading after close will result in a panic
-func (r *Reader[K, V]) Close() {
+// ForEach calls fn for every key and value visible to this reader, stopping
+// early if fn returns false. The entire iteration is performed against a single
+// readable map, so it observes one consistent generation of the map even if
+// Refresh is called concurrently. Because Refresh waits for in-flight reads to
+// finish, fn should not block for long periods of time.
+func (r *Reader[K, V]) ForEach(fn func(key K, value *V) bool) {
+	s := r.enter()
+	defer r.exit(s)
+	m := s.m
+	for k, v := range *m {
+		if !fn(k, v) {
+			return
+		}
+	}
+}
+
+// All returns an iterator over the keys and values visible to this reader. Like
+// ForEach, the iteration is performed against a single readable map and the
+// loop body should not block for long periods of time.
+func (r *Reader[K, V]) All() iter.Seq2[K, *V] {
+	return func(yield func(K, *V) bool) {
+		r.ForEach(yield)
+	}
+}
+
+// KeysSeq returns an iterator over the keys visible to this reader.
+func (r *Reader[K, V]) KeysSeq() iter.Seq[K] {
+	return func(yield func(K) bool) {
+		r.ForEach(func(key K, _ *V) bool {
+			return yield(key)
+		})
+	}
+}
+
+// ValuesSeq returns an iterator over the values visible to this reader.
+func (r *Reader[K, V]) ValuesSeq() iter.Seq[*V] {
+	return func(yield func(*V) bool) {
+		r.ForEach(func(_ K, value *V) bool {
+			return yield(value)
+		})
+	}
+}
+
+// GetMany looks up every key against a single readable map and returns the
+// keys that were found along with their values. Keys that are not visible to
+// this reader are omitted from the result.
+func (r *Reader[K, V]) GetMany(keys []K) map[K]*V {
+	s := r.enter()
+	defer r.exit(s)
+	m := s.m
+	values := make(map[K]*V, len(keys))
+	for _, k := range keys {
+		v, ok := (*m)[k]
+		if ok {
+			values[k] = v
+		}
+		r.read(ok)
+	}
+	return values
+}
+
+// With calls fn with the raw readable map while the snapshot is pinned. The map
+// must not be modified or retained after fn returns, and like ForEach, fn should
+// not block for long periods of time.
+func (r *Reader[K, V]) With(fn func(m map[K]*V)) {
+	s := r.enter()
+	defer r.exit(s)
+	fn(*s.m)
+}
+
+// Generation returns the generation of the map that the reader is currently
+// viewing. The generation starts at zero and is incremented on every refresh,
+// so it can be used to detect staleness and to correlate reads with specific
+// publishes.
+func (r *Reader[K, V]) Generation() uint64 {
+	return (*snapshot[K, V])(atomic.LoadPointer(&r.snapshot)).generation
+}
+
+// Meta returns the meta value that was published along with the snapshot that
+// the reader is currently viewing, or nil if no meta value has been set. Use
+// Guard to read the meta value and the data from the same snapshot.
+func (r *Reader[K, V]) Meta() any {
+	return (*snapshot[K, V])(atomic.LoadPointer(&r.snapshot)).meta
+}
+
+// WaitForGeneration blocks until the reader observes a refresh at or beyond the
+// provided generation, or until the context is done in which case the context's
+// error is returned. If the reader or the map is closed while waiting,
+// ErrReaderClosed is returned.
+func (r *Reader[K, V]) WaitForGeneration(ctx context.Context, gen uint64) error {
+	for {
+		if atomic.LoadUint32(&r.closed) != 0 {
+			return ErrReaderClosed
+		}
+		s := (*snapshot[K, V])(atomic.LoadPointer(&r.snapshot))
+		if s.generation >= gen {
+			return nil
+		}
+		select {
+		case <-s.replaced:
+		case <-r.m.done:
+			return ErrReaderClosed
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// GetWait returns the value of the key, blocking until the key is visible to the
+// reader if it isn't yet. This is useful for consumers that may race ahead of
+// the writer populating the map. If the context is done first, the context's
+// error is returned, and if the reader or the map is closed while waiting,
+// ErrReaderClosed is returned.
+func (r *Reader[K, V]) GetWait(ctx context.Context, key K) (*V, error) {
+	for {
+		s, err := r.tryEnter()
+		if err != nil {
+			return nil, err
+		}
+		v, ok := (*s.m)[key]
+		r.exit(s)
+		if ok {
+			return v, nil
+		}
+		select {
+		case <-s.replaced:
+		case <-r.m.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// ID returns an identifier of the reader that is unique within its map, which
+// identifies the reader in a StuckReadersError.
+func (r *Reader[K, V]) ID() uint64 {
+	return r.id
+}
+
+// Clone registers and returns a new reader for the same map that this reader
+// is reading from. The new reader is independent of this reader and must be
+// closed separately.
+func (r *Reader[K, V]) Clone() *Reader[K, V] {
+	return r.m.Reader()
+}
+
+// Freeze stops the reader from observing refreshes until Unfreeze is called.
+// This is useful for pinning a single generation of the map for a long period
+// of time, for example while serving a long request, without blocking Refresh.
+// Freezing copies the currently visible map, so it's expensive for large maps.
+// Calling Freeze on a frozen reader has no effect.
+func (r *Reader[K, V]) Freeze() {
 	r.m.readersLock.Lock()
 	defer r.m.readersLock.Unlock()
-	for idx, reader := range r.m.readers {
-		if unsafe.Pointer(reader) == unsafe.Pointer(r) {
-			remove[*Reader[K, V]](r.m.readers, idx)
-			break
-		}
+	if r.frozen {
+		return
 	}
+	r.frozen = true
+
+	// Holding the readers lock guarantees that no refresh is in progress, so
+	// the readable map is safe to copy without pinning it.
+	current := (*snapshot[K, V])(atomic.LoadPointer(&r.snapshot))
+	m := make(map[K]*V, len(*current.m))
+	for k, v := range *current.m {
+		m[k] = v
+	}
+	frozen := newSnapshot(&m, sidePrivate, current.generation, current.meta)
+	frozen.index = current.index
+	r.swapSnapshot(frozen)
 }
 
-func (r *Reader[K, V]) swapReadable(m *map[K]*V) {
-	r.lock.Lock()
-	defer r.lock.Unlock()
-	r.readable = unsafe.Pointer(m)
+// Unfreeze makes the reader observe the latest refresh of the map and resumes
+// observing future refreshes. Calling Unfreeze on a reader that is not frozen
+// has no effect.
+func (r *Reader[K, V]) Unfreeze() {
+	r.m.readersLock.Lock()
+	defer r.m.readersLock.Unlock()
+	if !r.frozen {
+		return
+	}
+	r.frozen = false
+	old := (*snapshot[K, V])(atomic.LoadPointer(&r.snapshot))
+	r.swapSnapshot(r.m.snapshot)
+	close(old.replaced)
+}
+
+// View returns a read-only view of this reader that can be handed to code that
+// shouldn't be able to close the reader or access the underlying map.
+func (r *Reader[K, V]) View() *View[K, V] {
+	return &View[K, V]{r: r}
+}
+
+// Guard pins the snapshot that the reader is currently looking at until
+// Release is called on the returned guard.
+func (r *Reader[K, V]) Guard() *ReadGuard[K, V] {
+	return &ReadGuard[K, V]{r: r, s: r.enter()}
+}
+
+// GuardErr is like Guard but returns ErrReaderClosed rather than panicking if
+// the reader has been closed.
+func (r *Reader[K, V]) GuardErr() (*ReadGuard[K, V], error) {
+	s, err := r.tryEnter()
+	if err != nil {
+		return nil, err
+	}
+	return &ReadGuard[K, V]{r: r, s: s}, nil
+}
+
+// enter pins the snapshot that the reader is currently looking at and returns
+// it. The snapshot is guaranteed not to be modified until it is unpinned
+// by passing it to exit.
+func (r *Reader[K, V]) enter() *snapshot[K, V] {
+	s, err := r.tryEnter()
+	if err != nil {
+		panic(err)
+	}
+	return s
 }
 
+// Close removes the reader from the map so that the map no longer tracks it
+// during refreshes. The caller will not be able to use the reader anymore and
+// reading after close will result in a panic, or ErrReaderClosed for the
+// methods that return an error. Close is safe to call multiple
+// times and always returns nil, it returns an error so that the reader
+// satisfies io.Closer.
+//
+// A reader that is garbage collected without being closed is closed
+// automatically, but until the garbage collector gets to it, the map keeps
+// tracking it during refreshes.
+func (r *Reader[K, V]) Close() error {
+	r.cleanup.Stop()
+	r.close()
+	return nil
+}
+
+// close marks the reader as closed, unless it already is. The next refresh
+// unlinks it from the map's list of readers.
+func (r *readerState[K, V]) close() {
+	if atomic.CompareAndSwapUint32(&r.closed, 0, 1) {
+		r.m.stats.closed.Add(1)
+		r.m.metrics.Readers(int(r.m.readerCount.Add(-1)))
+		r.m.closedReader()
+	}
+}
+
+// abandon closes the state of a reader that was garbage collected without
+// being closed. Nothing can be reading through an unreachable reader, so any
+// pins that are left were leaked, for example by a guard that was never
+// released, and they're dropped so that they don't block refreshes forever.
+func (r *readerState[K, V]) abandon() {
+	for side := range r.pins {
+		atomic.StoreInt64(&r.pins[side], 0)
+	}
+	r.close()
+}
+
+// NewReader creates and registers a new reader for the map, the same as
+// m.Reader.
 func NewReader[K comparable, V any](m *Map[K, V]) *Reader[K, V] {
-	return &Reader[K, V]{m: m, readable: unsafe.Pointer(m.readable)}
+	return m.Reader()
 }
 
 func remove[V any](s []V, i int) []V {
 	s[i] = s[len(s)-1]
 	return s[:len(s)-1]
 }
+
+// ReadHandleFactory creates readers for a map without exposing any write
+// access to it. A ReadHandleFactory is safe to share between goroutines.
+type ReadHandleFactory[K comparable, V any] struct {
+	m *Map[K, V]
+}
+
+// Handle creates and registers a new reader for the underlying map.
+func (f *ReadHandleFactory[K, V]) Handle() *Reader[K, V] {
+	return f.m.Reader()
+}
@@ -0,0 +1,523 @@
+package eventual
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"runtime"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReader_Close(t *testing.T) {
+	m := NewMap[string, any]()
+	r1 := m.Reader()
+	r2 := m.Reader()
+	assert.Len(t, m.openReaders(), 2)
+
+	assert.NoError(t, r1.Close())
+	assert.Len(t, m.openReaders(), 1, "closing should deregister the reader")
+	assert.Equal(t, r2.readerState, m.openReaders()[0])
+
+	// Closing a second time is a no-op
+	assert.NoError(t, r1.Close())
+	assert.Len(t, m.openReaders(), 1)
+
+	// The next refresh unlinks the closed reader
+	m.Refresh()
+	assert.Equal(t, []*readerState[string, any]{r2.readerState}, slices.Collect(m.readers.all()))
+
+	assert.Panics(t, func() { r1.Get("foo") })
+
+	// Refreshes should keep working for the remaining readers
+	m.Insert("foo", nil)
+	m.Refresh()
+	assert.True(t, r2.Has("foo"))
+}
+
+func TestNewReader(t *testing.T) {
+	m := NewMap[string, any]()
+	r := NewReader(m)
+	assert.Equal(t, []*readerState[string, any]{r.readerState}, m.openReaders())
+
+	// The reader is swapped by refreshes like any other
+	m.Insert("foo", nil)
+	m.Refresh()
+	assert.True(t, r.Has("foo"))
+	assert.NoError(t, r.Close())
+	assert.Equal(t, 0, m.Stats().Readers)
+}
+
+func TestReader_Keys(t *testing.T) {
+	m := NewMap[string, any]()
+	reader := m.Reader()
+	assert.Empty(t, reader.Keys())
+
+	m.Insert("foo", nil)
+	m.Insert("bar", nil)
+	assert.Empty(t, reader.Keys(), "reader shouldn't see the keys before refresh")
+
+	m.Refresh()
+	assert.ElementsMatch(t, []string{"foo", "bar"}, reader.Keys())
+}
+
+func TestReader_Values(t *testing.T) {
+	m := NewMap[string, int]()
+	reader := m.Reader()
+	assert.Empty(t, reader.Values())
+
+	v1, v2 := 1, 2
+	m.Insert("foo", &v1)
+	m.Insert("bar", &v2)
+	m.Insert("baz", nil)
+	assert.Empty(t, reader.Values(), "reader shouldn't see the values before refresh")
+
+	m.Refresh()
+	assert.ElementsMatch(t, []*int{&v1, &v2, nil}, reader.Values())
+	assert.ElementsMatch(t, []int{1, 2, 0}, reader.ValuesCopy())
+}
+
+func TestReader_ForEach(t *testing.T) {
+	m := NewMap[string, any]()
+	reader := m.Reader()
+	m.Insert("foo", nil)
+	m.Insert("bar", nil)
+	m.Refresh()
+
+	t.Run("all", func(t *testing.T) {
+		var keys []string
+		reader.ForEach(func(key string, value *any) bool {
+			keys = append(keys, key)
+			return true
+		})
+		assert.ElementsMatch(t, []string{"foo", "bar"}, keys)
+	})
+	t.Run("stop early", func(t *testing.T) {
+		calls := 0
+		reader.ForEach(func(key string, value *any) bool {
+			calls++
+			return false
+		})
+		assert.Equal(t, 1, calls)
+	})
+	t.Run("consistent snapshot", func(t *testing.T) {
+		done := make(chan struct{})
+		reader.ForEach(func(key string, value *any) bool {
+			// Start a refresh that removes every key while we're iterating, the
+			// refresh must wait for the iteration to finish.
+			go func() {
+				m.Clear()
+				m.Refresh()
+				close(done)
+			}()
+			time.Sleep(10 * time.Millisecond)
+			select {
+			case <-done:
+				t.Error("refresh shouldn't complete while iterating")
+			default:
+			}
+			return false
+		})
+		<-done
+		assert.Empty(t, reader.Keys())
+	})
+}
+
+func TestReader_All(t *testing.T) {
+	m := NewMap[string, int]()
+	reader := m.Reader()
+	v1, v2 := 1, 2
+	m.Insert("foo", &v1)
+	m.Insert("bar", &v2)
+	m.Refresh()
+
+	got := map[string]*int{}
+	for k, v := range reader.All() {
+		got[k] = v
+	}
+	assert.Equal(t, map[string]*int{"foo": &v1, "bar": &v2}, got)
+
+	var keys []string
+	for k := range reader.KeysSeq() {
+		keys = append(keys, k)
+	}
+	assert.ElementsMatch(t, []string{"foo", "bar"}, keys)
+
+	var values []*int
+	for v := range reader.ValuesSeq() {
+		values = append(values, v)
+		break
+	}
+	assert.Len(t, values, 1, "breaking out of the loop should stop the iteration")
+}
+
+func TestReader_GetMany(t *testing.T) {
+	m := NewMap[string, int]()
+	reader := m.Reader()
+	v1, v2 := 1, 2
+	m.Insert("foo", &v1)
+	m.Insert("bar", &v2)
+	m.Refresh()
+
+	got := reader.GetMany([]string{"foo", "baz"})
+	assert.Equal(t, map[string]*int{"foo": &v1}, got)
+	assert.Empty(t, reader.GetMany(nil))
+}
+
+func TestReader_With(t *testing.T) {
+	m := NewMap[string, any]()
+	reader := m.Reader()
+	m.Insert("foo", nil)
+	m.Refresh()
+
+	called := false
+	reader.With(func(m map[string]*any) {
+		called = true
+		assert.Len(t, m, 1)
+		assert.Contains(t, m, "foo")
+	})
+	assert.True(t, called)
+}
+
+func TestReader_Generation(t *testing.T) {
+	m := NewMap[string, any]()
+	reader := m.Reader()
+	assert.Equal(t, uint64(0), reader.Generation())
+
+	m.Refresh()
+	m.Refresh()
+	assert.Equal(t, uint64(2), reader.Generation())
+
+	// New readers start at the current generation
+	assert.Equal(t, uint64(2), m.Reader().Generation())
+}
+
+func TestReader_WaitForGeneration(t *testing.T) {
+	m := NewMap[string, any]()
+	reader := m.Reader()
+
+	t.Run("already reached", func(t *testing.T) {
+		assert.NoError(t, reader.WaitForGeneration(context.Background(), 0))
+	})
+	t.Run("refresh", func(t *testing.T) {
+		go func() {
+			m.Refresh()
+			m.Refresh()
+		}()
+		assert.NoError(t, reader.WaitForGeneration(context.Background(), 2))
+		assert.GreaterOrEqual(t, reader.Generation(), uint64(2))
+	})
+	t.Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		assert.ErrorIs(t, reader.WaitForGeneration(ctx, 100), context.DeadlineExceeded)
+	})
+	t.Run("closed", func(t *testing.T) {
+		go m.Close()
+		assert.ErrorIs(t, reader.WaitForGeneration(context.Background(), 100), ErrReaderClosed)
+	})
+}
+
+func TestReader_GetWait(t *testing.T) {
+	m := NewMap[string, int]()
+	reader := m.Reader()
+
+	t.Run("visible", func(t *testing.T) {
+		v := 1
+		m.Insert("foo", &v)
+		m.Refresh()
+		got, err := reader.GetWait(context.Background(), "foo")
+		assert.NoError(t, err)
+		assert.Equal(t, &v, got)
+	})
+	t.Run("refresh", func(t *testing.T) {
+		v := 2
+		go func() {
+			// The first refresh doesn't make the key visible
+			m.Refresh()
+			m.Insert("bar", &v)
+			m.Refresh()
+		}()
+		got, err := reader.GetWait(context.Background(), "bar")
+		assert.NoError(t, err)
+		assert.Equal(t, &v, got)
+	})
+	t.Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_, err := reader.GetWait(ctx, "baz")
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+	t.Run("closed", func(t *testing.T) {
+		done := make(chan error)
+		go func() {
+			_, err := reader.GetWait(context.Background(), "baz")
+			done <- err
+		}()
+		m.Close()
+		assert.ErrorIs(t, <-done, ErrReaderClosed)
+	})
+}
+
+func TestReader_Clone(t *testing.T) {
+	m := NewMap[string, any]()
+	reader := m.Reader()
+	m.Insert("foo", nil)
+	m.Refresh()
+
+	clone := reader.Clone()
+	assert.Len(t, m.openReaders(), 2)
+	assert.True(t, clone.Has("foo"))
+
+	// Closing the original doesn't affect the clone
+	assert.NoError(t, reader.Close())
+	m.Insert("bar", nil)
+	m.Refresh()
+	assert.True(t, clone.Has("bar"))
+}
+
+func TestReader_closedErrors(t *testing.T) {
+	m := NewMap[string, any]()
+	reader := m.Reader()
+	m.Insert("foo", nil)
+	m.Refresh()
+
+	_, ok, err := reader.GetErr("foo")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = reader.HasErr("bar")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	assert.NoError(t, reader.Close())
+
+	_, _, err = reader.GetErr("foo")
+	assert.ErrorIs(t, err, ErrReaderClosed)
+	_, err = reader.HasErr("foo")
+	assert.ErrorIs(t, err, ErrReaderClosed)
+	assert.ErrorIs(t, reader.WaitForGeneration(context.Background(), 1), ErrReaderClosed)
+	assert.PanicsWithValue(t, ErrReaderClosed, func() { reader.Get("foo") })
+}
+
+func TestReader_Freeze(t *testing.T) {
+	m := NewMap[string, any]()
+	reader := m.Reader()
+	m.Insert("foo", nil)
+	m.Refresh()
+
+	reader.Freeze()
+	reader.Freeze()
+
+	// Refreshes shouldn't block on, or be visible to, the frozen reader
+	m.Delete("foo")
+	m.Insert("bar", nil)
+	m.Refresh()
+	m.Refresh()
+	assert.True(t, reader.Has("foo"))
+	assert.False(t, reader.Has("bar"))
+	assert.Equal(t, uint64(1), reader.Generation())
+
+	reader.Unfreeze()
+	reader.Unfreeze()
+	assert.False(t, reader.Has("foo"))
+	assert.True(t, reader.Has("bar"))
+	assert.Equal(t, uint64(3), reader.Generation())
+
+	m.Insert("baz", nil)
+	m.Refresh()
+	assert.True(t, reader.Has("baz"), "unfrozen readers should observe refreshes again")
+}
+
+func TestReader_Meta(t *testing.T) {
+	m := NewMap[string, any]()
+	reader := m.Reader()
+	assert.Nil(t, reader.Meta())
+
+	m.Insert("foo", nil)
+	m.SetMeta("v1")
+	assert.Nil(t, reader.Meta(), "the meta value shouldn't be visible before refresh")
+
+	m.Refresh()
+	guard := reader.Guard()
+	assert.Equal(t, "v1", guard.Meta())
+	assert.True(t, guard.Has("foo"))
+	guard.Release()
+
+	// The meta value stays the same until it's changed
+	m.Refresh()
+	assert.Equal(t, "v1", reader.Meta())
+}
+
+func TestReader_ReadAllocs(t *testing.T) {
+	m := NewMap[string, int](WithMetrics(&testReadMetrics{}))
+	defer m.Close()
+	r := m.Reader()
+	v := 1
+	assert.NoError(t, m.Insert("foo", &v))
+	assert.NoError(t, m.Refresh())
+
+	// The hot read path never allocates, whether or not the key exists
+	for _, key := range []string{"foo", "bar"} {
+		assert.Equal(t, 0.0, testing.AllocsPerRun(100, func() { r.Get(key) }))
+		assert.Equal(t, 0.0, testing.AllocsPerRun(100, func() { r.Has(key) }))
+		assert.Equal(t, 0.0, testing.AllocsPerRun(100, func() { _, _, _ = r.GetErr(key) }))
+		assert.Equal(t, 0.0, testing.AllocsPerRun(100, func() { _, _ = r.HasErr(key) }))
+	}
+}
+
+func TestReaders_ReadAllocs(t *testing.T) {
+	v := 1
+	sharded := NewShardedMap[string, int]()
+	defer sharded.Close()
+	assert.NoError(t, sharded.Insert("foo", &v))
+	ttl := NewTTLMap[string, int]()
+	defer ttl.Close()
+	assert.NoError(t, ttl.InsertWithTTL("foo", &v, time.Hour))
+	bimap := NewBiMap[string, int]()
+	defer bimap.Close()
+	assert.NoError(t, bimap.Insert("foo", 1))
+	values := NewValueMap[string, int]()
+	defer values.Close()
+	assert.NoError(t, values.Insert("foo", 1))
+	hasher := NewMapWithHasher[string, int](func(s string) uint64 { return uint64(len(s)) }, func(a, b string) bool { return a == b })
+	defer hasher.Close()
+	assert.NoError(t, hasher.Insert("foo", &v))
+
+	readers := map[string]interface{ Has(key string) bool }{
+		"sharded": sharded.Reader(),
+		"ttl":     ttl.Reader(),
+		"bimap":   bimap.Reader(),
+		"value":   values.Reader(),
+		"hasher":  hasher.Reader(),
+	}
+	assert.NoError(t, sharded.Refresh())
+	assert.NoError(t, ttl.Refresh())
+	assert.NoError(t, bimap.Refresh())
+	assert.NoError(t, values.Refresh())
+	assert.NoError(t, hasher.Refresh())
+
+	for name, r := range readers {
+		assert.True(t, r.Has("foo"), name)
+		for _, key := range []string{"foo", "bar"} {
+			assert.Equal(t, 0.0, testing.AllocsPerRun(100, func() { r.Has(key) }), name)
+		}
+	}
+}
+
+func TestReader_ConcurrentRegistration(t *testing.T) {
+	m := NewMap[int, int]()
+	defer m.Close()
+	done := make(chan struct{})
+	go func() {
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+				m.Insert(0, &i)
+				m.Refresh()
+			}
+		}
+	}()
+
+	// Readers that are registered in the middle of a refresh never read from
+	// the map that is being synced
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				r := m.Reader()
+				r.Get(0)
+				assert.NoError(t, r.Close())
+			}
+		}()
+	}
+	wg.Wait()
+	close(done)
+
+	m.Refresh()
+	assert.Empty(t, m.openReaders())
+	assert.Equal(t, int64(0), m.readerCount.Load())
+}
+
+func TestReader_ClosePrunesShared(t *testing.T) {
+	// A shared reader that is closed while other goroutines are reading through
+	// it may be pruned, after which refreshes modify the map it was looking at
+	// without waiting for it, which the race detector checks
+	for i := 0; i < 10; i++ {
+		m := NewMap[int, int]()
+		reader := m.Reader()
+		var wg, reading sync.WaitGroup
+		for g := 0; g < 4; g++ {
+			wg.Add(1)
+			reading.Add(1)
+			go func() {
+				defer wg.Done()
+				for k := 0; ; k++ {
+					if _, _, err := reader.GetErr(k % 10); err != nil {
+						assert.ErrorIs(t, err, ErrReaderClosed)
+						return
+					}
+					if k == 0 {
+						reading.Done()
+					}
+				}
+			}()
+		}
+		reading.Wait()
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for k := 0; k < 200; k++ {
+				v := k
+				assert.NoError(t, m.Insert(k%10, &v))
+				assert.NoError(t, m.Refresh())
+			}
+		}()
+		assert.NoError(t, reader.Close())
+		wg.Wait()
+		<-done
+		assert.NotContains(t, slices.Collect(m.readers.all()), reader.readerState)
+		assert.NoError(t, m.Close())
+	}
+}
+
+func TestReader_ClosePrunes(t *testing.T) {
+	m := NewMap[int, int]()
+	defer m.Close()
+	open := m.Reader()
+
+	// Closed readers are pruned without a refresh once they outnumber the open
+	// readers by more than the slack
+	for i := 0; i < 10*pruneSlack; i++ {
+		assert.NoError(t, m.Reader().Close())
+	}
+	linked := slices.Collect(m.readers.all())
+	assert.LessOrEqual(t, len(linked), 2+pruneSlack)
+	assert.Contains(t, linked, open.readerState)
+}
+
+func TestReader_Abandoned(t *testing.T) {
+	m := NewMap[int, int]()
+	defer m.Close()
+	open := m.Reader()
+	abandoned := m.Reader()
+
+	// A leaked guard doesn't keep pinning the map once it's collected
+	abandoned.Guard()
+	state := abandoned.readerState
+	abandoned = nil
+	for i := 0; i < 100 && m.readerCount.Load() != 1; i++ {
+		runtime.GC()
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, int64(1), m.readerCount.Load(), "the abandoned reader should be closed once it's collected")
+	assert.Equal(t, [3]int64{}, state.loadPins())
+
+	m.Refresh()
+	assert.Equal(t, []*readerState[int, int]{open.readerState}, slices.Collect(m.readers.all()))
+}
@@ -0,0 +1,25 @@
+package eventual
+
+// unloggedLocked reports whether the next write can skip the oplog because of
+// WithReaderlessWrites. Readers only ever see the published snapshot, so a
+// reader that is registered in the meantime doesn't need the oplog either, but
+// the write-behind sink is handed the entries of the oplog, and queued writes
+// have to be applied in order by the incremental replay. This must be called
+// while holding the write lock.
+func (m *Map[K, V]) unloggedLocked() bool {
+	return m.options.ReaderlessWrites && m.writeBehind == nil && !m.replaying && m.readerCount.Load() == 0
+}
+
+// copyReadableLocked syncs the writable map by copying the readable map rather
+// than replaying the oplog, which is missing the writes that skipped it. This
+// must be called while holding the write lock, once every reader has left the
+// writable map.
+func (m *Map[K, V]) copyReadableLocked() {
+	clear(*m.writable)
+	for k, v := range *m.readable {
+		(*m.writable)[k] = v
+	}
+	m.oplog.Clear()
+	m.unlogged = 0
+	m.syncedLocked()
+}
@@ -0,0 +1,68 @@
+package eventual
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestMap_ReaderlessWrites(t *testing.T) {
+	m := NewMap[string, int](WithReaderlessWrites())
+	defer m.Close()
+	feed := m.Changefeed()
+	defer feed.Close()
+
+	v1, v2 := 1, 2
+	assert.NoError(t, m.Insert("foo", &v1))
+	assert.NoError(t, m.Insert("bar", &v1))
+	assert.True(t, m.Delete("bar"))
+	assert.Equal(t, 0, m.oplog.Len())
+	assert.Equal(t, 3, m.PendingWrites())
+
+	// A reader registered in the meantime only sees the published snapshot
+	r := m.Reader()
+	assert.Empty(t, r.Snapshot())
+	assert.NoError(t, m.Insert("baz", &v2))
+	assert.Equal(t, 1, m.oplog.Len())
+	assert.Equal(t, 4, m.PendingWrites())
+
+	// The refresh copies the map rather than replaying the oplog
+	assert.NoError(t, m.Refresh())
+	assert.Equal(t, map[string]int{"foo": 1, "baz": 2}, r.Snapshot())
+	assert.Equal(t, 0, m.PendingWrites())
+	assert.Equal(t, 2, len(*m.writable))
+
+	c, err := feed.Next(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, c.Changes, 2)
+
+	// Writes go through the oplog while there are readers
+	assert.NoError(t, m.Insert("foo", &v2))
+	assert.Equal(t, 1, m.oplog.Len())
+	assert.NoError(t, m.Refresh())
+	assert.Equal(t, map[string]int{"foo": 2, "baz": 2}, r.Snapshot())
+
+	assert.NoError(t, r.Close())
+	assert.NoError(t, m.Insert("qux", &v1))
+	assert.Equal(t, 0, m.oplog.Len())
+	assert.NoError(t, m.Refresh())
+	assert.Equal(t, map[string]int{"foo": 2, "baz": 2, "qux": 1}, m.Reader().Snapshot())
+	assert.NoError(t, m.Refresh())
+	assert.Equal(t, map[string]int{"foo": 2, "baz": 2, "qux": 1}, m.Snapshot())
+}
+
+func TestBiMap_ReaderlessWrites(t *testing.T) {
+	m := NewBiMap[string, int](WithReaderlessWrites())
+	defer m.Close()
+	assert.NoError(t, m.Insert("foo", 1))
+	assert.NoError(t, m.Insert("bar", 1))
+	assert.Equal(t, 0, m.m.oplog.Len())
+
+	assert.NoError(t, m.Refresh())
+	r := m.Reader()
+	_, ok := r.Get("foo")
+	assert.False(t, ok)
+	key, ok := r.GetByValue(1)
+	assert.True(t, ok)
+	assert.Equal(t, "bar", key)
+}
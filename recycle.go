@@ -0,0 +1,132 @@
+package eventual
+
+import (
+	"context"
+	"github.com/clarkmcc/go-evmap/pkg/oplog"
+	"sync"
+	"sync/atomic"
+)
+
+// valueFreelist holds the storage of values that were removed from a map
+// created with WithValueRecycling and can't be observed anymore, for reuse by
+// the values that are inserted next. Values are inserted without holding the
+// write lock, for example by Batch, so the freelist has its own lock.
+type valueFreelist[V any] struct {
+	mu   sync.Mutex
+	free []*V
+}
+
+// copy returns a copy of the value in recycled storage, or in new storage if
+// the freelist is empty.
+func (l *valueFreelist[V]) copy(v *V) *V {
+	l.mu.Lock()
+	n := len(l.free)
+	if n == 0 {
+		l.mu.Unlock()
+		c := new(V)
+		*c = *v
+		return c
+	}
+	p := l.free[n-1]
+	l.free[n-1] = nil
+	l.free = l.free[:n-1]
+	l.mu.Unlock()
+	*p = *v
+	return p
+}
+
+// put zeroes the values, so that they don't keep what they reference alive,
+// and adds them to the freelist.
+func (l *valueFreelist[V]) put(values []*V) {
+	var zero V
+	for _, v := range values {
+		*v = zero
+	}
+	l.mu.Lock()
+	l.free = append(l.free, values...)
+	l.mu.Unlock()
+}
+
+// removableValue is a value that may be removed from the writable map by an
+// oplog entry.
+type removableValue[K comparable, V any] struct {
+	key   K
+	value *V
+}
+
+// removableLocked appends the values of the writable map that may be removed
+// by applying the entry to removable. The values removed by operations aren't
+// known, so they're left to the garbage collector. This must be called while
+// holding the write lock, before the entry is applied.
+func (m *Map[K, V]) removableLocked(e *oplog.Entry[K, *V], removable []removableValue[K, V]) []removableValue[K, V] {
+	switch e.Type() {
+	case oplog.EntryInsert, oplog.EntryDelete, oplog.EntryUpdate:
+		// Single key writes are the common case, and don't allocate
+		if v := (*m.writable)[e.Key()]; v != nil {
+			removable = append(removable, removableValue[K, V]{e.Key(), v})
+		}
+		return removable
+	}
+	keys, cleared := e.ModifiedKeys()
+	if cleared {
+		for k, v := range *m.writable {
+			if v != nil {
+				removable = append(removable, removableValue[K, V]{k, v})
+			}
+		}
+		return removable
+	}
+	if len(keys) == 1 {
+		if v := (*m.writable)[keys[0]]; v != nil {
+			removable = append(removable, removableValue[K, V]{keys[0], v})
+		}
+		return removable
+	}
+
+	// Keys can be repeated, and a value must only be retired once
+	seen := make(map[K]struct{}, len(keys))
+	for _, k := range keys {
+		if _, ok := seen[k]; ok {
+			continue
+		}
+		seen[k] = struct{}{}
+		if v := (*m.writable)[k]; v != nil {
+			removable = append(removable, removableValue[K, V]{k, v})
+		}
+	}
+	return removable
+}
+
+// retireLocked retires the removable values that are no longer stored under
+// their key now that the entry has been applied. Retired values are recycled
+// once the refresh that publishes their removal has synced both maps. This must
+// be called while holding the write lock.
+func (m *Map[K, V]) retireLocked(removable []removableValue[K, V]) {
+	for _, r := range removable {
+		if (*m.writable)[r.key] != r.value {
+			m.retiring = append(m.retiring, r.value)
+		}
+	}
+}
+
+// recycleLocked moves the retired values to the freelist, unless a reader is
+// frozen, in which case its private copy of the map may still reference them
+// and they're kept until a later refresh. This must be called while holding
+// the write lock, once neither map contains the retired values.
+func (m *Map[K, V]) recycleLocked() {
+	if m.free == nil || len(m.retired) == 0 {
+		return
+	}
+	m.readersLock.Lock()
+	defer m.readersLock.Unlock()
+	for r := range m.readers.all() {
+		if r.frozen && atomic.LoadUint32(&r.closed) == 0 {
+			return
+		}
+	}
+
+	// Readers that were unfrozen may still be reading from their private copy
+	_ = m.waitReadersLocked(context.Background(), sidePrivate)
+	m.free.put(m.retired)
+	m.retired = nil
+}
@@ -0,0 +1,78 @@
+package eventual
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestMap_ValueRecycling(t *testing.T) {
+	type value struct{ n int }
+	m := NewMap[string, value](WithValueRecycling())
+	defer m.Close()
+	r := m.Reader()
+
+	// The map stores its own copies of the values
+	v := value{1}
+	assert.NoError(t, m.Insert("foo", &v))
+	assert.NoError(t, m.Refresh())
+	old, _ := r.Get("foo")
+	assert.NotSame(t, &v, old)
+
+	// The removed value is still visible until the removal is published
+	assert.NoError(t, m.Insert("foo", &value{2}))
+	assert.Equal(t, value{1}, *old)
+	assert.Len(t, m.free.free, 0)
+	assert.NoError(t, m.Refresh())
+	assert.Equal(t, value{}, *old, "recycled values are zeroed")
+	assert.Len(t, m.free.free, 1)
+
+	// The next insert reuses the storage of the removed value
+	assert.NoError(t, m.Insert("bar", &value{3}))
+	assert.Len(t, m.free.free, 0)
+	assert.NoError(t, m.Refresh())
+	bar, _ := r.Get("bar")
+	assert.Same(t, old, bar)
+	assert.Equal(t, map[string]value{"foo": {2}, "bar": {3}}, r.Snapshot())
+
+	// Every removed value is recycled exactly once
+	m.DeleteMany([]string{"foo", "bar", "foo"})
+	assert.NoError(t, m.Refresh())
+	assert.Len(t, m.free.free, 2)
+	assert.NotSame(t, m.free.free[0], m.free.free[1])
+	assert.Empty(t, r.Snapshot())
+}
+
+func TestMap_ValueRecyclingFrozen(t *testing.T) {
+	m := NewMap[string, int](WithValueRecycling())
+	defer m.Close()
+	frozen := m.Reader()
+	v := 1
+	assert.NoError(t, m.Insert("foo", &v))
+	assert.NoError(t, m.Refresh())
+	frozen.Freeze()
+
+	// The frozen reader's copy still references the removed value
+	assert.NoError(t, m.Clear())
+	assert.NoError(t, m.Refresh())
+	assert.Len(t, m.free.free, 0)
+	assert.Equal(t, map[string]int{"foo": 1}, frozen.Snapshot())
+
+	frozen.Unfreeze()
+	assert.NoError(t, m.Refresh())
+	assert.Len(t, m.free.free, 1)
+	assert.Empty(t, frozen.Snapshot())
+}
+
+func TestPrefixMap_ValueRecycling(t *testing.T) {
+	m := NewPrefixMap[int](WithValueRecycling())
+	defer m.Close()
+	r := m.Reader()
+
+	v := 1
+	assert.NoError(t, m.Insert("foo", &v))
+	assert.NoError(t, m.Refresh())
+	assert.True(t, m.Delete("foo"))
+	assert.NoError(t, m.Refresh())
+	assert.Len(t, m.m.free.free, 1)
+	assert.Empty(t, r.Prefix("f"))
+}
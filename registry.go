@@ -0,0 +1,104 @@
+package eventual
+
+import (
+	"iter"
+	"sync/atomic"
+)
+
+// pruneSlack is the number of closed readers that may stay linked in a map's
+// list of readers on top of the open readers before closing a reader prunes
+// the list, for maps that are rarely refreshed.
+const pruneSlack = 64
+
+// readerList is the lock-free list of the readers registered with a map.
+// Readers are registered by pushing them onto the head of the list, and closed
+// by marking them as closed, so neither blocks on a refresh or on each other.
+// Closed readers are unlinked from the list by the next refresh, once no read
+// is in progress against them, and so are the readers that were garbage
+// collected without being closed.
+type readerList[K comparable, V any] struct {
+	head atomic.Pointer[readerState[K, V]]
+
+	// The number of closed readers that are still linked
+	closed atomic.Int64
+}
+
+// push registers the reader with the list.
+func (l *readerList[K, V]) push(r *readerState[K, V]) {
+	for {
+		head := l.head.Load()
+		r.next.Store(head)
+		if l.head.CompareAndSwap(head, r) {
+			return
+		}
+	}
+}
+
+// all iterates over every reader in the list, including the closed readers
+// that haven't been unlinked yet, which may still have reads in progress.
+func (l *readerList[K, V]) all() iter.Seq[*readerState[K, V]] {
+	return func(yield func(*readerState[K, V]) bool) {
+		for r := l.head.Load(); r != nil; r = r.next.Load() {
+			if !yield(r) {
+				return
+			}
+		}
+	}
+}
+
+// pruneLocked unlinks the closed readers that don't have any reads in progress,
+// and the detached readers, which aren't waited for anymore. A read that pins a
+// closed reader after its pins were checked here sees that it's closed and
+// backs out before reading, so it doesn't need to be waited for either.
+// Readers are only ever pushed onto the head of the list, so every link but the
+// head is only modified here. This must be called while holding the readers
+// lock, which guarantees that there is a single pruner.
+func (l *readerList[K, V]) pruneLocked() {
+	link := &l.head
+	for {
+		r := link.Load()
+		if r == nil {
+			return
+		}
+		if atomic.LoadUint32(&r.closed) != 0 && (r.detached || r.loadPins() == [3]int64{}) {
+			// This fails if a reader was pushed onto the head in the meantime,
+			// in which case the new head is checked instead.
+			if link.CompareAndSwap(r, r.next.Load()) {
+				l.closed.Add(-1)
+			}
+			continue
+		}
+		link = &r.next
+	}
+}
+
+// clear unlinks every reader from the list.
+func (l *readerList[K, V]) clear() {
+	l.head.Store(nil)
+	l.closed.Store(0)
+}
+
+// closedReader is called when a linked reader is closed. Closing a reader
+// doesn't wait for the readers lock, but once the closed readers outnumber the
+// open readers by more than pruneSlack and no refresh is in progress, the list
+// is pruned, so the cost of pruning is amortized over the closed readers.
+func (m *Map[K, V]) closedReader() {
+	if m.readers.closed.Add(1) <= m.readerCount.Load()+pruneSlack {
+		return
+	}
+	if m.readersLock.TryLock() {
+		m.readers.pruneLocked()
+		m.readersLock.Unlock()
+	}
+}
+
+// openReaders returns the registered readers that haven't been closed.
+func (m *Map[K, V]) openReaders() []*readerState[K, V] {
+	var readers []*readerState[K, V]
+	for r := range m.readers.all() {
+		if atomic.LoadUint32(&r.closed) == 0 {
+			readers = append(readers, r)
+		}
+	}
+	return readers
+}
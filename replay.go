@@ -0,0 +1,94 @@
+package eventual
+
+import (
+	"runtime"
+	"time"
+)
+
+// replayChunk is the number of oplog entries that an incremental refresh
+// replays between checks of the time it has been holding the write lock.
+const replayChunk = 256
+
+// incrementalLocked reports whether the oplog is replayed incrementally after a
+// refresh. Evictions depend on the contents of the writable map after every
+// write, so bounded maps are always replayed in full.
+func (m *Map[K, V]) incrementalLocked() bool {
+	return m.options.MaxRefreshPause > 0 && m.eviction == nil
+}
+
+// startReplayLocked starts replaying the published oplog entries to the
+// writable map incrementally. The first slice is replayed right away and the
+// rest is replayed by a background goroutine, one slice per acquisition of the
+// write lock. This must be called while holding the write lock, once every
+// reader has left the writable map.
+func (m *Map[K, V]) startReplayLocked() {
+	m.replaying = true
+	m.replayBacklog = m.oplog.Len()
+	m.replayApplied = 0
+	m.replaySliceLocked()
+	if m.replaying && !m.replayer {
+		m.replayer = true
+		m.background.Add(1)
+		go m.replayInBackground()
+	}
+}
+
+// replaySliceLocked replays oplog entries until the replay is finished or it
+// has taken MaxRefreshPause. This must be called while holding the write lock.
+func (m *Map[K, V]) replaySliceLocked() {
+	deadline := time.Now().Add(m.options.MaxRefreshPause)
+	for m.replaying {
+		m.replayChunkLocked(replayChunk)
+		if !time.Now().Before(deadline) {
+			return
+		}
+	}
+}
+
+// finishReplayLocked replays the rest of the oplog, if an incremental replay is
+// in progress, so that the writable map is up-to-date. This must be called
+// while holding the write lock.
+func (m *Map[K, V]) finishReplayLocked() {
+	for m.replaying {
+		m.replayChunkLocked(m.oplog.Len())
+	}
+}
+
+// replayChunkLocked replays up to n oplog entries. The published entries at
+// the front of the oplog are discarded once they've been replayed, while the
+// entries that were queued behind them by writes made during the replay are
+// kept for the next refresh.
+func (m *Map[K, V]) replayChunkLocked(n int) {
+	if m.replayBacklog > 0 {
+		applied := m.oplog.ApplyN(m.writable, min(n, m.replayBacklog))
+		m.oplog.Truncate(applied)
+		m.replayBacklog -= applied
+		n -= applied
+	}
+	if m.replayBacklog == 0 {
+		m.replayApplied += m.oplog.ApplyRange(m.writable, m.replayApplied, m.replayApplied+n)
+		if m.replayApplied == m.oplog.Len() {
+			m.replaying = false
+			m.replayApplied = 0
+			m.syncedLocked()
+		}
+	}
+}
+
+// replayInBackground replays the oplog one slice at a time until the replay is
+// finished or the map is closed, yielding between slices so that writers can
+// acquire the write lock.
+func (m *Map[K, V]) replayInBackground() {
+	defer m.background.Done()
+	for {
+		runtime.Gosched()
+		m.writeLock.Lock()
+		if m.closed || !m.replaying {
+			m.replayer = false
+			m.writeLock.Unlock()
+			return
+		}
+		m.replaySliceLocked()
+		m.writeLock.Unlock()
+	}
+}
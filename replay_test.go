@@ -0,0 +1,76 @@
+package eventual
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestMap_IncrementalRefresh(t *testing.T) {
+	m := NewMap[string, int](WithIncrementalRefresh(time.Nanosecond))
+	defer m.Close()
+	r := m.Reader()
+	expected := map[string]int{}
+
+	for round := 0; round < 4; round++ {
+		for i := 0; i < 5000; i++ {
+			k, v := strconv.Itoa(i), round*i
+			assert.NoError(t, m.Insert(k, &v))
+			expected[k] = v
+		}
+		assert.NoError(t, m.Refresh())
+		assert.Equal(t, 0, m.PendingWrites())
+		assert.Equal(t, expected, r.Snapshot())
+
+		// Writes made while the oplog is being replayed are queued behind it
+		v := -1
+		assert.NoError(t, m.Insert("queued", &v))
+		assert.NoError(t, m.Clear())
+		assert.NoError(t, m.Insert("queued", &v))
+		assert.Equal(t, 3, m.PendingWrites())
+		assert.Len(t, m.PendingEntries(), 3)
+		expected = map[string]int{"queued": v}
+
+		// Writes that depend on the contents of the map see every write
+		assert.True(t, m.Delete("queued"))
+		assert.False(t, m.Delete("queued"))
+		assert.Equal(t, 0, m.Len())
+		delete(expected, "queued")
+	}
+
+	assert.NoError(t, m.Refresh())
+	assert.Empty(t, r.Snapshot())
+	assert.NoError(t, m.Refresh())
+	assert.Empty(t, r.Snapshot())
+	assert.Equal(t, 0, m.Len())
+}
+
+func TestMap_IncrementalRefreshBackground(t *testing.T) {
+	m := NewMap[int, int](WithIncrementalRefresh(time.Nanosecond))
+	defer m.Close()
+	for i := 0; i < 10000; i++ {
+		assert.NoError(t, m.Insert(i, &i))
+	}
+	assert.NoError(t, m.Refresh())
+
+	// The rest of the oplog is replayed without any further writes
+	assert.Eventually(t, func() bool {
+		m.writeLock.Lock()
+		defer m.writeLock.Unlock()
+		return !m.replaying && !m.replayer && len(*m.writable) == 10000
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, 0, m.oplog.Len())
+}
+
+func TestMap_IncrementalRefreshBounded(t *testing.T) {
+	// Bounded maps always replay the oplog in full
+	m := NewMap[int, int](WithIncrementalRefresh(time.Nanosecond), WithMaxEntries(10))
+	defer m.Close()
+	for i := 0; i < 1000; i++ {
+		assert.NoError(t, m.Insert(i, &i))
+	}
+	assert.NoError(t, m.Refresh())
+	assert.False(t, m.replaying)
+	assert.Equal(t, 10, m.Len())
+}
@@ -0,0 +1,221 @@
+package eventual
+
+import (
+	"context"
+	"hash/maphash"
+)
+
+// ShardedMap partitions its keys across a number of independent maps, each with
+// its own readable and writable maps, oplog and write lock. Writers that write
+// to different shards don't contend with each other and each shard is refreshed
+// separately, so the pause caused by a refresh is bounded by the size of a
+// single shard rather than the whole map.
+//
+// Because the shards are refreshed one at a time, readers are not guaranteed
+// to observe a single consistent generation across all shards. Each shard on
+// its own has the same refresh semantics as a Map.
+type ShardedMap[K comparable, V any] struct {
+	shards []*Map[K, V]
+	seed   maphash.Seed
+}
+
+// shard returns the shard that the key belongs to.
+func (m *ShardedMap[K, V]) shard(key K) *Map[K, V] {
+	return m.shards[maphash.Comparable(m.seed, key)%uint64(len(m.shards))]
+}
+
+// Shards returns the number of shards that the keys are partitioned across.
+func (m *ShardedMap[K, V]) Shards() int {
+	return len(m.shards)
+}
+
+// Insert inserts the value into the shard that the key belongs to.
+func (m *ShardedMap[K, V]) Insert(key K, value *V) error {
+	return m.shard(key).Insert(key, value)
+}
+
+// Delete attempts to delete the key from the map and returns a boolean representing
+// whether the key existed.
+func (m *ShardedMap[K, V]) Delete(key K) bool {
+	return m.shard(key).Delete(key)
+}
+
+// DeleteErr is like Delete but returns the error when the key can't be deleted.
+func (m *ShardedMap[K, V]) DeleteErr(key K) (bool, error) {
+	return m.shard(key).DeleteErr(key)
+}
+
+// Get returns the value stored under the key, including writes that have not
+// been exposed to the readers yet.
+func (m *ShardedMap[K, V]) Get(key K) (*V, bool) {
+	return m.shard(key).Get(key)
+}
+
+// Len returns the number of keys across all shards, including writes that have
+// not been exposed to the readers yet.
+func (m *ShardedMap[K, V]) Len() int {
+	n := 0
+	for _, s := range m.shards {
+		n += s.Len()
+	}
+	return n
+}
+
+// Clear removes all the keys from every shard.
+func (m *ShardedMap[K, V]) Clear() error {
+	for _, s := range m.shards {
+		if err := s.Clear(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Refresh refreshes every shard, one shard at a time.
+func (m *ShardedMap[K, V]) Refresh() error {
+	for _, s := range m.shards {
+		if err := s.Refresh(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RefreshAndWait refreshes every shard like Map.RefreshAndWait, one shard at a
+// time, so that once it returns every reader observes the writes made to every
+// shard before the call.
+func (m *ShardedMap[K, V]) RefreshAndWait(ctx context.Context) error {
+	for _, s := range m.shards {
+		if err := s.RefreshAndWait(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes every shard, which closes every reader of the map like
+// Map.Close.
+func (m *ShardedMap[K, V]) Close() error {
+	var err error
+	for _, s := range m.shards {
+		if e := s.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// Reader creates a new reader that reads from every shard. The reader holds a
+// reader of every shard, and like a Reader, it's safe to share between
+// goroutines and must be closed once it's no longer needed.
+func (m *ShardedMap[K, V]) Reader() *ShardedReader[K, V] {
+	r := &ShardedReader[K, V]{m: m, readers: make([]*Reader[K, V], len(m.shards))}
+	for i, s := range m.shards {
+		r.readers[i] = s.Reader()
+	}
+	return r
+}
+
+// ShardedReader reads from every shard of a ShardedMap.
+type ShardedReader[K comparable, V any] struct {
+	m       *ShardedMap[K, V]
+	readers []*Reader[K, V]
+}
+
+// reader returns the reader for the shard that the key belongs to.
+func (r *ShardedReader[K, V]) reader(key K) *Reader[K, V] {
+	return r.readers[maphash.Comparable(r.m.seed, key)%uint64(len(r.readers))]
+}
+
+func (r *ShardedReader[K, V]) Get(key K) (*V, bool) {
+	return r.reader(key).Get(key)
+}
+
+func (r *ShardedReader[K, V]) Has(key K) bool {
+	return r.reader(key).Has(key)
+}
+
+// GetErr is like Get but returns ErrReaderClosed rather than panicking if the
+// reader or the map has been closed.
+func (r *ShardedReader[K, V]) GetErr(key K) (*V, bool, error) {
+	return r.reader(key).GetErr(key)
+}
+
+// HasErr is like Has but returns ErrReaderClosed rather than panicking if the
+// reader or the map has been closed.
+func (r *ShardedReader[K, V]) HasErr(key K) (bool, error) {
+	return r.reader(key).HasErr(key)
+}
+
+// Snapshot returns a copy of the keys and values visible to this reader across
+// all shards. Like ForEach, every shard is copied from a single snapshot, but
+// different shards may be at different generations.
+func (r *ShardedReader[K, V]) Snapshot() map[K]V {
+	snapshot := make(map[K]V)
+	for _, reader := range r.readers {
+		for k, v := range reader.Snapshot() {
+			snapshot[k] = v
+		}
+	}
+	return snapshot
+}
+
+// Len returns the number of keys visible to this reader across all shards.
+func (r *ShardedReader[K, V]) Len() int {
+	n := 0
+	for _, reader := range r.readers {
+		reader.With(func(m map[K]*V) {
+			n += len(m)
+		})
+	}
+	return n
+}
+
+// Keys returns the keys visible to this reader across all shards.
+func (r *ShardedReader[K, V]) Keys() []K {
+	var keys []K
+	for _, reader := range r.readers {
+		keys = append(keys, reader.Keys()...)
+	}
+	return keys
+}
+
+// ForEach calls fn for every key and value visible to this reader, stopping
+// early if fn returns false. Each shard is iterated against a single snapshot,
+// but different shards may be at different generations.
+func (r *ShardedReader[K, V]) ForEach(fn func(key K, value *V) bool) {
+	for _, reader := range r.readers {
+		stopped := false
+		reader.ForEach(func(key K, value *V) bool {
+			stopped = !fn(key, value)
+			return !stopped
+		})
+		if stopped {
+			return
+		}
+	}
+}
+
+// Close closes the reader of every shard.
+func (r *ShardedReader[K, V]) Close() error {
+	for _, reader := range r.readers {
+		_ = reader.Close()
+	}
+	return nil
+}
+
+// NewShardedMap creates a new ShardedMap with the number of shards configured by
+// WithShardCount, defaulting to a single shard. The remaining options are applied
+// to every shard, so for example WithInitialCapacity sizes each shard.
+func NewShardedMap[K comparable, V any](opts ...OptionFunc) *ShardedMap[K, V] {
+	options := newOptions(opts...)
+	n := max(options.ShardCount, 1)
+	m := &ShardedMap[K, V]{shards: make([]*Map[K, V], n), seed: maphash.MakeSeed()}
+
+	// Every shard is a Map of its own, which isn't sharded
+	opts = append(opts[:len(opts):len(opts)], WithShardCount(1))
+	for i := range m.shards {
+		m.shards[i] = NewMap[K, V](opts...)
+	}
+	return m
+}
@@ -0,0 +1,81 @@
+package eventual
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+)
+
+func TestShardedMap(t *testing.T) {
+	m := NewShardedMap[int, int](WithShardCount(4))
+	reader := m.Reader()
+	assert.Equal(t, 4, m.Shards())
+
+	// Write from multiple goroutines at once
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := w * 100; i < (w+1)*100; i++ {
+				v := i
+				assert.NoError(t, m.Insert(i, &v))
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	assert.Equal(t, 400, m.Len())
+	assert.Equal(t, 0, reader.Len())
+	for _, s := range m.shards {
+		assert.NotZero(t, s.Len(), "keys should be spread across the shards")
+	}
+
+	assert.NoError(t, m.Refresh())
+	assert.Equal(t, 400, reader.Len())
+	assert.Len(t, reader.Keys(), 400)
+	got, ok := reader.Get(123)
+	assert.True(t, ok)
+	assert.Equal(t, 123, *got)
+
+	assert.True(t, m.Delete(123))
+	assert.NoError(t, m.Refresh())
+	assert.False(t, reader.Has(123))
+
+	calls := 0
+	reader.ForEach(func(key int, value *int) bool {
+		calls++
+		return calls < 10
+	})
+	assert.Equal(t, 10, calls)
+
+	assert.NoError(t, m.Insert(1000, nil))
+	assert.NoError(t, m.RefreshAndWait(context.Background()))
+	got, ok, err := reader.GetErr(1000)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Nil(t, got)
+	assert.Len(t, reader.Snapshot(), 400)
+
+	assert.NoError(t, m.Clear())
+	assert.NoError(t, m.Refresh())
+	assert.Equal(t, 0, reader.Len())
+
+	// Closing the map closes its readers
+	assert.NoError(t, m.Close())
+	_, err = reader.HasErr(1)
+	assert.ErrorIs(t, err, ErrReaderClosed)
+	assert.NoError(t, reader.Close())
+	assert.ErrorIs(t, m.Close(), ErrClosed)
+}
+
+func TestNewShardedMap_default(t *testing.T) {
+	assert.Equal(t, 1, NewShardedMap[int, int]().Shards())
+}
+
+func TestNewMap_ShardCount(t *testing.T) {
+	assert.NotPanics(t, func() { NewMap[int, int](WithShardCount(1)) })
+	assert.Panics(t, func() { NewMap[int, int](WithShardCount(8)) })
+	assert.Panics(t, func() { NewMapFrom(map[int]int{}, WithShardCount(8)) })
+}
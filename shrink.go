@@ -0,0 +1,49 @@
+package eventual
+
+// ShrinkToFit reclaims the memory held by both internal maps beyond what their
+// keys need. Go maps never shrink, so a map that once held many more keys than
+// it does now keeps the memory of its largest size. The next refresh rebuilds
+// the writable map at the size of its contents before publishing it, and then
+// rebuilds the other map once it has been synced, so readers never observe the
+// rebuild. Rebuilding takes time proportional to the size of the map.
+func (m *Map[K, V]) ShrinkToFit() error {
+	m.writeLock.Lock()
+	defer m.writeLock.Unlock()
+	if m.closed {
+		return ErrClosed
+	}
+	m.shrinkRequested = true
+	return nil
+}
+
+// shrinkBeforeSwapLocked rebuilds the writable map if ShrinkToFit was called,
+// and marks the other map to be rebuilt once it's synced. This must be called
+// by a refresh while holding the write lock, before the maps are swapped.
+func (m *Map[K, V]) shrinkBeforeSwapLocked() {
+	if !m.shrinkRequested {
+		return
+	}
+	m.shrinkRequested = false
+	m.shrinkWritableLocked()
+	m.shrinkPending = true
+}
+
+// syncedLocked must be called once the writable map has been fully synced with
+// the readable map after a refresh, while holding the write lock.
+func (m *Map[K, V]) syncedLocked() {
+	m.recycleLocked()
+	if m.shrinkPending {
+		m.shrinkPending = false
+		m.shrinkWritableLocked()
+	}
+}
+
+// shrinkWritableLocked replaces the writable map with a copy that is sized for
+// its contents. This must be called while holding the write lock.
+func (m *Map[K, V]) shrinkWritableLocked() {
+	shrunk := make(map[K]*V, len(*m.writable))
+	for k, v := range *m.writable {
+		shrunk[k] = v
+	}
+	*m.writable = shrunk
+}
@@ -0,0 +1,47 @@
+package eventual
+
+import (
+	"github.com/stretchr/testify/assert"
+	"reflect"
+	"testing"
+)
+
+func TestMap_ShrinkToFit(t *testing.T) {
+	m := NewMap[int, int]()
+	r := m.Reader()
+	for i := 0; i < 1000; i++ {
+		assert.NoError(t, m.Insert(i, &i))
+	}
+	assert.NoError(t, m.Refresh())
+	assert.Equal(t, 999, m.DeleteMany(makeRange(1, 1000)))
+	assert.NoError(t, m.Refresh())
+
+	addr := func(p *map[int]*int) uintptr {
+		return reflect.ValueOf(*p).Pointer()
+	}
+	readable, writable := addr(m.readable), addr(m.writable)
+
+	// Nothing is rebuilt until the next refresh
+	assert.NoError(t, m.ShrinkToFit())
+	assert.Equal(t, writable, addr(m.writable))
+
+	v := 1
+	assert.NoError(t, m.Insert(1, &v))
+	assert.NoError(t, m.Refresh())
+	assert.NotContains(t, []uintptr{readable, writable}, addr(m.readable))
+	assert.NotContains(t, []uintptr{readable, writable}, addr(m.writable))
+	assert.False(t, m.shrinkRequested || m.shrinkPending)
+	assert.Equal(t, map[int]int{0: 0, 1: 1}, r.Snapshot())
+	assert.Equal(t, map[int]int{0: 0, 1: 1}, m.Snapshot())
+
+	assert.NoError(t, m.Close())
+	assert.ErrorIs(t, m.ShrinkToFit(), ErrClosed)
+}
+
+func makeRange(from, to int) []int {
+	keys := make([]int, 0, to-from)
+	for i := from; i < to; i++ {
+		keys = append(keys, i)
+	}
+	return keys
+}
@@ -0,0 +1,112 @@
+package eventual
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Stats contains cumulative counts of the operations performed on a map, since
+// it was created or since the last call to ResetStats, along with its current
+// sizes.
+type Stats struct {
+	// Inserts and Deletes count the keys that were inserted or deleted, and
+	// Clears and Refreshes count the calls that cleared or refreshed the map.
+	Inserts   uint64
+	Deletes   uint64
+	Clears    uint64
+	Refreshes uint64
+
+	// ReadersCreated and ReadersClosed count the readers that were registered
+	// with and removed from the map.
+	ReadersCreated uint64
+	ReadersClosed  uint64
+
+	// Readers is the number of readers that are currently registered.
+	Readers int
+
+	// Len is the number of keys including writes that haven't been refreshed,
+	// and VisibleLen is the number of keys visible to the readers.
+	Len        int
+	VisibleLen int
+
+	// PendingWrites is the same as Map.PendingWrites.
+	PendingWrites int
+
+	// Generation is the same as Map.Generation.
+	Generation uint64
+}
+
+// statsCollector counts the operations reported to the map's MetricsCollector
+// before forwarding them to it.
+type statsCollector struct {
+	next MetricsCollector
+
+	inserts, deletes, clears, refreshes atomic.Uint64
+
+	// created and closed are counted by the map when readers are registered and
+	// closed, because concurrent registrations may report the number of readers
+	// out of order.
+	created, closed atomic.Uint64
+}
+
+func (s *statsCollector) Inserted(keys int) {
+	s.inserts.Add(uint64(keys))
+	s.next.Inserted(keys)
+}
+
+func (s *statsCollector) Deleted(keys int) {
+	s.deletes.Add(uint64(keys))
+	s.next.Deleted(keys)
+}
+
+func (s *statsCollector) Cleared() {
+	s.clears.Add(1)
+	s.next.Cleared()
+}
+
+func (s *statsCollector) Refreshed(duration time.Duration, entries int) {
+	s.refreshes.Add(1)
+	s.next.Refreshed(duration, entries)
+}
+
+func (s *statsCollector) ReplicationLag(entries int) {
+	s.next.ReplicationLag(entries)
+}
+
+func (s *statsCollector) Readers(n int) {
+	s.next.Readers(n)
+}
+
+// Stats returns the cumulative counts of the operations performed on the map
+// and its current sizes, for lightweight self-reporting without a metrics
+// backend. The counts are taken separately from each other, so they may be
+// slightly inconsistent while the map is being written to.
+func (m *Map[K, V]) Stats() Stats {
+	m.lockWriter()
+	defer m.writeLock.Unlock()
+	readers := int(m.readerCount.Load())
+	return Stats{
+		Inserts:        m.stats.inserts.Load(),
+		Deletes:        m.stats.deletes.Load(),
+		Clears:         m.stats.clears.Load(),
+		Refreshes:      m.stats.refreshes.Load(),
+		ReadersCreated: m.stats.created.Load(),
+		ReadersClosed:  m.stats.closed.Load(),
+		Readers:        readers,
+		Len:            len(*m.writable),
+		VisibleLen:     len(*m.readable),
+		PendingWrites:  m.pendingWritesLocked(),
+		Generation:     m.snapshot.generation,
+	}
+}
+
+// ResetStats resets the cumulative counts returned by Stats to zero. The current
+// sizes aren't affected.
+func (m *Map[K, V]) ResetStats() {
+	m.stats.inserts.Store(0)
+	m.stats.deletes.Store(0)
+	m.stats.clears.Store(0)
+	m.stats.refreshes.Store(0)
+	m.stats.created.Store(0)
+	m.stats.closed.Store(0)
+}
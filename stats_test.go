@@ -0,0 +1,51 @@
+package eventual
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestMap_Stats(t *testing.T) {
+	metrics := &testMetrics{}
+	m := NewMap[string, int](WithMetrics(metrics))
+	reader := m.Reader()
+	m.Reader()
+	assert.NoError(t, reader.Close())
+
+	v := 1
+	assert.NoError(t, m.InsertMany(map[string]*int{"foo": &v, "bar": &v}))
+	assert.True(t, m.Delete("foo"))
+	assert.NoError(t, m.Refresh())
+	assert.NoError(t, m.Insert("baz", &v))
+	assert.Equal(t, Stats{
+		Inserts:        3,
+		Deletes:        1,
+		Refreshes:      1,
+		ReadersCreated: 2,
+		ReadersClosed:  1,
+		Readers:        1,
+		Len:            2,
+		VisibleLen:     1,
+		PendingWrites:  1,
+		Generation:     1,
+	}, m.Stats())
+
+	// Operations are still reported to the collector
+	assert.Equal(t, 3, metrics.inserted)
+	assert.Equal(t, 1, metrics.readers)
+
+	// Clones count separately
+	clone := m.Clone()
+	assert.NoError(t, clone.Clear())
+	assert.Equal(t, uint64(0), m.Stats().Clears)
+	assert.Equal(t, uint64(1), clone.Stats().Clears)
+
+	m.ResetStats()
+	assert.Equal(t, Stats{
+		Readers:       1,
+		Len:           2,
+		VisibleLen:    1,
+		PendingWrites: 1,
+		Generation:    1,
+	}, m.Stats())
+}
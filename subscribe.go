@@ -0,0 +1,68 @@
+package eventual
+
+import (
+	"time"
+)
+
+// RefreshEvent describes a snapshot that was published by a refresh.
+type RefreshEvent struct {
+	// Generation is the generation of the published snapshot
+	Generation uint64
+
+	// Writes is the number of oplog entries that the refresh made visible
+	Writes int
+
+	// Len is the number of keys in the published snapshot
+	Len int
+
+	// Time is when the snapshot was published
+	Time time.Time
+}
+
+// Subscribe returns a channel that receives a RefreshEvent every time a refresh
+// publishes a new snapshot to the readers. Like Watch, refreshes never block on
+// subscribers, so the channel only buffers the latest event and subscribers that
+// fall behind only observe the most recent generation. The channel is closed by
+// Unsubscribe or when the map is closed.
+func (m *Map[K, V]) Subscribe() <-chan RefreshEvent {
+	m.writeLock.Lock()
+	defer m.writeLock.Unlock()
+	ch := make(chan RefreshEvent, 1)
+	if m.closed {
+		close(ch)
+		return ch
+	}
+	m.subscribers = append(m.subscribers, ch)
+	return ch
+}
+
+// Unsubscribe stops the channel returned by Subscribe from receiving events and
+// closes it. Unsubscribing a channel that isn't subscribed has no effect.
+func (m *Map[K, V]) Unsubscribe(ch <-chan RefreshEvent) {
+	m.writeLock.Lock()
+	defer m.writeLock.Unlock()
+	for i, s := range m.subscribers {
+		if s == ch {
+			close(s)
+			m.subscribers = remove(m.subscribers, i)
+			return
+		}
+	}
+}
+
+// notifySubscribersLocked sends the event to every subscriber. This must be
+// called while holding the write lock.
+func (m *Map[K, V]) notifySubscribersLocked(e RefreshEvent) {
+	for _, s := range m.subscribers {
+		sendLatest(s, e)
+	}
+}
+
+// closeSubscribersLocked closes every subscriber. This must be called while
+// holding the write lock.
+func (m *Map[K, V]) closeSubscribersLocked() {
+	for _, s := range m.subscribers {
+		close(s)
+	}
+	m.subscribers = nil
+}
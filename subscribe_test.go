@@ -0,0 +1,43 @@
+package eventual
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestMap_Subscribe(t *testing.T) {
+	m := NewMap[string, int]()
+	ch := m.Subscribe()
+
+	v := 1
+	assert.NoError(t, m.Insert("foo", &v))
+	assert.NoError(t, m.Insert("bar", &v))
+	assert.NoError(t, m.Refresh())
+	e := <-ch
+	assert.Equal(t, uint64(1), e.Generation)
+	assert.Equal(t, 2, e.Writes)
+	assert.Equal(t, 2, e.Len)
+	assert.False(t, e.Time.IsZero())
+
+	// Subscribers that fall behind only observe the latest event
+	assert.True(t, m.Delete("foo"))
+	assert.NoError(t, m.Refresh())
+	assert.NoError(t, m.Refresh())
+	e = <-ch
+	assert.Equal(t, uint64(3), e.Generation)
+	assert.Equal(t, 0, e.Writes)
+	assert.Equal(t, 1, e.Len)
+	assert.Empty(t, ch)
+
+	m.Unsubscribe(ch)
+	_, ok := <-ch
+	assert.False(t, ok)
+	assert.NoError(t, m.Refresh())
+
+	ch = m.Subscribe()
+	assert.NoError(t, m.Close())
+	_, ok = <-ch
+	assert.False(t, ok)
+	_, ok = <-m.Subscribe()
+	assert.False(t, ok)
+}
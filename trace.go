@@ -0,0 +1,40 @@
+package eventual
+
+import (
+	"context"
+)
+
+// Tracer starts spans around the operations of a map that can take long enough
+// to show up in a distributed trace: refreshes, InsertMany, and persisting or
+// restoring the map. The map doesn't depend on a tracing library, the evotel
+// package provides a Tracer backed by OpenTelemetry.
+//
+// Refreshes that are made through RefreshAndWait are children of the span in
+// the provided context. Other operations don't take a context, so their spans
+// are started from context.Background.
+type Tracer interface {
+	// Start starts a span named after the operation, such as "evmap.Refresh".
+	Start(ctx context.Context, operation string) (context.Context, Span)
+}
+
+// Span is a span started by a Tracer.
+type Span interface {
+	// SetAttribute records an attribute of the operation, such as the number
+	// of keys that it affected.
+	SetAttribute(key string, value int64)
+
+	// End ends the span with the result of the operation.
+	End(err error)
+}
+
+// nopTracer is the Tracer used when no tracer is configured.
+type nopTracer struct{}
+
+func (nopTracer) Start(ctx context.Context, _ string) (context.Context, Span) {
+	return ctx, nopSpan{}
+}
+
+type nopSpan struct{}
+
+func (nopSpan) SetAttribute(string, int64) {}
+func (nopSpan) End(error)                  {}
@@ -0,0 +1,75 @@
+package eventual
+
+import (
+	"bytes"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// testTracer records the spans that it starts.
+type testTracer struct {
+	mu    sync.Mutex
+	spans []*testSpan
+}
+
+type testSpan struct {
+	operation string
+	attrs     map[string]int64
+	ended     bool
+	err       error
+}
+
+func (t *testTracer) Start(ctx context.Context, operation string) (context.Context, Span) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := &testSpan{operation: operation, attrs: map[string]int64{}}
+	t.spans = append(t.spans, s)
+	return ctx, s
+}
+
+func (s *testSpan) SetAttribute(key string, value int64) { s.attrs[key] = value }
+func (s *testSpan) End(err error)                        { s.ended, s.err = true, err }
+
+func TestWithTracer(t *testing.T) {
+	tracer := &testTracer{}
+	m := NewMap[string, int](WithTracer(tracer))
+	v := 1
+	assert.NoError(t, m.InsertMany(map[string]*int{"foo": &v, "bar": &v}))
+	assert.NoError(t, m.Refresh())
+	var buf bytes.Buffer
+	_, err := m.WriteTo(&buf)
+	assert.NoError(t, err)
+	_, err = ReadMapFrom[string, int](&buf, WithTracer(tracer))
+	assert.NoError(t, err)
+
+	assert.NoError(t, m.Close())
+	assert.ErrorIs(t, m.InsertMany(map[string]*int{"baz": &v}), ErrClosed)
+
+	var operations []string
+	for _, s := range tracer.spans {
+		operations = append(operations, s.operation)
+		assert.True(t, s.ended)
+	}
+	assert.Equal(t, []string{"evmap.InsertMany", "evmap.Refresh", "evmap.WriteTo", "evmap.ReadMapFrom", "evmap.InsertMany"}, operations)
+	assert.Equal(t, map[string]int64{"evmap.keys": 2}, tracer.spans[0].attrs)
+	assert.Equal(t, map[string]int64{"evmap.generation": 1, "evmap.writes": 1}, tracer.spans[1].attrs)
+	assert.Equal(t, int64(2), tracer.spans[2].attrs["evmap.keys"])
+	assert.Equal(t, tracer.spans[2].attrs["evmap.bytes"], tracer.spans[3].attrs["evmap.bytes"])
+	assert.ErrorIs(t, tracer.spans[4].err, ErrClosed)
+
+	// Durable maps trace opening and checkpointing
+	tracer.spans = nil
+	path := filepath.Join(t.TempDir(), "wal")
+	m, err = OpenMap[string, int](path, WithTracer(tracer))
+	assert.NoError(t, err)
+	assert.NoError(t, m.Insert("foo", &v))
+	assert.NoError(t, m.Checkpoint())
+	assert.NoError(t, m.Close())
+	assert.Len(t, tracer.spans, 2)
+	assert.Equal(t, "evmap.OpenMap", tracer.spans[0].operation)
+	assert.Equal(t, "evmap.Checkpoint", tracer.spans[1].operation)
+	assert.Equal(t, int64(1), tracer.spans[1].attrs["evmap.keys"])
+}
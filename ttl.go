@@ -0,0 +1,271 @@
+package eventual
+
+import (
+	"container/heap"
+	"context"
+	"github.com/clarkmcc/go-evmap/pkg/oplog"
+	"time"
+)
+
+// defaultTTLSweepInterval is the sweep interval used when none is configured
+const defaultTTLSweepInterval = time.Second
+
+// TTLMap is a map whose keys can expire after a time-to-live, which makes it
+// suitable as a DNS or session cache. A background goroutine periodically
+// deletes expired keys as regular oplog deletes, so the deletes become visible
+// at the next refresh, but expired keys are hidden from readers as soon as they
+// expire, whether or not they've been swept yet.
+//
+// Under the hood the values are stored in a regular Map along with their
+// expiry, so a TTLMap shares the refresh semantics of a Map. Close must be
+// called to stop the background goroutine.
+type TTLMap[K comparable, V any] struct {
+	m *Map[K, ttlEntry[V]]
+
+	// Copies values as they're inserted, or nil if values are stored as is
+	copy func(v *V) *V
+
+	// The pending expiries ordered by time, protected by the map's write lock.
+	// Expiries of keys that have since been overwritten or deleted are skipped
+	// by the sweeper.
+	expiries expiryHeap[K]
+}
+
+// ttlEntry is a value along with its expiry. A zero expiry never expires.
+type ttlEntry[V any] struct {
+	value   *V
+	expires time.Time
+}
+
+// expired reports whether the entry has expired at the given time.
+func (e *ttlEntry[V]) expired(now time.Time) bool {
+	return !e.expires.IsZero() && !now.Before(e.expires)
+}
+
+// Insert inserts the value into the map under the provided key without an
+// expiry, replacing any expiry the key had.
+func (m *TTLMap[K, V]) Insert(key K, value *V) error {
+	return m.InsertWithTTL(key, value, 0)
+}
+
+// InsertWithTTL inserts the value into the map under the provided key. The key
+// expires once ttl has elapsed. A ttl of zero or less never expires.
+func (m *TTLMap[K, V]) InsertWithTTL(key K, value *V, ttl time.Duration) error {
+	m.m.lockForWrite()
+	defer m.m.writeLock.Unlock()
+	if m.m.closed {
+		return ErrClosed
+	}
+
+	e := &ttlEntry[V]{value: m.stored(value)}
+	if ttl > 0 {
+		e.expires = m.m.options.Clock.Now().Add(ttl)
+	}
+	if err := m.m.pushLocked(oplog.Insert(key, e)); err != nil {
+		return err
+	}
+	if ttl > 0 {
+		heap.Push(&m.expiries, expiry[K]{key: key, at: e.expires})
+	}
+	m.m.metrics.Inserted(1)
+	m.m.writtenLocked()
+	return nil
+}
+
+// stored is the same as Map.stored but for the values of this map rather than
+// the entries.
+func (m *TTLMap[K, V]) stored(v *V) *V {
+	if m.copy == nil || v == nil {
+		return v
+	}
+	return m.copy(v)
+}
+
+// Delete attempts to delete the key from the map and returns a boolean representing
+// whether the key existed. Expired keys that haven't been swept yet count as
+// existing.
+func (m *TTLMap[K, V]) Delete(key K) bool {
+	return m.m.Delete(key)
+}
+
+// Get returns the value stored under the key, including writes that have not
+// been exposed to the readers yet. Expired keys are never returned.
+func (m *TTLMap[K, V]) Get(key K) (*V, bool) {
+	e, ok := m.m.Get(key)
+	if !ok || e.expired(m.m.options.Clock.Now()) {
+		return nil, false
+	}
+	return e.value, true
+}
+
+// Len returns the number of keys in the map, including writes that have not
+// been exposed to the readers yet and expired keys that haven't been swept yet.
+func (m *TTLMap[K, V]) Len() int {
+	return m.m.Len()
+}
+
+// Clear removes all the keys from the map.
+func (m *TTLMap[K, V]) Clear() error {
+	m.m.lockForWrite()
+	defer m.m.writeLock.Unlock()
+	if m.m.closed {
+		return ErrClosed
+	}
+	if err := m.m.pushLocked(oplog.Clear[K, *ttlEntry[V]]()); err != nil {
+		return err
+	}
+	m.expiries = nil
+	m.m.metrics.Cleared()
+	m.m.writtenLocked()
+	return nil
+}
+
+// Refresh exposes the current state of the map to the readers.
+func (m *TTLMap[K, V]) Refresh() error {
+	return m.m.Refresh()
+}
+
+// Close tears down the map, closing every reader created from it and stopping
+// the background goroutine.
+func (m *TTLMap[K, V]) Close() error {
+	return m.m.Close()
+}
+
+// Reader creates and registers a new reader for the map.
+func (m *TTLMap[K, V]) Reader() *TTLReader[K, V] {
+	return &TTLReader[K, V]{m: m, r: m.m.Reader()}
+}
+
+// sweep deletes every key that has expired.
+func (m *TTLMap[K, V]) sweep() {
+	m.m.lockWriter()
+	defer m.m.writeLock.Unlock()
+	if m.m.closed {
+		return
+	}
+
+	now := m.m.options.Clock.Now()
+	n := 0
+	for len(m.expiries) > 0 && !now.Before(m.expiries[0].at) {
+		x := heap.Pop(&m.expiries).(expiry[K])
+		if e := (*m.m.writable)[x.key]; e != nil && e.expires.Equal(x.at) {
+			// Expiring keys is up to the map, so like evictions it isn't held
+			// back by the maximum size of the oplog
+			if m.m.pushUncheckedLocked(oplog.Delete[K, *ttlEntry[V]](x.key)) != nil {
+				heap.Push(&m.expiries, x)
+				break
+			}
+			n++
+		}
+	}
+	if n > 0 {
+		m.m.metrics.Deleted(n)
+		m.m.writtenLocked()
+	}
+}
+
+// sweeper sweeps the map every interval until the map is closed.
+func (m *TTLMap[K, V]) sweeper(interval time.Duration) {
+	defer m.m.background.Done()
+
+	ticker := m.m.options.Clock.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.m.done:
+			return
+		case <-ticker.C():
+			m.m.labeled(context.Background(), ttlSweepLabels, func(context.Context) {
+				m.sweep()
+			})
+		}
+	}
+}
+
+// TTLReader reads from a TTLMap.
+type TTLReader[K comparable, V any] struct {
+	m *TTLMap[K, V]
+	r *Reader[K, ttlEntry[V]]
+}
+
+// Get returns the value stored under the key, hiding keys that have expired
+// even if the deletes of the expired keys haven't been refreshed yet.
+func (r *TTLReader[K, V]) Get(key K) (*V, bool) {
+	e, ok := r.r.Get(key)
+	if !ok || e.expired(r.m.m.options.Clock.Now()) {
+		return nil, false
+	}
+	return e.value, true
+}
+
+func (r *TTLReader[K, V]) Has(key K) bool {
+	_, ok := r.Get(key)
+	return ok
+}
+
+// ForEach calls fn for every key and value visible to this reader that hasn't
+// expired, stopping early if fn returns false. Like Reader.ForEach, the
+// iteration is performed against a single snapshot.
+func (r *TTLReader[K, V]) ForEach(fn func(key K, value *V) bool) {
+	now := r.m.m.options.Clock.Now()
+	r.r.ForEach(func(key K, e *ttlEntry[V]) bool {
+		if e.expired(now) {
+			return true
+		}
+		return fn(key, e.value)
+	})
+}
+
+// Close removes the reader from the map.
+func (r *TTLReader[K, V]) Close() error {
+	return r.r.Close()
+}
+
+// expiry is the time at which a key expires.
+type expiry[K comparable] struct {
+	key K
+	at  time.Time
+}
+
+// expiryHeap is a min-heap of expiries implementing heap.Interface.
+type expiryHeap[K comparable] []expiry[K]
+
+func (h expiryHeap[K]) Len() int           { return len(h) }
+func (h expiryHeap[K]) Less(i, j int) bool { return h[i].at.Before(h[j].at) }
+func (h expiryHeap[K]) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *expiryHeap[K]) Push(x any) {
+	*h = append(*h, x.(expiry[K]))
+}
+
+func (h *expiryHeap[K]) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// NewTTLMap creates a new TTLMap of the given type with the provided options,
+// and starts the goroutine that sweeps expired keys every TTLSweepInterval.
+func NewTTLMap[K comparable, V any](opts ...OptionFunc) *TTLMap[K, V] {
+	options := newOptions(opts...)
+	copy := valueCopy[V](options)
+
+	// The value options apply to V rather than the entries stored in the
+	// underlying map.
+	options = options.withoutValueOptions()
+	r := make(map[K]*ttlEntry[V], options.InitialCapacity)
+	w := make(map[K]*ttlEntry[V], options.InitialCapacity)
+	m := &TTLMap[K, V]{
+		m:    newMap(r, w, options),
+		copy: copy,
+	}
+
+	interval := options.TTLSweepInterval
+	if interval <= 0 {
+		interval = defaultTTLSweepInterval
+	}
+	m.m.background.Add(1)
+	go m.sweeper(interval)
+	return m
+}
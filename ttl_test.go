@@ -0,0 +1,66 @@
+package eventual
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestTTLMap(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	m := NewTTLMap[string, int](WithTTLSweepInterval(time.Hour), WithClock(clock))
+	defer m.Close()
+	reader := m.Reader()
+
+	v := 1
+	assert.NoError(t, m.InsertWithTTL("foo", &v, time.Minute))
+	assert.NoError(t, m.InsertWithTTL("bar", &v, 2*time.Minute))
+	assert.NoError(t, m.Insert("baz", &v))
+	assert.NoError(t, m.Refresh())
+	assert.True(t, reader.Has("foo"))
+
+	// Expired keys are hidden from readers before they're swept
+	clock.Advance(time.Minute)
+	assert.False(t, reader.Has("foo"))
+	_, ok := m.Get("foo")
+	assert.False(t, ok)
+	assert.True(t, reader.Has("bar"))
+	assert.Equal(t, 3, m.Len())
+
+	n := 0
+	reader.ForEach(func(string, *int) bool {
+		n++
+		return true
+	})
+	assert.Equal(t, 2, n)
+
+	// Sweeping deletes the expired keys through the oplog
+	m.sweep()
+	assert.Equal(t, 2, m.Len())
+	assert.Equal(t, 1, m.m.PendingWrites())
+
+	// Overwriting a key replaces its expiry
+	assert.NoError(t, m.Insert("bar", &v))
+	clock.Advance(time.Hour)
+	m.sweep()
+	assert.NoError(t, m.Refresh())
+	assert.True(t, reader.Has("bar"))
+	assert.True(t, reader.Has("baz"))
+	assert.Equal(t, 2, m.Len())
+}
+
+func TestTTLMap_sweeper(t *testing.T) {
+	m := NewTTLMap[string, int](WithTTLSweepInterval(time.Millisecond))
+	reader := m.Reader()
+
+	v := 1
+	assert.NoError(t, m.InsertWithTTL("foo", &v, time.Millisecond))
+	assert.Eventually(t, func() bool {
+		return m.Len() == 0
+	}, time.Second, time.Millisecond)
+	assert.NoError(t, m.Refresh())
+	assert.False(t, reader.Has("foo"))
+
+	assert.NoError(t, m.Close())
+	assert.ErrorIs(t, m.InsertWithTTL("foo", &v, time.Minute), ErrClosed)
+}
@@ -0,0 +1,294 @@
+package eventual
+
+import (
+	"fmt"
+	"github.com/clarkmcc/go-evmap/pkg/oplog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ValueMap is like Map but stores values directly in the internal maps and the
+// oplog rather than pointers to them. This avoids an allocation and a pointer
+// dereference per value, which matters for small value types like integers,
+// at the cost of copying values in and out of the map. Values are returned by
+// copy, so they must not be modified through shared references by readers.
+//
+// ValueMap supports the core subset of the Map API and only supports the
+// MaxReplicationWriteLag, InitialCapacity and Metrics options. NewValueMap
+// panics if any other option is provided.
+type ValueMap[K comparable, V any] struct {
+	readable *map[K]V
+	writable *map[K]V
+
+	readers     []*ValueReader[K, V]
+	readersLock sync.Mutex
+
+	// The snapshot of m.readable that was most recently published to readers
+	snapshot *snapshotOf[map[K]V]
+
+	writeLock sync.Mutex
+	oplog     *oplog.Log[K, V]
+	options   Options
+	closed    bool
+}
+
+// Insert inserts a copy of the value into the map under the provided key.
+func (m *ValueMap[K, V]) Insert(key K, value V) error {
+	m.writeLock.Lock()
+	defer m.writeLock.Unlock()
+	if m.closed {
+		return ErrClosed
+	}
+
+	m.oplog.PushAndApply(oplog.Insert(key, value), m.writable)
+	m.options.Metrics.Inserted(1)
+	m.writtenLocked()
+	return nil
+}
+
+// Delete attempts to delete the key from the map and returns a boolean representing
+// whether the key existed.
+func (m *ValueMap[K, V]) Delete(key K) bool {
+	m.writeLock.Lock()
+	defer m.writeLock.Unlock()
+	if m.closed {
+		return false
+	}
+
+	_, ok := (*m.writable)[key]
+	if !ok {
+		return false
+	}
+	m.oplog.PushAndApply(oplog.Delete[K, V](key), m.writable)
+	m.options.Metrics.Deleted(1)
+	m.writtenLocked()
+	return true
+}
+
+// Clear removes all the keys from the map.
+func (m *ValueMap[K, V]) Clear() error {
+	m.writeLock.Lock()
+	defer m.writeLock.Unlock()
+	if m.closed {
+		return ErrClosed
+	}
+
+	m.oplog.PushAndApply(oplog.Clear[K, V](), m.writable)
+	m.options.Metrics.Cleared()
+	m.writtenLocked()
+	return nil
+}
+
+// Get returns the value stored under the key in the writable map, including
+// writes that have not been exposed to the readers yet.
+func (m *ValueMap[K, V]) Get(key K) (V, bool) {
+	m.writeLock.Lock()
+	defer m.writeLock.Unlock()
+	v, ok := (*m.writable)[key]
+	return v, ok
+}
+
+// Len returns the number of keys in the writable map, which includes writes
+// that have not been exposed to the readers yet.
+func (m *ValueMap[K, V]) Len() int {
+	m.writeLock.Lock()
+	defer m.writeLock.Unlock()
+	return len(*m.writable)
+}
+
+// Generation returns the number of times the map has been refreshed.
+func (m *ValueMap[K, V]) Generation() uint64 {
+	m.writeLock.Lock()
+	defer m.writeLock.Unlock()
+	return m.snapshot.generation
+}
+
+// Refresh exposes the current state of the map to the readers. See Map.Refresh.
+func (m *ValueMap[K, V]) Refresh() error {
+	m.writeLock.Lock()
+	defer m.writeLock.Unlock()
+	if m.closed {
+		return ErrClosed
+	}
+	m.refreshLocked()
+	return nil
+}
+
+// refreshLocked performs the work of Refresh and must only be called while
+// holding the write lock.
+func (m *ValueMap[K, V]) refreshLocked() {
+	start := time.Now()
+	m.readersLock.Lock()
+	m.readable, m.writable = m.writable, m.readable
+	old := m.snapshot
+	m.snapshot = &snapshotOf[map[K]V]{m: m.readable, side: 1 - old.side, generation: old.generation + 1}
+	for _, r := range m.readers {
+		r.swapSnapshot(m.snapshot)
+	}
+
+	// Wait for reads against the old readable map to finish before syncing it
+	for _, r := range m.readers {
+		r.waitUnpinned(old.side)
+	}
+	m.readersLock.Unlock()
+
+	entries := m.oplog.Len()
+	m.oplog.Apply(m.writable)
+	m.oplog.Clear()
+	m.options.Metrics.Refreshed(time.Since(start), entries)
+	m.options.Metrics.ReplicationLag(0)
+}
+
+// writtenLocked is the ValueMap equivalent of Map.writtenLocked.
+func (m *ValueMap[K, V]) writtenLocked() {
+	m.options.Metrics.ReplicationLag(m.oplog.Len())
+	if m.options.MaxReplicationWriteLag > 0 && m.oplog.Len() >= m.options.MaxReplicationWriteLag {
+		m.refreshLocked()
+	}
+}
+
+// Reader creates and registers a new reader for the map.
+func (m *ValueMap[K, V]) Reader() *ValueReader[K, V] {
+	m.readersLock.Lock()
+	defer m.readersLock.Unlock()
+	r := &ValueReader[K, V]{m: m}
+	r.swapSnapshot(m.snapshot)
+	if m.closed {
+		r.closed = 1
+		return r
+	}
+	m.readers = append(m.readers, r)
+	m.options.Metrics.Readers(len(m.readers))
+	return r
+}
+
+// Close tears down the map in the same way as Map.Close.
+func (m *ValueMap[K, V]) Close() error {
+	m.writeLock.Lock()
+	defer m.writeLock.Unlock()
+	if m.closed {
+		return ErrClosed
+	}
+	m.readersLock.Lock()
+	m.closed = true
+	for _, r := range m.readers {
+		atomic.StoreUint32(&r.closed, 1)
+	}
+	for _, r := range m.readers {
+		r.waitUnpinned(0)
+		r.waitUnpinned(1)
+	}
+	m.readers = nil
+	m.options.Metrics.Readers(0)
+	m.readersLock.Unlock()
+
+	clear(*m.readable)
+	clear(*m.writable)
+	m.oplog.Clear()
+	return nil
+}
+
+// ValueReader reads from a ValueMap. Like a Reader, it's safe to share between
+// goroutines.
+type ValueReader[K comparable, V any] struct {
+	pinState[map[K]V]
+	m *ValueMap[K, V]
+}
+
+func (r *ValueReader[K, V]) Get(key K) (V, bool) {
+	s := r.enter()
+	defer r.exit(s)
+	v, ok := (*s.m)[key]
+	return v, ok
+}
+
+func (r *ValueReader[K, V]) Has(key K) bool {
+	s := r.enter()
+	defer r.exit(s)
+	_, ok := (*s.m)[key]
+	return ok
+}
+
+// Len returns the number of keys visible to this reader.
+func (r *ValueReader[K, V]) Len() int {
+	s := r.enter()
+	defer r.exit(s)
+	return len(*s.m)
+}
+
+// Keys returns the keys visible to this reader. The order of the keys is
+// unspecified.
+func (r *ValueReader[K, V]) Keys() []K {
+	s := r.enter()
+	defer r.exit(s)
+	keys := make([]K, 0, len(*s.m))
+	for k := range *s.m {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// ForEach calls fn for every key and value visible to this reader, stopping
+// early if fn returns false. See Reader.ForEach.
+func (r *ValueReader[K, V]) ForEach(fn func(key K, value V) bool) {
+	s := r.enter()
+	defer r.exit(s)
+	for k, v := range *s.m {
+		if !fn(k, v) {
+			return
+		}
+	}
+}
+
+// Generation returns the generation of the map that the reader is currently
+// viewing.
+func (r *ValueReader[K, V]) Generation() uint64 {
+	return (*snapshotOf[map[K]V])(atomic.LoadPointer(&r.snapshot)).generation
+}
+
+// Close removes the reader from the map. See Reader.Close.
+func (r *ValueReader[K, V]) Close() error {
+	if !atomic.CompareAndSwapUint32(&r.closed, 0, 1) {
+		return nil
+	}
+	r.m.readersLock.Lock()
+	defer r.m.readersLock.Unlock()
+	for idx, reader := range r.m.readers {
+		if reader == r {
+			r.m.readers = remove(r.m.readers, idx)
+			r.m.options.Metrics.Readers(len(r.m.readers))
+			break
+		}
+	}
+	return nil
+}
+
+// enter pins the reader's current snapshot, panicking if the reader has been
+// closed, in the same way as Reader.enter.
+func (r *ValueReader[K, V]) enter() *snapshotOf[map[K]V] {
+	s, err := r.tryEnter()
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// NewValueMap creates a new ValueMap of the given type with the provided
+// options, panicking if an option that ValueMap doesn't support is provided.
+func NewValueMap[K comparable, V any](opts ...OptionFunc) *ValueMap[K, V] {
+	options := newOptions(opts...)
+	if names := unsupportedOptions(options, "MaxReplicationWriteLag", "InitialCapacity", "Metrics"); len(names) > 0 {
+		panic(fmt.Sprintf("eventual: ValueMap doesn't support the %s options", strings.Join(names, ", ")))
+	}
+	r := make(map[K]V, options.InitialCapacity)
+	w := make(map[K]V, options.InitialCapacity)
+	return &ValueMap[K, V]{
+		readable: &r,
+		writable: &w,
+		snapshot: &snapshotOf[map[K]V]{m: &r},
+		oplog:    oplog.NewLog[K, V](),
+		options:  options,
+	}
+}
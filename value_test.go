@@ -0,0 +1,123 @@
+package eventual
+
+import (
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestValueMap(t *testing.T) {
+	m := NewValueMap[string, int]()
+	reader := m.Reader()
+
+	assert.NoError(t, m.Insert("foo", 1))
+	assert.NoError(t, m.Insert("bar", 2))
+	assert.Equal(t, 2, m.Len())
+	assert.False(t, reader.Has("foo"))
+
+	v, ok := m.Get("foo")
+	assert.True(t, ok)
+	assert.Equal(t, 1, v)
+
+	assert.NoError(t, m.Refresh())
+	v, ok = reader.Get("foo")
+	assert.True(t, ok)
+	assert.Equal(t, 1, v)
+	assert.Equal(t, 2, reader.Len())
+	assert.ElementsMatch(t, []string{"foo", "bar"}, reader.Keys())
+	assert.Equal(t, uint64(1), reader.Generation())
+
+	assert.True(t, m.Delete("foo"))
+	assert.False(t, m.Delete("foo"))
+	assert.NoError(t, m.Refresh())
+	assert.False(t, reader.Has("foo"))
+	assert.Len(t, *m.writable, 1)
+
+	sum := 0
+	reader.ForEach(func(key string, value int) bool {
+		sum += value
+		return true
+	})
+	assert.Equal(t, 2, sum)
+
+	assert.NoError(t, m.Clear())
+	assert.NoError(t, m.Refresh())
+	assert.Equal(t, 0, reader.Len())
+
+	assert.NoError(t, m.Close())
+	assert.ErrorIs(t, m.Insert("foo", 1), ErrClosed)
+	assert.Panics(t, func() { reader.Get("foo") })
+}
+
+func TestValueMap_concurrent(t *testing.T) {
+	m := NewValueMap[int, int](WithMaxReplicationWriteLag(10))
+	done := make(chan struct{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		reader := m.Reader()
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+					if v, ok := reader.Get(rand.Intn(100)); ok {
+						assert.GreaterOrEqual(t, v, 0)
+					}
+				}
+			}
+		}()
+	}
+	for i := 0; i < 1000; i++ {
+		assert.NoError(t, m.Insert(i%100, i))
+	}
+	close(done)
+	wg.Wait()
+}
+
+func TestValueMap_UnsupportedOptions(t *testing.T) {
+	assert.NotPanics(t, func() {
+		NewValueMap[int, int](WithMaxReplicationWriteLag(10), WithInitialCapacity(10), WithMetrics(nopMetrics{}))
+	})
+	assert.PanicsWithValue(t, "eventual: ValueMap doesn't support the AutoRefreshInterval, valueCopy options", func() {
+		NewValueMap[int, int](WithAutoRefreshInterval(time.Second), WithValueCopy(func(v *int) *int { return v }))
+	})
+	assert.Panics(t, func() { NewValueMap[int, int](WithClock(&fakeClock{})) })
+}
+
+func TestValueMap_CloseConcurrentReads(t *testing.T) {
+	for i := 0; i < 10; i++ {
+		m := NewValueMap[int, int]()
+		for k := 0; k < 100; k++ {
+			m.Insert(k, k)
+		}
+		m.Refresh()
+
+		var wg, reading sync.WaitGroup
+		for g := 0; g < 4; g++ {
+			wg.Add(1)
+			reading.Add(1)
+			go func(reader *ValueReader[int, int]) {
+				defer wg.Done()
+				defer func() {
+					assert.Equal(t, ErrReaderClosed, recover())
+				}()
+				for k := 0; ; k++ {
+					_, ok := reader.Get(k % 100)
+					assert.True(t, ok, "reads must not observe the map being cleared")
+					if k == 0 {
+						reading.Done()
+					}
+				}
+			}(m.Reader())
+		}
+		reading.Wait()
+		assert.NoError(t, m.Close())
+		wg.Wait()
+	}
+}
@@ -0,0 +1,100 @@
+package eventual
+
+import (
+	"context"
+	"iter"
+)
+
+// View is a read-only wrapper around a Reader. It exposes the reader's query
+// methods but gives no control over the reader's lifecycle or access to the
+// underlying map, which makes it suitable for handing read access to code that
+// shouldn't be trusted with anything more, such as plugins. A View must not be
+// used after the Reader it wraps has been closed.
+type View[K comparable, V any] struct {
+	r *Reader[K, V]
+}
+
+func (v *View[K, V]) Get(key K) (*V, bool) {
+	return v.r.Get(key)
+}
+
+func (v *View[K, V]) Has(key K) bool {
+	return v.r.Has(key)
+}
+
+// GetErr is like Get but returns ErrReaderClosed rather than panicking if the
+// underlying reader has been closed.
+func (v *View[K, V]) GetErr(key K) (*V, bool, error) {
+	return v.r.GetErr(key)
+}
+
+// HasErr is like Has but returns ErrReaderClosed rather than panicking if the
+// underlying reader has been closed.
+func (v *View[K, V]) HasErr(key K) (bool, error) {
+	return v.r.HasErr(key)
+}
+
+// GetMany is the same as Reader.GetMany.
+func (v *View[K, V]) GetMany(keys []K) map[K]*V {
+	return v.r.GetMany(keys)
+}
+
+// Keys is the same as Reader.Keys.
+func (v *View[K, V]) Keys() []K {
+	return v.r.Keys()
+}
+
+// Values is the same as Reader.Values.
+func (v *View[K, V]) Values() []*V {
+	return v.r.Values()
+}
+
+// ValuesCopy is the same as Reader.ValuesCopy.
+func (v *View[K, V]) ValuesCopy() []V {
+	return v.r.ValuesCopy()
+}
+
+// Snapshot is the same as Reader.Snapshot.
+func (v *View[K, V]) Snapshot() map[K]V {
+	return v.r.Snapshot()
+}
+
+// ForEach is the same as Reader.ForEach.
+func (v *View[K, V]) ForEach(fn func(key K, value *V) bool) {
+	v.r.ForEach(fn)
+}
+
+// All is the same as Reader.All.
+func (v *View[K, V]) All() iter.Seq2[K, *V] {
+	return v.r.All()
+}
+
+// KeysSeq is the same as Reader.KeysSeq.
+func (v *View[K, V]) KeysSeq() iter.Seq[K] {
+	return v.r.KeysSeq()
+}
+
+// ValuesSeq is the same as Reader.ValuesSeq.
+func (v *View[K, V]) ValuesSeq() iter.Seq[*V] {
+	return v.r.ValuesSeq()
+}
+
+// Generation is the same as Reader.Generation.
+func (v *View[K, V]) Generation() uint64 {
+	return v.r.Generation()
+}
+
+// Meta is the same as Reader.Meta.
+func (v *View[K, V]) Meta() any {
+	return v.r.Meta()
+}
+
+// WaitForGeneration is the same as Reader.WaitForGeneration.
+func (v *View[K, V]) WaitForGeneration(ctx context.Context, gen uint64) error {
+	return v.r.WaitForGeneration(ctx, gen)
+}
+
+// Guard is the same as Reader.Guard.
+func (v *View[K, V]) Guard() *ReadGuard[K, V] {
+	return v.r.Guard()
+}
@@ -0,0 +1,28 @@
+package eventual
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestView(t *testing.T) {
+	m := NewMap[string, int]()
+	reader := m.Reader()
+	view := reader.View()
+
+	v := 1
+	m.Insert("foo", &v)
+	assert.False(t, view.Has("foo"))
+
+	m.Refresh()
+	got, ok := view.Get("foo")
+	assert.True(t, ok)
+	assert.Equal(t, v, *got)
+	assert.Equal(t, []string{"foo"}, view.Keys())
+	assert.Equal(t, []int{1}, view.ValuesCopy())
+	assert.Equal(t, uint64(1), view.Generation())
+
+	assert.NoError(t, reader.Close())
+	_, err := view.HasErr("foo")
+	assert.ErrorIs(t, err, ErrReaderClosed)
+}
@@ -0,0 +1,139 @@
+package eventual
+
+// ChangeOp is the kind of modification described by a Change.
+type ChangeOp uint8
+
+const (
+	// ChangeInsert means that the key wasn't visible before the refresh
+	ChangeInsert ChangeOp = iota
+
+	// ChangeUpdate means that the visible value of the key was replaced
+	ChangeUpdate
+
+	// ChangeDelete means that the key isn't visible anymore
+	ChangeDelete
+)
+
+// Change describes how the visible value of a key was changed by a refresh.
+type Change[K comparable, V any] struct {
+	Key K
+	Op  ChangeOp
+
+	// Old and New are the values that were visible before and after the
+	// refresh, or nil if the key didn't exist.
+	Old, New *V
+
+	// Deleted is true if the key was visible before the refresh but isn't
+	// anymore.
+	Deleted bool
+
+	// Generation is the generation of the snapshot that made the change visible
+	Generation uint64
+}
+
+// Watch returns a channel that receives a Change every time a refresh changes
+// the value of the key that is visible to readers. Values are compared using
+// the function set with WithValueEqual, or by pointer identity by default.
+//
+// Refreshes never block on watchers, so the channel only buffers the latest
+// change: if the previous change hasn't been received by the time the next one
+// is published, the previous change is replaced. The channel is closed by
+// Unwatch or when the map is closed.
+func (m *Map[K, V]) Watch(key K) <-chan Change[K, V] {
+	m.writeLock.Lock()
+	defer m.writeLock.Unlock()
+	ch := make(chan Change[K, V], 1)
+	if m.closed {
+		close(ch)
+		return ch
+	}
+	if m.watchers == nil {
+		m.watchers = map[K][]chan Change[K, V]{}
+	}
+	m.watchers[key] = append(m.watchers[key], ch)
+	return ch
+}
+
+// Unwatch stops the channel returned by Watch from receiving changes and closes
+// it. Unwatching a channel that isn't watching the map has no effect.
+func (m *Map[K, V]) Unwatch(ch <-chan Change[K, V]) {
+	m.writeLock.Lock()
+	defer m.writeLock.Unlock()
+	for key, watchers := range m.watchers {
+		for i, w := range watchers {
+			if w == ch {
+				close(w)
+				if len(watchers) == 1 {
+					delete(m.watchers, key)
+				} else {
+					m.watchers[key] = remove(watchers, i)
+				}
+				return
+			}
+		}
+	}
+}
+
+// notifyWatchersLocked compares the watched keys between the previously visible
+// map and the newly visible map and notifies the watchers of the keys that have
+// changed. This must be called while holding the write lock, after the maps have
+// been swapped but before the previously visible map is synced.
+func (m *Map[K, V]) notifyWatchersLocked(prev, next *map[K]*V, generation uint64) {
+	for key, watchers := range m.watchers {
+		c, changed := m.diffKey(prev, next, key, generation)
+		if !changed {
+			continue
+		}
+		for _, w := range watchers {
+			sendLatest(w, c)
+		}
+	}
+}
+
+// diffKey compares the value of the key in two versions of the map, and returns
+// the change between them if the value was changed.
+func (m *Map[K, V]) diffKey(prev, next *map[K]*V, key K, generation uint64) (Change[K, V], bool) {
+	old, existed := (*prev)[key]
+	new, exists := (*next)[key]
+	c := Change[K, V]{Key: key, Old: old, New: new, Generation: generation}
+	switch {
+	case !existed && !exists:
+		return c, false
+	case !existed:
+		c.Op = ChangeInsert
+	case !exists:
+		c.Op = ChangeDelete
+		c.Deleted = true
+	case m.equal(old, new):
+		return c, false
+	default:
+		c.Op = ChangeUpdate
+	}
+	return c, true
+}
+
+// closeWatchersLocked closes every watcher. This must be called while holding
+// the write lock.
+func (m *Map[K, V]) closeWatchersLocked() {
+	for _, watchers := range m.watchers {
+		for _, w := range watchers {
+			close(w)
+		}
+	}
+	m.watchers = nil
+}
+
+// sendLatest sends v on a channel with a buffer of one without blocking,
+// replacing the buffered value if it hasn't been received yet. The caller must
+// be the only sender on the channel, otherwise the second send could block.
+func sendLatest[T any](ch chan T, v T) {
+	select {
+	case ch <- v:
+	default:
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- v
+	}
+}
@@ -0,0 +1,59 @@
+package eventual
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestMap_Watch(t *testing.T) {
+	m := NewMap[string, int]()
+	ch := m.Watch("foo")
+
+	v1, v2 := 1, 2
+	assert.NoError(t, m.Insert("foo", &v1))
+	assert.NoError(t, m.Insert("bar", &v1))
+	assert.Empty(t, ch)
+	assert.NoError(t, m.Refresh())
+	c := <-ch
+	assert.Equal(t, "foo", c.Key)
+	assert.Equal(t, ChangeInsert, c.Op)
+	assert.Nil(t, c.Old)
+	assert.Equal(t, &v1, c.New)
+	assert.False(t, c.Deleted)
+	assert.Equal(t, uint64(1), c.Generation)
+
+	// Refreshes that don't change the key don't notify the watcher
+	assert.NoError(t, m.Insert("bar", &v2))
+	assert.NoError(t, m.Refresh())
+	assert.Empty(t, ch)
+
+	// Only the latest change is buffered
+	assert.NoError(t, m.Insert("foo", &v2))
+	assert.NoError(t, m.Refresh())
+	assert.True(t, m.Delete("foo"))
+	assert.NoError(t, m.Refresh())
+	c = <-ch
+	assert.Equal(t, &v2, c.Old)
+	assert.Nil(t, c.New)
+	assert.True(t, c.Deleted)
+	assert.Equal(t, ChangeDelete, c.Op)
+	assert.Equal(t, uint64(4), c.Generation)
+	assert.Empty(t, ch)
+
+	m.Unwatch(ch)
+	_, ok := <-ch
+	assert.False(t, ok)
+	assert.NoError(t, m.Insert("foo", &v1))
+	assert.NoError(t, m.Refresh())
+}
+
+func TestMap_Watch_close(t *testing.T) {
+	m := NewMap[string, int]()
+	ch := m.Watch("foo")
+	assert.NoError(t, m.Close())
+	_, ok := <-ch
+	assert.False(t, ok)
+
+	_, ok = <-m.Watch("foo")
+	assert.False(t, ok)
+}
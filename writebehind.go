@@ -0,0 +1,121 @@
+package eventual
+
+import (
+	"context"
+	"github.com/clarkmcc/go-evmap/pkg/oplog"
+	"sync"
+)
+
+// writeBehind queues the entries published by every refresh and hands them to
+// the sink from a background goroutine.
+type writeBehind[K comparable, V any] struct {
+	sink func(entries []*oplog.Entry[K, *V]) error
+
+	mu    sync.Mutex
+	queue [][]*oplog.Entry[K, *V]
+
+	// The number of refreshes that were queued and handed to the sink
+	queued, written uint64
+
+	// The first error returned by the sink since the last Flush
+	err error
+
+	// progress is closed and replaced whenever refreshes are handed to the sink
+	progress chan struct{}
+
+	// notify has a buffer of one and is signalled when refreshes are queued
+	notify chan struct{}
+}
+
+func newWriteBehind[K comparable, V any](sink func(entries []*oplog.Entry[K, *V]) error) *writeBehind[K, V] {
+	return &writeBehind[K, V]{
+		sink:     sink,
+		progress: make(chan struct{}),
+		notify:   make(chan struct{}, 1),
+	}
+}
+
+// push queues the entries of a refresh without blocking.
+func (w *writeBehind[K, V]) push(entries []*oplog.Entry[K, *V]) {
+	w.mu.Lock()
+	w.queue = append(w.queue, entries)
+	w.queued++
+	w.mu.Unlock()
+	select {
+	case w.notify <- struct{}{}:
+	default:
+	}
+}
+
+// drain hands every queued refresh to the sink.
+func (w *writeBehind[K, V]) drain() {
+	w.mu.Lock()
+	queue := w.queue
+	w.queue = nil
+	w.mu.Unlock()
+
+	for _, entries := range queue {
+		err := w.sink(entries)
+		w.mu.Lock()
+		w.written++
+		if err != nil && w.err == nil {
+			w.err = err
+		}
+		close(w.progress)
+		w.progress = make(chan struct{})
+		w.mu.Unlock()
+	}
+}
+
+// flush waits until every refresh that has been queued so far has been handed to
+// the sink, and returns and resets the first error returned by the sink.
+func (w *writeBehind[K, V]) flush(ctx context.Context) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	target := w.queued
+	for w.written < target {
+		progress := w.progress
+		w.mu.Unlock()
+		select {
+		case <-progress:
+			w.mu.Lock()
+		case <-ctx.Done():
+			w.mu.Lock()
+			return ctx.Err()
+		}
+	}
+	err := w.err
+	w.err = nil
+	return err
+}
+
+// runWriteBehind hands the queued refreshes to the sink until the map is
+// closed, at which point the remaining refreshes are handed to the sink before
+// returning.
+func (m *Map[K, V]) runWriteBehind() {
+	defer m.background.Done()
+	for {
+		select {
+		case <-m.writeBehind.notify:
+			m.labeled(context.Background(), writeBehindLabels, func(context.Context) {
+				m.writeBehind.drain()
+			})
+		case <-m.done:
+			m.labeled(context.Background(), writeBehindLabels, func(context.Context) {
+				m.writeBehind.drain()
+			})
+			return
+		}
+	}
+}
+
+// Flush blocks until the writes of every refresh so far have been handed to the
+// sink set by WithWriteBehind, or until the context is done. It returns the
+// first error returned by the sink since the previous call to Flush. Without a
+// write-behind sink, Flush returns nil immediately.
+func (m *Map[K, V]) Flush(ctx context.Context) error {
+	if m.writeBehind == nil {
+		return nil
+	}
+	return m.writeBehind.flush(ctx)
+}
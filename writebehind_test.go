@@ -0,0 +1,59 @@
+package eventual
+
+import (
+	"context"
+	"errors"
+	"github.com/clarkmcc/go-evmap/pkg/oplog"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+)
+
+func TestWithWriteBehind(t *testing.T) {
+	var mu sync.Mutex
+	var persisted [][]*oplog.Entry[string, *int]
+	fail := errors.New("database unavailable")
+	m := NewMap[string, int](WithWriteBehind(func(entries []*oplog.Entry[string, *int]) error {
+		mu.Lock()
+		defer mu.Unlock()
+		persisted = append(persisted, entries)
+		if len(persisted) == 2 {
+			return fail
+		}
+		return nil
+	}))
+
+	v := 1
+	assert.NoError(t, m.Insert("foo", &v))
+	assert.True(t, m.Delete("foo"))
+	assert.NoError(t, m.Refresh())
+	assert.NoError(t, m.Flush(context.Background()))
+	mu.Lock()
+	assert.Len(t, persisted, 1)
+	assert.Len(t, persisted[0], 2)
+	assert.Equal(t, oplog.EntryInsert, persisted[0][0].Type())
+	assert.Equal(t, "foo", persisted[0][1].Key())
+	mu.Unlock()
+
+	// Refreshes without writes aren't handed to the sink
+	assert.NoError(t, m.Refresh())
+
+	// Errors are reported once by Flush
+	assert.NoError(t, m.Insert("bar", &v))
+	assert.NoError(t, m.Refresh())
+	assert.ErrorIs(t, m.Flush(context.Background()), fail)
+	assert.NoError(t, m.Flush(context.Background()))
+
+	// Close hands the remaining refreshes to the sink
+	assert.NoError(t, m.Insert("baz", &v))
+	assert.NoError(t, m.Refresh())
+	assert.NoError(t, m.Close())
+	mu.Lock()
+	assert.Len(t, persisted, 3)
+	mu.Unlock()
+}
+
+func TestMap_Flush_withoutWriteBehind(t *testing.T) {
+	m := NewMap[string, int]()
+	assert.NoError(t, m.Flush(context.Background()))
+}
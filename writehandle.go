@@ -0,0 +1,184 @@
+package eventual
+
+import (
+	"github.com/clarkmcc/go-evmap/pkg/oplog"
+	"sync"
+	"time"
+)
+
+// HandleWrite is an insert or delete made through a WriteHandle.
+type HandleWrite[K comparable, V any] struct {
+	Key K
+
+	// Value is the inserted value, or nil if Deleted is true
+	Value *V
+
+	// Deleted is true if the key was deleted
+	Deleted bool
+
+	// Time is the time of the write, either when it was made or the time that
+	// was passed to InsertAt or DeleteAt
+	Time time.Time
+}
+
+// lastWriterWins is the default conflict resolver, which keeps the latest
+// write, or the incoming write if both writes were made at the same time.
+func lastWriterWins[K comparable, V any](existing, incoming HandleWrite[K, V]) HandleWrite[K, V] {
+	if incoming.Time.Before(existing.Time) {
+		return existing
+	}
+	return incoming
+}
+
+// WriteHandle is an independent writer of a Map. Writes made through a handle
+// only take the handle's own lock and are buffered in the handle, so writers
+// that each own a handle don't contend with each other. Every refresh merges
+// the writes buffered by all the handles into the map, resolving writes to the
+// same key with the function set by WithConflictResolver, which keeps the
+// latest write by default, and commits the result as a single oplog entry on
+// top of any writes made directly to the map.
+//
+// Like writes made directly to the map, the writes of a handle only become
+// visible to the readers at the next refresh, and they're not visible to Get
+// before then either.
+type WriteHandle[K comparable, V any] struct {
+	m *Map[K, V]
+
+	mu      sync.Mutex
+	pending []HandleWrite[K, V]
+	closed  bool
+}
+
+// WriteHandle creates and registers a new write handle for the map. The handle
+// should be closed once it's no longer needed.
+func (m *Map[K, V]) WriteHandle() *WriteHandle[K, V] {
+	m.writeLock.Lock()
+	defer m.writeLock.Unlock()
+	h := &WriteHandle[K, V]{m: m}
+	if m.closed {
+		h.closed = true
+		return h
+	}
+	m.handles = append(m.handles, h)
+	return h
+}
+
+// Insert buffers an insert of the value under the key at the current time.
+func (h *WriteHandle[K, V]) Insert(key K, value *V) error {
+	return h.InsertAt(key, value, h.m.options.Clock.Now())
+}
+
+// InsertAt buffers an insert of the value under the key at the provided time,
+// which is useful when the writes originate from a source with its own clock.
+func (h *WriteHandle[K, V]) InsertAt(key K, value *V, t time.Time) error {
+	return h.write(HandleWrite[K, V]{Key: h.m.storedKey(key), Value: h.m.stored(value), Time: t})
+}
+
+// Delete buffers a delete of the key at the current time.
+func (h *WriteHandle[K, V]) Delete(key K) error {
+	return h.DeleteAt(key, h.m.options.Clock.Now())
+}
+
+// DeleteAt buffers a delete of the key at the provided time.
+func (h *WriteHandle[K, V]) DeleteAt(key K, t time.Time) error {
+	return h.write(HandleWrite[K, V]{Key: key, Deleted: true, Time: t})
+}
+
+func (h *WriteHandle[K, V]) write(w HandleWrite[K, V]) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return ErrClosed
+	}
+	h.pending = append(h.pending, w)
+	h.m.handleWrites.Add(1)
+	return nil
+}
+
+// Close unregisters the handle from the map. Writes that were buffered before
+// Close are still merged by the next refresh, and writes made after Close
+// return ErrClosed.
+func (h *WriteHandle[K, V]) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	return nil
+}
+
+// take removes and returns the writes buffered by the handle, along with
+// whether the handle has been closed.
+func (h *WriteHandle[K, V]) take() ([]HandleWrite[K, V], bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	pending := h.pending
+	h.pending = nil
+	return pending, h.closed
+}
+
+// mergeHandlesLocked merges the writes buffered by every write handle and
+// commits them to the map as a single batch, unregistering the handles that
+// have been closed. The merged writes are discarded if the batch can't be
+// appended to the write-ahead log. This must be called while holding the write
+// lock.
+func (m *Map[K, V]) mergeHandlesLocked() error {
+	if len(m.handles) == 0 {
+		return nil
+	}
+	merged := make(map[K]HandleWrite[K, V])
+	open := m.handles[:0]
+	var n int
+	for _, h := range m.handles {
+		writes, closed := h.take()
+		if !closed {
+			open = append(open, h)
+		}
+		n += len(writes)
+		for _, w := range writes {
+			if existing, ok := merged[w.Key]; ok {
+				w = m.resolve(existing, w)
+			}
+			merged[w.Key] = w
+		}
+	}
+	clear(m.handles[len(open):])
+	m.handles = open
+	m.handleWrites.Add(-int64(n))
+	if len(merged) == 0 {
+		return nil
+	}
+
+	var inserts, deletes int
+	b := oplog.NewBatch[K, *V]()
+	for k, w := range merged {
+		if w.Deleted {
+			// Only the keys that exist are counted as deleted, which needs the
+			// writable map to be up-to-date
+			m.finishReplayLocked()
+			if _, ok := (*m.writable)[k]; ok {
+				deletes++
+			}
+			b.Delete(k)
+		} else {
+			b.Insert(k, w.Value)
+			inserts++
+		}
+	}
+	if err := m.pushUncheckedLocked(b.Entry()); err != nil {
+		return err
+	}
+	m.metrics.Inserted(inserts)
+	m.metrics.Deleted(deletes)
+	m.evictLocked()
+	return nil
+}
+
+// closeHandlesLocked closes every write handle, discarding their buffered
+// writes. This must be called while holding the write lock.
+func (m *Map[K, V]) closeHandlesLocked() {
+	for _, h := range m.handles {
+		_ = h.Close()
+		writes, _ := h.take()
+		m.handleWrites.Add(-int64(len(writes)))
+	}
+	m.handles = nil
+}
@@ -0,0 +1,82 @@
+package eventual
+
+import (
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWriteHandle(t *testing.T) {
+	m := NewMap[string, int]()
+	reader := m.Reader()
+	a, b := m.WriteHandle(), m.WriteHandle()
+
+	v1, v2 := 1, 2
+	now := time.Now()
+	assert.NoError(t, a.InsertAt("foo", &v1, now.Add(time.Second)))
+	assert.NoError(t, b.InsertAt("foo", &v2, now))
+	assert.NoError(t, b.Insert("bar", &v2))
+	assert.Equal(t, 3, m.PendingWrites())
+
+	// Handle writes aren't applied until the next refresh
+	_, ok := m.Get("bar")
+	assert.False(t, ok)
+
+	// The latest write wins regardless of which handle made it
+	assert.NoError(t, m.Refresh())
+	assert.Equal(t, map[string]int{"foo": 1, "bar": 2}, reader.Snapshot())
+	assert.Equal(t, 0, m.PendingWrites())
+
+	// Deleting a key that doesn't exist isn't counted as a delete
+	assert.NoError(t, a.Delete("bar"))
+	assert.NoError(t, b.Delete("qux"))
+	assert.NoError(t, a.Close())
+	assert.ErrorIs(t, a.Insert("baz", &v1), ErrClosed)
+	assert.NoError(t, m.Refresh())
+	assert.Equal(t, map[string]int{"foo": 1}, reader.Snapshot())
+	assert.Equal(t, uint64(1), m.Stats().Deletes)
+	assert.Len(t, m.handles, 1)
+
+	assert.NoError(t, m.Close())
+	assert.ErrorIs(t, b.Insert("baz", &v1), ErrClosed)
+	assert.ErrorIs(t, m.WriteHandle().Insert("baz", &v1), ErrClosed)
+}
+
+func TestWriteHandle_Concurrent(t *testing.T) {
+	m := NewMap[int, int]()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		h := m.WriteHandle()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer h.Close()
+			for k := 0; k < 100; k++ {
+				v := i
+				assert.NoError(t, h.Insert(i*100+k, &v))
+			}
+		}()
+	}
+	wg.Wait()
+	assert.NoError(t, m.Refresh())
+	assert.Equal(t, 400, m.Len())
+	assert.Empty(t, m.handles)
+}
+
+func TestWithConflictResolver(t *testing.T) {
+	// Keep the largest value rather than the latest
+	m := NewMap[string, int](WithConflictResolver(func(existing, incoming HandleWrite[string, int]) HandleWrite[string, int] {
+		if *incoming.Value > *existing.Value {
+			return incoming
+		}
+		return existing
+	}))
+	a, b := m.WriteHandle(), m.WriteHandle()
+	v1, v2 := 1, 2
+	assert.NoError(t, a.Insert("foo", &v2))
+	assert.NoError(t, b.Insert("foo", &v1))
+	assert.NoError(t, m.Refresh())
+	v, _ := m.Get("foo")
+	assert.Equal(t, 2, *v)
+}
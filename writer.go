@@ -0,0 +1,268 @@
+package eventual
+
+import (
+	"context"
+	"github.com/clarkmcc/go-evmap/pkg/oplog"
+)
+
+// Writer is the write handle to a Map. Unlike the Map type, a Writer does
+// not hand out readers, which makes it possible to give exclusive write
+// access to a single goroutine while readers are created independently from
+// a ReadHandleFactory.
+//
+// A Writer exposes the writes, refreshes and observers of the map. Creating
+// readers and write handles, persistence, statistics and debugging are
+// deliberately left to the Map, so a map that needs them should be created
+// with NewMap instead.
+type Writer[K comparable, V any] struct {
+	m *Map[K, V]
+}
+
+// Insert inserts the value into the map under the provided key. The insert
+// is not visible to readers until the next call to Refresh.
+func (w *Writer[K, V]) Insert(key K, value *V) error {
+	return w.m.Insert(key, value)
+}
+
+// Swap inserts the value under the key and returns the previous value.
+func (w *Writer[K, V]) Swap(key K, value *V) (*V, bool) {
+	return w.m.Swap(key, value)
+}
+
+// SwapErr is like Swap but returns the error when the value can't be inserted.
+func (w *Writer[K, V]) SwapErr(key K, value *V) (*V, bool, error) {
+	return w.m.SwapErr(key, value)
+}
+
+// InsertMany inserts every key and value from the provided map using a single
+// oplog entry.
+func (w *Writer[K, V]) InsertMany(entries map[K]*V) error {
+	return w.m.InsertMany(entries)
+}
+
+// MergeFrom merges src into the map, using resolve to pick a value for keys
+// that already exist.
+func (w *Writer[K, V]) MergeFrom(src map[K]*V, resolve func(key K, existing, incoming *V) *V) error {
+	return w.m.MergeFrom(src, resolve)
+}
+
+// Delete attempts to delete the key from the map and returns a boolean representing
+// whether the key existed.
+func (w *Writer[K, V]) Delete(key K) bool {
+	return w.m.Delete(key)
+}
+
+// DeleteErr is like Delete but returns the error when the key can't be deleted.
+func (w *Writer[K, V]) DeleteErr(key K) (bool, error) {
+	return w.m.DeleteErr(key)
+}
+
+// Pop deletes the key from the map and returns the value that it held.
+func (w *Writer[K, V]) Pop(key K) (*V, bool) {
+	return w.m.Pop(key)
+}
+
+// PopErr is like Pop but returns the error when the key can't be deleted.
+func (w *Writer[K, V]) PopErr(key K) (*V, bool, error) {
+	return w.m.PopErr(key)
+}
+
+// DeleteMany deletes every provided key from the map using a single oplog entry
+// and returns the number of keys that existed.
+func (w *Writer[K, V]) DeleteMany(keys []K) int {
+	return w.m.DeleteMany(keys)
+}
+
+// Retain removes every key and value from the map for which keep returns false.
+func (w *Writer[K, V]) Retain(keep func(key K, value *V) bool) error {
+	return w.m.Retain(keep)
+}
+
+// Clear removes all the keys from the map.
+func (w *Writer[K, V]) Clear() error {
+	return w.m.Clear()
+}
+
+// Update atomically replaces the value of the key with the value returned by fn.
+func (w *Writer[K, V]) Update(key K, fn func(old *V, ok bool) *V) error {
+	return w.m.Update(key, fn)
+}
+
+// GetOrInsert returns the existing value of the key, or inserts and returns the
+// provided value if the key doesn't exist.
+func (w *Writer[K, V]) GetOrInsert(key K, value *V) (*V, bool) {
+	return w.m.GetOrInsert(key, value)
+}
+
+// GetOrInsertErr is like GetOrInsert but returns the error when the value
+// can't be inserted.
+func (w *Writer[K, V]) GetOrInsertErr(key K, value *V) (*V, bool, error) {
+	return w.m.GetOrInsertErr(key, value)
+}
+
+// CompareAndSwap inserts the new value under the key only if the key currently
+// holds a value equal to old.
+func (w *Writer[K, V]) CompareAndSwap(key K, old, new *V) bool {
+	return w.m.CompareAndSwap(key, old, new)
+}
+
+// CompareAndSwapErr is like CompareAndSwap but returns the error when the new
+// value can't be inserted.
+func (w *Writer[K, V]) CompareAndSwapErr(key K, old, new *V) (bool, error) {
+	return w.m.CompareAndSwapErr(key, old, new)
+}
+
+// CompareAndDelete deletes the key only if it currently holds a value equal
+// to old.
+func (w *Writer[K, V]) CompareAndDelete(key K, old *V) bool {
+	return w.m.CompareAndDelete(key, old)
+}
+
+// CompareAndDeleteErr is like CompareAndDelete but returns the error when the
+// key can't be deleted.
+func (w *Writer[K, V]) CompareAndDeleteErr(key K, old *V) (bool, error) {
+	return w.m.CompareAndDeleteErr(key, old)
+}
+
+// Replace atomically replaces the entire contents of the map.
+func (w *Writer[K, V]) Replace(contents map[K]*V) error {
+	return w.m.Replace(contents)
+}
+
+// SetMeta sets a meta value that becomes visible to readers at the next Refresh.
+func (w *Writer[K, V]) SetMeta(meta any) error {
+	return w.m.SetMeta(meta)
+}
+
+// Batch commits the writes buffered by fn as a single oplog entry.
+func (w *Writer[K, V]) Batch(fn func(b *Batch[K, V])) error {
+	return w.m.Batch(fn)
+}
+
+// ApplyOp applies a custom operation to the map.
+func (w *Writer[K, V]) ApplyOp(op Operation[K, V]) error {
+	return w.m.ApplyOp(op)
+}
+
+// ShrinkToFit reclaims the memory held by the map beyond what its keys need.
+func (w *Writer[K, V]) ShrinkToFit() error {
+	return w.m.ShrinkToFit()
+}
+
+// Refresh exposes the current state of the map to the readers.
+func (w *Writer[K, V]) Refresh() error {
+	return w.m.Refresh()
+}
+
+// Get returns the value stored under the key, including writes that have not
+// been exposed to the readers yet.
+func (w *Writer[K, V]) Get(key K) (*V, bool) {
+	return w.m.Get(key)
+}
+
+// Len returns the number of keys in the map, including writes that have not
+// been exposed to the readers yet.
+func (w *Writer[K, V]) Len() int {
+	return w.m.Len()
+}
+
+// Keys returns the keys in the map, including writes that have not been exposed
+// to the readers yet.
+func (w *Writer[K, V]) Keys() []K {
+	return w.m.Keys()
+}
+
+// Values returns the values in the map, including writes that have not been
+// exposed to the readers yet.
+func (w *Writer[K, V]) Values() []*V {
+	return w.m.Values()
+}
+
+// Range calls fn for every key and value in the map. The map must not be
+// modified from within fn.
+func (w *Writer[K, V]) Range(fn func(key K, value *V) bool) {
+	w.m.Range(fn)
+}
+
+// Snapshot returns a copy of the map, including writes that have not been
+// exposed to the readers yet, as a plain Go map.
+func (w *Writer[K, V]) Snapshot() map[K]V {
+	return w.m.Snapshot()
+}
+
+// Clone creates an independent map seeded from the current state of the map.
+func (w *Writer[K, V]) Clone() *Map[K, V] {
+	return w.m.Clone()
+}
+
+// PendingEntries returns the oplog entries of the writes that will be published
+// by the next refresh.
+func (w *Writer[K, V]) PendingEntries() []*oplog.Entry[K, *V] {
+	return w.m.PendingEntries()
+}
+
+// Watch returns a channel that receives the changes to the key made visible by
+// refreshes.
+func (w *Writer[K, V]) Watch(key K) <-chan Change[K, V] {
+	return w.m.Watch(key)
+}
+
+// Unwatch stops the channel returned by Watch from receiving changes and closes
+// it.
+func (w *Writer[K, V]) Unwatch(ch <-chan Change[K, V]) {
+	w.m.Unwatch(ch)
+}
+
+// Subscribe returns a channel that receives a RefreshEvent every time a refresh
+// publishes a new snapshot.
+func (w *Writer[K, V]) Subscribe() <-chan RefreshEvent {
+	return w.m.Subscribe()
+}
+
+// Unsubscribe stops the channel returned by Subscribe from receiving events and
+// closes it.
+func (w *Writer[K, V]) Unsubscribe(ch <-chan RefreshEvent) {
+	w.m.Unsubscribe(ch)
+}
+
+// Changefeed creates a changefeed that receives the changes made visible by
+// every refresh from now on.
+func (w *Writer[K, V]) Changefeed() *Changefeed[K, V] {
+	return w.m.Changefeed()
+}
+
+// RefreshAndWait is like Refresh but gives up waiting for lagging readers when
+// the context is done.
+func (w *Writer[K, V]) RefreshAndWait(ctx context.Context) error {
+	return w.m.RefreshAndWait(ctx)
+}
+
+// Generation returns the number of times the map has been refreshed.
+func (w *Writer[K, V]) Generation() uint64 {
+	return w.m.Generation()
+}
+
+// PendingWrites returns the number of writes that are not visible to the
+// readers yet.
+func (w *Writer[K, V]) PendingWrites() int {
+	return w.m.PendingWrites()
+}
+
+// Dirty reports whether there are writes that are not visible to the readers yet.
+func (w *Writer[K, V]) Dirty() bool {
+	return w.m.Dirty()
+}
+
+// Close tears down the map, closing every reader created from it.
+func (w *Writer[K, V]) Close() error {
+	return w.m.Close()
+}
+
+// New creates a new map and returns separate write and read handles to it,
+// similar to Rust's evmap::new(). The Writer should be owned by the goroutine
+// responsible for writes, while the ReadHandleFactory can be shared freely and
+// used to create readers.
+func New[K comparable, V any](opts ...OptionFunc) (*Writer[K, V], *ReadHandleFactory[K, V]) {
+	m := NewMap[K, V](opts...)
+	return &Writer[K, V]{m: m}, &ReadHandleFactory[K, V]{m: m}
+}
@@ -0,0 +1,54 @@
+package eventual
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	w, f := New[string, int]()
+	reader := f.Handle()
+
+	v := 1
+	w.Insert("foo", &v)
+	assert.False(t, reader.Has("foo"), "reader shouldn't see the insert before refresh")
+
+	w.Refresh()
+	got, ok := reader.Get("foo")
+	assert.True(t, ok)
+	assert.Equal(t, v, *got)
+
+	assert.True(t, w.Delete("foo"))
+	w.Refresh()
+	assert.False(t, reader.Has("foo"))
+
+	w.Insert("bar", &v)
+	w.Clear()
+	w.Refresh()
+	assert.False(t, reader.Has("bar"))
+}
+
+func TestWriter_Observers(t *testing.T) {
+	w, _ := New[string, int]()
+	defer w.Close()
+	watch := w.Watch("foo")
+	events := w.Subscribe()
+	feed := w.Changefeed()
+	defer feed.Close()
+
+	v := 1
+	assert.NoError(t, w.Insert("foo", &v))
+	assert.Len(t, w.PendingEntries(), 1)
+	assert.Equal(t, map[string]int{"foo": 1}, w.Snapshot())
+	assert.NoError(t, w.Refresh())
+	assert.Equal(t, "foo", (<-watch).Key)
+	assert.Equal(t, uint64(1), (<-events).Generation)
+	assert.Equal(t, map[string]int{"foo": 1}, w.Clone().Snapshot())
+
+	w.Unwatch(watch)
+	w.Unsubscribe(events)
+	_, ok := <-watch
+	assert.False(t, ok)
+	_, ok = <-events
+	assert.False(t, ok)
+}